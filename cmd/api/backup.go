@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/backup"
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/migration"
+	"github.com/spin311/library-api/pkg/config"
+	"io"
+	"log"
+	"os"
+)
+
+// runExport writes a backup of all users, books, borrows and charges, e.g. library-api export -o library.tar.gz
+func runExport(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "-", "file to write the backup to, - for standard output")
+	format := flags.String("format", "", "bundle format, ndjson or tar.gz (default from the file name, ndjson for standard output)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("usage: export [-o file] [-format ndjson|tar.gz]")
+	}
+	bundleFormat, err := backupFormat(*format, *output)
+	if err != nil {
+		return err
+	}
+
+	schemaVersion, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	config.SetDbs(db)
+	b, err := backup.Export(schemaVersion)
+	if err != nil {
+		return err
+	}
+	// the export is kept even if the data breaks an invariant, the import reports the same problems
+	if err := backup.Validate(b); err != nil {
+		log.Printf("Warning: the exported data cannot be imported until it is repaired, %v", err)
+	}
+
+	if *output == "-" {
+		return backup.Write(os.Stdout, bundleFormat, b)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := backup.Write(file, bundleFormat, b); err != nil {
+		_ = file.Close()
+		_ = os.Remove(*output)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	log.Printf("Exported %d users, %d books, %d borrows, %d charges and %d revoked cards to %s", len(b.Users), len(b.Books), len(b.Borrows), len(b.Charges), len(b.RevokedCards), *output)
+	return nil
+}
+
+// runImport restores a backup written by export, e.g. library-api import -replace library.tar.gz
+func runImport(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "bundle format, ndjson or tar.gz (default from the file name, ndjson for standard input)")
+	replace := flags.Bool("replace", false, "delete the existing users, books, borrows, charges and notifications before restoring")
+	dryRun := flags.Bool("dry-run", false, "only read and validate the backup")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import [-format ndjson|tar.gz] [-replace] [-dry-run] file|-")
+	}
+	input := flags.Arg(0)
+	bundleFormat, err := backupFormat(*format, input)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer func(file *os.File) {
+			err := file.Close()
+			if err != nil {
+				return
+			}
+		}(file)
+		r = file
+	}
+	b, err := backup.Read(r, bundleFormat)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	if err := backup.Validate(b); err != nil {
+		return err
+	}
+	if *dryRun {
+		log.Printf("Backup from %s is valid: %d users, %d books, %d borrows, %d charges and %d revoked cards", b.Manifest.CreatedAt.Format("2006-01-02 15:04:05Z07:00"), len(b.Users), len(b.Books), len(b.Borrows), len(b.Charges), len(b.RevokedCards))
+		return nil
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if b.Manifest.SchemaVersion > current {
+		return fmt.Errorf("the backup was taken at schema version %d but the database is at %d, run migrate up first", b.Manifest.SchemaVersion, current)
+	}
+	config.SetDbs(db)
+	if err := backup.Restore(b, *replace, models.SystemActor("restore")); err != nil {
+		return err
+	}
+	log.Printf("Imported %d users, %d books, %d borrows, %d charges and %d revoked cards", len(b.Users), len(b.Books), len(b.Borrows), len(b.Charges), len(b.RevokedCards))
+	return nil
+}
+
+func backupFormat(format string, path string) (string, error) {
+	if format == "" {
+		return backup.FormatFromPath(path), nil
+	}
+	if !backup.ValidFormat(format) {
+		return "", fmt.Errorf("unknown format %q, expected %s or %s", format, models.BackupFormatNDJSON, models.BackupFormatTarGz)
+	}
+	return format, nil
+}
+
+// schemaVersion returns the migration the database is at, backups are not taken or restored on a dirty schema
+func schemaVersion(db *sql.DB) (uint, error) {
+	version, dirty, err := migration.Version(db)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, errors.New("the database is dirty, the last migration failed and needs manual repair")
+	}
+	return version, nil
+}
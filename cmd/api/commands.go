@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/migration"
+	"github.com/spin311/library-api/pkg/config"
+	"log"
+	"strconv"
+)
+
+// runCommand dispatches the subcommands that run instead of the server, e.g. library-api migrate up
+func runCommand(db *sql.DB, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(db, args[1:])
+	case "export":
+		return runExport(db, args[1:])
+	case "import":
+		return runImport(db, args[1:])
+	case "fsck":
+		return runFsck(db, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func runMigrate(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status|version")
+	}
+	switch args[0] {
+	case "up":
+		if err := migration.Up(db); err != nil {
+			return err
+		}
+		log.Println("Migrations applied")
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		if err := migration.Down(db, steps); err != nil {
+			return err
+		}
+		log.Printf("Rolled back %d migration(s)", steps)
+	case "status":
+		migrations, dirty, err := migration.Status(db)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d %-30s %s\n", m.Version, m.Name, state)
+		}
+		if dirty {
+			fmt.Println("database is dirty, the last migration failed and needs manual repair")
+		}
+	case "version":
+		version, dirty, err := migration.Version(db)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			fmt.Printf("%d (dirty)\n", version)
+		} else {
+			fmt.Println(version)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or version", args[0])
+	}
+	return nil
+}
+
+// runFsck reports books whose borrowed count differs from their open borrows and fails while any remain
+func runFsck(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "set the borrowed counts to the open borrows in a single transaction")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("usage: fsck [-repair]")
+	}
+
+	config.SetDbs(db)
+	report, httpErr := services.CheckConsistency(*repair, models.SystemActor("fsck"))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return fmt.Errorf("%s", httpErr.Message)
+	}
+	for _, m := range report.Mismatches {
+		state := "mismatch"
+		switch {
+		case m.Repaired:
+			state = "repaired"
+		case m.Problem != "":
+			state = m.Problem
+		}
+		fmt.Printf("book %d %q: borrowed_count %d, open borrows %d, quantity %d: %s\n", m.BookID, m.Title, m.BorrowedCount, m.OpenBorrows, m.Quantity, state)
+	}
+	fmt.Printf("%d books checked, %d mismatches, %d unrepaired\n", report.Books, len(report.Mismatches), report.Unrepaired())
+	if unrepaired := report.Unrepaired(); unrepaired > 0 {
+		if !*repair {
+			return fmt.Errorf("found %d mismatched borrowed counts, run fsck -repair to correct them", unrepaired)
+		}
+		return fmt.Errorf("%d borrowed counts could not be repaired", unrepaired)
+	}
+	return nil
+}
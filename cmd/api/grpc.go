@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/spin311/library-api/internal/app/rpc"
+	"github.com/spin311/library-api/pkg/config"
+	"log"
+	"net"
+	"time"
+)
+
+// serveGRPC runs the gRPC server until ctx is cancelled, then lets in-flight calls finish
+// for up to shutdownTimeout before closing the remaining connections
+func serveGRPC(ctx context.Context, cfg config.GRPCConfig, server config.ServerConfig) error {
+	var tlsConfig *tls.Config
+	if server.TLS.Enabled() {
+		var err error
+		if tlsConfig, err = server.TLS.ServerTLSConfig(); err != nil {
+			return err
+		}
+	}
+	listener, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return err
+	}
+	grpcServer := rpc.NewServer(tlsConfig)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			log.Printf("gRPC listening on %s (TLS, client auth: %s)", cfg.Address, server.TLS.ClientAuth)
+		} else {
+			log.Printf("gRPC listening on %s", cfg.Address)
+		}
+		serverErr <- grpcServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down gRPC server...")
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(server.ShutdownTimeout):
+		grpcServer.Stop()
+	}
+	return nil
+}
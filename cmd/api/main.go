@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 	_ "github.com/spin311/library-api/docs"
+	"github.com/spin311/library-api/internal/app/availability"
 	"github.com/spin311/library-api/internal/app/handlers"
+	"github.com/spin311/library-api/internal/app/middleware"
+	"github.com/spin311/library-api/migration"
 	"github.com/spin311/library-api/pkg/config"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 // @title Library API
@@ -18,8 +26,12 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
 
-	db, err := config.InitDatabase()
+	db, err := config.InitDatabase(cfg.Database)
 	if err != nil {
 		log.Fatalf("Error initializing database: %v", err)
 	}
@@ -30,24 +42,210 @@ func main() {
 		}
 	}(db)
 
+	if len(args) > 0 {
+		if err := runCommand(db, args); err != nil {
+			log.Fatalf("Error running %s: %v", args[0], err)
+		}
+		return
+	}
+
+	if cfg.Database.AutoMigrate {
+		if err := migration.Up(db); err != nil {
+			log.Fatalf("Error applying migrations: %v", err)
+		}
+	}
+
 	config.SetDbs(db)
+	config.SetLoanRules(cfg.Loans)
+	config.SetIdempotency(cfg.Idempotency, instanceName())
+	config.SetImports(cfg.Imports)
+	config.SetAvailability(cfg.Availability)
+	config.SetWebhooks(cfg.Webhooks)
+	if err := registerJobs(cfg); err != nil {
+		log.Fatalf("Error registering jobs: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workers := startWorkers(ctx, cfg)
+	go func() {
+		// end the availability streams, the server waits for open requests when it shuts down
+		<-ctx.Done()
+		availability.Close()
+	}()
+	// grpcErr is only read after workers.Wait
+	var grpcErr error
+	if cfg.GRPC.Enabled {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			if err := serveGRPC(ctx, cfg.GRPC, cfg.Server); err != nil {
+				log.Printf("gRPC server error: %v", err)
+				grpcErr = err
+				stop()
+			}
+		}()
+	}
+	serveErr := serve(ctx, cfg.Server, newRouter(cfg))
+	if serveErr != nil {
+		log.Printf("Server error: %v", serveErr)
+	}
+	stop()
+	workers.Wait()
+	// supervisors must see a server that could not start or failed as a failed process
+	if serveErr != nil || grpcErr != nil {
+		os.Exit(1)
+	}
+}
+
+func newRouter(cfg *config.Config) *mux.Router {
 	r := mux.NewRouter()
+	r.Use(middleware.Actor(cfg.Server.TrustProxy))
+	if cfg.RateLimit.Enabled {
+		r.Use(middleware.RateLimit(rateLimitOptions(cfg)))
+	}
 
 	//User Routes
-	r.HandleFunc("/users", handlers.CreateUser).Methods(http.MethodPost)
+	r.Handle("/users", middleware.Idempotent(http.HandlerFunc(handlers.CreateUser))).Methods(http.MethodPost)
 	r.HandleFunc("/users", handlers.GetUsers).Methods(http.MethodGet)
+	r.HandleFunc("/users/by-card/{card}", handlers.GetUserByCard).Methods(http.MethodGet)
 	r.HandleFunc("/users/{userId}", handlers.GetUser).Methods(http.MethodGet)
+	r.HandleFunc("/users/{userId}", handlers.UpdateUser).Methods(http.MethodPut)
+	r.HandleFunc("/users/{userId}/notifications", handlers.GetUserNotifications).Methods(http.MethodGet)
+	r.HandleFunc("/users/{userId}/recommendations", handlers.GetUserRecommendations).Methods(http.MethodGet)
+	r.HandleFunc("/users/{userId}/charges", handlers.GetUserCharges).Methods(http.MethodGet)
+	r.Handle("/users/{userId}/card", middleware.Idempotent(http.HandlerFunc(handlers.ReplaceUserCard))).Methods(http.MethodPost)
 
 	//Book Routes
 	r.HandleFunc("/books", handlers.GetBooks).Methods(http.MethodGet)
+	r.HandleFunc("/books/availability/stream", handlers.StreamAvailability).Methods(http.MethodGet)
+	r.HandleFunc("/books/{bookId}/availability/stream", handlers.StreamBookAvailability).Methods(http.MethodGet)
+	r.HandleFunc("/books/{bookId:[0-9]+}.mrc", handlers.GetBookMARC).Methods(http.MethodGet)
+	r.HandleFunc("/books/{bookId:[0-9]+}.xml", handlers.GetBookMARCXML).Methods(http.MethodGet)
+	r.HandleFunc("/books/{bookId}/similar", handlers.GetSimilarBooks).Methods(http.MethodGet)
 	r.HandleFunc("/books/{bookId}", handlers.GetBook).Methods(http.MethodGet)
+	r.HandleFunc("/books/{bookId}", handlers.UpdateBook).Methods(http.MethodPut)
+
+	r.Handle("/users/{userId}/books/{bookId}/borrow", middleware.Idempotent(http.HandlerFunc(handlers.BorrowBook))).Methods(http.MethodPost)
+	r.Handle("/users/{userId}/books/{bookId}/return", middleware.Idempotent(http.HandlerFunc(handlers.ReturnBook))).Methods(http.MethodPut)
+	r.Handle("/users/{userId}/books/{bookId}/renew", middleware.Idempotent(http.HandlerFunc(handlers.RenewBook))).Methods(http.MethodPut)
+
+	//Borrow Routes
+	r.Handle("/borrows/{borrowId}/lost", middleware.Idempotent(http.HandlerFunc(handlers.MarkBorrowLost))).Methods(http.MethodPost)
+	r.Handle("/borrows/{borrowId}/found", middleware.Idempotent(http.HandlerFunc(handlers.MarkBorrowFound))).Methods(http.MethodPost)
+
+	//OPDS Routes
+	r.HandleFunc("/opds", handlers.GetOPDSRoot).Methods(http.MethodGet)
+	r.HandleFunc("/opds/new", handlers.GetOPDSNew).Methods(http.MethodGet)
+	r.HandleFunc("/opds/authors", handlers.GetOPDSAuthors).Methods(http.MethodGet)
+	r.HandleFunc("/opds/subjects", handlers.GetOPDSSubjects).Methods(http.MethodGet)
+	r.HandleFunc("/opds/books", handlers.GetOPDSBooks).Methods(http.MethodGet)
+	r.HandleFunc("/opds/search", handlers.SearchOPDS).Methods(http.MethodGet)
+	r.HandleFunc("/opds/opensearch.xml", handlers.GetOPDSOpenSearch).Methods(http.MethodGet)
+
+	//SRU Routes
+	r.HandleFunc("/sru", handlers.SRU).Methods(http.MethodGet, http.MethodPost)
+
+	//Import Routes
+	r.HandleFunc("/imports/books", handlers.ImportBooks).Methods(http.MethodPost)
+	r.HandleFunc("/imports/users", handlers.ImportUsers).Methods(http.MethodPost)
+	r.HandleFunc("/imports/{importId}", handlers.GetImport).Methods(http.MethodGet)
 
-	r.HandleFunc("/users/{userId}/books/{bookId}/borrow", handlers.BorrowBook).Methods(http.MethodPost)
-	r.HandleFunc("/users/{userId}/books/{bookId}/return", handlers.ReturnBook).Methods(http.MethodPut)
+	//Webhook Routes
+	r.HandleFunc("/webhooks", handlers.CreateWebhook).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks", handlers.GetWebhooks).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{webhookId}", handlers.GetWebhook).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{webhookId}", handlers.DeleteWebhook).Methods(http.MethodDelete)
+	r.HandleFunc("/webhooks/{webhookId}/deliveries", handlers.GetWebhookDeliveries).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver", handlers.RedeliverWebhook).Methods(http.MethodPost)
+
+	//GraphQL Routes
+	r.HandleFunc("/graphql", handlers.GraphQL).Methods(http.MethodPost)
+
+	//Report Routes
+	r.HandleFunc("/reports/top-books", handlers.GetTopBooks).Methods(http.MethodGet)
+	r.HandleFunc("/reports/borrows", handlers.GetBorrowCounts).Methods(http.MethodGet)
+	r.HandleFunc("/reports/loan-duration", handlers.GetLoanDurations).Methods(http.MethodGet)
+	r.HandleFunc("/reports/utilization", handlers.GetUtilization).Methods(http.MethodGet)
+	r.HandleFunc("/reports/active-patrons", handlers.GetActivePatrons).Methods(http.MethodGet)
+	r.HandleFunc("/reports/never-borrowed", handlers.GetUnborrowedBooks).Methods(http.MethodGet)
+
+	//Admin Routes
+	r.HandleFunc("/admin/audit", handlers.GetAuditLog).Methods(http.MethodGet)
+	r.HandleFunc("/admin/jobs", handlers.GetJobs).Methods(http.MethodGet)
+	r.HandleFunc("/admin/jobs/{jobName}/runs", handlers.GetJobRuns).Methods(http.MethodGet)
+	r.HandleFunc("/admin/jobs/{jobName}/run", handlers.TriggerJob).Methods(http.MethodPost)
+	r.HandleFunc("/admin/fsck", handlers.CheckConsistency).Methods(http.MethodGet)
+	r.HandleFunc("/admin/fsck/repair", handlers.RepairConsistency).Methods(http.MethodPost)
 
 	// Swagger UI
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
-	serverPort := config.GetEnvString("SERVER_PORT")
-	log.Fatal(http.ListenAndServe(serverPort, r))
+	return r
+}
+
+func rateLimitOptions(cfg *config.Config) middleware.RateLimitOptions {
+	toLimit := func(l config.RateLimit) middleware.Limit {
+		return middleware.Limit{Requests: l.Requests, Period: l.Period, Burst: l.Burst, KeyBy: l.KeyBy}
+	}
+	routes := make(map[string]middleware.Limit)
+	for route, limit := range cfg.RateLimit.Routes {
+		routes[route] = toLimit(limit)
+	}
+	return middleware.RateLimitOptions{
+		Default:    toLimit(cfg.RateLimit.Default),
+		Routes:     routes,
+		KeyBy:      cfg.RateLimit.KeyBy,
+		APIKeys:    cfg.RateLimit.APIKeys,
+		TrustProxy: cfg.Server.TrustProxy,
+		Store:      middleware.NewMemoryStore(),
+	}
+}
+
+// serve runs the HTTP(S) server until ctx is cancelled, then drains in-flight requests
+func serve(ctx context.Context, cfg config.ServerConfig, handler http.Handler) error {
+	server := &http.Server{
+		Addr:         cfg.Address,
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := cfg.TLS.ServerTLSConfig()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			log.Printf("Listening on %s (HTTPS, client auth: %s)", cfg.Address, cfg.TLS.ClientAuth)
+			// certificates come from TLSConfig so they can be reloaded on rotation
+			serverErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		log.Printf("Listening on %s", cfg.Address)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-serverErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
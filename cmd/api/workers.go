@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/availability"
+	"github.com/spin311/library-api/internal/app/events"
+	"github.com/spin311/library-api/internal/app/imports"
+	"github.com/spin311/library-api/internal/app/jobs"
+	"github.com/spin311/library-api/internal/app/notifications"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/pkg/config"
+	"os"
+	"sync"
+	"time"
+)
+
+// startWorkers launches the background processes of this instance, they stop when ctx is cancelled
+func startWorkers(ctx context.Context, cfg *config.Config) *sync.WaitGroup {
+	var workers sync.WaitGroup
+
+	if cfg.Events.RelayEnabled {
+		relay := &events.Relay{
+			Targets: []events.Target{
+				{Name: cfg.Events.Publisher, Publisher: newPublisher(cfg.Events)},
+				{Name: "subscriptions", Publisher: events.SubscriptionPublisher{}},
+			},
+			PollInterval: cfg.Events.PollInterval,
+			BatchSize:    cfg.Events.BatchSize,
+			MaxAttempts:  cfg.Events.MaxAttempts,
+			MaxBackoff:   cfg.Events.MaxBackoff,
+			ClaimLease:   cfg.Events.ClaimLease,
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			relay.Run(ctx)
+		}()
+	}
+
+	if cfg.Webhooks.DispatcherEnabled {
+		dispatcher := &events.Dispatcher{
+			Client:       cfg.Webhooks.OutboundPolicy().NewHTTPClient(cfg.Webhooks.Timeout),
+			PollInterval: cfg.Webhooks.PollInterval,
+			BatchSize:    cfg.Webhooks.BatchSize,
+			MaxAttempts:  cfg.Webhooks.MaxAttempts,
+			MaxBackoff:   cfg.Webhooks.MaxBackoff,
+			ClaimLease:   cfg.Webhooks.ClaimLease,
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			dispatcher.Run(ctx)
+		}()
+	}
+
+	if cfg.Availability.Notify {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			availability.Listen(ctx, cfg.Database.DSN())
+		}()
+	}
+
+	if cfg.Imports.WorkerEnabled {
+		worker := &imports.Worker{
+			PollInterval: cfg.Imports.PollInterval,
+			StaleAfter:   cfg.Imports.StaleAfter,
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker.Run(ctx)
+		}()
+	}
+
+	if cfg.Jobs.RunnerEnabled {
+		runner := &jobs.Runner{
+			PollInterval: cfg.Jobs.PollInterval,
+			Instance:     instanceName(),
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			runner.Run(ctx)
+		}()
+	}
+
+	return &workers
+}
+
+// registerJobs registers the background jobs with their configured schedules.
+// It runs on every instance, so jobs can be listed and triggered through any of them.
+func registerJobs(cfg *config.Config) error {
+	definitions := []struct {
+		name        string
+		description string
+		enabled     bool
+		run         jobs.Func
+	}{
+		{"notifications", "send due date reminders and overdue notices to patrons", cfg.Notifications.Enabled, (&notifications.Notifier{
+			Channels:      newChannels(cfg.Notifications),
+			DueSoonDays:   cfg.Notifications.DueSoonDays,
+			DefaultLocale: cfg.Notifications.DefaultLocale,
+			MaxAttempts:   cfg.Notifications.MaxAttempts,
+			RetryBackoff:  cfg.Notifications.RetryBackoff,
+		}).Run},
+		{"idempotency-cleanup", "delete expired idempotency keys", true, cleanupIdempotencyKeys},
+		{"job-history-cleanup", "delete job runs older than jobs.history_retention", true, cleanupJobHistory(cfg.Jobs.HistoryRetention)},
+		{"recommendations", "count new borrows into the co-borrowing recommendations", true, refreshRecommendations},
+	}
+
+	known := make(map[string]bool)
+	for _, definition := range definitions {
+		known[definition.name] = true
+		if !definition.enabled {
+			continue
+		}
+		spec, ok := cfg.Jobs.Schedules[definition.name]
+		if !ok {
+			return fmt.Errorf("no schedule for job %s, set jobs.schedules[%q]", definition.name, definition.name)
+		}
+		if err := jobs.Register(definition.name, definition.description, spec, definition.run); err != nil {
+			return err
+		}
+	}
+	for name := range cfg.Jobs.Schedules {
+		if !known[name] {
+			return fmt.Errorf("jobs.schedules has a schedule for unknown job %s", name)
+		}
+	}
+	return nil
+}
+
+func cleanupIdempotencyKeys(_ context.Context) (string, error) {
+	deleted, err := services.DeleteExpiredIdempotencyKeys()
+	if !models.IsHttpErrorEmpty(err) {
+		return "", errors.New(err.Message)
+	}
+	return fmt.Sprintf("deleted %d expired idempotency keys", deleted), nil
+}
+
+func cleanupJobHistory(retention time.Duration) jobs.Func {
+	return func(_ context.Context) (string, error) {
+		deleted, err := services.DeleteJobRunsOlderThan(retention)
+		if !models.IsHttpErrorEmpty(err) {
+			return "", errors.New(err.Message)
+		}
+		return fmt.Sprintf("deleted %d job runs", deleted), nil
+	}
+}
+
+// refreshRecommendations counts new borrows in batches until none are left or ctx is cancelled
+func refreshRecommendations(ctx context.Context) (string, error) {
+	borrows := 0
+	for {
+		refresh, err := services.RefreshRecommendations()
+		if !models.IsHttpErrorEmpty(err) {
+			return "", errors.New(err.Message)
+		}
+		borrows += refresh.Borrows
+		if refresh.Done || ctx.Err() != nil {
+			return fmt.Sprintf("counted %d new reads, up to borrow %d", borrows, refresh.LastBorrowID), nil
+		}
+	}
+}
+
+// instanceName identifies this replica in the job history
+func instanceName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func newPublisher(cfg config.EventsConfig) events.Publisher {
+	if cfg.Publisher == "webhook" {
+		return events.NewWebhookPublisher(cfg.WebhookURL, cfg.WebhookTimeout)
+	}
+	return events.LogPublisher{}
+}
+
+// newChannels returns the notification channels that are configured
+func newChannels(cfg config.NotificationsConfig) []notifications.Channel {
+	var channels []notifications.Channel
+	if cfg.SMTP.Host != "" {
+		channels = append(channels, &notifications.EmailChannel{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		})
+	}
+	if cfg.SMS.URL != "" {
+		channels = append(channels, notifications.NewSMSChannel(cfg.SMS.URL, cfg.SMS.Token, cfg.SMS.Timeout))
+	}
+	return channels
+}
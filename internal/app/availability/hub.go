@@ -0,0 +1,139 @@
+// Package availability fans the availability of books out to the clients streaming it.
+// Updates are published within the process, or with Listen across replicas through PostgreSQL LISTEN/NOTIFY.
+package availability
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Options configures the availability streams
+type Options struct {
+	// Heartbeat is how often an idle stream sends a comment, so proxies and clients keep the connection open
+	Heartbeat time.Duration
+	// MaxBooks is the largest number of books one stream may follow
+	MaxBooks int
+}
+
+var options = Options{
+	Heartbeat: 15 * time.Second,
+	MaxBooks:  100,
+}
+
+func SetOptions(o Options) {
+	options = o
+}
+
+// StreamOptions returns the options of the availability streams
+func StreamOptions() Options {
+	return options
+}
+
+// Subscription receives the availability of a set of books.
+// Updates that arrive faster than the subscriber reads them are coalesced to the latest one per book.
+type Subscription struct {
+	books   []int
+	mu      sync.Mutex
+	pending map[int]models.BookAvailability
+	ready   chan struct{}
+	closed  bool
+}
+
+var (
+	mu            sync.RWMutex
+	subscriptions = map[*Subscription]struct{}{}
+	closed        bool
+)
+
+// Subscribe starts receiving the availability of the books. Callers must Close the subscription.
+func Subscribe(bookIds []int) *Subscription {
+	s := &Subscription{
+		books:   bookIds,
+		pending: map[int]models.BookAvailability{},
+		ready:   make(chan struct{}, 1),
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if closed {
+		s.closed = true
+		close(s.ready)
+		return s
+	}
+	subscriptions[s] = struct{}{}
+	return s
+}
+
+// Ready receives when updates are pending, it is closed when the subscription ends
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Next returns the pending updates ordered by book ID
+func (s *Subscription) Next() []models.BookAvailability {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updates := make([]models.BookAvailability, 0, len(s.pending))
+	for _, update := range s.pending {
+		updates = append(updates, update)
+	}
+	clear(s.pending)
+	slices.SortFunc(updates, func(a, b models.BookAvailability) int { return a.BookID - b.BookID })
+	return updates
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	mu.Lock()
+	delete(subscriptions, s)
+	mu.Unlock()
+	s.end()
+}
+
+func (s *Subscription) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ready)
+	}
+}
+
+func (s *Subscription) offer(update models.BookAvailability) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if current, ok := s.pending[update.BookID]; ok && current.Version > update.Version {
+		return
+	}
+	s.pending[update.BookID] = update
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Publish passes an update to the subscriptions following the book, it never blocks on slow subscribers
+func Publish(update models.BookAvailability) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for s := range subscriptions {
+		if slices.Contains(s.books, update.BookID) {
+			s.offer(update)
+		}
+	}
+}
+
+// Close ends every subscription and refuses new ones, so open streams return when the server shuts down
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	closed = true
+	for s := range subscriptions {
+		s.end()
+		delete(subscriptions, s)
+	}
+}
@@ -0,0 +1,56 @@
+package availability
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"log"
+	"time"
+)
+
+// pingInterval is how often an idle listener checks its connection
+const pingInterval = 90 * time.Second
+
+// Listen publishes the availability notified by any replica until ctx is cancelled.
+// It keeps its own connection, lib/pq reconnects it when it drops.
+func Listen(ctx context.Context, dsn string) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Availability listener: %v", err)
+		}
+	})
+	defer func(listener *pq.Listener) {
+		err := listener.Close()
+		if err != nil {
+			log.Printf("Failed to close availability listener: %v", err)
+		}
+	}(listener)
+	if err := listener.Listen(postgres.AvailabilityChannel); err != nil {
+		log.Printf("Failed to listen for availability: %v", err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-listener.Notify:
+			// nil follows a reconnect, updates sent while disconnected are lost until the books change again
+			if notification == nil {
+				continue
+			}
+			var update models.BookAvailability
+			if err := json.Unmarshal([]byte(notification.Extra), &update); err != nil {
+				log.Printf("Ignoring availability notification %q: %v", notification.Extra, err)
+				continue
+			}
+			Publish(update)
+		case <-time.After(pingInterval):
+			if err := listener.Ping(); err != nil {
+				log.Printf("Availability listener ping failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package backup
+
+import (
+	"errors"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+)
+
+// Export reads a consistent snapshot of the library, schemaVersion is the migration the database is at
+func Export(schemaVersion uint) (models.Backup, error) {
+	b, httpErr := services.ExportBackup()
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return b, errors.New(httpErr.Message)
+	}
+	b.Manifest = newManifest(b, schemaVersion)
+	return b, nil
+}
+
+// Restore validates a backup and writes it in a single transaction, keeping the original IDs so borrows
+// still refer to the same users and books. The database must be empty unless replace is set.
+// The restore is recorded in the audit log as done by actor.
+func Restore(b models.Backup, replace bool, actor models.Actor) error {
+	if err := Validate(b); err != nil {
+		return err
+	}
+	if httpErr := services.RestoreBackup(b, replace, actor); !models.IsHttpErrorEmpty(httpErr) {
+		return errors.New(httpErr.Message)
+	}
+	return nil
+}
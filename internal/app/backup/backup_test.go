@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"github.com/spin311/library-api/internal/repository/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func at(day int) *time.Time {
+	t := time.Date(2024, 9, day, 10, 0, 0, 0, time.UTC)
+	return &t
+}
+
+// sampleBackup has one open loan, one returned loan and one lost copy with its charge
+func sampleBackup() models.Backup {
+	b := models.Backup{
+		Users: []models.User{
+			{ID: 1, FirstName: "Ana", LastName: "Novak", CardNumber: "20000000000021", Email: "ana@example.com", Locale: "sl", NotifyEmail: true,
+				DateOfBirth: "1990-05-31", MembershipStarts: "2024-01-01", MembershipExpires: "2024-12-31", Category: "adult"},
+			{ID: 2, FirstName: "Bor", LastName: "Kos", CardNumber: "20000000000038", Category: "child"},
+		},
+		Books: []models.BackupBook{
+			{Book: models.Book{ID: 1, Title: "The Hobbit", Quantity: 2, BorrowedCount: 1, Version: 3,
+				Catalog: models.Catalog{ISBN: "0261102214", Authors: []string{"J. R. R. Tolkien"}, Subjects: []string{"Dragons"}}}, CreatedAt: at(1)},
+			{Book: models.Book{ID: 2, Title: "Čeština", Quantity: 1, Restrictions: models.Restrictions{ReferenceOnly: true, AgeRating: 12}}},
+		},
+		Borrows: []models.Borrow{
+			{ID: 1, UserID: 1, BookID: 1, BorrowedAt: *at(2), DueAt: at(16)},
+			{ID: 2, UserID: 2, BookID: 2, BorrowedAt: *at(2), DueAt: at(16), ReturnedAt: at(5), Renewals: 1},
+			{ID: 3, UserID: 2, BookID: 1, BorrowedAt: *at(3), ReturnedAt: at(6), LostAt: at(6)},
+		},
+		Charges: []models.Charge{
+			{ID: 1, UserID: 2, BorrowID: 3, BookID: 1, Reason: models.ChargeLost, Amount: 2500, CreatedAt: *at(6)},
+		},
+		RevokedCards: []models.RevokedCard{
+			{CardNumber: "20000000000014", UserID: 1, RevokedAt: *at(4)},
+		},
+	}
+	b.Manifest = newManifest(b, 22)
+	b.Manifest.CreatedAt = *at(7)
+	return b
+}
+
+func TestWriteRead(t *testing.T) {
+	for _, format := range []string{models.BackupFormatNDJSON, models.BackupFormatTarGz} {
+		t.Run(format, func(t *testing.T) {
+			want := sampleBackup()
+			var buf bytes.Buffer
+			if err := Write(&buf, format, want); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Read(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("read back\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":            ``,
+		"no manifest":      `{"type":"user","data":{"id":1}}`,
+		"late manifest":    `{"type":"manifest","data":{"version":1}}` + "\n" + `{"type":"manifest","data":{"version":1}}`,
+		"no version":       `{"type":"manifest","data":{}}`,
+		"newer version":    `{"type":"manifest","data":{"version":99}}`,
+		"unknown row type": `{"type":"manifest","data":{"version":1}}` + "\n" + `{"type":"hold","data":{}}`,
+		"malformed row":    `{"type":"manifest","data":{"version":1}}` + "\n" + `{"type":"user","data":{"id":"one"}}`,
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(input), models.BackupFormatNDJSON); err == nil {
+				t.Error("Read() did not fail")
+			}
+		})
+	}
+	if _, err := Read(strings.NewReader("not gzip"), models.BackupFormatTarGz); err == nil {
+		t.Error("Read() of a broken archive did not fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(b *models.Backup)
+		// problems are matched as substrings, in order
+		problems []string
+	}{
+		{"valid", func(b *models.Backup) {}, nil},
+		{"manifest count", func(b *models.Backup) { b.Manifest.Users = 3 }, []string{"the manifest lists 3 users but the backup has 2"}},
+		{"duplicate user", func(b *models.Backup) {
+			b.Users[1].ID = 1
+			b.Users[1].CardNumber = ""
+		}, []string{"user 1 appears more than once", "borrow 2 refers to user 2", "borrow 3 refers to user 2"}},
+		{"missing book", func(b *models.Backup) { b.Borrows[1].BookID = 9 }, []string{"borrow 2 refers to book 9"}},
+		{"returned before borrowed", func(b *models.Backup) { b.Borrows[1].ReturnedAt = at(1) }, []string{"borrow 2 was returned before it was borrowed"}},
+		{"lost but open", func(b *models.Backup) {
+			b.Borrows[2].ReturnedAt = nil
+			b.Books[0].BorrowedCount = 2
+		}, []string{"borrow 3 was reported lost but is still open"}},
+		{"found but never lost", func(b *models.Backup) { b.Borrows[1].FoundAt = at(8) }, []string{"borrow 2 was found but never reported lost"}},
+		{"charge of another user", func(b *models.Backup) { b.Charges[0].UserID = 1 }, []string{"charge 1 refers to borrow 3 of user 1"}},
+		{"charge reason and amount", func(b *models.Backup) {
+			b.Charges[0].Reason = "late"
+			b.Charges[0].Amount = 0
+		}, []string{`unknown reason "late"`, "charge 1 has an amount of 0"}},
+		{"revoked card still in use", func(b *models.Backup) { b.RevokedCards[0].CardNumber = "20000000000038" }, []string{"revoked card 20000000000038 is still the card of a user"}},
+		{"borrowed count", func(b *models.Backup) { b.Books[0].BorrowedCount = 0 }, []string{"book 1 has a borrowed count of 0 but 1 open borrows"}},
+		{"borrowed count over quantity", func(b *models.Backup) { b.Books[1].BorrowedCount = 2 }, []string{"book 2 has 2 copies borrowed out of 1", "book 2 has a borrowed count of 2 but 0 open borrows"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := sampleBackup()
+			tt.change(&b)
+			err := Validate(b)
+			if tt.problems == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			if len(validationErr.Problems) != len(tt.problems) {
+				t.Fatalf("got problems %q, want %d", validationErr.Problems, len(tt.problems))
+			}
+			for i, problem := range tt.problems {
+				if !strings.Contains(validationErr.Problems[i], problem) {
+					t.Errorf("problem %d = %q, want it to contain %q", i, validationErr.Problems[i], problem)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationErrorListsAtMostTwenty(t *testing.T) {
+	problems := make([]string, maxListedProblems+5)
+	for i := range problems {
+		problems[i] = "problem"
+	}
+	message := (&ValidationError{Problems: problems}).Error()
+	if !strings.HasPrefix(message, "the backup has 25 problems") || !strings.HasSuffix(message, "and 5 more") {
+		t.Errorf("unexpected message %q", message)
+	}
+}
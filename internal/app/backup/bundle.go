@@ -0,0 +1,316 @@
+// Package backup writes and reads versioned snapshots of the library's users, books, borrows, charges and revoked cards,
+// either as a single NDJSON stream or as a tar.gz archive with one NDJSON file per table.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"io"
+	"strings"
+	"time"
+)
+
+// NDJSON bundles start with a manifest line followed by one line per row, e.g. {"type":"user","data":{...}}
+const (
+	typeManifest = "manifest"
+	typeUser     = "user"
+	typeBook     = "book"
+	typeBorrow   = "borrow"
+	typeCharge   = "charge"
+	typeRevoked  = "revoked_card"
+)
+
+// file names inside a tar.gz bundle
+const (
+	manifestFile = "manifest.json"
+	usersFile    = "users.ndjson"
+	booksFile    = "books.ndjson"
+	borrowsFile  = "borrows.ndjson"
+	chargesFile  = "charges.ndjson"
+	revokedFile  = "revoked_cards.ndjson"
+)
+
+type line struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// FormatFromPath returns the bundle format implied by a file name, NDJSON unless it ends in .tar.gz or .tgz
+func FormatFromPath(path string) string {
+	if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
+		return models.BackupFormatTarGz
+	}
+	return models.BackupFormatNDJSON
+}
+
+// ValidFormat reports whether format is a supported bundle format
+func ValidFormat(format string) bool {
+	return format == models.BackupFormatNDJSON || format == models.BackupFormatTarGz
+}
+
+// newManifest describes a backup taken now at the given schema version
+func newManifest(b models.Backup, schemaVersion uint) models.BackupManifest {
+	return models.BackupManifest{
+		Version:       models.BackupVersion,
+		CreatedAt:     time.Now().UTC(),
+		SchemaVersion: schemaVersion,
+		Users:         len(b.Users),
+		Books:         len(b.Books),
+		Borrows:       len(b.Borrows),
+		Charges:       len(b.Charges),
+		RevokedCards:  len(b.RevokedCards),
+	}
+}
+
+// Write encodes the backup in the given format
+func Write(w io.Writer, format string, b models.Backup) error {
+	switch format {
+	case models.BackupFormatNDJSON:
+		return writeNDJSON(w, b)
+	case models.BackupFormatTarGz:
+		return writeTarGz(w, b)
+	default:
+		return fmt.Errorf("unsupported backup format %q", format)
+	}
+}
+
+func writeNDJSON(w io.Writer, b models.Backup) error {
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	write := func(kind string, data any) error {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(line{Type: kind, Data: raw})
+	}
+	if err := write(typeManifest, b.Manifest); err != nil {
+		return err
+	}
+	for _, user := range b.Users {
+		if err := write(typeUser, user); err != nil {
+			return err
+		}
+	}
+	for _, book := range b.Books {
+		if err := write(typeBook, book); err != nil {
+			return err
+		}
+	}
+	for _, borrow := range b.Borrows {
+		if err := write(typeBorrow, borrow); err != nil {
+			return err
+		}
+	}
+	for _, charge := range b.Charges {
+		if err := write(typeCharge, charge); err != nil {
+			return err
+		}
+	}
+	for _, card := range b.RevokedCards {
+		if err := write(typeRevoked, card); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+func writeTarGz(w io.Writer, b models.Backup) error {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	files := []struct {
+		name string
+		rows func(encoder *json.Encoder) error
+	}{
+		{manifestFile, func(encoder *json.Encoder) error { return encoder.Encode(b.Manifest) }},
+		{usersFile, func(encoder *json.Encoder) error { return encodeAll(encoder, b.Users) }},
+		{booksFile, func(encoder *json.Encoder) error { return encodeAll(encoder, b.Books) }},
+		{borrowsFile, func(encoder *json.Encoder) error { return encodeAll(encoder, b.Borrows) }},
+		{chargesFile, func(encoder *json.Encoder) error { return encodeAll(encoder, b.Charges) }},
+		{revokedFile, func(encoder *json.Encoder) error { return encodeAll(encoder, b.RevokedCards) }},
+	}
+	for _, file := range files {
+		var content bytes.Buffer
+		if err := file.rows(json.NewEncoder(&content)); err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    file.name,
+			Mode:    0o644,
+			Size:    int64(content.Len()),
+			ModTime: b.Manifest.CreatedAt,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := archive.Write(content.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func encodeAll[T any](encoder *json.Encoder, rows []T) error {
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read decodes a bundle in the given format. Bundles written by a newer version are rejected.
+func Read(r io.Reader, format string) (models.Backup, error) {
+	switch format {
+	case models.BackupFormatNDJSON:
+		return readNDJSON(r)
+	case models.BackupFormatTarGz:
+		return readTarGz(r)
+	default:
+		return models.Backup{}, fmt.Errorf("unsupported backup format %q", format)
+	}
+}
+
+func readNDJSON(r io.Reader) (models.Backup, error) {
+	var b models.Backup
+	decoder := json.NewDecoder(r)
+	for number := 1; ; number++ {
+		var l line
+		err := decoder.Decode(&l)
+		if errors.Is(err, io.EOF) {
+			if number == 1 {
+				return b, errors.New("the backup is empty")
+			}
+			return b, nil
+		}
+		if err != nil {
+			return b, fmt.Errorf("line %d: %w", number, err)
+		}
+		if number == 1 && l.Type != typeManifest {
+			return b, errors.New("the backup does not start with a manifest")
+		}
+		switch l.Type {
+		case typeManifest:
+			if number != 1 {
+				return b, fmt.Errorf("line %d: the manifest must be the first line", number)
+			}
+			err = decodeManifest(l.Data, &b.Manifest)
+		case typeUser:
+			err = appendRow(l.Data, &b.Users)
+		case typeBook:
+			err = appendRow(l.Data, &b.Books)
+		case typeBorrow:
+			err = appendRow(l.Data, &b.Borrows)
+		case typeCharge:
+			err = appendRow(l.Data, &b.Charges)
+		case typeRevoked:
+			err = appendRow(l.Data, &b.RevokedCards)
+		default:
+			err = fmt.Errorf("unknown row type %q", l.Type)
+		}
+		if err != nil {
+			return b, fmt.Errorf("line %d: %w", number, err)
+		}
+	}
+}
+
+func readTarGz(r io.Reader) (models.Backup, error) {
+	var b models.Backup
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return b, err
+	}
+	archive := tar.NewReader(gz)
+	found := make(map[string]bool)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return b, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if found[header.Name] {
+			return b, fmt.Errorf("the archive has more than one %s", header.Name)
+		}
+		found[header.Name] = true
+		switch header.Name {
+		case manifestFile:
+			data, err := io.ReadAll(archive)
+			if err == nil {
+				err = decodeManifest(data, &b.Manifest)
+			}
+			if err != nil {
+				return b, fmt.Errorf("%s: %w", manifestFile, err)
+			}
+		case usersFile:
+			err = readFile(archive, header.Name, &b.Users)
+		case booksFile:
+			err = readFile(archive, header.Name, &b.Books)
+		case borrowsFile:
+			err = readFile(archive, header.Name, &b.Borrows)
+		case chargesFile:
+			err = readFile(archive, header.Name, &b.Charges)
+		case revokedFile:
+			err = readFile(archive, header.Name, &b.RevokedCards)
+		default:
+			err = fmt.Errorf("unexpected file %s in the archive", header.Name)
+		}
+		if err != nil {
+			return b, err
+		}
+	}
+	if !found[manifestFile] {
+		return b, fmt.Errorf("the archive has no %s", manifestFile)
+	}
+	return b, nil
+}
+
+func readFile[T any](r io.Reader, name string, rows *[]T) error {
+	decoder := json.NewDecoder(r)
+	for number := 1; ; number++ {
+		var row T
+		err := decoder.Decode(&row)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", name, number, err)
+		}
+		*rows = append(*rows, row)
+	}
+}
+
+func decodeManifest(data []byte, manifest *models.BackupManifest) error {
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return err
+	}
+	if manifest.Version < 1 {
+		return errors.New("the manifest has no version")
+	}
+	if manifest.Version > models.BackupVersion {
+		return fmt.Errorf("the backup has version %d, this build reads up to version %d", manifest.Version, models.BackupVersion)
+	}
+	return nil
+}
+
+func appendRow[T any](data []byte, rows *[]T) error {
+	var row T
+	if err := json.Unmarshal(data, &row); err != nil {
+		return err
+	}
+	*rows = append(*rows, row)
+	return nil
+}
@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"strings"
+)
+
+// maxListedProblems is the number of problems spelled out in a ValidationError message
+const maxListedProblems = 20
+
+// ValidationError lists the invariants a backup violates
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	listed := e.Problems
+	if len(listed) > maxListedProblems {
+		listed = listed[:maxListedProblems]
+	}
+	message := fmt.Sprintf("the backup has %d problems:\n  %s", len(e.Problems), strings.Join(listed, "\n  "))
+	if len(e.Problems) > len(listed) {
+		message += fmt.Sprintf("\n  and %d more", len(e.Problems)-len(listed))
+	}
+	return message
+}
+
+// Validate checks that a backup can be restored as it is: IDs are unique, every borrow refers to a user and
+// a book of the backup, every charge to a borrow of its user, every revoked card to a user and to no current card,
+// and the borrowed count of every book matches its open borrows and its quantity.
+// It returns a *ValidationError listing every violation.
+func Validate(b models.Backup) error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	counts := []struct {
+		name     string
+		manifest int
+		rows     int
+	}{
+		{"users", b.Manifest.Users, len(b.Users)},
+		{"books", b.Manifest.Books, len(b.Books)},
+		{"borrows", b.Manifest.Borrows, len(b.Borrows)},
+		{"charges", b.Manifest.Charges, len(b.Charges)},
+		{"revoked cards", b.Manifest.RevokedCards, len(b.RevokedCards)},
+	}
+	for _, count := range counts {
+		if count.manifest != count.rows {
+			add("the manifest lists %d %s but the backup has %d", count.manifest, count.name, count.rows)
+		}
+	}
+
+	users := make(map[int]bool, len(b.Users))
+	for _, user := range b.Users {
+		switch {
+		case user.ID <= 0:
+			add("user %d has an invalid ID", user.ID)
+		case users[user.ID]:
+			add("user %d appears more than once", user.ID)
+		}
+		users[user.ID] = true
+		if user.FirstName == "" || user.LastName == "" {
+			add("user %d has no first or last name", user.ID)
+		}
+	}
+
+	books := make(map[int]models.Book, len(b.Books))
+	for _, book := range b.Books {
+		switch {
+		case book.ID <= 0:
+			add("book %d has an invalid ID", book.ID)
+		case books[book.ID].ID != 0:
+			add("book %d appears more than once", book.ID)
+		}
+		books[book.ID] = book.Book
+		if book.Title == "" {
+			add("book %d has no title", book.ID)
+		}
+		if book.Quantity < 0 {
+			add("book %d has a negative quantity", book.ID)
+		}
+		if book.BorrowedCount < 0 || book.BorrowedCount > book.Quantity {
+			add("book %d has %d copies borrowed out of %d", book.ID, book.BorrowedCount, book.Quantity)
+		}
+	}
+
+	borrows := make(map[int]models.Borrow, len(b.Borrows))
+	open := make(map[int]int)
+	for _, borrow := range b.Borrows {
+		switch {
+		case borrow.ID <= 0:
+			add("borrow %d has an invalid ID", borrow.ID)
+		case borrows[borrow.ID].ID != 0:
+			add("borrow %d appears more than once", borrow.ID)
+		}
+		borrows[borrow.ID] = borrow
+		if !users[borrow.UserID] {
+			add("borrow %d refers to user %d, which is not in the backup", borrow.ID, borrow.UserID)
+		}
+		if _, ok := books[borrow.BookID]; !ok {
+			add("borrow %d refers to book %d, which is not in the backup", borrow.ID, borrow.BookID)
+		}
+		if borrow.ReturnedAt != nil && borrow.ReturnedAt.Before(borrow.BorrowedAt) {
+			add("borrow %d was returned before it was borrowed", borrow.ID)
+		}
+		if borrow.LostAt != nil && borrow.ReturnedAt == nil {
+			add("borrow %d was reported lost but is still open", borrow.ID)
+		}
+		if borrow.FoundAt != nil && borrow.LostAt == nil {
+			add("borrow %d was found but never reported lost", borrow.ID)
+		}
+		if borrow.ReturnedAt == nil {
+			open[borrow.BookID]++
+		}
+	}
+
+	charges := make(map[int]bool, len(b.Charges))
+	for _, charge := range b.Charges {
+		switch {
+		case charge.ID <= 0:
+			add("charge %d has an invalid ID", charge.ID)
+		case charges[charge.ID]:
+			add("charge %d appears more than once", charge.ID)
+		}
+		charges[charge.ID] = true
+		if borrow, ok := borrows[charge.BorrowID]; !ok || borrow.UserID != charge.UserID {
+			add("charge %d refers to borrow %d of user %d, which is not in the backup", charge.ID, charge.BorrowID, charge.UserID)
+		}
+		if charge.Reason != models.ChargeLost && charge.Reason != models.ChargeDamaged {
+			add("charge %d has an unknown reason %q", charge.ID, charge.Reason)
+		}
+		if charge.Amount <= 0 {
+			add("charge %d has an amount of %d", charge.ID, charge.Amount)
+		}
+	}
+
+	current := make(map[string]bool, len(b.Users))
+	for _, user := range b.Users {
+		if user.CardNumber != "" {
+			current[user.CardNumber] = true
+		}
+	}
+	revoked := make(map[string]bool, len(b.RevokedCards))
+	for _, card := range b.RevokedCards {
+		switch {
+		case card.CardNumber == "":
+			add("a revoked card of user %d has no number", card.UserID)
+		case revoked[card.CardNumber]:
+			add("revoked card %s appears more than once", card.CardNumber)
+		case current[card.CardNumber]:
+			add("revoked card %s is still the card of a user", card.CardNumber)
+		}
+		revoked[card.CardNumber] = true
+		if !users[card.UserID] {
+			add("revoked card %s refers to user %d, which is not in the backup", card.CardNumber, card.UserID)
+		}
+	}
+
+	for _, book := range b.Books {
+		if book.BorrowedCount != open[book.ID] {
+			add("book %d has a borrowed count of %d but %d open borrows", book.ID, book.BorrowedCount, open[book.ID])
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Package cards validates library card numbers. The numbers are issued by the LIBRARY_CARD_NUMBER database function:
+// 14 digits, a leading 2, a 12 digit serial and a Luhn check digit.
+package cards
+
+import "strings"
+
+// Length is the number of digits of a card number
+const Length = 14
+
+// separators may be typed or printed between groups of digits
+var separators = strings.NewReplacer(" ", "", "-", "")
+
+// Normalize removes the spaces and hyphens of a typed or printed card number
+func Normalize(number string) string {
+	return separators.Replace(strings.TrimSpace(number))
+}
+
+// Valid reports whether a normalized card number has the right length and check digit,
+// so mistyped and misread numbers are rejected without a lookup
+func Valid(number string) bool {
+	if len(number) != Length || number[0] != '2' {
+		return false
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return CheckDigit(number[:Length-1]) == number[Length-1]
+}
+
+// CheckDigit returns the Luhn check digit of a string of digits
+func CheckDigit(payload string) byte {
+	total := 0
+	for i := 0; i < len(payload); i++ {
+		digit := int(payload[len(payload)-1-i] - '0')
+		if i%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		total += digit
+	}
+	return byte('0' + (10-total%10)%10)
+}
@@ -0,0 +1,42 @@
+package cards
+
+import "testing"
+
+func TestCheckDigit(t *testing.T) {
+	tests := map[string]byte{
+		"7992739871":    '3',
+		"2000000000001": '4',
+		"2000000000042": '8',
+		"0":             '0',
+	}
+	for payload, want := range tests {
+		if got := CheckDigit(payload); got != want {
+			t.Errorf("CheckDigit(%q) = %c, want %c", payload, got, want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := map[string]bool{
+		"20000000000014":  true,
+		"20000000000428":  true,
+		"20000000000015":  false,
+		"20000000000041":  false,
+		"10000000000014":  false,
+		"2000000000014":   false,
+		"200000000000140": false,
+		"2000000000001a":  false,
+		"":                false,
+	}
+	for number, want := range tests {
+		if got := Valid(number); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", number, got, want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := Normalize(" 2 0000-0000-0001 4 "); got != "20000000000014" {
+		t.Errorf("Normalize = %q", got)
+	}
+}
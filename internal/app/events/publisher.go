@@ -0,0 +1,71 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Publisher delivers a domain event to another system. Returning an error makes the relay retry the event later.
+type Publisher interface {
+	Publish(ctx context.Context, event models.Event) error
+}
+
+// LogPublisher writes events to the application log, useful for development
+type LogPublisher struct{}
+
+func (LogPublisher) Publish(_ context.Context, event models.Event) error {
+	log.Printf("event %d %s %s/%d: %s", event.ID, event.Type, event.AggregateType, event.AggregateID, event.Data)
+	return nil
+}
+
+// WebhookPublisher POSTs every event as JSON to a single URL, any non-2xx answer counts as a failed delivery
+type WebhookPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookPublisher(url string, timeout time.Duration) *WebhookPublisher {
+	return &WebhookPublisher{
+		URL:    url,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, event models.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(event.ID, 10))
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(body io.ReadCloser) {
+		_, _ = io.Copy(io.Discard, body)
+		err := body.Close()
+		if err != nil {
+			return
+		}
+	}(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"log"
+	"slices"
+	"time"
+)
+
+// Target is a publisher the relay keeps track of separately, a failing target does not make the others receive an event twice
+type Target struct {
+	Name      string
+	Publisher Publisher
+}
+
+// Relay moves committed events from the outbox to its Targets.
+// Delivery is at least once: an event is retried with exponential backoff for the targets it did not reach yet,
+// after MaxAttempts failed attempts it is marked dead and left in the outbox for inspection.
+type Relay struct {
+	Targets      []Target
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	MaxBackoff   time.Duration
+	// ClaimLease is how long a claimed batch is hidden from other relays, it has to cover publishing the whole batch
+	ClaimLease time.Duration
+}
+
+// Run polls the outbox until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain publishes batches until the outbox has no more due events
+func (r *Relay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := services.ClaimOutbox(r.BatchSize, r.ClaimLease)
+		if !models.IsHttpErrorEmpty(err) {
+			log.Println(err)
+			return
+		}
+
+		published := 0
+		for _, event := range batch {
+			if ctx.Err() != nil {
+				// unpublished events of the batch are claimed again once the lease ran out
+				return
+			}
+			if r.publish(ctx, event) {
+				published++
+			}
+		}
+		// stop on a short batch or when everything failed, failed events wait for their next attempt
+		if len(batch) < r.BatchSize || published == 0 {
+			return
+		}
+	}
+}
+
+// publish hands the event to every target it has not reached yet and records the outcome, it reports whether all targets have it now
+func (r *Relay) publish(ctx context.Context, event models.Event) bool {
+	publishedTo := slices.Clone(event.PublishedTo)
+	var errs []error
+	for _, target := range r.Targets {
+		if slices.Contains(event.PublishedTo, target.Name) {
+			continue
+		}
+		if err := target.Publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+			continue
+		}
+		publishedTo = append(publishedTo, target.Name)
+	}
+	publishErr := errors.Join(errs...)
+	if publishErr != nil {
+		if ctx.Err() != nil {
+			// shutting down is not the event's fault, leave the attempt unrecorded
+			return false
+		}
+		if event.Attempts+1 >= r.MaxAttempts {
+			log.Printf("giving up on event %d (%s) after %d attempts: %v", event.ID, event.Type, event.Attempts+1, publishErr)
+		} else {
+			log.Printf("failed to publish event %d (%s), attempt %d: %v", event.ID, event.Type, event.Attempts+1, publishErr)
+		}
+	}
+
+	if err := services.RecordOutboxAttempt(event, publishedTo, publishErr, r.MaxAttempts, r.backoff); !models.IsHttpErrorEmpty(err) {
+		log.Println(err)
+		return false
+	}
+	return publishErr == nil
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.MaxBackoff)
+}
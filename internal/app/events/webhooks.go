@@ -0,0 +1,138 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Library-Signature"
+	EventHeader     = "X-Library-Event"
+	DeliveryHeader  = "X-Library-Delivery"
+)
+
+// SubscriptionPublisher fans an event out to the webhook subscriptions interested in it.
+// It only queues deliveries, the Dispatcher sends them so a slow partner cannot hold up the outbox.
+type SubscriptionPublisher struct{}
+
+func (SubscriptionPublisher) Publish(_ context.Context, event models.Event) error {
+	if err := services.EnqueueWebhookDeliveries(event); !models.IsHttpErrorEmpty(err) {
+		return errors.New(err.Message)
+	}
+	return nil
+}
+
+// Sign computes the signature header value for a payload sent at the given time.
+// Receivers recompute HMAC-SHA256(secret, "<t>.<body>") and compare it with v1,
+// the timestamp lets them reject old deliveries that are replayed.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Dispatcher sends queued webhook deliveries, retrying failures with exponential backoff
+// and moving deliveries that failed MaxAttempts times to the dead-letter list.
+// Subscription URLs come from API users, so Client should come from helpers.OutboundPolicy.NewHTTPClient.
+type Dispatcher struct {
+	Client       *http.Client
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	MaxBackoff   time.Duration
+	// ClaimLease is how long a claimed batch is hidden from other dispatchers, it has to cover sending the whole batch
+	ClaimLease time.Duration
+}
+
+// Run polls for due deliveries until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := services.ClaimWebhookDeliveries(d.BatchSize, d.ClaimLease)
+		if !models.IsHttpErrorEmpty(err) {
+			log.Println(err)
+			return
+		}
+
+		for _, delivery := range batch {
+			statusCode, deliverErr := d.deliver(ctx, delivery)
+			if deliverErr != nil {
+				if ctx.Err() != nil {
+					// shutting down is not the receiver's fault, the rest of the batch is claimed again once the lease ran out
+					return
+				}
+				log.Printf("webhook delivery %d to subscription %d failed, attempt %d: %v", delivery.ID, delivery.SubscriptionID, delivery.Attempts+1, deliverErr)
+			}
+			if err := services.RecordWebhookDelivery(delivery, statusCode, deliverErr, d.MaxAttempts, d.backoff); !models.IsHttpErrorEmpty(err) {
+				log.Println(err)
+				return
+			}
+		}
+		if len(batch) < d.BatchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func(body io.ReadCloser) {
+		_, _ = io.Copy(io.Discard, body)
+		err := body.Close()
+		if err != nil {
+			return
+		}
+	}(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver answered with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.MaxBackoff)
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/repository/models"
+)
+
+func TestSign(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	body := []byte(`{"id":1}`)
+	got := Sign("secret", timestamp, body)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+	if Sign("other", timestamp, body) == got {
+		t.Error("the signature does not depend on the secret")
+	}
+	if Sign("secret", timestamp.Add(time.Second), body) == got {
+		t.Error("the signature does not depend on the timestamp")
+	}
+}
+
+// localDispatcher sends to receivers on localhost, which only an allowlist lets through
+func localDispatcher() *Dispatcher {
+	policy := helpers.OutboundPolicy{Allowed: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}}
+	return &Dispatcher{Client: policy.NewHTTPClient(5 * time.Second)}
+}
+
+func TestDeliver(t *testing.T) {
+	var redirected bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+
+	var received *http.Request
+	var receivedBody string
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		statusCode int
+		wantErr    bool
+	}{
+		{"2xx succeeds", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }, http.StatusNoContent, false},
+		{"5xx fails", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }, http.StatusInternalServerError, true},
+		{"redirect is not followed", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, target.URL, http.StatusFound) }, http.StatusFound, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received, receivedBody = r, string(body)
+				tt.handler(w, r)
+			}))
+			defer receiver.Close()
+
+			delivery := models.WebhookDelivery{ID: 7, EventType: models.EventBookBorrowed, Payload: []byte(`{"id":1}`), URL: receiver.URL, Secret: "secret"}
+			statusCode, err := localDispatcher().deliver(context.Background(), delivery)
+			if statusCode != tt.statusCode || (err != nil) != tt.wantErr {
+				t.Fatalf("deliver() = %d, %v, want %d and error %v", statusCode, err, tt.statusCode, tt.wantErr)
+			}
+			if receivedBody != `{"id":1}` || received.Header.Get(EventHeader) != models.EventBookBorrowed || received.Header.Get(DeliveryHeader) != "7" {
+				t.Errorf("received body %s and headers %v", receivedBody, received.Header)
+			}
+			signature := received.Header.Get(SignatureHeader)
+			timestamp, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil || Sign("secret", time.Unix(unix, 0), delivery.Payload) != signature {
+				t.Errorf("signature %q does not verify", signature)
+			}
+		})
+	}
+	if redirected {
+		t.Error("the redirect target was requested")
+	}
+}
+
+func TestDeliverRefusesPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the receiver on localhost was reached")
+	}))
+	defer receiver.Close()
+
+	dispatcher := &Dispatcher{Client: helpers.OutboundPolicy{}.NewHTTPClient(5 * time.Second)}
+	delivery := models.WebhookDelivery{ID: 1, Payload: []byte(`{}`), URL: receiver.URL, Secret: "secret"}
+	if _, err := dispatcher.deliver(context.Background(), delivery); err == nil {
+		t.Error("deliver() to localhost succeeded without an allowlist")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := &Dispatcher{MaxBackoff: time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{20, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := dispatcher.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package graphql serves users, books and borrows as a GraphQL schema next to the REST API.
+// Resolvers go through the services package and batch their lookups per request, so a query
+// for many users and their loans costs one database query per level instead of one per row.
+package graphql
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	gographql "github.com/graph-gophers/graphql-go"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"strconv"
+)
+
+// maxDepth limits the nesting of a query, e.g. users { loans { user { loans ... } } }
+const maxDepth = 8
+
+//go:embed schema.graphql
+var schemaSource string
+
+var schema = gographql.MustParseSchema(schemaSource, &resolver{}, gographql.MaxDepth(maxDepth))
+
+// Execute runs a query or mutation, failures are reported in the errors of the response
+func Execute(ctx context.Context, request models.GraphQLRequest) *gographql.Response {
+	return schema.Exec(withLoaders(ctx), request.Query, request.OperationName, request.Variables)
+}
+
+// resolverError carries the status code of a service error as the code extension of a GraphQL error
+type resolverError struct {
+	httpErr models.HttpError
+}
+
+func (e resolverError) Error() string {
+	return e.httpErr.Message
+}
+
+func (e resolverError) Extensions() map[string]any {
+	return map[string]any{"code": e.httpErr.StatusCode}
+}
+
+func toError(httpErr models.HttpError) error {
+	if models.IsHttpErrorEmpty(httpErr) {
+		return nil
+	}
+	return resolverError{httpErr: httpErr}
+}
+
+func parseId(id gographql.ID) (int, error) {
+	value, err := strconv.Atoi(string(id))
+	if err != nil || value <= 0 {
+		return 0, toError(models.NewHttpError(fmt.Sprintf("invalid ID %q", id), http.StatusBadRequest))
+	}
+	return value, nil
+}
+
+func toId(id int) gographql.ID {
+	return gographql.ID(strconv.Itoa(id))
+}
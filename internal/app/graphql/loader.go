@@ -0,0 +1,138 @@
+package graphql
+
+import (
+	"context"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"sync"
+	"time"
+)
+
+// batchWait is how long a loader collects IDs before fetching them. Sibling fields and list items are resolved
+// concurrently, so the IDs requested by all of them within the window are fetched with a single query.
+const batchWait = 2 * time.Millisecond
+
+// loader batches lookups by ID and caches the results for the rest of the request
+type loader[V any] struct {
+	fetch func(ids []int) (map[int]V, models.HttpError)
+
+	mu      sync.Mutex
+	results map[int]*result[V]
+	pending []int
+}
+
+type result[V any] struct {
+	done  chan struct{}
+	value V
+	found bool
+	err   models.HttpError
+}
+
+func newLoader[V any](fetch func(ids []int) (map[int]V, models.HttpError)) *loader[V] {
+	return &loader[V]{fetch: fetch, results: make(map[int]*result[V])}
+}
+
+// prime adds IDs to the next batch without waiting for them, resolvers call it with the IDs
+// their child fields are about to load so they are fetched together
+func (l *loader[V]) prime(ids ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		l.enqueue(id)
+	}
+}
+
+// load returns the value for the ID and whether it exists
+func (l *loader[V]) load(id int) (V, bool, models.HttpError) {
+	l.mu.Lock()
+	r := l.enqueue(id)
+	l.mu.Unlock()
+	<-r.done
+	return r.value, r.found, r.err
+}
+
+// enqueue must be called with mu held
+func (l *loader[V]) enqueue(id int) *result[V] {
+	if r, ok := l.results[id]; ok {
+		return r
+	}
+	r := &result[V]{done: make(chan struct{})}
+	l.results[id] = r
+	l.pending = append(l.pending, id)
+	if len(l.pending) == 1 {
+		go l.dispatch()
+	}
+	return r
+}
+
+func (l *loader[V]) dispatch() {
+	time.Sleep(batchWait)
+	l.mu.Lock()
+	ids := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	values, err := l.fetch(ids)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		r := l.results[id]
+		r.value, r.found = values[id]
+		r.err = err
+		close(r.done)
+	}
+}
+
+// loaders are created for every request, so nothing is cached between requests
+type loaders struct {
+	users *loader[models.User]
+	books *loader[models.BookResponse]
+	// loans are the open borrows by user ID
+	loans *loader[[]models.Borrow]
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		users: newLoader(fetchUsers),
+		books: newLoader(fetchBooks),
+		loans: newLoader(fetchLoans),
+	})
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+func fetchUsers(ids []int) (map[int]models.User, models.HttpError) {
+	users, err := services.GetUsersByIds(ids)
+	byId := make(map[int]models.User, len(users))
+	for _, user := range users {
+		byId[user.ID] = user
+	}
+	return byId, err
+}
+
+func fetchBooks(ids []int) (map[int]models.BookResponse, models.HttpError) {
+	books, err := services.GetBooksByIds(ids)
+	byId := make(map[int]models.BookResponse, len(books))
+	for _, book := range books {
+		byId[book.ID] = book
+	}
+	return byId, err
+}
+
+// fetchLoans finds every requested user, users without open borrows get an empty list
+func fetchLoans(userIds []int) (map[int][]models.Borrow, models.HttpError) {
+	borrows, err := services.GetOpenBorrows(userIds)
+	byUser := make(map[int][]models.Borrow, len(userIds))
+	for _, id := range userIds {
+		byUser[id] = []models.Borrow{}
+	}
+	for _, borrow := range borrows {
+		byUser[borrow.UserID] = append(byUser[borrow.UserID], borrow)
+	}
+	return byUser, err
+}
@@ -0,0 +1,305 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	gographql "github.com/graph-gophers/graphql-go"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+)
+
+type resolver struct{}
+
+func (*resolver) User(ctx context.Context, args struct{ ID gographql.ID }) (*userResolver, error) {
+	id, err := parseId(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	user, found, httpErr := loadersFrom(ctx).users.load(id)
+	if !found {
+		return nil, toError(httpErr)
+	}
+	return &userResolver{user: user}, nil
+}
+
+func (*resolver) Users(ctx context.Context) ([]*userResolver, error) {
+	users, httpErr := services.GetUsers()
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, toError(httpErr)
+	}
+	resolvers := make([]*userResolver, len(users))
+	ids := make([]int, len(users))
+	for i, user := range users {
+		resolvers[i] = &userResolver{user: user}
+		ids[i] = user.ID
+	}
+	if gographql.HasSelectedField(ctx, "loans") {
+		loadersFrom(ctx).loans.prime(ids...)
+	}
+	return resolvers, nil
+}
+
+func (*resolver) Book(ctx context.Context, args struct{ ID gographql.ID }) (*bookResolver, error) {
+	id, err := parseId(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	book, found, httpErr := loadersFrom(ctx).books.load(id)
+	if !found {
+		return nil, toError(httpErr)
+	}
+	return &bookResolver{book: book}, nil
+}
+
+func (*resolver) Books() ([]*bookResolver, error) {
+	books, httpErr := services.GetBooks()
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, toError(httpErr)
+	}
+	resolvers := make([]*bookResolver, len(books))
+	for i, book := range books {
+		resolvers[i] = &bookResolver{book: book}
+	}
+	return resolvers, nil
+}
+
+type createUserInput struct {
+	FirstName   string
+	LastName    string
+	Email       *string
+	Phone       *string
+	Locale      *string
+	NotifyEmail *bool
+	NotifySms   *bool
+	Category    *string
+	// DateOfBirth and the membership dates are YYYY-MM-DD
+	DateOfBirth       *string
+	Address           *string
+	MembershipStarts  *string
+	MembershipExpires *string
+}
+
+func (*resolver) CreateUser(ctx context.Context, args struct{ Input createUserInput }) (*userResolver, error) {
+	input := args.Input
+	if input.FirstName == "" || input.LastName == "" {
+		return nil, toError(models.NewHttpError("firstName and lastName are required", http.StatusBadRequest))
+	}
+	user := models.User{FirstName: input.FirstName, LastName: input.LastName}
+	if input.Email != nil {
+		user.Email = *input.Email
+	}
+	if input.Phone != nil {
+		user.Phone = *input.Phone
+	}
+	if input.Locale != nil {
+		user.Locale = *input.Locale
+	}
+	if input.NotifyEmail != nil {
+		user.NotifyEmail = *input.NotifyEmail
+	}
+	if input.NotifySms != nil {
+		user.NotifySMS = *input.NotifySms
+	}
+	if input.Category != nil {
+		user.Category = *input.Category
+	}
+	if input.DateOfBirth != nil {
+		user.DateOfBirth = *input.DateOfBirth
+	}
+	if input.Address != nil {
+		user.Address = *input.Address
+	}
+	if input.MembershipStarts != nil {
+		user.MembershipStarts = *input.MembershipStarts
+	}
+	if input.MembershipExpires != nil {
+		user.MembershipExpires = *input.MembershipExpires
+	}
+	user, httpErr := services.CreateUser(user, helpers.ActorFromContext(ctx))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, toError(httpErr)
+	}
+	return &userResolver{user: user}, nil
+}
+
+type loanArgs struct {
+	UserId gographql.ID
+	BookId gographql.ID
+}
+
+func (a loanArgs) ids() (int, int, error) {
+	userId, err := parseId(a.UserId)
+	if err != nil {
+		return 0, 0, err
+	}
+	bookId, err := parseId(a.BookId)
+	return userId, bookId, err
+}
+
+func (*resolver) BorrowBook(ctx context.Context, args loanArgs) (*borrowResolver, error) {
+	userId, bookId, err := args.ids()
+	if err != nil {
+		return nil, err
+	}
+	borrow, httpErr := services.BorrowBook(userId, bookId, helpers.ActorFromContext(ctx))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, toError(httpErr)
+	}
+	return &borrowResolver{borrow: borrow}, nil
+}
+
+type returnArgs struct {
+	loanArgs
+	Damaged bool
+}
+
+func (*resolver) ReturnBook(ctx context.Context, args returnArgs) (*borrowResolver, error) {
+	userId, bookId, err := args.ids()
+	if err != nil {
+		return nil, err
+	}
+	borrow, httpErr := services.ReturnBook(userId, bookId, args.Damaged, helpers.ActorFromContext(ctx))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, toError(httpErr)
+	}
+	return &borrowResolver{borrow: borrow}, nil
+}
+
+type userResolver struct {
+	user models.User
+}
+
+func (r *userResolver) ID() gographql.ID           { return toId(r.user.ID) }
+func (r *userResolver) FirstName() string          { return r.user.FirstName }
+func (r *userResolver) LastName() string           { return r.user.LastName }
+func (r *userResolver) Email() *string             { return optional(r.user.Email) }
+func (r *userResolver) Phone() *string             { return optional(r.user.Phone) }
+func (r *userResolver) Locale() string             { return r.user.Locale }
+func (r *userResolver) NotifyEmail() bool          { return r.user.NotifyEmail }
+func (r *userResolver) NotifySms() bool            { return r.user.NotifySMS }
+func (r *userResolver) Category() string           { return r.user.Category }
+func (r *userResolver) CardNumber() *string        { return optional(r.user.CardNumber) }
+func (r *userResolver) DateOfBirth() *string       { return optional(r.user.DateOfBirth) }
+func (r *userResolver) Address() *string           { return optional(r.user.Address) }
+func (r *userResolver) MembershipStarts() *string  { return optional(r.user.MembershipStarts) }
+func (r *userResolver) MembershipExpires() *string { return optional(r.user.MembershipExpires) }
+
+func (r *userResolver) Loans(ctx context.Context) ([]*borrowResolver, error) {
+	borrows, _, httpErr := loadersFrom(ctx).loans.load(r.user.ID)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, toError(httpErr)
+	}
+	return borrowResolvers(ctx, borrows), nil
+}
+
+type bookResolver struct {
+	book models.BookResponse
+}
+
+func (r *bookResolver) ID() gographql.ID         { return toId(r.book.ID) }
+func (r *bookResolver) Title() string            { return r.book.Title }
+func (r *bookResolver) Available() int32         { return int32(r.book.AvailableCount) }
+func (r *bookResolver) Isbn() *string            { return optional(r.book.ISBN) }
+func (r *bookResolver) Authors() []string        { return nonNil(r.book.Authors) }
+func (r *bookResolver) Publisher() *string       { return optional(r.book.Publisher) }
+func (r *bookResolver) PublicationDate() *string { return optional(r.book.PublicationDate) }
+func (r *bookResolver) Subjects() []string       { return nonNil(r.book.Subjects) }
+
+type borrowResolver struct {
+	borrow models.Borrow
+}
+
+// borrowResolvers primes the user and book loaders with the IDs the borrows refer to, if they are selected
+func borrowResolvers(ctx context.Context, borrows []models.Borrow) []*borrowResolver {
+	resolvers := make([]*borrowResolver, len(borrows))
+	userIds := make([]int, len(borrows))
+	bookIds := make([]int, len(borrows))
+	for i, borrow := range borrows {
+		resolvers[i] = &borrowResolver{borrow: borrow}
+		userIds[i] = borrow.UserID
+		bookIds[i] = borrow.BookID
+	}
+	if gographql.HasSelectedField(ctx, "user") {
+		loadersFrom(ctx).users.prime(userIds...)
+	}
+	if gographql.HasSelectedField(ctx, "book") {
+		loadersFrom(ctx).books.prime(bookIds...)
+	}
+	return resolvers
+}
+
+func (r *borrowResolver) ID() gographql.ID { return toId(r.borrow.ID) }
+
+func (r *borrowResolver) User(ctx context.Context) (*userResolver, error) {
+	user, found, httpErr := loadersFrom(ctx).users.load(r.borrow.UserID)
+	if !found {
+		return nil, notFound(httpErr, "user", r.borrow.UserID)
+	}
+	return &userResolver{user: user}, nil
+}
+
+func (r *borrowResolver) Book(ctx context.Context) (*bookResolver, error) {
+	book, found, httpErr := loadersFrom(ctx).books.load(r.borrow.BookID)
+	if !found {
+		return nil, notFound(httpErr, "book", r.borrow.BookID)
+	}
+	return &bookResolver{book: book}, nil
+}
+
+func (r *borrowResolver) BorrowedAt() gographql.Time {
+	return gographql.Time{Time: r.borrow.BorrowedAt}
+}
+
+func (r *borrowResolver) DueAt() *gographql.Time {
+	if r.borrow.DueAt == nil {
+		return nil
+	}
+	return &gographql.Time{Time: *r.borrow.DueAt}
+}
+
+func (r *borrowResolver) ReturnedAt() *gographql.Time {
+	if r.borrow.ReturnedAt == nil {
+		return nil
+	}
+	return &gographql.Time{Time: *r.borrow.ReturnedAt}
+}
+
+func (r *borrowResolver) Damaged() bool { return r.borrow.Damaged }
+
+func (r *borrowResolver) LostAt() *gographql.Time {
+	if r.borrow.LostAt == nil {
+		return nil
+	}
+	return &gographql.Time{Time: *r.borrow.LostAt}
+}
+
+func (r *borrowResolver) FoundAt() *gographql.Time {
+	if r.borrow.FoundAt == nil {
+		return nil
+	}
+	return &gographql.Time{Time: *r.borrow.FoundAt}
+}
+
+// notFound reports a missing user or book that a borrow refers to, or the error that prevented loading it
+func notFound(httpErr models.HttpError, kind string, id int) error {
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return toError(httpErr)
+	}
+	return toError(models.NewHttpError(fmt.Sprintf("%s with ID %d not found", kind, id), http.StatusNotFound))
+}
+
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// GetAuditLog godoc
+// @Summary Get the audit log
+// @Description Get audit entries of state-changing operations, newest first. Page backwards by passing the lowest ID received as before_id.
+// @Tags admin
+// @Produce json
+// @Param actor query string false "Actor, cert:<common name> or anonymous"
+// @Param claimed_actor query string false "Unverified actor claimed in the X-Actor header"
+// @Param action query string false "Action" Enums(user.create, user.update, user.card, book.create, book.update, book.borrow, book.return, book.renew, book.lost, book.found, book.repair, webhook.create, webhook.delete, webhook.redeliver, job.run, backup.restore)
+// @Param target_type query string false "Target type" Enums(user, book, borrow, webhook, job, backup)
+// @Param target_id query int false "Target ID"
+// @Param user_id query int false "Entries about the user, including their borrows and returns"
+// @Param book_id query int false "Entries about the book, including its borrows and returns"
+// @Param request_id query string false "X-Request-ID of the request that made the change"
+// @Param from query string false "Earliest time, RFC 3339" example(2024-01-01T00:00:00Z)
+// @Param to query string false "Time before which entries occurred, RFC 3339"
+// @Param before_id query int false "Only entries with a lower ID"
+// @Param limit query int false "Maximum number of entries, 100 by default, at most 1000"
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /admin/audit [get]
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, httpErr := auditFilter(r.URL.Query())
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	entries, httpErr := services.GetAuditEntries(filter)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	if len(entries) == 0 {
+		entries = []models.AuditEntry{}
+	}
+	err := json.NewEncoder(w).Encode(entries)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func auditFilter(query url.Values) (models.AuditFilter, models.HttpError) {
+	filter := models.AuditFilter{
+		Actor:        query.Get("actor"),
+		ClaimedActor: query.Get("claimed_actor"),
+		Action:       query.Get("action"),
+		TargetType:   query.Get("target_type"),
+		RequestID:    query.Get("request_id"),
+	}
+	ints := map[string]*int{
+		"target_id": &filter.TargetID,
+		"user_id":   &filter.UserID,
+		"book_id":   &filter.BookID,
+		"limit":     &filter.Limit,
+	}
+	for name, field := range ints {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return filter, models.NewHttpError(fmt.Sprintf("%s must be a number", name), http.StatusBadRequest)
+			}
+			*field = parsed
+		}
+	}
+	if value := query.Get("before_id"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, models.NewHttpError("before_id must be a number", http.StatusBadRequest)
+		}
+		filter.BeforeID = parsed
+	}
+	times := map[string]**time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	}
+	for name, field := range times {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, models.NewHttpError(fmt.Sprintf("%s must be an RFC 3339 time, e.g. 2024-01-01T00:00:00Z", name), http.StatusBadRequest)
+			}
+			*field = &parsed
+		}
+	}
+	return filter, models.NewEmptyHttpError()
+}
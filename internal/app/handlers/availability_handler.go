@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/spin311/library-api/internal/app/availability"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamBookAvailability godoc
+// @Summary Stream the availability of a book
+// @Description Server-Sent Events stream of the copies of a book available to borrow. The current availability is sent first,
+// @Description then an "availability" event whenever a borrow, return or update changes it. Idle streams send a comment every 15 seconds.
+// @Tags books
+// @Produce text/event-stream
+// @Param bookId path int true "Book ID" example(1)
+// @Success 200 {object} models.BookAvailability "availability events"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /books/{bookId}/availability/stream [get]
+func StreamBookAvailability(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["bookId"])
+	if err != nil || id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	streamAvailability(w, r, []int{id})
+}
+
+// StreamAvailability godoc
+// @Summary Stream the availability of several books
+// @Description Server-Sent Events stream of the copies available to borrow for each of the books, for kiosks showing a shelf.
+// @Description The current availability of every book is sent first, then an "availability" event whenever one of them changes.
+// @Tags books
+// @Produce text/event-stream
+// @Param ids query string true "Comma separated book IDs, at most 100" example(1,2,3)
+// @Success 200 {object} models.BookAvailability "availability events"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /books/availability/stream [get]
+func StreamAvailability(w http.ResponseWriter, r *http.Request) {
+	var ids []int
+	for _, value := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			helpers.WriteHttpErrorResponse(w, models.NewHttpError(fmt.Sprintf("invalid book ID %q", value), http.StatusBadRequest))
+			return
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("ids is required", http.StatusBadRequest))
+		return
+	}
+	if maxBooks := availability.StreamOptions().MaxBooks; len(ids) > maxBooks {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError(fmt.Sprintf("a stream can follow at most %d books", maxBooks), http.StatusBadRequest))
+		return
+	}
+	streamAvailability(w, r, ids)
+}
+
+// streamAvailability sends the current availability of the books and then every change until the client disconnects
+// or the server shuts down
+func streamAvailability(w http.ResponseWriter, r *http.Request, ids []int) {
+	// subscribe before reading the books so no change falls in between, versions drop what the first read already had
+	subscription := availability.Subscribe(ids)
+	defer subscription.Close()
+
+	books, httpErr := services.GetBooksByIds(ids)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	if len(books) < len(ids) {
+		var missing []string
+		for _, id := range ids {
+			if !slices.ContainsFunc(books, func(book models.BookResponse) bool { return book.ID == id }) {
+				missing = append(missing, strconv.Itoa(id))
+			}
+		}
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError(fmt.Sprintf("books with IDs %s not found", strings.Join(missing, ", ")), http.StatusNotFound))
+		return
+	}
+
+	// streams outlive the server write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	versions := map[int]int{}
+	send := func(update models.BookAvailability) error {
+		if update.Version <= versions[update.BookID] {
+			return nil
+		}
+		versions[update.BookID] = update.Version
+		data, err := json.Marshal(update)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: availability\ndata: %s\n\n", data)
+		return err
+	}
+	slices.SortFunc(books, func(a, b models.BookResponse) int { return a.ID - b.ID })
+	for _, book := range books {
+		if send(models.NewBookAvailability(book)) != nil {
+			return
+		}
+	}
+	if controller.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(availability.StreamOptions().Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case _, ok := <-subscription.Ready():
+			if !ok {
+				return
+			}
+			for _, update := range subscription.Next() {
+				if send(update) != nil {
+					return
+				}
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		if controller.Flush() != nil {
+			return
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/marc"
 	"github.com/spin311/library-api/internal/app/services"
 	"github.com/spin311/library-api/internal/repository/models"
+	"io"
 	"net/http"
 	"strconv"
 )
@@ -17,7 +20,10 @@ import (
 // @Tags books
 // @Produce json
 // @Param bookId path int true "Book ID" example(1)
+// @Param If-None-Match header string false "ETag from a previous response"
 // @Success 200 {object} models.BookResponse
+// @Header 200 {string} ETag "Version of the book"
+// @Success 304 "Book has not changed"
 // @Failure 400 {object} models.HttpError
 // @Failure 404 {object} models.HttpError
 // @Failure 500 {object} models.HttpError
@@ -33,12 +39,142 @@ func GetBook(w http.ResponseWriter, r *http.Request) {
 		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
 		return
 	}
-	user, httpError := services.GetBook(id)
+	book, httpError := services.GetBook(id)
 	if !models.IsHttpErrorEmpty(httpError) {
 		helpers.WriteHttpErrorResponse(w, httpError)
 		return
 	}
-	jsonErr := json.NewEncoder(w).Encode(user)
+	etag := helpers.ETag(book.Version)
+	if helpers.NotModified(r, etag) {
+		helpers.WriteNotModified(w, etag)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	jsonErr := json.NewEncoder(w).Encode(book)
+	if jsonErr != nil {
+		helpers.WriteErrorResponse(w, jsonErr, http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetBookMARC godoc
+// @Summary Export a book as MARC 21
+// @Description Export the catalog record of a book in the MARC 21 binary exchange format (ISO 2709, UTF-8)
+// @Tags books
+// @Produce application/marc
+// @Param bookId path int true "Book ID" example(1)
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {file} file
+// @Header 200 {string} ETag "Version of the book"
+// @Success 304 "Book has not changed"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /books/{bookId}.mrc [get]
+func GetBookMARC(w http.ResponseWriter, r *http.Request) {
+	exportBook(w, r, "application/marc", marc.WriteBinary)
+}
+
+// GetBookMARCXML godoc
+// @Summary Export a book as MARCXML
+// @Description Export the catalog record of a book as a MARCXML collection with one record
+// @Tags books
+// @Produce application/marcxml+xml
+// @Param bookId path int true "Book ID" example(1)
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {file} file
+// @Header 200 {string} ETag "Version of the book"
+// @Success 304 "Book has not changed"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /books/{bookId}.xml [get]
+func GetBookMARCXML(w http.ResponseWriter, r *http.Request) {
+	exportBook(w, r, "application/marcxml+xml; charset=utf-8", marc.WriteXML)
+}
+
+func exportBook(w http.ResponseWriter, r *http.Request, contentType string, write func(io.Writer, ...marc.Record) error) {
+	id, err := strconv.Atoi(mux.Vars(r)["bookId"])
+	if err != nil || id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	book, httpErr := services.GetCatalogBook(id)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	etag := helpers.ETag(book.Version)
+	if helpers.NotModified(r, etag) {
+		helpers.WriteNotModified(w, etag)
+		return
+	}
+	// encode first so a record that cannot be written is still answered with an error
+	var body bytes.Buffer
+	if err := write(&body, marc.FromBook(book)); err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(body.Bytes())
+}
+
+// UpdateBook godoc
+// @Summary Update a book
+// @Description Update the title and quantity of a book, the If-Match header must hold the ETag from GetBook
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param bookId path int true "Book ID" example(1)
+// @Param If-Match header string true "ETag of the book"
+// @Param book body models.BookRequest true "Book object"
+// @Success 200 {object} models.BookResponse
+// @Header 200 {string} ETag "New version of the book"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 409 {object} models.HttpError
+// @Failure 412 {object} models.HttpError
+// @Failure 428 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /books/{bookId} [put]
+func UpdateBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["bookId"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	version, httpErr := helpers.IfMatchVersion(r)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	var request models.BookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if request.Title == "" || request.Quantity < 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("title is required and quantity must not be negative", http.StatusBadRequest))
+		return
+	}
+	if request.AgeRating < 0 || request.AgeRating > 21 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("age_rating must be between 0 and 21", http.StatusBadRequest))
+		return
+	}
+
+	book, httpErr := services.UpdateBook(id, request, version, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	w.Header().Set("ETag", helpers.ETag(book.Version))
+	jsonErr := json.NewEncoder(w).Encode(book)
 	if jsonErr != nil {
 		helpers.WriteErrorResponse(w, jsonErr, http.StatusInternalServerError)
 		return
@@ -71,15 +207,20 @@ func GetBooks(w http.ResponseWriter, _ *http.Request) {
 
 // BorrowBook godoc
 // @Summary Borrow a book
-// @Description Borrow a book by user ID and book ID
+// @Description Borrow a book by user ID and book ID. The loan period and limits follow the user's category.
+// @Description Broken rules are reported with the Code LOAN_LIMIT_REACHED, REFERENCE_ONLY or AGE_RESTRICTED.
 // @Tags books
 // @Accept json
 // @Produce json
 // @Param userId path int true "User ID" example(5)
 // @Param bookId path int true "Book ID" example(1)
+// @Param Idempotency-Key header string false "Unique key to safely retry the request"
 // @Success 200 {string} string "book borrowed successfully"
 // @Failure 400 {object} models.HttpError
+// @Failure 403 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
 // @Failure 409 {object} models.HttpError
+// @Failure 422 {object} models.HttpError
 // @Failure 500 {object} models.HttpError
 // @Router /users/{userId}/books/{bookId}/borrow [post]
 func BorrowBook(w http.ResponseWriter, r *http.Request) {
@@ -94,7 +235,7 @@ func BorrowBook(w http.ResponseWriter, r *http.Request) {
 		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier values", http.StatusBadRequest))
 		return
 	}
-	err := services.BorrowBook(userId, bookId)
+	_, err := services.BorrowBook(userId, bookId, helpers.Actor(r))
 	if !models.IsHttpErrorEmpty(err) {
 		helpers.WriteHttpErrorResponse(w, err)
 		return
@@ -108,14 +249,20 @@ func BorrowBook(w http.ResponseWriter, r *http.Request) {
 
 // ReturnBook godoc
 // @Summary Return a book
-// @Description Return a book by user ID and book ID
+// @Description Return a book by user ID and book ID.
+// @Description A copy returned damaged is withdrawn from the book's quantity and the replacement fee is charged to the user.
 // @Tags books
 // @Accept json
 // @Produce json
 // @Param userId path int true "User ID" example(5)
 // @Param bookId path int true "Book ID" example(1)
+// @Param damaged query bool false "The copy was returned damaged"
+// @Param Idempotency-Key header string false "Unique key to safely retry the request"
 // @Success 200 {string} string "book returned successfully"
 // @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 409 {object} models.HttpError
+// @Failure 422 {object} models.HttpError
 // @Failure 500 {object} models.HttpError
 // @Router /users/{userId}/books/{bookId}/return [put]
 func ReturnBook(w http.ResponseWriter, r *http.Request) {
@@ -130,7 +277,16 @@ func ReturnBook(w http.ResponseWriter, r *http.Request) {
 		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier values", http.StatusBadRequest))
 		return
 	}
-	httpError := services.ReturnBook(userId, bookId)
+	damaged := false
+	if value := r.URL.Query().Get("damaged"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			helpers.WriteHttpErrorResponse(w, models.NewHttpError("damaged must be true or false", http.StatusBadRequest))
+			return
+		}
+		damaged = parsed
+	}
+	_, httpError := services.ReturnBook(userId, bookId, damaged, helpers.Actor(r))
 	if !models.IsHttpErrorEmpty(httpError) {
 		helpers.WriteHttpErrorResponse(w, httpError)
 		return
@@ -141,3 +297,43 @@ func ReturnBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// RenewBook godoc
+// @Summary Renew a loan
+// @Description Extend the user's loan of a book by the loan period of the user's category, counted from the due date or from now when overdue.
+// @Description Each category allows a number of renewals per loan, when they are used up the Code is RENEWAL_LIMIT_REACHED.
+// @Tags books
+// @Produce json
+// @Param userId path int true "User ID" example(5)
+// @Param bookId path int true "Book ID" example(1)
+// @Param Idempotency-Key header string false "Unique key to safely retry the request"
+// @Success 200 {object} models.Borrow
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 409 {object} models.HttpError
+// @Failure 422 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /users/{userId}/books/{bookId}/renew [put]
+func RenewBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bookId, bookErr := strconv.Atoi(vars["bookId"])
+	userId, userErr := strconv.Atoi(vars["userId"])
+	if userErr != nil || bookErr != nil {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid userId or bookId parameter", http.StatusBadRequest))
+		return
+	}
+	if userId <= 0 || bookId <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier values", http.StatusBadRequest))
+		return
+	}
+	borrow, httpError := services.RenewBook(userId, bookId, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpError) {
+		helpers.WriteHttpErrorResponse(w, httpError)
+		return
+	}
+	jsonError := json.NewEncoder(w).Encode(borrow)
+	if jsonError != nil {
+		helpers.WriteErrorResponse(w, jsonError, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"strconv"
+)
+
+// MarkBorrowLost godoc
+// @Summary Report a borrowed copy lost
+// @Description Close an open loan whose copy the patron lost. The copy is withdrawn from the book's quantity and the replacement fee is charged to the user.
+// @Description A loan that is already closed is answered with the Code LOAN_CLOSED.
+// @Tags borrows
+// @Produce json
+// @Param borrowId path int true "Borrow ID" example(12)
+// @Param Idempotency-Key header string false "Unique key to safely retry the request"
+// @Success 200 {object} models.LossResponse
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 409 {object} models.HttpError
+// @Failure 422 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /borrows/{borrowId}/lost [post]
+func MarkBorrowLost(w http.ResponseWriter, r *http.Request) {
+	writeLoss(w, r, services.MarkBorrowLost)
+}
+
+// MarkBorrowFound godoc
+// @Summary Report a lost copy found
+// @Description Put the copy of a loan reported lost back into the book's quantity and waive its replacement fee.
+// @Description A loan whose copy is not lost is answered with the Code NOT_LOST.
+// @Tags borrows
+// @Produce json
+// @Param borrowId path int true "Borrow ID" example(12)
+// @Param Idempotency-Key header string false "Unique key to safely retry the request"
+// @Success 200 {object} models.LossResponse
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 409 {object} models.HttpError
+// @Failure 422 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /borrows/{borrowId}/found [post]
+func MarkBorrowFound(w http.ResponseWriter, r *http.Request) {
+	writeLoss(w, r, services.MarkBorrowFound)
+}
+
+func writeLoss(w http.ResponseWriter, r *http.Request, mark func(borrowId int, actor models.Actor) (models.LossResponse, models.HttpError)) {
+	id, err := strconv.Atoi(mux.Vars(r)["borrowId"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	loss, httpErr := mark(id, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	err = json.NewEncoder(w).Encode(loss)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetUserCharges godoc
+// @Summary Get the charges of a user
+// @Description Get the replacement fees charged to a user for lost and damaged copies, newest first. Amounts are in cents.
+// @Tags users
+// @Produce json
+// @Param userId path int true "User ID" example(5)
+// @Success 200 {array} models.Charge
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /users/{userId}/charges [get]
+func GetUserCharges(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	charges, httpErr := services.GetCharges(id)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	if len(charges) == 0 {
+		charges = []models.Charge{}
+	}
+	err = json.NewEncoder(w).Encode(charges)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+)
+
+// CheckConsistency godoc
+// @Summary Check borrowed counts
+// @Description Compare the borrowed count of every book with its open borrows and list the books where they differ
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.ConsistencyReport
+// @Failure 500 {object} models.HttpError
+// @Router /admin/fsck [get]
+func CheckConsistency(w http.ResponseWriter, r *http.Request) {
+	writeConsistencyReport(w, r, false)
+}
+
+// RepairConsistency godoc
+// @Summary Repair borrowed counts
+// @Description Set the borrowed count of every mismatched book to its open borrows in a single transaction. Books with more open borrows than copies are reported without a change.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.ConsistencyReport
+// @Failure 500 {object} models.HttpError
+// @Router /admin/fsck/repair [post]
+func RepairConsistency(w http.ResponseWriter, r *http.Request) {
+	writeConsistencyReport(w, r, true)
+}
+
+func writeConsistencyReport(w http.ResponseWriter, r *http.Request, repair bool) {
+	report, httpErr := services.CheckConsistency(repair, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
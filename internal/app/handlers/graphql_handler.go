@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/spin311/library-api/internal/app/graphql"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+)
+
+// GraphQL godoc
+// @Summary Run a GraphQL query or mutation
+// @Description Query users with their current loans and books with their availability, or borrow and return books and create users. The schema is in internal/app/graphql/schema.graphql. Errors are reported in the errors of the response, with the HTTP status code the REST API would use in extensions.code.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param request body models.GraphQLRequest true "GraphQL request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.HttpError
+// @Router /graphql [post]
+func GraphQL(w http.ResponseWriter, r *http.Request) {
+	var request models.GraphQLRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if request.Query == "" {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("query is required", http.StatusBadRequest))
+		return
+	}
+	response := graphql.Execute(r.Context(), request)
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
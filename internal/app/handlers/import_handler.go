@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/imports"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// ImportBooks godoc
+// @Summary Import books in bulk
+// @Description Import books from a CSV file with the header title,quantity, from NDJSON with one {"title": ..., "quantity": ...} object per line,
+// @Description or from MARC 21 records (binary or MARCXML), which add one copy of every book with its ISBN, authors, publisher, publication date and subjects.
+// @Description Every row is validated first, if any row is invalid nothing is imported and the import is answered with 422 and the row errors.
+// @Description Small files are imported within the request in one transaction, larger ones are queued and answered with 202, poll the Location header for progress.
+// @Description Queued imports commit in batches of imports.batch_size rows, one that fails after validation keeps the batches counted in processed_rows.
+// @Tags imports
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Accept application/marc
+// @Accept application/marcxml+xml
+// @Produce json
+// @Param format query string false "File format, taken from the Content-Type header by default" Enums(csv, ndjson, marc, marcxml)
+// @Param dry_run query bool false "Only validate the file"
+// @Success 201 {object} models.Import
+// @Success 202 {object} models.Import
+// @Failure 400 {object} models.HttpError
+// @Failure 413 {object} models.HttpError
+// @Failure 415 {object} models.HttpError
+// @Failure 422 {object} models.Import
+// @Failure 500 {object} models.HttpError
+// @Router /imports/books [post]
+func ImportBooks(w http.ResponseWriter, r *http.Request) {
+	startImport(w, r, models.ImportBooks)
+}
+
+// ImportUsers godoc
+// @Summary Import users in bulk
+// @Description Import users from a CSV file or NDJSON with the fields first_name, last_name and optionally email, phone, locale, notify_email and notify_sms.
+// @Description Every row is validated first, if any row is invalid nothing is imported and the import is answered with 422 and the row errors.
+// @Description Small files are imported within the request in one transaction, larger ones are queued and answered with 202, poll the Location header for progress.
+// @Description Queued imports commit in batches of imports.batch_size rows, one that fails after validation keeps the batches counted in processed_rows.
+// @Tags imports
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "File format, taken from the Content-Type header by default" Enums(csv, ndjson)
+// @Param dry_run query bool false "Only validate the file"
+// @Success 201 {object} models.Import
+// @Success 202 {object} models.Import
+// @Failure 400 {object} models.HttpError
+// @Failure 413 {object} models.HttpError
+// @Failure 415 {object} models.HttpError
+// @Failure 422 {object} models.Import
+// @Failure 500 {object} models.HttpError
+// @Router /imports/users [post]
+func ImportUsers(w http.ResponseWriter, r *http.Request) {
+	startImport(w, r, models.ImportUsers)
+}
+
+func startImport(w http.ResponseWriter, r *http.Request, kind string) {
+	format, httpErr := importFormat(r)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			helpers.WriteHttpErrorResponse(w, models.NewHttpError("dry_run must be true or false", http.StatusBadRequest))
+			return
+		}
+		dryRun = parsed
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, imports.MaxBytes()))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			helpers.WriteHttpErrorResponse(w, models.NewHttpError(fmt.Sprintf("the file is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge))
+			return
+		}
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+
+	imp, httpErr := imports.Start(kind, format, dryRun, payload, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+
+	status := http.StatusCreated
+	switch imp.Status {
+	case models.ImportPending:
+		status = http.StatusAccepted
+	case models.ImportFailed:
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Location", fmt.Sprintf("/imports/%d", imp.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(imp)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// importFormat takes the format from the format query parameter or the Content-Type header
+func importFormat(r *http.Request) (string, models.HttpError) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if !slices.Contains([]string{models.ImportFormatCSV, models.ImportFormatNDJSON, models.ImportFormatMARC, models.ImportFormatMARCXML}, format) {
+			return "", models.NewHttpError(fmt.Sprintf("unknown format %q, use csv, ndjson, marc or marcxml", format), http.StatusBadRequest)
+		}
+		return format, models.NewEmptyHttpError()
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return models.ImportFormatCSV, models.NewEmptyHttpError()
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return models.ImportFormatNDJSON, models.NewEmptyHttpError()
+	case "application/marc":
+		return models.ImportFormatMARC, models.NewEmptyHttpError()
+	case "application/marcxml+xml", "application/xml", "text/xml":
+		return models.ImportFormatMARCXML, models.NewEmptyHttpError()
+	default:
+		return "", models.NewHttpError("send the file as text/csv, application/x-ndjson, application/marc or application/marcxml+xml, or set the format query parameter", http.StatusUnsupportedMediaType)
+	}
+}
+
+// GetImport godoc
+// @Summary Get an import
+// @Description Get the status, progress and row errors of an import
+// @Tags imports
+// @Produce json
+// @Param importId path int true "Import ID" example(1)
+// @Success 200 {object} models.Import
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /imports/{importId} [get]
+func GetImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["importId"], 10, 64)
+	if err != nil || id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	imp, httpErr := services.GetImport(id)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	err = json.NewEncoder(w).Encode(imp)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/jobs"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+)
+
+// GetJobs godoc
+// @Summary Get background jobs
+// @Description Get every registered background job with its schedule, next run and last run
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.JobStatus
+// @Failure 500 {object} models.HttpError
+// @Router /admin/jobs [get]
+func GetJobs(w http.ResponseWriter, _ *http.Request) {
+	statuses, httpErr := jobs.Statuses()
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	if len(statuses) == 0 {
+		statuses = []models.JobStatus{}
+	}
+	err := json.NewEncoder(w).Encode(statuses)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetJobRuns godoc
+// @Summary Get the run history of a job
+// @Description Get the most recent runs of a background job with their status and duration, newest first
+// @Tags admin
+// @Produce json
+// @Param jobName path string true "Job name" example(notifications)
+// @Success 200 {array} models.JobRun
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /admin/jobs/{jobName}/runs [get]
+func GetJobRuns(w http.ResponseWriter, r *http.Request) {
+	runs, httpErr := jobs.Runs(mux.Vars(r)["jobName"])
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	if len(runs) == 0 {
+		runs = []models.JobRun{}
+	}
+	err := json.NewEncoder(w).Encode(runs)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// TriggerJob godoc
+// @Summary Run a job now
+// @Description Queue a run of a background job, the instance running jobs starts it within jobs.poll_interval. Triggering a job that is already queued returns the queued run.
+// @Tags admin
+// @Produce json
+// @Param jobName path string true "Job name" example(notifications)
+// @Success 202 {object} models.JobRun
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /admin/jobs/{jobName}/run [post]
+func TriggerJob(w http.ResponseWriter, r *http.Request) {
+	run, httpErr := jobs.Trigger(mux.Vars(r)["jobName"], helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(run)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
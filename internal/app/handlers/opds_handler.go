@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/opds"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// opdsCacheControl lets e-reader apps and proxies reuse a feed for a minute, then revalidate it with its ETag
+const opdsCacheControl = "public, max-age=60"
+
+// GetOPDSRoot godoc
+// @Summary OPDS catalog root
+// @Description OPDS 1.2 navigation feed linking to new arrivals, books by author and by subject, and the OpenSearch description
+// @Tags opds
+// @Produce application/atom+xml
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {file} file
+// @Header 200 {string} ETag "Hash of the feed"
+// @Success 304 "Feed has not changed"
+// @Failure 500 {object} models.HttpError
+// @Router /opds [get]
+func GetOPDSRoot(w http.ResponseWriter, r *http.Request) {
+	feed, httpErr := opds.Root()
+	writeOPDS(w, r, opds.NavigationType, feed, httpErr)
+}
+
+// GetOPDSNew godoc
+// @Summary OPDS new arrivals
+// @Description OPDS 1.2 acquisition feed of all books, most recently added first, with the number of available copies of each
+// @Tags opds
+// @Produce application/atom+xml
+// @Param page query int false "Page, 25 books per page" example(1)
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {file} file
+// @Header 200 {string} ETag "Hash of the feed"
+// @Success 304 "Feed has not changed"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /opds/new [get]
+func GetOPDSNew(w http.ResponseWriter, r *http.Request) {
+	page, httpErr := opdsPage(r)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	feed, httpErr := opds.NewArrivals(page)
+	writeOPDS(w, r, opds.AcquisitionType, feed, httpErr)
+}
+
+// GetOPDSAuthors godoc
+// @Summary OPDS authors
+// @Description OPDS 1.2 navigation feed of all authors in alphabetical order, each linking to their books
+// @Tags opds
+// @Produce application/atom+xml
+// @Param page query int false "Page, 25 authors per page" example(1)
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {file} file
+// @Header 200 {string} ETag "Hash of the feed"
+// @Success 304 "Feed has not changed"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /opds/authors [get]
+func GetOPDSAuthors(w http.ResponseWriter, r *http.Request) {
+	getOPDSHeadings(w, r, models.HeadingAuthor)
+}
+
+// GetOPDSSubjects godoc
+// @Summary OPDS subjects
+// @Description OPDS 1.2 navigation feed of all subjects in alphabetical order, each linking to its books
+// @Tags opds
+// @Produce application/atom+xml
+// @Param page query int false "Page, 25 subjects per page" example(1)
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {file} file
+// @Header 200 {string} ETag "Hash of the feed"
+// @Success 304 "Feed has not changed"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /opds/subjects [get]
+func GetOPDSSubjects(w http.ResponseWriter, r *http.Request) {
+	getOPDSHeadings(w, r, models.HeadingSubject)
+}
+
+func getOPDSHeadings(w http.ResponseWriter, r *http.Request, kind string) {
+	page, httpErr := opdsPage(r)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	feed, httpErr := opds.Headings(kind, page)
+	writeOPDS(w, r, opds.NavigationType, feed, httpErr)
+}
+
+// GetOPDSBooks godoc
+// @Summary OPDS books by author or subject
+// @Description OPDS 1.2 acquisition feed of the books of one author or subject, most recently added first
+// @Tags opds
+// @Produce application/atom+xml
+// @Param author query string false "Author as listed in /opds/authors" example(Tolkien, J. R. R.)
+// @Param subject query string false "Subject as listed in /opds/subjects"
+// @Param page query int false "Page, 25 books per page" example(1)
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {file} file
+// @Header 200 {string} ETag "Hash of the feed"
+// @Success 304 "Feed has not changed"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /opds/books [get]
+func GetOPDSBooks(w http.ResponseWriter, r *http.Request) {
+	page, httpErr := opdsPage(r)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	author, subject := r.URL.Query().Get(models.HeadingAuthor), r.URL.Query().Get(models.HeadingSubject)
+	if (author == "") == (subject == "") {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("exactly one of author and subject is required", http.StatusBadRequest))
+		return
+	}
+	kind, name := models.HeadingAuthor, author
+	if subject != "" {
+		kind, name = models.HeadingSubject, subject
+	}
+	feed, httpErr := opds.BooksBy(kind, name, page)
+	writeOPDS(w, r, opds.AcquisitionType, feed, httpErr)
+}
+
+// SearchOPDS godoc
+// @Summary OPDS search
+// @Description OPDS 1.2 acquisition feed of the books whose title, authors or subjects contain every search word, or whose ISBN is the search term
+// @Tags opds
+// @Produce application/atom+xml
+// @Param q query string true "Search terms" example(hobbit)
+// @Param page query int false "Page, 25 books per page" example(1)
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {file} file
+// @Header 200 {string} ETag "Hash of the feed"
+// @Success 304 "Feed has not changed"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /opds/search [get]
+func SearchOPDS(w http.ResponseWriter, r *http.Request) {
+	page, httpErr := opdsPage(r)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	terms := strings.TrimSpace(r.URL.Query().Get("q"))
+	if terms == "" {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("q is required", http.StatusBadRequest))
+		return
+	}
+	feed, httpErr := opds.Search(terms, page)
+	writeOPDS(w, r, opds.AcquisitionType, feed, httpErr)
+}
+
+// GetOPDSOpenSearch godoc
+// @Summary OPDS OpenSearch description
+// @Description OpenSearch 1.1 description of the catalog search, linked from every feed
+// @Tags opds
+// @Produce application/opensearchdescription+xml
+// @Success 200 {file} file
+// @Header 200 {string} ETag "Hash of the description"
+// @Success 304 "Description has not changed"
+// @Router /opds/opensearch.xml [get]
+func GetOPDSOpenSearch(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	writeOPDS(w, r, opds.OpenSearchType, opds.Description(fmt.Sprintf("%s://%s", scheme, r.Host)), models.NewEmptyHttpError())
+}
+
+// opdsPage reads the page query parameter, the first page when it is missing or empty
+func opdsPage(r *http.Request) (int, models.HttpError) {
+	value := r.URL.Query().Get("page")
+	if value == "" {
+		return 1, models.NewEmptyHttpError()
+	}
+	page, err := strconv.Atoi(value)
+	if err != nil || page < 1 {
+		return 0, models.NewHttpError("page must be a positive number", http.StatusBadRequest)
+	}
+	return page, models.NewEmptyHttpError()
+}
+
+// writeOPDS renders a catalog document and answers 304 when the client already has it
+func writeOPDS(w http.ResponseWriter, r *http.Request, contentType string, document any, httpErr models.HttpError) {
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	var buf bytes.Buffer
+	if err := opds.Write(&buf, document); err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+	etag := helpers.ContentETag(buf.Bytes())
+	w.Header().Set("Cache-Control", opdsCacheControl)
+	if helpers.NotModified(r, etag) {
+		helpers.WriteNotModified(w, etag)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(buf.Bytes())
+}
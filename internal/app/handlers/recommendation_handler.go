@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"strconv"
+)
+
+// GetSimilarBooks godoc
+// @Summary Get similar books
+// @Description People who borrowed this book also borrowed these. Books with available copies come first, then the most similar.
+// @Description Borrows are counted by the recommendations job, so the newest ones are missing until it runs.
+// @Tags books
+// @Produce json
+// @Param bookId path int true "Book ID" example(1)
+// @Param limit query int false "Maximum number of books, 10 by default, at most 100"
+// @Success 200 {array} models.Recommendation
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /books/{bookId}/similar [get]
+func GetSimilarBooks(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["bookId"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	limit, httpErr := recommendationLimit(r)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	books, httpErr := services.GetSimilarBooks(id, limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	writeRecommendations(w, books)
+}
+
+// GetUserRecommendations godoc
+// @Summary Get book recommendations for a user
+// @Description Recommend books borrowed by people who borrowed the same books as the user, leaving out books the user already borrowed.
+// @Description Books with available copies come first. Users with little history get popular books.
+// @Tags users
+// @Produce json
+// @Param userId path int true "User ID" example(5)
+// @Param limit query int false "Maximum number of books, 10 by default, at most 100"
+// @Success 200 {array} models.Recommendation
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /users/{userId}/recommendations [get]
+func GetUserRecommendations(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	limit, httpErr := recommendationLimit(r)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	books, httpErr := services.GetRecommendations(id, limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	writeRecommendations(w, books)
+}
+
+func recommendationLimit(r *http.Request) (int, models.HttpError) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return 0, models.NewEmptyHttpError()
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, models.NewHttpError("limit must be a number", http.StatusBadRequest)
+	}
+	return limit, models.NewEmptyHttpError()
+}
+
+func writeRecommendations(w http.ResponseWriter, books []models.Recommendation) {
+	if len(books) == 0 {
+		books = []models.Recommendation{}
+	}
+	err := json.NewEncoder(w).Encode(books)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
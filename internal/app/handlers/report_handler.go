@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetTopBooks godoc
+// @Summary Get the most borrowed books
+// @Description Get the books borrowed most often in the period, most borrows first
+// @Tags reports
+// @Produce json,text/csv
+// @Param from query string false "Start of the period, RFC 3339, 30 days before to by default" example(2024-01-01T00:00:00Z)
+// @Param to query string false "End of the period, RFC 3339, now by default"
+// @Param limit query int false "Maximum number of books, 10 by default, at most 1000"
+// @Param format query string false "Output format, taken from the Accept header by default" Enums(json, csv)
+// @Success 200 {array} models.TopBook
+// @Failure 400 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /reports/top-books [get]
+func GetTopBooks(w http.ResponseWriter, r *http.Request) {
+	params, httpErr := reportParams(r.URL.Query())
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	books, httpErr := services.GetTopBooks(params.from, params.to, params.limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	writeReport(w, r, "top-books", books, []string{"book_id", "title", "borrows"}, func(book models.TopBook) []string {
+		return []string{strconv.Itoa(book.BookID), book.Title, strconv.Itoa(book.Borrows)}
+	})
+}
+
+// GetBorrowCounts godoc
+// @Summary Get the number of borrows over time
+// @Description Get the number of borrows in every day, week or month of the period, including those without borrows. Weeks start on Monday.
+// @Tags reports
+// @Produce json,text/csv
+// @Param from query string false "Start of the period, RFC 3339, 30 days before to by default" example(2024-01-01T00:00:00Z)
+// @Param to query string false "End of the period, RFC 3339, now by default"
+// @Param interval query string false "Interval, day by default" Enums(day, week, month)
+// @Param format query string false "Output format, taken from the Accept header by default" Enums(json, csv)
+// @Success 200 {array} models.BorrowCount
+// @Failure 400 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /reports/borrows [get]
+func GetBorrowCounts(w http.ResponseWriter, r *http.Request) {
+	params, httpErr := reportParams(r.URL.Query())
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	counts, httpErr := services.GetBorrowCounts(params.from, params.to, r.URL.Query().Get("interval"))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	writeReport(w, r, "borrows", counts, []string{"start", "borrows"}, func(count models.BorrowCount) []string {
+		return []string{count.Start.Format(time.DateOnly), strconv.Itoa(count.Borrows)}
+	})
+}
+
+// GetLoanDurations godoc
+// @Summary Get the loan duration
+// @Description Get the average, median and longest duration of the loans returned in the period and how many were returned late
+// @Tags reports
+// @Produce json,text/csv
+// @Param from query string false "Start of the period, RFC 3339, 30 days before to by default" example(2024-01-01T00:00:00Z)
+// @Param to query string false "End of the period, RFC 3339, now by default"
+// @Param format query string false "Output format, taken from the Accept header by default" Enums(json, csv)
+// @Success 200 {object} models.LoanDurationReport
+// @Failure 400 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /reports/loan-duration [get]
+func GetLoanDurations(w http.ResponseWriter, r *http.Request) {
+	params, httpErr := reportParams(r.URL.Query())
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	report, httpErr := services.GetLoanDurations(params.from, params.to)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	switch reportFormat(r) {
+	case "csv":
+		writeCSV(w, "loan-duration", []string{"returned", "returned_late", "average_days", "median_days", "max_days"}, []models.LoanDurationReport{report}, func(report models.LoanDurationReport) []string {
+			return []string{strconv.Itoa(report.Returned), strconv.Itoa(report.ReturnedLate), formatDays(report.AverageDays), formatDays(report.MedianDays), formatDays(report.MaxDays)}
+		})
+	case "json":
+		writeJSON(w, report)
+	default:
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("format must be json or csv", http.StatusBadRequest))
+	}
+}
+
+// GetUtilization godoc
+// @Summary Get the utilization of books
+// @Description Get the share of each book's copies that was on loan during the period, most utilized first. Loans that are still open count until now.
+// @Tags reports
+// @Produce json,text/csv
+// @Param from query string false "Start of the period, RFC 3339, 30 days before to by default" example(2024-01-01T00:00:00Z)
+// @Param to query string false "End of the period, RFC 3339, now by default"
+// @Param limit query int false "Maximum number of books, 10 by default, at most 1000"
+// @Param format query string false "Output format, taken from the Accept header by default" Enums(json, csv)
+// @Success 200 {array} models.BookUtilization
+// @Failure 400 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /reports/utilization [get]
+func GetUtilization(w http.ResponseWriter, r *http.Request) {
+	params, httpErr := reportParams(r.URL.Query())
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	books, httpErr := services.GetUtilization(params.from, params.to, params.limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	writeReport(w, r, "utilization", books, []string{"book_id", "title", "quantity", "borrowed_count", "loan_days", "utilization"}, func(book models.BookUtilization) []string {
+		return []string{strconv.Itoa(book.BookID), book.Title, strconv.Itoa(book.Quantity), strconv.Itoa(book.BorrowedCount),
+			formatDays(book.LoanDays), strconv.FormatFloat(book.Utilization, 'f', 4, 64)}
+	})
+}
+
+// GetActivePatrons godoc
+// @Summary Get the most active patrons
+// @Description Get the users who borrowed the most books in the period, ranked from 1. Anonymized reports leave out the ID and name.
+// @Tags reports
+// @Produce json,text/csv
+// @Param from query string false "Start of the period, RFC 3339, 30 days before to by default" example(2024-01-01T00:00:00Z)
+// @Param to query string false "End of the period, RFC 3339, now by default"
+// @Param limit query int false "Maximum number of patrons, 10 by default, at most 1000"
+// @Param anonymize query bool false "Leave out the user ID and name"
+// @Param format query string false "Output format, taken from the Accept header by default" Enums(json, csv)
+// @Success 200 {array} models.ActivePatron
+// @Failure 400 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /reports/active-patrons [get]
+func GetActivePatrons(w http.ResponseWriter, r *http.Request) {
+	params, httpErr := reportParams(r.URL.Query())
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	anonymize := false
+	if value := r.URL.Query().Get("anonymize"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			helpers.WriteHttpErrorResponse(w, models.NewHttpError("anonymize must be true or false", http.StatusBadRequest))
+			return
+		}
+		anonymize = parsed
+	}
+	patrons, httpErr := services.GetActivePatrons(params.from, params.to, params.limit, anonymize)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	header := []string{"rank", "user_id", "name", "borrows"}
+	if anonymize {
+		header = []string{"rank", "borrows"}
+	}
+	writeReport(w, r, "active-patrons", patrons, header, func(patron models.ActivePatron) []string {
+		if anonymize {
+			return []string{strconv.Itoa(patron.Rank), strconv.Itoa(patron.Borrows)}
+		}
+		return []string{strconv.Itoa(patron.Rank), strconv.Itoa(patron.UserID), patron.Name, strconv.Itoa(patron.Borrows)}
+	})
+}
+
+// GetUnborrowedBooks godoc
+// @Summary Get the books that were never borrowed
+// @Description Get the books that were never borrowed, longest in the catalog first
+// @Tags reports
+// @Produce json,text/csv
+// @Param limit query int false "Maximum number of books, 10 by default, at most 1000"
+// @Param format query string false "Output format, taken from the Accept header by default" Enums(json, csv)
+// @Success 200 {array} models.UnborrowedBook
+// @Failure 400 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /reports/never-borrowed [get]
+func GetUnborrowedBooks(w http.ResponseWriter, r *http.Request) {
+	params, httpErr := reportParams(r.URL.Query())
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	books, httpErr := services.GetUnborrowedBooks(params.limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	writeReport(w, r, "never-borrowed", books, []string{"book_id", "title", "quantity", "added_at"}, func(book models.UnborrowedBook) []string {
+		return []string{strconv.Itoa(book.BookID), book.Title, strconv.Itoa(book.Quantity), book.AddedAt.UTC().Format(time.RFC3339)}
+	})
+}
+
+// reportQuery holds the query parameters shared by the reports
+type reportQuery struct {
+	from  *time.Time
+	to    *time.Time
+	limit int
+}
+
+func reportParams(query url.Values) (reportQuery, models.HttpError) {
+	var params reportQuery
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return params, models.NewHttpError("limit must be a number", http.StatusBadRequest)
+		}
+		params.limit = parsed
+	}
+	times := map[string]**time.Time{
+		"from": &params.from,
+		"to":   &params.to,
+	}
+	for name, field := range times {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return params, models.NewHttpError(fmt.Sprintf("%s must be an RFC 3339 time, e.g. 2024-01-01T00:00:00Z", name), http.StatusBadRequest)
+			}
+			*field = &parsed
+		}
+	}
+	return params, models.NewEmptyHttpError()
+}
+
+// reportFormat takes the format from the format query parameter or the Accept header, JSON by default
+func reportFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accepted))
+		switch mediaType {
+		case "text/csv":
+			return "csv"
+		case "application/json":
+			return "json"
+		}
+	}
+	return "json"
+}
+
+// writeReport writes the rows as a JSON array or as CSV with the header and one record per row
+func writeReport[T any](w http.ResponseWriter, r *http.Request, name string, rows []T, header []string, record func(T) []string) {
+	switch reportFormat(r) {
+	case "csv":
+		writeCSV(w, name, header, rows, record)
+	case "json":
+		if len(rows) == 0 {
+			rows = []T{}
+		}
+		writeJSON(w, rows)
+	default:
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("format must be json or csv", http.StatusBadRequest))
+	}
+}
+
+func writeCSV[T any](w http.ResponseWriter, name string, header []string, rows []T, record func(T) []string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+	writer := csv.NewWriter(w)
+	_ = writer.Write(header)
+	for _, row := range rows {
+		_ = writer.Write(record(row))
+	}
+	writer.Flush()
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func formatDays(days float64) string {
+	return strconv.FormatFloat(days, 'f', 2, 64)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/sru"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// SRU godoc
+// @Summary SRU search and explain
+// @Description SRU 1.2 endpoint for union catalogs and interlibrary loan systems. searchRetrieve runs a CQL query
+// @Description over title (dc.title), author (dc.creator), subject (dc.subject) and ISBN (bath.isbn) indexes with
+// @Description and, or, not and parentheses, and returns MARCXML or Dublin Core records. explain describes the server.
+// @Description Errors are reported as SRU diagnostics in a 200 response.
+// @Tags sru
+// @Produce xml
+// @Param operation query string false "Operation, searchRetrieve when a query is given and explain otherwise" Enums(explain, searchRetrieve)
+// @Param version query string false "SRU version" Enums(1.1, 1.2)
+// @Param query query string false "CQL query, required for searchRetrieve" example(dc.title = hobbit and dc.creator = tolkien)
+// @Param startRecord query int false "Position of the first record, starting at 1"
+// @Param maximumRecords query int false "Number of records, 10 by default, at most 100"
+// @Param recordSchema query string false "Record schema" Enums(marcxml, dc)
+// @Param recordPacking query string false "Record packing" Enums(xml)
+// @Success 200 {file} file
+// @Router /sru [get]
+func SRU(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	host, port := r.Host, 80
+	if r.TLS != nil {
+		port = 443
+	}
+	if h, p, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+		if parsed, err := strconv.Atoi(p); err == nil {
+			port = parsed
+		}
+	}
+	var buf bytes.Buffer
+	if err := sru.Write(&buf, sru.Respond(r.Form, host, port)); err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
@@ -13,13 +13,16 @@ import (
 
 // CreateUser godoc
 // @Summary Create a new user
-// @Description Create a new user with provided first name and last name
+// @Description Create a new user with provided first name and last name, and optionally contact details and notification preferences
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param user body models.User true "User object" example({"first_name": "John", "last_name": "Doe"})
+// @Param user body models.User true "User object" example({"first_name": "John", "last_name": "Doe", "email": "john.doe@example.com", "notify_email": true})
+// @Param Idempotency-Key header string false "Unique key to safely retry the request"
 // @Success 201 {string} string "User created successfully"
 // @Failure 400 {object} models.HttpError
+// @Failure 409 {object} models.HttpError
+// @Failure 422 {object} models.HttpError
 // @Failure 500 {object} models.HttpError
 // @Router /users [post]
 func CreateUser(w http.ResponseWriter, r *http.Request) {
@@ -34,7 +37,7 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	httpErr := services.CreateUser(user)
+	_, httpErr := services.CreateUser(user, helpers.Actor(r))
 	if !models.IsHttpErrorEmpty(httpErr) {
 		helpers.WriteHttpErrorResponse(w, httpErr)
 		return
@@ -74,7 +77,10 @@ func GetUsers(w http.ResponseWriter, _ *http.Request) {
 // @Tags users
 // @Produce json
 // @Param userId path int true "User ID" example(5)
+// @Param If-None-Match header string false "ETag from a previous response"
 // @Success 200 {object} models.User
+// @Header 200 {string} ETag "Version of the user"
+// @Success 304 "User has not changed"
 // @Failure 400 {object} models.HttpError
 // @Failure 404 {object} models.HttpError
 // @Failure 500 {object} models.HttpError
@@ -95,9 +101,175 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 		helpers.WriteHttpErrorResponse(w, httpErr)
 		return
 	}
+	etag := helpers.ETag(user.Version)
+	if helpers.NotModified(r, etag) {
+		helpers.WriteNotModified(w, etag)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	err = json.NewEncoder(w).Encode(user)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateUser godoc
+// @Summary Update a user
+// @Description Update the name, contact details and notification preferences of a user, the If-Match header must hold the ETag from GetUser
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param userId path int true "User ID" example(5)
+// @Param If-Match header string true "ETag of the user"
+// @Param user body models.User true "User object" example({"first_name": "John", "last_name": "Doe"})
+// @Success 200 {object} models.User
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 412 {object} models.HttpError
+// @Failure 428 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /users/{userId} [put]
+func UpdateUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["userId"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	version, httpErr := helpers.IfMatchVersion(r)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	var user models.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if user.FirstName == "" || user.LastName == "" {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("first_name and last_name parameters are required", http.StatusBadRequest))
+		return
+	}
+	user.ID = id
+	user.Version = version
+
+	user, httpErr = services.UpdateUser(user, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	w.Header().Set("ETag", helpers.ETag(user.Version))
 	err = json.NewEncoder(w).Encode(user)
 	if err != nil {
 		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
 		return
 	}
 }
+
+// GetUserByCard godoc
+// @Summary Get a user by card number
+// @Description Get the user holding a library card, e.g. scanned at a kiosk. Spaces and hyphens are ignored.
+// @Description The number of a replaced card is answered with 410 and the Code CARD_REPLACED.
+// @Tags users
+// @Produce json
+// @Param card path string true "Card number" example(20000000000014)
+// @Success 200 {object} models.User
+// @Header 200 {string} ETag "Version of the user"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 410 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /users/by-card/{card} [get]
+func GetUserByCard(w http.ResponseWriter, r *http.Request) {
+	user, httpErr := services.GetUserByCard(mux.Vars(r)["card"])
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	w.Header().Set("ETag", helpers.ETag(user.Version))
+	err := json.NewEncoder(w).Encode(user)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// ReplaceUserCard godoc
+// @Summary Replace a library card
+// @Description Issue a new card number to a user, e.g. when the card was lost. The old number no longer identifies the user.
+// @Tags users
+// @Produce json
+// @Param userId path int true "User ID" example(5)
+// @Param Idempotency-Key header string false "Unique key to safely retry the request"
+// @Success 200 {object} models.User
+// @Header 200 {string} ETag "Version of the user"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 422 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /users/{userId}/card [post]
+func ReplaceUserCard(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	user, httpErr := services.ReplaceCard(id, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	w.Header().Set("ETag", helpers.ETag(user.Version))
+	err = json.NewEncoder(w).Encode(user)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetUserNotifications godoc
+// @Summary Get the notifications of a user
+// @Description Get the due date reminders and overdue notices sent, or attempted, to a user, newest first
+// @Tags users
+// @Produce json
+// @Param userId path int true "User ID" example(5)
+// @Success 200 {array} models.Notification
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /users/{userId}/notifications [get]
+func GetUserNotifications(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["userId"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return
+	}
+	notifications, httpErr := services.GetNotifications(id)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	if len(notifications) == 0 {
+		notifications = []models.Notification{}
+	}
+	err = json.NewEncoder(w).Encode(notifications)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"strconv"
+)
+
+// CreateWebhook godoc
+// @Summary Subscribe to events
+// @Description Register a URL that receives the given event types, deliveries are signed with HMAC-SHA256 of the secret in the X-Library-Signature header. A secret is generated when none is given and only returned in this response.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body models.WebhookSubscriptionRequest true "Webhook subscription"
+// @Success 201 {object} models.WebhookSubscription
+// @Failure 400 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /webhooks [post]
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request models.WebhookSubscriptionRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+
+	subscription, httpErr := services.CreateWebhookSubscription(request, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(subscription)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetWebhooks godoc
+// @Summary Get all webhooks
+// @Description Get a list of all webhook subscriptions
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} models.WebhookSubscription
+// @Failure 500 {object} models.HttpError
+// @Router /webhooks [get]
+func GetWebhooks(w http.ResponseWriter, _ *http.Request) {
+	subscriptions, httpErr := services.GetWebhookSubscriptions()
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	if len(subscriptions) == 0 {
+		subscriptions = []models.WebhookSubscription{}
+	}
+	jsonErr := json.NewEncoder(w).Encode(subscriptions)
+	if jsonErr != nil {
+		helpers.WriteErrorResponse(w, jsonErr, http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetWebhook godoc
+// @Summary Get a webhook by ID
+// @Description Get a webhook subscription by ID
+// @Tags webhooks
+// @Produce json
+// @Param webhookId path int true "Webhook ID" example(1)
+// @Success 200 {object} models.WebhookSubscription
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /webhooks/{webhookId} [get]
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookId(w, r)
+	if !ok {
+		return
+	}
+	subscription, httpErr := services.GetWebhookSubscription(id)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	jsonErr := json.NewEncoder(w).Encode(subscription)
+	if jsonErr != nil {
+		helpers.WriteErrorResponse(w, jsonErr, http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Delete a webhook subscription together with its delivery log
+// @Tags webhooks
+// @Param webhookId path int true "Webhook ID" example(1)
+// @Success 204
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /webhooks/{webhookId} [delete]
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookId(w, r)
+	if !ok {
+		return
+	}
+	httpErr := services.DeleteWebhookSubscription(id, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Get the delivery log of a webhook
+// @Description Get the latest deliveries of a webhook, status=dead lists the dead-letter deliveries that exhausted their retries
+// @Tags webhooks
+// @Produce json
+// @Param webhookId path int true "Webhook ID" example(1)
+// @Param status query string false "Filter by status" Enums(pending, succeeded, dead)
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /webhooks/{webhookId}/deliveries [get]
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookId(w, r)
+	if !ok {
+		return
+	}
+	deliveries, httpErr := services.GetWebhookDeliveries(id, r.URL.Query().Get("status"))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	if len(deliveries) == 0 {
+		deliveries = []models.WebhookDelivery{}
+	}
+	jsonErr := json.NewEncoder(w).Encode(deliveries)
+	if jsonErr != nil {
+		helpers.WriteErrorResponse(w, jsonErr, http.StatusInternalServerError)
+		return
+	}
+}
+
+// RedeliverWebhook godoc
+// @Summary Redeliver a webhook delivery
+// @Description Queue a delivery again with a fresh set of attempts, e.g. to replay a dead-letter delivery after the receiver was fixed
+// @Tags webhooks
+// @Produce json
+// @Param webhookId path int true "Webhook ID" example(1)
+// @Param deliveryId path int true "Delivery ID" example(1)
+// @Success 202 {string} string "delivery queued"
+// @Failure 400 {object} models.HttpError
+// @Failure 404 {object} models.HttpError
+// @Failure 500 {object} models.HttpError
+// @Router /webhooks/{webhookId}/deliveries/{deliveryId}/redeliver [post]
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookId(w, r)
+	if !ok {
+		return
+	}
+	deliveryId, err := strconv.ParseInt(mux.Vars(r)["deliveryId"], 10, 64)
+	if err != nil || deliveryId <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid deliveryId parameter", http.StatusBadRequest))
+		return
+	}
+	httpErr := services.RedeliverWebhook(id, deliveryId, helpers.Actor(r))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		helpers.WriteHttpErrorResponse(w, httpErr)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	jsonErr := json.NewEncoder(w).Encode(fmt.Sprintf("delivery with ID %d queued for redelivery", deliveryId))
+	if jsonErr != nil {
+		helpers.WriteErrorResponse(w, jsonErr, http.StatusInternalServerError)
+		return
+	}
+}
+
+func webhookId(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["webhookId"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+		return 0, false
+	}
+	if id <= 0 {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("invalid identifier", http.StatusBadRequest))
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"context"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+)
+
+type actorKey struct{}
+
+// WithActor stores who is making the request in the context
+func WithActor(ctx context.Context, actor models.Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns who is making the request, as stored by the Actor middleware
+func Actor(r *http.Request) models.Actor {
+	return ActorFromContext(r.Context())
+}
+
+// ActorFromContext returns the actor stored by WithActor, or the anonymous actor
+func ActorFromContext(ctx context.Context) models.Actor {
+	if actor, ok := ctx.Value(actorKey{}).(models.Actor); ok {
+		return actor
+	}
+	return models.Actor{Name: models.AnonymousActor}
+}
@@ -0,0 +1,58 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag formats a row version as a strong entity tag
+func ETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ContentETag derives a strong entity tag from a response body, for documents without a single row version
+func ContentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified reports whether the If-None-Match header matches the current ETag,
+// in which case the caller should answer 304 Not Modified
+func NotModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteNotModified answers 304 with the current ETag and no body
+func WriteNotModified(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// IfMatchVersion reads the row version the client expects from the If-Match header.
+// Updates require the header, a missing one is answered with 428 Precondition Required.
+func IfMatchVersion(r *http.Request) (int, models.HttpError) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, models.NewHttpError("If-Match header with the ETag of the resource is required", http.StatusPreconditionRequired)
+	}
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return 0, models.NewHttpError(fmt.Sprintf("If-Match header %s does not match the current ETag", header), http.StatusPreconditionFailed)
+	}
+	return version, models.NewEmptyHttpError()
+}
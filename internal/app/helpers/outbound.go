@@ -0,0 +1,99 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicAddr reports whether ip is an address on the public internet.
+// Loopback, private, link-local (e.g. the 169.254.169.254 metadata service), shared, unspecified and multicast addresses are not.
+func PublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip) &&
+		ip != netip.AddrFrom4([4]byte{255, 255, 255, 255})
+}
+
+// OutboundPolicy decides which addresses requests to URLs supplied by API users may reach:
+// public addresses, and the networks in Allowed, e.g. a receiver on localhost during development
+type OutboundPolicy struct {
+	Allowed []netip.Prefix
+}
+
+// Permits reports whether the policy allows connecting to ip
+func (p OutboundPolicy) Permits(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if PublicAddr(ip) {
+		return true
+	}
+	for _, network := range p.Allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHost resolves host and fails unless the policy permits every address it resolves to
+func (p OutboundPolicy) CheckHost(ctx context.Context, host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !p.Permits(ip) {
+			return fmt.Errorf("%s is not a public address", ip)
+		}
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !p.Permits(ip) {
+			return fmt.Errorf("%s resolves to %s, which is not a public address", host, ip)
+		}
+	}
+	return nil
+}
+
+// NewHTTPClient returns a client that only connects to addresses the policy permits,
+// checked when dialing so a host that resolves differently later cannot reach internal services.
+// It does not follow redirects, a 3xx answer is returned as is.
+func (p OutboundPolicy) NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !p.Permits(addrPort.Addr()) {
+				return fmt.Errorf("refusing to connect to %s, it is not a public address", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be dialed instead of the target and bypass the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+)
+
+func TestOutboundPolicyPermits(t *testing.T) {
+	allowLocal := OutboundPolicy{Allowed: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("10.1.0.0/16")}}
+	tests := []struct {
+		addr        string
+		public      bool
+		allowedByIt bool
+	}{
+		{"93.184.216.34", true, true},
+		{"2606:4700::1111", true, true},
+		{"127.0.0.1", false, true},
+		{"127.0.0.2", false, false},
+		{"::ffff:127.0.0.1", false, true},
+		{"10.1.2.3", false, true},
+		{"10.2.0.1", false, false},
+		{"192.168.1.1", false, false},
+		{"169.254.169.254", false, false},
+		{"100.64.0.1", false, false},
+		{"::1", false, false},
+		{"fe80::1", false, false},
+		{"0.0.0.0", false, false},
+		{"255.255.255.255", false, false},
+		{"224.0.0.1", false, false},
+	}
+	for _, tt := range tests {
+		addr := netip.MustParseAddr(tt.addr)
+		if got := (OutboundPolicy{}).Permits(addr); got != tt.public {
+			t.Errorf("default policy Permits(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+		if got := allowLocal.Permits(addr); got != tt.allowedByIt {
+			t.Errorf("allowlist Permits(%s) = %v, want %v", tt.addr, got, tt.allowedByIt)
+		}
+	}
+}
+
+func TestOutboundPolicyCheckHost(t *testing.T) {
+	if err := (OutboundPolicy{}).CheckHost(context.Background(), "127.0.0.1"); err == nil {
+		t.Error("CheckHost(127.0.0.1) passed without an allowlist")
+	}
+	allowLocal := OutboundPolicy{Allowed: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}
+	if err := allowLocal.CheckHost(context.Background(), "127.0.0.1"); err != nil {
+		t.Errorf("CheckHost(127.0.0.1) with an allowlist: %v", err)
+	}
+}
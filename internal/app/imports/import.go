@@ -0,0 +1,121 @@
+// Package imports loads books and users in bulk from CSV, NDJSON or MARC uploads.
+// Every row is validated before anything is written, so a file with an invalid row loads nothing.
+// Files imported within the request are written in a single transaction. Queued imports commit one batch at a time
+// and resume after the last committed batch, an import that stops on an error keeps the batches committed before it.
+package imports
+
+import (
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+)
+
+// Limits bounds the size of uploads and how they are run
+type Limits struct {
+	// MaxBytes is the largest accepted upload
+	MaxBytes int64
+	// SyncRows is the largest import run within the request, larger ones are queued for a Worker
+	SyncRows int
+	// BatchSize is the number of rows a Worker commits at a time
+	BatchSize int
+}
+
+var limits = Limits{
+	MaxBytes:  32 << 20,
+	SyncRows:  1000,
+	BatchSize: 500,
+}
+
+func SetLimits(l Limits) {
+	limits = l
+}
+
+// MaxBytes returns the largest accepted upload
+func MaxBytes() int64 {
+	return limits.MaxBytes
+}
+
+// Start validates an upload and records it as an import.
+// Invalid uploads are recorded as failed with their row errors and dry runs as completed without writing rows.
+// Otherwise small uploads are imported in a single transaction and larger ones are left pending for a Worker.
+func Start(kind string, format string, dryRun bool, payload []byte, actor models.Actor) (models.Import, models.HttpError) {
+	imp := models.Import{
+		Kind:         kind,
+		Format:       format,
+		DryRun:       dryRun,
+		Actor:        actor.Name,
+		ClaimedActor: actor.Claimed,
+		RequestID:    actor.RequestID,
+		ClientIP:     actor.ClientIP,
+	}
+	rows, err := readRows(kind, format, payload)
+	if err != nil {
+		return imp, models.NewHttpError(err.Error(), http.StatusBadRequest)
+	}
+	if len(rows) == 0 {
+		return imp, models.NewHttpError("the file has no rows to import", http.StatusBadRequest)
+	}
+	imp.TotalRows = len(rows)
+
+	errs := validate(kind, rows)
+	imp.ErrorCount = errs.count
+	imp.Errors = errs.errors
+	switch {
+	case errs.count > 0:
+		imp.Status = models.ImportFailed
+		return services.InsertImport(imp, nil)
+	case dryRun:
+		imp.Status = models.ImportCompleted
+		return services.InsertImport(imp, nil)
+	case len(rows) > limits.SyncRows:
+		imp.Status = models.ImportPending
+		return services.InsertImport(imp, payload)
+	}
+
+	imp.Status = models.ImportRunning
+	imp, httpErr := services.InsertImport(imp, nil)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return imp, httpErr
+	}
+	httpErr = importRows(imp, rows, 0, len(rows))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		_ = services.FinishImport(imp.ID, models.ImportFailed, httpErr.Message)
+		return imp, httpErr
+	}
+	if httpErr = services.FinishImport(imp.ID, models.ImportCompleted, ""); !models.IsHttpErrorEmpty(httpErr) {
+		return imp, httpErr
+	}
+	return services.GetImport(imp.ID)
+}
+
+func validate(kind string, rows []row) rowErrors {
+	switch kind {
+	case models.ImportBooks:
+		_, errs := parseBooks(rows)
+		return errs
+	default:
+		_, errs := parseUsers(rows)
+		return errs
+	}
+}
+
+// importRows writes rows[from:to] in one transaction and records to as the processed row count.
+// It fails with ErrorImportTakenOver when the import is no longer at from.
+func importRows(imp models.Import, rows []row, from int, to int) models.HttpError {
+	actor := imp.ImportActor()
+	switch imp.Kind {
+	case models.ImportBooks:
+		books, errs := parseBooks(rows[from:to])
+		if errs.count > 0 {
+			return models.NewHttpError(fmt.Sprintf("%d rows of import %d are no longer valid", errs.count, imp.ID), http.StatusInternalServerError)
+		}
+		return services.ImportBooks(imp.ID, from, to, books, actor)
+	default:
+		users, errs := parseUsers(rows[from:to])
+		if errs.count > 0 {
+			return models.NewHttpError(fmt.Sprintf("%d rows of import %d are no longer valid", errs.count, imp.ID), http.StatusInternalServerError)
+		}
+		return services.ImportUsers(imp.ID, from, to, users, actor)
+	}
+}
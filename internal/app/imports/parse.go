@@ -0,0 +1,313 @@
+package imports
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/marc"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// the lengths of the VARCHAR columns
+const (
+	maxTitleLength           = 255
+	maxNameLength            = 100
+	maxPublisherLength       = 255
+	maxPublicationDateLength = 32
+)
+
+// maxStoredErrors caps the row errors kept on an import, ErrorCount still counts all of them
+const maxStoredErrors = 1000
+
+var columns = map[string][]string{
+	models.ImportBooks: {"title", "quantity"},
+	models.ImportUsers: {"first_name", "last_name", "email", "phone", "locale", "notify_email", "notify_sms", "category",
+		"date_of_birth", "address", "membership_starts", "membership_expires"},
+}
+
+var requiredColumns = map[string][]string{
+	models.ImportBooks: {"title", "quantity"},
+	models.ImportUsers: {"first_name", "last_name"},
+}
+
+// row is one record of an upload with its fields by column name.
+// problem is set when the record itself is malformed, e.g. has too many fields.
+// MARC records also carry the catalog description of the book.
+type row struct {
+	number  int
+	fields  map[string]string
+	catalog *models.Catalog
+	problem string
+}
+
+// readRows splits an upload into rows. It fails only when the file as a whole is unusable.
+func readRows(kind string, format string, payload []byte) ([]row, error) {
+	switch format {
+	case models.ImportFormatCSV:
+		return readCSV(kind, payload)
+	case models.ImportFormatNDJSON:
+		return readNDJSON(kind, payload)
+	case models.ImportFormatMARC, models.ImportFormatMARCXML:
+		if kind != models.ImportBooks {
+			return nil, errors.New("MARC records can only be imported as books")
+		}
+		if format == models.ImportFormatMARC {
+			return readMARC(marc.NewBinaryReader(bytes.NewReader(payload)))
+		}
+		return readMARC(marc.NewXMLReader(bytes.NewReader(payload)))
+	default:
+		return nil, fmt.Errorf("unknown format %q, use csv, ndjson, marc or marcxml", format)
+	}
+}
+
+func readCSV(kind string, payload []byte) ([]row, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(payload, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty, the first line must be a header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header: %w", err)
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(columns[kind], header[i]) {
+			return nil, fmt.Errorf("unknown column %q, %s can have the columns %s", name, kind, strings.Join(columns[kind], ", "))
+		}
+		if slices.Contains(header[:i], header[i]) {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+	}
+	for _, name := range requiredColumns[kind] {
+		if !slices.Contains(header, name) {
+			return nil, fmt.Errorf("the header has no %s column", name)
+		}
+	}
+
+	var rows []row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		r := row{number: len(rows) + 1, fields: make(map[string]string, len(header))}
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			r.problem = "invalid CSV: " + parseErr.Err.Error()
+		case err != nil:
+			return nil, err
+		case len(record) != len(header):
+			r.problem = fmt.Sprintf("row has %d fields, the header has %d", len(record), len(header))
+		default:
+			for i, value := range record {
+				r.fields[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, r)
+	}
+}
+
+func readNDJSON(kind string, payload []byte) ([]row, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(payload))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(payload)+1)
+
+	var rows []row
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		r := row{number: line, fields: make(map[string]string)}
+		r.problem = r.decode(kind, text)
+		rows = append(rows, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read line %d: %w", line+1, err)
+	}
+	return rows, nil
+}
+
+// readMARC maps every record onto a book, the holdings are not part of a bibliographic record so every book gets one copy
+func readMARC(reader marc.Reader) ([]row, error) {
+	var rows []row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		var recordErr *marc.RecordError
+		if errors.As(err, &recordErr) {
+			rows = append(rows, row{number: recordErr.Record, problem: "invalid MARC record: " + recordErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read record %d: %w", len(rows)+1, err)
+		}
+		book := marc.ToBook(record)
+		rows = append(rows, row{
+			number:  len(rows) + 1,
+			fields:  map[string]string{"title": book.Title, "quantity": "1"},
+			catalog: &book.Catalog,
+		})
+	}
+}
+
+// decode fills the fields from a JSON object and returns what is wrong with it
+func (r row) decode(kind string, text []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return "line is not a JSON object"
+	}
+	for name, value := range object {
+		if !slices.Contains(columns[kind], name) {
+			return fmt.Sprintf("unknown field %q", name)
+		}
+		switch v := value.(type) {
+		case nil:
+		case string:
+			r.fields[name] = strings.TrimSpace(v)
+		case json.Number, bool:
+			r.fields[name] = fmt.Sprint(v)
+		default:
+			return fmt.Sprintf("field %q must be a string, number or boolean", name)
+		}
+	}
+	return ""
+}
+
+// rowErrors collects invalid rows and keeps the first maxStoredErrors of them
+type rowErrors struct {
+	count  int
+	errors []models.ImportRowError
+}
+
+func (e *rowErrors) add(number int, field string, message string) {
+	e.count++
+	if len(e.errors) < maxStoredErrors {
+		e.errors = append(e.errors, models.ImportRowError{Row: number, Field: field, Message: message})
+	}
+}
+
+// text returns a required field that fits its column
+func (e *rowErrors) text(r row, field string, maxLength int) (string, bool) {
+	value := r.fields[field]
+	if value == "" {
+		e.add(r.number, field, "is required")
+		return value, false
+	}
+	return value, e.length(r, field, value, maxLength)
+}
+
+// length reports whether an optional value fits its column
+func (e *rowErrors) length(r row, field string, value string, maxLength int) bool {
+	if utf8.RuneCountInString(value) > maxLength {
+		e.add(r.number, field, fmt.Sprintf("must be at most %d characters", maxLength))
+		return false
+	}
+	return true
+}
+
+// catalogOk validates the catalog description of a MARC record
+func (e *rowErrors) catalogOk(r row) bool {
+	before := e.count
+	if r.catalog.ISBN != "" && !marc.ValidISBN(r.catalog.ISBN) {
+		e.add(r.number, "isbn", fmt.Sprintf("%q is not a valid ISBN-10 or ISBN-13", r.catalog.ISBN))
+	}
+	e.length(r, "publisher", r.catalog.Publisher, maxPublisherLength)
+	e.length(r, "publication_date", r.catalog.PublicationDate, maxPublicationDateLength)
+	return e.count == before
+}
+
+// flag returns an optional boolean field, empty means false
+func (e *rowErrors) flag(r row, field string) bool {
+	value := r.fields[field]
+	if value == "" {
+		return false
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		e.add(r.number, field, "must be true or false")
+	}
+	return parsed
+}
+
+// parseBooks validates every row and returns the books, or the errors when any row is invalid
+func parseBooks(rows []row) ([]models.Book, rowErrors) {
+	var errs rowErrors
+	books := make([]models.Book, 0, len(rows))
+	for _, r := range rows {
+		if r.problem != "" {
+			errs.add(r.number, "", r.problem)
+			continue
+		}
+		title, titleOk := errs.text(r, "title", maxTitleLength)
+		quantity, err := strconv.Atoi(r.fields["quantity"])
+		quantityOk := err == nil && quantity >= 0
+		if !quantityOk {
+			errs.add(r.number, "quantity", "must be a whole number of at least 0")
+		}
+		catalogOk := r.catalog == nil || errs.catalogOk(r)
+		if titleOk && quantityOk && catalogOk {
+			book := models.Book{Title: title, Quantity: quantity}
+			if r.catalog != nil {
+				book.Catalog = *r.catalog
+			}
+			books = append(books, book)
+		}
+	}
+	return books, errs
+}
+
+// parseUsers validates every row and returns the users, or the errors when any row is invalid
+func parseUsers(rows []row) ([]models.User, rowErrors) {
+	var errs rowErrors
+	users := make([]models.User, 0, len(rows))
+	for _, r := range rows {
+		if r.problem != "" {
+			errs.add(r.number, "", r.problem)
+			continue
+		}
+		before := errs.count
+		user := models.User{Email: r.fields["email"], Phone: r.fields["phone"], Locale: r.fields["locale"], Category: r.fields["category"],
+			DateOfBirth: r.fields["date_of_birth"], Address: r.fields["address"],
+			MembershipStarts: r.fields["membership_starts"], MembershipExpires: r.fields["membership_expires"]}
+		user.FirstName, _ = errs.text(r, "first_name", maxNameLength)
+		user.LastName, _ = errs.text(r, "last_name", maxNameLength)
+		user.NotifyEmail = errs.flag(r, "notify_email")
+		user.NotifySMS = errs.flag(r, "notify_sms")
+		if errs.count > before {
+			continue
+		}
+		if err := services.ValidateContact(&user); !models.IsHttpErrorEmpty(err) {
+			errs.add(r.number, "", err.Message)
+			continue
+		}
+		if err := services.ValidateIdentity(&user); !models.IsHttpErrorEmpty(err) {
+			errs.add(r.number, "", err.Message)
+			continue
+		}
+		if err := services.ValidateCategory(&user); !models.IsHttpErrorEmpty(err) {
+			errs.add(r.number, "category", err.Message)
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, errs
+}
@@ -0,0 +1,93 @@
+package imports
+
+import (
+	"context"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"log"
+	"time"
+)
+
+// Worker runs queued imports in batches. Every replica can run one, an import is claimed by a single worker at a time.
+// Each batch commits together with the import's progress, so an import interrupted by a shutdown or crash
+// is claimed again after StaleAfter and continues after its last committed batch.
+type Worker struct {
+	PollInterval time.Duration
+	StaleAfter   time.Duration
+}
+
+// Run polls for queued imports until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		imp, payload, ok, err := services.ClaimImport(w.StaleAfter)
+		if !models.IsHttpErrorEmpty(err) {
+			log.Println(err)
+			return
+		}
+		if !ok {
+			return
+		}
+		w.run(ctx, imp, payload)
+	}
+}
+
+func (w *Worker) run(ctx context.Context, imp models.Import, payload []byte) {
+	fail := func(message string) {
+		log.Printf("import %d failed: %s", imp.ID, message)
+		if err := services.FinishImport(imp.ID, models.ImportFailed, message); !models.IsHttpErrorEmpty(err) {
+			log.Println(err)
+		}
+	}
+	if payload == nil {
+		// imports run within a request keep no payload, one that was interrupted wrote nothing
+		fail("interrupted, the instance running it stopped")
+		return
+	}
+	rows, err := readRows(imp.Kind, imp.Format, payload)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if len(rows) != imp.TotalRows {
+		fail(fmt.Sprintf("the stored file has %d rows instead of %d", len(rows), imp.TotalRows))
+		return
+	}
+
+	log.Printf("running import %d of %d %s from row %d", imp.ID, imp.TotalRows, imp.Kind, imp.ProcessedRows+1)
+	for from := imp.ProcessedRows; from < len(rows); from += limits.BatchSize {
+		if ctx.Err() != nil {
+			// left running, it is claimed again after StaleAfter
+			return
+		}
+		to := min(from+limits.BatchSize, len(rows))
+		if httpErr := importRows(imp, rows, from, to); !models.IsHttpErrorEmpty(httpErr) {
+			if httpErr.Code == models.ErrorImportTakenOver {
+				// this worker stalled and the import was claimed again, the other worker finishes it
+				log.Println(httpErr.Message)
+				return
+			}
+			fail(httpErr.Message)
+			return
+		}
+	}
+	if err := services.FinishImport(imp.ID, models.ImportCompleted, ""); !models.IsHttpErrorEmpty(err) {
+		log.Println(err)
+		return
+	}
+	log.Printf("import %d completed", imp.ID)
+}
@@ -0,0 +1,131 @@
+// Package jobs runs time-driven background work, such as patron notifications and cleanups,
+// on a single replica at a time.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Func does the work of a job. The returned message summarizes a successful run in the job history.
+type Func func(ctx context.Context) (string, error)
+
+// Job is a unit of background work run on a schedule
+type Job struct {
+	Name        string
+	Description string
+	Spec        string
+	Schedule    Schedule
+	Run         Func
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]*Job)
+)
+
+// Register adds a job that runs on the given schedule, see ParseSchedule for the accepted forms.
+// Jobs are registered on every replica so they can be listed and triggered anywhere,
+// but only the leader runs them.
+func Register(name string, description string, spec string, run Func) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		return fmt.Errorf("job %s is already registered", name)
+	}
+	registry[name] = &Job{Name: name, Description: description, Spec: spec, Schedule: schedule, Run: run}
+	return nil
+}
+
+func lookup(name string) (*Job, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	job, ok := registry[name]
+	return job, ok
+}
+
+// registered returns the jobs sorted by name
+func registered() []*Job {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	list := make([]*Job, 0, len(registry))
+	for _, job := range registry {
+		list = append(list, job)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// nextSlot returns the next scheduled slot of a job after its last scheduled run.
+// The slot is in the past when it was missed while no replica was leading, it is then run once right away.
+func nextSlot(job *Job, lastScheduled *time.Time, now time.Time) time.Time {
+	if lastScheduled == nil {
+		return job.Schedule.Next(now)
+	}
+	return job.Schedule.Next(*lastScheduled)
+}
+
+// Statuses describes every registered job with its next and last run
+func Statuses() ([]models.JobStatus, models.HttpError) {
+	latest, err := services.GetLatestJobRuns(false)
+	if !models.IsHttpErrorEmpty(err) {
+		return nil, err
+	}
+	latestScheduled, err := services.GetLatestJobRuns(true)
+	if !models.IsHttpErrorEmpty(err) {
+		return nil, err
+	}
+
+	now := time.Now()
+	var statuses []models.JobStatus
+	for _, job := range registered() {
+		status := models.JobStatus{Name: job.Name, Description: job.Description, Schedule: job.Spec}
+		var lastScheduled *time.Time
+		if run, ok := latestScheduled[job.Name]; ok {
+			lastScheduled = &run.ScheduledAt
+		}
+		if next := nextSlot(job, lastScheduled, now); !next.IsZero() {
+			if next.Before(now) {
+				next = now
+			}
+			status.NextRunAt = &next
+		}
+		if run, ok := latest[job.Name]; ok {
+			status.LastRun = &run
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, models.NewEmptyHttpError()
+}
+
+// Trigger queues a run of the job on behalf of actor, the leader picks it up within its poll interval
+func Trigger(name string, actor models.Actor) (models.JobRun, models.HttpError) {
+	if _, ok := lookup(name); !ok {
+		return models.JobRun{}, jobNotFound(name)
+	}
+	return services.QueueJobRun(name, actor)
+}
+
+// Runs returns the run history of a job, newest first
+func Runs(name string) ([]models.JobRun, models.HttpError) {
+	if _, ok := lookup(name); !ok {
+		return nil, jobNotFound(name)
+	}
+	return services.GetJobRuns(name)
+}
+
+func jobNotFound(name string) models.HttpError {
+	return models.NewHttpError(fmt.Sprintf("job %q not found", name), http.StatusNotFound)
+}
@@ -0,0 +1,210 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"log"
+	"sync"
+	"time"
+)
+
+// Runner runs the registered jobs on the replica that holds the leader lock.
+// Every replica runs a Runner, the others keep trying to take the lock and take over when the leader goes away.
+// A job never overlaps with itself: a slot that comes up while the previous run is still going is run once it finishes.
+type Runner struct {
+	// PollInterval is how often leadership, due jobs and manual triggers are checked
+	PollInterval time.Duration
+	// Instance names this replica in the job history
+	Instance string
+
+	mu      sync.Mutex
+	running map[string]bool
+	next    map[string]time.Time
+	wg      sync.WaitGroup
+}
+
+// term is a period of leadership, its context is cancelled when leadership ends
+type term struct {
+	lock   *postgres.JobLeaderLock
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Run competes for leadership and runs due jobs until ctx is cancelled
+func (r *Runner) Run(ctx context.Context) {
+	r.running = make(map[string]bool)
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	var leader *term
+	for {
+		if leader == nil {
+			leader = r.elect(ctx)
+		} else if !leader.lock.Held(ctx) && ctx.Err() == nil {
+			log.Println("lost job leadership")
+			r.stepDown(leader)
+			leader = nil
+		}
+		if leader != nil {
+			r.tick(leader.ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			if leader != nil {
+				r.stepDown(leader)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// elect takes the leader lock if it is free and prepares the schedule
+func (r *Runner) elect(ctx context.Context) *term {
+	lock, acquired, err := services.TryJobLeaderLock(ctx)
+	if !models.IsHttpErrorEmpty(err) {
+		log.Println(err)
+		return nil
+	}
+	if !acquired {
+		return nil
+	}
+
+	// nothing runs without the lock, so runs still marked running were cut short by the previous leader
+	if failed, err := services.FailInterruptedJobRuns(); !models.IsHttpErrorEmpty(err) {
+		log.Println(err)
+	} else if failed > 0 {
+		log.Printf("marked %d interrupted job runs as failed", failed)
+	}
+	latestScheduled, err := services.GetLatestJobRuns(true)
+	if !models.IsHttpErrorEmpty(err) {
+		log.Println(err)
+		lock.Release()
+		return nil
+	}
+
+	now := time.Now()
+	r.next = make(map[string]time.Time)
+	for _, job := range registered() {
+		var lastScheduled *time.Time
+		if run, ok := latestScheduled[job.Name]; ok {
+			lastScheduled = &run.ScheduledAt
+		}
+		r.next[job.Name] = nextSlot(job, lastScheduled, now)
+	}
+
+	log.Printf("%s is now running background jobs", r.Instance)
+	termCtx, cancel := context.WithCancel(ctx)
+	return &term{lock: lock, ctx: termCtx, cancel: cancel}
+}
+
+// stepDown stops the running jobs and gives up the lock
+func (r *Runner) stepDown(leader *term) {
+	leader.cancel()
+	r.wg.Wait()
+	leader.lock.Release()
+}
+
+// tick starts the jobs whose slot has come and the manually triggered ones
+func (r *Runner) tick(ctx context.Context) {
+	now := time.Now()
+	for _, job := range registered() {
+		slot, ok := r.next[job.Name]
+		if !ok || slot.IsZero() || now.Before(slot) || r.isRunning(job.Name) {
+			continue
+		}
+		r.next[job.Name] = job.Schedule.Next(now)
+
+		run, started, err := services.StartScheduledJobRun(job.Name, slot, r.Instance)
+		if !models.IsHttpErrorEmpty(err) {
+			log.Println(err)
+			continue
+		}
+		if started {
+			r.start(ctx, job, run)
+		}
+	}
+
+	runs, err := services.ClaimQueuedJobRuns(r.Instance, r.runningJobs())
+	if !models.IsHttpErrorEmpty(err) {
+		log.Println(err)
+		return
+	}
+	for _, run := range runs {
+		job, ok := lookup(run.JobName)
+		if !ok {
+			run.Status = models.JobFailed
+			run.Error = "job is not registered on this instance"
+			if err := services.FinishJobRun(run); !models.IsHttpErrorEmpty(err) {
+				log.Println(err)
+			}
+			continue
+		}
+		r.start(ctx, job, run)
+	}
+}
+
+func (r *Runner) start(ctx context.Context, job *Job, run models.JobRun) {
+	r.setRunning(job.Name, true)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer r.setRunning(job.Name, false)
+
+		started := time.Now()
+		message, err := execute(ctx, job)
+		duration := time.Since(started).Milliseconds()
+
+		run.DurationMs = &duration
+		run.Status = models.JobSucceeded
+		run.Message = message
+		if err != nil {
+			log.Printf("job %s failed after %dms: %v", job.Name, duration, err)
+			run.Status = models.JobFailed
+			run.Error = err.Error()
+		}
+		if err := services.FinishJobRun(run); !models.IsHttpErrorEmpty(err) {
+			log.Println(err)
+		}
+	}()
+}
+
+// execute runs a job, turning a panic into a failed run instead of bringing down the server
+func execute(ctx context.Context, job *Job) (message string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+func (r *Runner) isRunning(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running[name]
+}
+
+func (r *Runner) setRunning(name string, running bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if running {
+		r.running[name] = true
+	} else {
+		delete(r.running, name)
+	}
+}
+
+func (r *Runner) runningJobs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.running))
+	for name := range r.running {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// cron expressions are evaluated in local time, pin it so the expected times do not depend on the machine
+	local := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = local })
+
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04:05", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	// 2024-09-01 is a Sunday
+	tests := []struct {
+		spec  string
+		after string
+		want  string
+	}{
+		{"30 2 * * *", "2024-09-01 02:29:59", "2024-09-01 02:30:00"},
+		{"30 2 * * *", "2024-09-01 02:30:00", "2024-09-02 02:30:00"},
+		{"*/15 * * * *", "2024-09-01 10:07:00", "2024-09-01 10:15:00"},
+		{"0-30/10 * * * *", "2024-09-01 10:31:00", "2024-09-01 11:00:00"},
+		{"10/20 * * * *", "2024-09-01 10:31:00", "2024-09-01 10:50:00"},
+		{"5,35 * * * *", "2024-09-01 10:06:00", "2024-09-01 10:35:00"},
+		{"0 9-17 * * *", "2024-09-01 17:30:00", "2024-09-02 09:00:00"},
+		{"0 0 * * 1-5", "2024-09-06 12:00:00", "2024-09-09 00:00:00"},
+		{"0 0 * * 7", "2024-09-02 00:00:00", "2024-09-08 00:00:00"},
+		{"0 0 31 * *", "2024-02-01 00:00:00", "2024-03-31 00:00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		// with both day fields restricted a day matching either is enough
+		{"0 0 13 * 5", "2024-09-01 00:00:00", "2024-09-06 00:00:00"},
+		{"0 0 13 * 5", "2024-09-06 00:00:00", "2024-09-13 00:00:00"},
+		{"0 0 13 * 5", "2024-09-13 00:00:00", "2024-09-20 00:00:00"},
+		{"0 0 13 * *", "2024-09-01 00:00:00", "2024-09-13 00:00:00"},
+		{"0 0 * * 5", "2024-09-06 00:00:00", "2024-09-13 00:00:00"},
+		{"@hourly", "2024-09-01 10:07:00", "2024-09-01 11:00:00"},
+		{"@daily", "2024-09-01 10:07:00", "2024-09-02 00:00:00"},
+		{"@weekly", "2024-09-01 10:07:00", "2024-09-08 00:00:00"},
+		{"@monthly", "2024-01-31 12:00:00", "2024-02-01 00:00:00"},
+		{"@yearly", "2024-09-01 10:07:00", "2025-01-01 00:00:00"},
+		{"@every 15m", "2024-09-01 10:07:30", "2024-09-01 10:15:00"},
+		{"@every 15m", "2024-09-01 10:15:00", "2024-09-01 10:30:00"},
+		{"@every 1h30m", "2024-09-01 10:07:00", "2024-09-01 10:30:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec+" after "+tt.after, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.Next(at(tt.after)); !got.Equal(at(tt.want)) {
+				t.Errorf("Next() = %s, want %s", got.Format(time.DateTime), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"1,x * * * *",
+		"@every 30s",
+		"@every soon",
+		"@sometimes",
+	}
+	for _, spec := range specs {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) did not fail", spec)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	leaderLength         = 24
+	directoryEntryLength = 12
+	subfieldDelimiter    = 0x1f
+	fieldTerminator      = 0x1e
+	recordTerminator     = 0x1d
+	// defaultLeader describes a new, UTF-8 encoded language material monograph
+	defaultLeader = "00000nam a2200000 i 4500"
+)
+
+// BinaryReader reads records in the ISO 2709 exchange format
+type BinaryReader struct {
+	r     *bufio.Reader
+	count int
+}
+
+func NewBinaryReader(r io.Reader) *BinaryReader {
+	return &BinaryReader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, io.EOF at the end of the input or a *RecordError for a malformed record
+func (b *BinaryReader) Read() (Record, error) {
+	data, err := b.r.ReadBytes(recordTerminator)
+	// line breaks between records are common in files edited by hand
+	data = bytes.TrimLeft(data, "\r\n\t ")
+	if errors.Is(err, io.EOF) {
+		if len(bytes.TrimSpace(data)) == 0 {
+			return Record{}, io.EOF
+		}
+		b.count++
+		return Record{}, &RecordError{Record: b.count, Err: errors.New("the record terminator is missing")}
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	b.count++
+	record, err := parseBinary(data)
+	if err != nil {
+		return Record{}, &RecordError{Record: b.count, Err: err}
+	}
+	return record, nil
+}
+
+// parseBinary parses one record including its terminator
+func parseBinary(data []byte) (Record, error) {
+	var record Record
+	if len(data) < leaderLength+2 {
+		return record, errors.New("the record is shorter than its leader")
+	}
+	record.Leader = string(data[:leaderLength])
+	switch record.Leader[9] {
+	case 'a':
+		if !utf8.Valid(data) {
+			return record, errors.New("the leader declares UTF-8 but the record is not valid UTF-8")
+		}
+	case ' ':
+		// MARC-8 shares ASCII with UTF-8, only its extended characters would need converting
+		for _, c := range data {
+			if c >= 0x80 {
+				return record, errors.New("MARC-8 encoded characters are not supported, convert the file to UTF-8")
+			}
+		}
+	default:
+		return record, fmt.Errorf("unknown character coding %q in leader position 9", record.Leader[9])
+	}
+
+	base, err := strconv.Atoi(record.Leader[12:17])
+	if err != nil || base <= leaderLength || base > len(data) {
+		return record, fmt.Errorf("invalid base address of data %q", record.Leader[12:17])
+	}
+	if data[base-1] != fieldTerminator {
+		return record, errors.New("the directory is not terminated")
+	}
+	directory := data[leaderLength : base-1]
+	if len(directory)%directoryEntryLength != 0 {
+		return record, errors.New("the directory length is not a multiple of 12")
+	}
+	fields := data[base : len(data)-1]
+
+	for entry := 0; entry < len(directory); entry += directoryEntryLength {
+		tag := string(directory[entry : entry+3])
+		length, lengthErr := strconv.Atoi(string(directory[entry+3 : entry+7]))
+		start, startErr := strconv.Atoi(string(directory[entry+7 : entry+12]))
+		if !validTag(tag) || lengthErr != nil || startErr != nil || length < 1 || start < 0 || start+length > len(fields) {
+			return record, fmt.Errorf("invalid directory entry %q", directory[entry:entry+directoryEntryLength])
+		}
+		field := fields[start : start+length]
+		if field[len(field)-1] != fieldTerminator {
+			return record, fmt.Errorf("field %s is not terminated", tag)
+		}
+		field = field[:len(field)-1]
+
+		if isControlTag(tag) {
+			record.ControlFields = append(record.ControlFields, ControlField{Tag: tag, Value: string(field)})
+			continue
+		}
+		if len(field) < 2 {
+			return record, fmt.Errorf("field %s has no indicators", tag)
+		}
+		dataField := DataField{Tag: tag, Ind1: field[0], Ind2: field[1]}
+		for i, chunk := range bytes.Split(field[2:], []byte{subfieldDelimiter}) {
+			if i == 0 {
+				if len(chunk) > 0 {
+					return record, fmt.Errorf("field %s has data before its first subfield", tag)
+				}
+				continue
+			}
+			if len(chunk) == 0 {
+				return record, fmt.Errorf("field %s has a subfield without a code", tag)
+			}
+			dataField.Subfields = append(dataField.Subfields, Subfield{Code: chunk[0], Value: string(chunk[1:])})
+		}
+		record.DataFields = append(record.DataFields, dataField)
+	}
+	return record, nil
+}
+
+// MarshalBinary encodes the record in the ISO 2709 exchange format.
+// Record length, base address and the UTF-8 coding are set in the leader, its other positions are kept.
+func (r Record) MarshalBinary() ([]byte, error) {
+	var directory, fields bytes.Buffer
+	addField := func(tag string, data []byte) error {
+		if !validTag(tag) {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+		if len(data) > 9999 {
+			return fmt.Errorf("field %s is longer than 9999 bytes", tag)
+		}
+		if fields.Len() > 99999 {
+			return errors.New("the record is longer than 99999 bytes")
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(data), fields.Len())
+		fields.Write(data)
+		return nil
+	}
+
+	for _, field := range r.ControlFields {
+		if !isControlTag(field.Tag) {
+			return nil, fmt.Errorf("%s is not a control field tag", field.Tag)
+		}
+		if containsDelimiter(field.Value) {
+			return nil, fmt.Errorf("field %s contains a MARC delimiter", field.Tag)
+		}
+		if err := addField(field.Tag, append([]byte(field.Value), fieldTerminator)); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range r.DataFields {
+		if isControlTag(field.Tag) {
+			return nil, fmt.Errorf("%s is a control field tag", field.Tag)
+		}
+		data := []byte{indicator(field.Ind1), indicator(field.Ind2)}
+		for _, subfield := range field.Subfields {
+			if containsDelimiter(subfield.Value) || subfield.Code <= ' ' {
+				return nil, fmt.Errorf("subfield %s $%c contains a MARC delimiter", field.Tag, subfield.Code)
+			}
+			data = append(data, subfieldDelimiter, subfield.Code)
+			data = append(data, subfield.Value...)
+		}
+		if err := addField(field.Tag, append(data, fieldTerminator)); err != nil {
+			return nil, err
+		}
+	}
+	directory.WriteByte(fieldTerminator)
+
+	base := leaderLength + directory.Len()
+	length := base + fields.Len() + 1
+	if length > 99999 {
+		return nil, errors.New("the record is longer than 99999 bytes")
+	}
+	leader := []byte(r.leader())
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	out := make([]byte, 0, length)
+	out = append(out, leader...)
+	out = append(out, directory.Bytes()...)
+	out = append(out, fields.Bytes()...)
+	return append(out, recordTerminator), nil
+}
+
+// leader returns a 24 character leader for a record encoded as UTF-8
+func (r Record) leader() string {
+	leader := []byte(defaultLeader)
+	if len(r.Leader) == leaderLength {
+		leader = []byte(r.Leader)
+	}
+	leader[9] = 'a'
+	copy(leader[10:12], "22")
+	copy(leader[20:24], "4500")
+	return string(leader)
+}
+
+func containsDelimiter(value string) bool {
+	return strings.ContainsAny(value, "\x1d\x1e\x1f")
+}
+
+func indicator(c byte) byte {
+	if c == 0 {
+		return ' '
+	}
+	return c
+}
+
+// WriteBinary writes the records one after another in the ISO 2709 exchange format
+func WriteBinary(w io.Writer, records ...Record) error {
+	for _, record := range records {
+		data, err := record.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package marc
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"strconv"
+	"strings"
+)
+
+// subjectSeparator joins a 650 heading with its subdivisions, as in "Fantasy fiction -- History and criticism"
+const subjectSeparator = " -- "
+
+// ToBook maps a bibliographic record onto a book. It reads the ISBN from 020, the authors from 100 and 700,
+// the title from 245, the publisher and date from 264 (publication) or 260, and the subjects from 650.
+// ISBD punctuation that separates subfields is removed. The quantity is left to the caller.
+func ToBook(r Record) models.Book {
+	var book models.Book
+	if field, ok := first(r, "245"); ok {
+		book.Title = trimISBD(field.Value('a'), " /:;,=.")
+		if subtitle := trimISBD(field.Value('b'), " /:;,=."); subtitle != "" {
+			book.Title += " : " + subtitle
+		}
+	}
+	for _, field := range r.Fields("020") {
+		if isbn := strings.TrimSpace(field.Value('a')); isbn != "" {
+			// the qualifier follows the number, e.g. "0261102214 (pbk.)"
+			book.ISBN = NormalizeISBN(strings.Fields(isbn)[0])
+			break
+		}
+	}
+	for _, tag := range []string{"100", "700"} {
+		for _, field := range r.Fields(tag) {
+			if author := trimISBD(field.Value('a'), " ,"); author != "" {
+				book.Authors = append(book.Authors, author)
+			}
+		}
+	}
+	if field, ok := publication(r); ok {
+		book.Publisher = trimISBD(field.Value('b'), " ,:;")
+		book.PublicationDate = trimISBD(field.Value('c'), " ,;.")
+	}
+	for _, field := range r.Fields("650") {
+		var parts []string
+		for _, subfield := range field.Subfields {
+			switch subfield.Code {
+			case 'a', 'v', 'x', 'y', 'z':
+				if part := trimISBD(subfield.Value, " ."); part != "" {
+					parts = append(parts, part)
+				}
+			}
+		}
+		if len(parts) > 0 {
+			book.Subjects = append(book.Subjects, strings.Join(parts, subjectSeparator))
+		}
+	}
+	return book
+}
+
+// FromBook builds a record describing the book, its ID is the control number in 001
+func FromBook(book models.Book) Record {
+	record := Record{
+		Leader:        defaultLeader,
+		ControlFields: []ControlField{{Tag: "001", Value: strconv.Itoa(book.ID)}},
+	}
+	if book.ISBN != "" {
+		record.DataFields = append(record.DataFields, DataField{Tag: "020", Ind1: ' ', Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: book.ISBN}}})
+	}
+	// title added entry indicator: 1 when the title is traced under a main author entry
+	titleIndicator := byte('0')
+	for i, author := range book.Authors {
+		tag := "700"
+		if i == 0 {
+			tag = "100"
+			titleIndicator = '1'
+		}
+		record.DataFields = append(record.DataFields, DataField{Tag: tag, Ind1: '1', Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: author}}})
+	}
+	record.DataFields = append(record.DataFields, DataField{Tag: "245", Ind1: titleIndicator, Ind2: '0', Subfields: []Subfield{{Code: 'a', Value: book.Title}}})
+	if book.Publisher != "" || book.PublicationDate != "" {
+		field := DataField{Tag: "264", Ind1: ' ', Ind2: '1'}
+		if book.Publisher != "" {
+			field.Subfields = append(field.Subfields, Subfield{Code: 'b', Value: book.Publisher})
+		}
+		if book.PublicationDate != "" {
+			field.Subfields = append(field.Subfields, Subfield{Code: 'c', Value: book.PublicationDate})
+		}
+		record.DataFields = append(record.DataFields, field)
+	}
+	for _, subject := range book.Subjects {
+		field := DataField{Tag: "650", Ind1: ' ', Ind2: '0'}
+		for i, part := range strings.Split(subject, subjectSeparator) {
+			code := byte('x')
+			if i == 0 {
+				code = 'a'
+			}
+			field.Subfields = append(field.Subfields, Subfield{Code: code, Value: part})
+		}
+		record.DataFields = append(record.DataFields, field)
+	}
+	return record
+}
+
+// NormalizeISBN removes hyphens and spaces from an ISBN
+func NormalizeISBN(isbn string) string {
+	isbn = strings.NewReplacer("-", "", " ", "").Replace(isbn)
+	return strings.ToUpper(isbn)
+}
+
+// ValidISBN reports whether a normalized ISBN has the form of an ISBN-10 or ISBN-13
+func ValidISBN(isbn string) bool {
+	switch len(isbn) {
+	case 10:
+		return allDigits(isbn[:9]) && (allDigits(isbn[9:]) || isbn[9] == 'X')
+	case 13:
+		return allDigits(isbn)
+	default:
+		return false
+	}
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func first(r Record, tag string) (DataField, bool) {
+	fields := r.Fields(tag)
+	if len(fields) == 0 {
+		return DataField{}, false
+	}
+	return fields[0], true
+}
+
+// publication prefers the 264 publication statement over 260, which RDA records no longer use
+func publication(r Record) (DataField, bool) {
+	for _, field := range r.Fields("264") {
+		if field.Ind2 == '1' {
+			return field, true
+		}
+	}
+	return first(r, "260")
+}
+
+// trimISBD removes the punctuation that separates subfields from the end of a value
+func trimISBD(value string, cutset string) string {
+	return strings.TrimRight(strings.TrimSpace(value), cutset)
+}
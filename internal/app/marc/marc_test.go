@@ -0,0 +1,234 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"github.com/spin311/library-api/internal/repository/models"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sampleRecord() Record {
+	return Record{
+		Leader: "00000cam a2200000 i 4500",
+		ControlFields: []ControlField{
+			{Tag: "001", Value: "ocm12345"},
+			{Tag: "008", Value: "991105s1999    enk           000 1 eng d"},
+		},
+		DataFields: []DataField{
+			{Tag: "020", Ind1: ' ', Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: "0-261-10221-4 (pbk.)"}}},
+			{Tag: "100", Ind1: '1', Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: "Tolkien, J. R. R.,"}, {Code: 'd', Value: "1892-1973."}}},
+			{Tag: "245", Ind1: '1', Ind2: '4', Subfields: []Subfield{{Code: 'a', Value: "The hobbit :"}, {Code: 'b', Value: "or, There and back again /"}, {Code: 'c', Value: "J.R.R. Tolkien."}}},
+			{Tag: "260", Ind1: ' ', Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: "London :"}, {Code: 'b', Value: "Allen & Unwin,"}, {Code: 'c', Value: "1937."}}},
+			{Tag: "264", Ind1: ' ', Ind2: '1', Subfields: []Subfield{{Code: 'a', Value: "London :"}, {Code: 'b', Value: "HarperCollins,"}, {Code: 'c', Value: "1999."}}},
+			{Tag: "650", Ind1: ' ', Ind2: '0', Subfields: []Subfield{{Code: 'a', Value: "Middle Earth (Imaginary place)"}, {Code: 'v', Value: "Fiction."}}},
+			{Tag: "650", Ind1: ' ', Ind2: '0', Subfields: []Subfield{{Code: 'a', Value: "Dragons"}, {Code: 'v', Value: "Fiction."}}},
+			{Tag: "700", Ind1: '1', Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: "Anderson, Douglas A.,"}, {Code: 'e', Value: "editor."}}},
+			{Tag: "500", Ind1: ' ', Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: "Čeština, 日本語 and other UTF-8 text."}}},
+		},
+	}
+}
+
+func readAll(t *testing.T, reader Reader) []Record {
+	t.Helper()
+	var records []Record
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	want := sampleRecord()
+	var buf bytes.Buffer
+	if err := WriteBinary(&buf, want, want); err != nil {
+		t.Fatalf("WriteBinary() error = %v", err)
+	}
+	records := readAll(t, NewBinaryReader(bytes.NewReader(buf.Bytes())))
+	if len(records) != 2 {
+		t.Fatalf("read %d records, want 2", len(records))
+	}
+	got := records[0]
+	if !reflect.DeepEqual(got.ControlFields, want.ControlFields) || !reflect.DeepEqual(got.DataFields, want.DataFields) {
+		t.Errorf("round trip changed the record\n got: %+v\nwant: %+v", got, want)
+	}
+	if got.Leader[5:12] != want.Leader[5:12] {
+		t.Errorf("leader = %q, want the status, type and coding of %q", got.Leader, want.Leader)
+	}
+	again, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	if first, _ := want.MarshalBinary(); !bytes.Equal(again, first) {
+		t.Errorf("re-encoding a read record changed its bytes")
+	}
+}
+
+func TestBinaryLayout(t *testing.T) {
+	data, err := Record{DataFields: []DataField{{Tag: "245", Ind1: '0', Ind2: '0', Subfields: []Subfield{{Code: 'a', Value: "Title"}}}}}.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	// leader, one directory entry, the directory terminator, "00\x1faTitle\x1e" and the record terminator
+	want := "00048nam a2200037 i 4500" + "245001000000" + "\x1e" + "00\x1faTitle\x1e" + "\x1d"
+	if string(data) != want {
+		t.Errorf("MarshalBinary() = %q, want %q", data, want)
+	}
+}
+
+func TestBinaryReaderContinuesAfterMalformedRecord(t *testing.T) {
+	good, err := sampleRecord().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	broken := append([]byte(nil), good...)
+	copy(broken[12:17], "99999")
+	input := bytes.Join([][]byte{broken, good, []byte("\n")}, []byte("\n"))
+
+	reader := NewBinaryReader(bytes.NewReader(input))
+	_, err = reader.Read()
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) || recordErr.Record != 1 {
+		t.Fatalf("Read() error = %v, want a RecordError for record 1", err)
+	}
+	if _, err := reader.Read(); err != nil {
+		t.Fatalf("Read() after a malformed record error = %v", err)
+	}
+	if _, err := reader.Read(); !errors.Is(err, io.EOF) {
+		t.Fatalf("Read() at the end error = %v, want io.EOF", err)
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	want := sampleRecord()
+	var buf bytes.Buffer
+	if err := WriteXML(&buf, want); err != nil {
+		t.Fatalf("WriteXML() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), `<collection xmlns="`+Namespace+`">`) {
+		t.Errorf("WriteXML() did not write a MARC 21 slim collection:\n%s", buf.String())
+	}
+	records := readAll(t, NewXMLReader(&buf))
+	if len(records) != 1 {
+		t.Fatalf("read %d records, want 1", len(records))
+	}
+	if !reflect.DeepEqual(records[0], want) {
+		t.Errorf("round trip changed the record\n got: %+v\nwant: %+v", records[0], want)
+	}
+}
+
+func TestXMLReaderReadsPrefixedSingleRecord(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<marc:record xmlns:marc="http://www.loc.gov/MARC21/slim">
+  <marc:leader>00000nam a2200000 a 4500</marc:leader>
+  <marc:controlfield tag="001">42</marc:controlfield>
+  <marc:datafield tag="245" ind1="0" ind2="0"><marc:subfield code="a">Dune /</marc:subfield></marc:datafield>
+</marc:record>`
+	records := readAll(t, NewXMLReader(strings.NewReader(input)))
+	if len(records) != 1 {
+		t.Fatalf("read %d records, want 1", len(records))
+	}
+	if title := ToBook(records[0]).Title; title != "Dune" {
+		t.Errorf("title = %q, want Dune", title)
+	}
+}
+
+func TestToBook(t *testing.T) {
+	got := ToBook(sampleRecord())
+	want := models.Book{
+		Title: "The hobbit : or, There and back again",
+		Catalog: models.Catalog{
+			ISBN:            "0261102214",
+			Authors:         []string{"Tolkien, J. R. R.", "Anderson, Douglas A."},
+			Publisher:       "HarperCollins",
+			PublicationDate: "1999",
+			Subjects:        []string{"Middle Earth (Imaginary place) -- Fiction", "Dragons -- Fiction"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToBook()\n got: %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestToBookFallsBackTo260(t *testing.T) {
+	record := sampleRecord()
+	record.DataFields = record.Fields("260")
+	got := ToBook(record)
+	if got.Publisher != "Allen & Unwin" || got.PublicationDate != "1937" {
+		t.Errorf("publisher, date = %q, %q, want Allen & Unwin, 1937", got.Publisher, got.PublicationDate)
+	}
+}
+
+func TestBookRoundTrip(t *testing.T) {
+	books := []models.Book{
+		{
+			ID:    7,
+			Title: "The hobbit : or, There and back again",
+			Catalog: models.Catalog{
+				ISBN:            "9780261102217",
+				Authors:         []string{"Tolkien, J. R. R.", "Anderson, Douglas A."},
+				Publisher:       "HarperCollins",
+				PublicationDate: "c1999",
+				Subjects:        []string{"Middle Earth (Imaginary place) -- Fiction", "Bilbo Baggins (Fictitious character)"},
+			},
+		},
+		{ID: 8, Title: "Untitled notes"},
+	}
+	formats := map[string]struct {
+		write func(io.Writer, ...Record) error
+		read  func(io.Reader) Reader
+	}{
+		"binary":  {WriteBinary, func(r io.Reader) Reader { return NewBinaryReader(r) }},
+		"marcxml": {WriteXML, func(r io.Reader) Reader { return NewXMLReader(r) }},
+	}
+	for name, format := range formats {
+		for _, book := range books {
+			var buf bytes.Buffer
+			if err := format.write(&buf, FromBook(book)); err != nil {
+				t.Fatalf("%s: write error = %v", name, err)
+			}
+			records := readAll(t, format.read(&buf))
+			if len(records) != 1 {
+				t.Fatalf("%s: read %d records, want 1", name, len(records))
+			}
+			if id, _ := records[0].ControlField("001"); id != "7" && id != "8" {
+				t.Errorf("%s: 001 = %q, want the book ID", name, id)
+			}
+			got := ToBook(records[0])
+			want := models.Book{Title: book.Title, Catalog: book.Catalog}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: round trip of book %d\n got: %+v\nwant: %+v", name, book.ID, got, want)
+			}
+		}
+	}
+}
+
+func TestMarshalBinaryRejectsDelimiters(t *testing.T) {
+	record := FromBook(models.Book{ID: 1, Title: "Bad\x1dtitle"})
+	if _, err := record.MarshalBinary(); err == nil {
+		t.Error("MarshalBinary() accepted a value with a record terminator")
+	}
+}
+
+func TestValidISBN(t *testing.T) {
+	for isbn, want := range map[string]bool{
+		"0261102214":    true,
+		"080442957X":    true,
+		"9780261102217": true,
+		"978026110221":  false,
+		"02611O2214":    false,
+		"X261102214":    false,
+	} {
+		if got := ValidISBN(isbn); got != want {
+			t.Errorf("ValidISBN(%q) = %v, want %v", isbn, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package marc reads and writes MARC 21 bibliographic records in the ISO 2709 binary format and as MARCXML,
+// and maps them onto the catalog description of a book.
+package marc
+
+import "fmt"
+
+// Record is a MARC 21 record
+type Record struct {
+	// Leader is the 24 character record leader
+	Leader        string
+	ControlFields []ControlField
+	DataFields    []DataField
+}
+
+// ControlField is a field with a tag below 010, it has a value instead of indicators and subfields
+type ControlField struct {
+	Tag   string
+	Value string
+}
+
+type DataField struct {
+	Tag       string
+	Ind1      byte
+	Ind2      byte
+	Subfields []Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// Reader is implemented by BinaryReader and XMLReader
+type Reader interface {
+	// Read returns the next record, io.EOF at the end of the input or a *RecordError for a malformed record
+	Read() (Record, error)
+}
+
+// RecordError reports a malformed record, readers continue with the next record after it
+type RecordError struct {
+	// Record is the position of the record in the file, starting at 1
+	Record int
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Fields returns the data fields with the given tag in record order
+func (r Record) Fields(tag string) []DataField {
+	var fields []DataField
+	for _, field := range r.DataFields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// ControlField returns the value of the control field with the given tag
+func (r Record) ControlField(tag string) (string, bool) {
+	for _, field := range r.ControlFields {
+		if field.Tag == tag {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns the values of the subfields with the given code
+func (f DataField) Values(code byte) []string {
+	var values []string
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			values = append(values, subfield.Value)
+		}
+	}
+	return values
+}
+
+// Value returns the first subfield with the given code
+func (f DataField) Value(code byte) string {
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			return subfield.Value
+		}
+	}
+	return ""
+}
+
+func isControlTag(tag string) bool {
+	return tag < "010"
+}
+
+func validTag(tag string) bool {
+	if len(tag) != 3 {
+		return false
+	}
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
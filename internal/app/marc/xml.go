@@ -0,0 +1,150 @@
+package marc
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Namespace is the MARC 21 slim schema namespace of MARCXML documents
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlCollection struct {
+	XMLName xml.Name    `xml:"http://www.loc.gov/MARC21/slim collection"`
+	Records []xmlRecord `xml:"record"`
+}
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XMLReader reads the records of a MARCXML collection or a single MARCXML record, in any namespace
+type XMLReader struct {
+	decoder *xml.Decoder
+	count   int
+}
+
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{decoder: xml.NewDecoder(r)}
+}
+
+// Read returns the next record, io.EOF at the end of the document or a *RecordError for a malformed record.
+// Errors in the XML itself end the document and are returned as they are.
+func (x *XMLReader) Read() (Record, error) {
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return Record{}, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var element xmlRecord
+		if err := x.decoder.DecodeElement(&element, &start); err != nil {
+			return Record{}, err
+		}
+		x.count++
+		record, err := element.record()
+		if err != nil {
+			return Record{}, &RecordError{Record: x.count, Err: err}
+		}
+		return record, nil
+	}
+}
+
+func (e xmlRecord) record() (Record, error) {
+	record := Record{Leader: e.Leader}
+	if len(e.Leader) != leaderLength {
+		return record, fmt.Errorf("the leader has %d characters instead of 24", len(e.Leader))
+	}
+	for _, field := range e.ControlFields {
+		if !validTag(field.Tag) || !isControlTag(field.Tag) {
+			return record, fmt.Errorf("invalid control field tag %q", field.Tag)
+		}
+		record.ControlFields = append(record.ControlFields, ControlField{Tag: field.Tag, Value: field.Value})
+	}
+	for _, field := range e.DataFields {
+		if !validTag(field.Tag) || isControlTag(field.Tag) {
+			return record, fmt.Errorf("invalid data field tag %q", field.Tag)
+		}
+		if len(field.Ind1) != 1 || len(field.Ind2) != 1 {
+			return record, fmt.Errorf("field %s must have one character indicators", field.Tag)
+		}
+		dataField := DataField{Tag: field.Tag, Ind1: field.Ind1[0], Ind2: field.Ind2[0]}
+		for _, subfield := range field.Subfields {
+			if len(subfield.Code) != 1 {
+				return record, fmt.Errorf("field %s has an invalid subfield code %q", field.Tag, subfield.Code)
+			}
+			dataField.Subfields = append(dataField.Subfields, Subfield{Code: subfield.Code[0], Value: subfield.Value})
+		}
+		record.DataFields = append(record.DataFields, dataField)
+	}
+	return record, nil
+}
+
+func xmlFromRecord(r Record) xmlRecord {
+	element := xmlRecord{Leader: r.leader()}
+	for _, field := range r.ControlFields {
+		element.ControlFields = append(element.ControlFields, xmlControlField{Tag: field.Tag, Value: field.Value})
+	}
+	for _, field := range r.DataFields {
+		dataField := xmlDataField{Tag: field.Tag, Ind1: string(indicator(field.Ind1)), Ind2: string(indicator(field.Ind2))}
+		for _, subfield := range field.Subfields {
+			dataField.Subfields = append(dataField.Subfields, xmlSubfield{Code: string(subfield.Code), Value: subfield.Value})
+		}
+		element.DataFields = append(element.DataFields, dataField)
+	}
+	return element
+}
+
+// MarshalXML encodes the record as a MARCXML record element in the MARC 21 slim namespace,
+// so it can be embedded in other XML documents such as SRU responses
+func (r Record) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if len(r.Leader) != 0 && len(r.Leader) != leaderLength {
+		return errors.New("the leader must have 24 characters")
+	}
+	return e.EncodeElement(xmlFromRecord(r), xml.StartElement{Name: xml.Name{Space: Namespace, Local: "record"}})
+}
+
+// WriteXML writes the records as a MARCXML collection
+func WriteXML(w io.Writer, records ...Record) error {
+	var collection xmlCollection
+	for _, record := range records {
+		if len(record.Leader) != 0 && len(record.Leader) != leaderLength {
+			return errors.New("the leader must have 24 characters")
+		}
+		collection.Records = append(collection.Records, xmlFromRecord(record))
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(collection); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
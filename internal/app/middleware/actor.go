@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	ActorHeader     = "X-Actor"
+
+	maxRequestIDLength = 128
+	maxActorLength     = 255
+)
+
+// Actor records who makes each request, so changes can be attributed in the audit log.
+// The actor is the common name of a verified client certificate, otherwise anonymous.
+// The X-Actor header is set freely by the client, so it is only recorded as the claimed actor next to it.
+// Every request also gets a request ID, taken from X-Request-ID when the client sends a usable one,
+// which is echoed in the response.
+func Actor(trustProxy bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestId := RequestID(r.Header.Get(RequestIDHeader))
+			w.Header().Set(RequestIDHeader, requestId)
+
+			actor := models.Actor{
+				Name:      ActorName(r.TLS),
+				Claimed:   ClaimedActor(r.Header.Get(ActorHeader)),
+				RequestID: requestId,
+				ClientIP:  ClientIP(r, trustProxy),
+			}
+			next.ServeHTTP(w, r.WithContext(helpers.WithActor(r.Context(), actor)))
+		})
+	}
+}
+
+// RequestID returns the request ID sent by the client if it is usable, otherwise a new random one
+func RequestID(sent string) string {
+	if printable(sent, maxRequestIDLength) {
+		return sent
+	}
+	return newRequestID()
+}
+
+// ActorName returns the common name of a verified client certificate, otherwise anonymous
+func ActorName(state *tls.ConnectionState) string {
+	if name := certName(state); name != "" {
+		return name
+	}
+	return models.AnonymousActor
+}
+
+// ClaimedActor returns the actor a client claims to be if it is usable, otherwise an empty string
+func ClaimedActor(claimed string) string {
+	if name := strings.TrimSpace(claimed); printable(name, maxActorLength) {
+		return name
+	}
+	return ""
+}
+
+// certName returns "cert:" and the common name of a verified client certificate, or an empty string without one
+func certName(state *tls.ConnectionState) string {
+	if state != nil && len(state.VerifiedChains) > 0 {
+		if name := state.VerifiedChains[0][0].Subject.CommonName; name != "" {
+			return "cert:" + name
+		}
+	}
+	return ""
+}
+
+// printable reports whether s is non-empty, at most max bytes long and free of control characters
+func printable(s string, max int) bool {
+	if s == "" || len(s) > max {
+		return false
+	}
+	for _, c := range s {
+		if unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodyBytes  = 1 << 20
+)
+
+// Idempotent honors the Idempotency-Key header: the first request with a key is executed and its response stored,
+// retries with the same key and payload get the stored response replayed instead of being executed again.
+// Requests without the header are passed through unchanged.
+func Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			helpers.WriteHttpErrorResponse(w, models.NewHttpError(fmt.Sprintf("Idempotency-Key must not be longer than %d characters", maxIdempotencyKeyLength), http.StatusBadRequest))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			helpers.WriteErrorResponse(w, err, http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+		record, reserved, httpErr := services.ReserveIdempotencyKey(key, fingerprint)
+		if !models.IsHttpErrorEmpty(httpErr) {
+			helpers.WriteHttpErrorResponse(w, httpErr)
+			return
+		}
+
+		if !reserved {
+			replayIdempotentResponse(w, record, fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		stopRenewing := renewWhileRunning(key)
+		next.ServeHTTP(recorder, r)
+		stopRenewing()
+
+		// server errors are not stored so the client can retry with the same key
+		if recorder.statusCode >= http.StatusInternalServerError {
+			if releaseErr := services.ReleaseIdempotencyKey(key); !models.IsHttpErrorEmpty(releaseErr) {
+				log.Println(releaseErr)
+			}
+			return
+		}
+		record.Completed = true
+		record.StatusCode = recorder.statusCode
+		record.ContentType = w.Header().Get("Content-Type")
+		record.Body = recorder.body.Bytes()
+		if saveErr := services.SaveIdempotentResponse(record); !models.IsHttpErrorEmpty(saveErr) {
+			log.Println(saveErr)
+		}
+	})
+}
+
+// renewWhileRunning keeps renewing the reservation of key until the returned function is called,
+// so a slow request is not taken over by a retry while it is still running
+func renewWhileRunning(key string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(services.IdempotencyLease() / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := services.RenewIdempotencyKey(key); !models.IsHttpErrorEmpty(err) {
+					log.Println(err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, record models.IdempotencyRecord, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity))
+		return
+	}
+	if !record.Completed {
+		helpers.WriteHttpErrorResponse(w, models.NewHttpError("a request with this Idempotency-Key is still being processed", http.StatusConflict))
+		return
+	}
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	_, err := w.Write(record.Body)
+	if err != nil {
+		log.Printf("failed to replay idempotent response: %v", err)
+	}
+}
+
+// requestFingerprint identifies the payload a key was first used with: method, path, query and body.
+// The query is canonicalised, so parameters in a different order still match, but e.g. damaged=true does not match damaged=false.
+func requestFingerprint(r *http.Request, body []byte) string {
+	target := r.URL.Path
+	if query := r.URL.Query().Encode(); query != "" {
+		target += "?" + query
+	}
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + target + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder passes the response through while keeping a copy of the status code and body
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/repository/models"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	KeyByIP     = "ip"
+	KeyByAPIKey = "api_key"
+	KeyByUser   = "user"
+)
+
+// Limit is a token bucket budget: Requests tokens are refilled every Period and at most Burst can be saved up
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+	// KeyBy selects what a bucket belongs to: ip, api_key or user, empty uses the limiter default
+	KeyBy string
+}
+
+func (l Limit) capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// ratePerSecond is the refill rate of the bucket
+func (l Limit) ratePerSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Decision is the outcome of taking a token from the buckets of a request.
+// It describes the bucket with the fewest tokens left, or the empty bucket that takes longest to refill.
+type Decision struct {
+	Allowed    bool
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets. MemoryStore is used by default,
+// a shared implementation (e.g. Redis or PostgreSQL) lets several replicas enforce one budget.
+// Take checks every bucket in keys and takes a token from all of them only if each has one left,
+// so a request rejected by one bucket does not drain the others.
+type Store interface {
+	Take(ctx context.Context, keys []string, limit Limit) (Decision, error)
+}
+
+type RateLimitOptions struct {
+	Default Limit
+	// Routes holds per-route budgets keyed by "METHOD /path/template", e.g. "POST /users"
+	Routes map[string]Limit
+	KeyBy  string
+	// APIKeys are the X-API-Key values that get a bucket of their own, other keys are ignored
+	APIKeys []string
+	// TrustProxy takes the client IP from X-Forwarded-For, only enable it behind a reverse proxy
+	TrustProxy bool
+	Store      Store
+}
+
+// RateLimit rejects requests with 429 Too Many Requests once the client's bucket for the route is empty.
+// Routes without their own budget share the default bucket of the client.
+func RateLimit(opts RateLimitOptions) mux.MiddlewareFunc {
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	apiKeys := make(map[string]bool, len(opts.APIKeys))
+	for _, apiKey := range opts.APIKeys {
+		apiKeys[apiKey] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			routeKey := routeKey(r)
+			limit, ok := opts.Routes[routeKey]
+			if !ok {
+				limit = opts.Default
+				routeKey = "*"
+			}
+			if limit.Requests <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			keyBy := limit.KeyBy
+			if keyBy == "" {
+				keyBy = opts.KeyBy
+			}
+
+			keys := bucketKeys(r, keyBy, apiKeys, opts.TrustProxy)
+			for i, key := range keys {
+				keys[i] = routeKey + "|" + key
+			}
+			decision, err := opts.Store.Take(r.Context(), keys, limit)
+			if err != nil {
+				// fail open, an unavailable store must not take the API down
+				log.Printf("rate limit store error: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			writeRateLimitHeaders(w, limit, decision)
+			if !decision.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+				helpers.WriteHttpErrorResponse(w, models.NewHttpError("too many requests, please retry later", http.StatusTooManyRequests))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeRateLimitHeaders(w http.ResponseWriter, limit Limit, decision Decision) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.capacity()))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.ResetAfter)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period)))
+}
+
+func routeKey(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return r.Method + " " + r.URL.Path
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return r.Method + " " + r.URL.Path
+	}
+	return r.Method + " " + template
+}
+
+// bucketKeys returns the buckets a request is counted against. Beyond its IP a client is only identified by
+// what it cannot choose freely: a configured API key, otherwise a verified client certificate.
+// With key_by user the targeted user's bucket is charged in addition to the client's,
+// so a client cannot get fresh buckets by switching users and many clients cannot flood one user.
+func bucketKeys(r *http.Request, keyBy string, apiKeys map[string]bool, trustProxy bool) []string {
+	client := "ip:" + ClientIP(r, trustProxy)
+	if keyBy == KeyByIP {
+		return []string{client}
+	}
+	if name := certName(r.TLS); name != "" {
+		client = name
+	}
+	switch keyBy {
+	case KeyByAPIKey:
+		if apiKey := r.Header.Get("X-API-Key"); apiKeys[apiKey] {
+			// the key itself is not kept in the store
+			sum := sha256.Sum256([]byte(apiKey))
+			return []string{"key:" + hex.EncodeToString(sum[:16])}
+		}
+	case KeyByUser:
+		if userId := mux.Vars(r)["userId"]; userId != "" {
+			return []string{client, "user:" + userId}
+		}
+	}
+	return []string{client}
+}
+
+// ClientIP returns the address of the client, optionally taken from the first X-Forwarded-For entry
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are removed from the MemoryStore
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// fullAt is when the bucket will be refilled, after that it can be dropped
+	fullAt time.Time
+}
+
+// MemoryStore keeps token buckets in process memory, so every replica enforces its own budget
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, keys []string, limit Limit) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	capacity := float64(limit.capacity())
+	rate := limit.ratePerSecond()
+	s.sweep(now)
+
+	// refill every bucket first, the request is allowed only if none of them is empty
+	buckets := make([]*bucket, len(keys))
+	allowed := true
+	for i, key := range keys {
+		b, ok := s.buckets[key]
+		if !ok {
+			b = &bucket{tokens: capacity, updatedAt: now}
+			s.buckets[key] = b
+		}
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+		b.updatedAt = now
+		buckets[i] = b
+		if b.tokens < 1 {
+			allowed = false
+		}
+	}
+
+	var result Decision
+	for i, b := range buckets {
+		decision := Decision{Allowed: allowed}
+		if allowed {
+			b.tokens--
+		} else if b.tokens < 1 {
+			decision.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+		}
+		decision.Remaining = int(b.tokens)
+		decision.ResetAfter = secondsToDuration((capacity - b.tokens) / rate)
+		b.fullAt = now.Add(decision.ResetAfter)
+		if i == 0 || decision.RetryAfter > result.RetryAfter ||
+			(decision.RetryAfter == result.RetryAfter && decision.Remaining < result.Remaining) {
+			result = decision
+		}
+	}
+	return result, nil
+}
+
+// sweep drops buckets that are full again, a new bucket starts full so nothing is lost
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.After(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
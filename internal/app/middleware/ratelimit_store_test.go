@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTakesFromAllBucketsOrNone(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: time.Minute}
+
+	take := func(keys ...string) Decision {
+		t.Helper()
+		decision, err := store.Take(context.Background(), keys, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decision
+	}
+
+	// client a empties the bucket of user 1
+	take("ip:a", "user:1")
+	if decision := take("ip:a", "user:1"); !decision.Allowed || decision.Remaining != 0 {
+		t.Fatalf("second request of a: %+v", decision)
+	}
+
+	// client b is rejected on user 1 and keeps its own tokens
+	decision := take("ip:b", "user:1")
+	if decision.Allowed || decision.Remaining != 0 || decision.RetryAfter != 30*time.Second {
+		t.Fatalf("request of b on user 1: %+v, want a rejection retrying after 30s", decision)
+	}
+	if decision := take("ip:b", "user:2"); !decision.Allowed || decision.Remaining != 1 {
+		t.Errorf("request of b on user 2: %+v, want 1 token left in b's bucket", decision)
+	}
+
+	// the reported bucket is the one with the fewest tokens left
+	if decision := take("ip:c", "user:2"); !decision.Allowed || decision.Remaining != 0 {
+		t.Errorf("request of c on user 2: %+v, want user 2's bucket with 0 tokens left", decision)
+	}
+
+	now = now.Add(30 * time.Second)
+	if decision := take("ip:b", "user:1"); !decision.Allowed {
+		t.Errorf("request of b on user 1 after a refill: %+v", decision)
+	}
+}
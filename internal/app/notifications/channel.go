@@ -0,0 +1,23 @@
+// Package notifications sends due date reminders and overdue notices to patrons over pluggable channels.
+package notifications
+
+import (
+	"context"
+	"github.com/spin311/library-api/internal/repository/models"
+)
+
+// Message is a rendered notification ready to be sent
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Channel delivers messages to patrons, e.g. by email or SMS
+type Channel interface {
+	// Name is the channel stored with every notification, models.ChannelEmail or models.ChannelSMS
+	Name() string
+	// Recipient returns the address of the user on this channel and whether the user opted in to it
+	Recipient(user models.User) (string, bool)
+	Send(ctx context.Context, message Message) error
+}
@@ -0,0 +1,92 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"log"
+	"slices"
+	"time"
+)
+
+// sendTimeout bounds a single send so an unresponsive server cannot stall the whole run
+const sendTimeout = 30 * time.Second
+
+// Notifier looks for loans that are due soon or overdue and notifies their patrons on every channel
+// they opted in to. Each loan gets each kind of notice at most once per channel, failed sends are
+// recorded and retried with exponential backoff starting at RetryBackoff, up to MaxAttempts times.
+// It runs as the notifications job.
+type Notifier struct {
+	Channels      []Channel
+	DueSoonDays   int
+	DefaultLocale string
+	MaxAttempts   int
+	RetryBackoff  time.Duration
+}
+
+// Run sends every notice that is due now
+func (n *Notifier) Run(ctx context.Context) (string, error) {
+	var sent, failed int
+	for _, kind := range []string{models.NotificationDueSoon, models.NotificationOverdue} {
+		notices, err := services.GetLoansForNotification(kind, n.DueSoonDays, n.MaxAttempts, n.RetryBackoff)
+		if !models.IsHttpErrorEmpty(err) {
+			return "", errors.New(err.Message)
+		}
+		for _, notice := range notices {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			noticeSent, noticeFailed := n.notify(ctx, kind, notice)
+			sent += noticeSent
+			failed += noticeFailed
+		}
+	}
+	return fmt.Sprintf("sent %d notifications, %d failed", sent, failed), nil
+}
+
+// notify sends a notice on every channel it is still due on and returns how many sends succeeded and failed
+func (n *Notifier) notify(ctx context.Context, kind string, notice models.LoanNotice) (sent int, failed int) {
+	now := time.Now()
+	for _, channel := range n.Channels {
+		if slices.Contains(notice.SkipChannels, channel.Name()) {
+			continue
+		}
+		recipient, ok := channel.Recipient(notice.User)
+		if !ok {
+			continue
+		}
+
+		borrowId := notice.BorrowID
+		notification := models.Notification{
+			UserID:    notice.User.ID,
+			BorrowID:  &borrowId,
+			Kind:      kind,
+			Channel:   channel.Name(),
+			Recipient: recipient,
+			Status:    models.NotificationSent,
+		}
+		message, err := render(kind, channel.Name(), notice, n.DefaultLocale, now)
+		if err == nil {
+			message.To = recipient
+			notification.Subject = message.Subject
+			notification.Body = message.Body
+			sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+			err = channel.Send(sendCtx, message)
+			cancel()
+		}
+		if err != nil {
+			log.Printf("failed to send %s notice for loan %d by %s: %v", kind, notice.BorrowID, channel.Name(), err)
+			notification.Status = models.NotificationFailed
+			notification.Error = err.Error()
+			failed++
+		} else {
+			sent++
+		}
+		if err := services.RecordNotification(notification); !models.IsHttpErrorEmpty(err) {
+			log.Println(err)
+		}
+	}
+	return sent, failed
+}
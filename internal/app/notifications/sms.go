@@ -0,0 +1,69 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SMSChannel sends notifications through a generic HTTP SMS gateway.
+// Every message is POSTed as {"to": "...", "message": "..."} with the token as a bearer token,
+// any non-2xx answer counts as a failed send.
+type SMSChannel struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func NewSMSChannel(url string, token string, timeout time.Duration) *SMSChannel {
+	return &SMSChannel{
+		URL:    url,
+		Token:  token,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *SMSChannel) Name() string {
+	return models.ChannelSMS
+}
+
+func (c *SMSChannel) Recipient(user models.User) (string, bool) {
+	return user.Phone, user.NotifySMS && user.Phone != ""
+}
+
+func (c *SMSChannel) Send(ctx context.Context, message Message) error {
+	body, err := json.Marshal(map[string]string{"to": message.To, "message": message.Body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(body io.ReadCloser) {
+		_, _ = io.Copy(io.Discard, body)
+		err := body.Close()
+		if err != nil {
+			return
+		}
+	}(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("SMS gateway answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package notifications
+
+import (
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// noticeData is what the templates can refer to
+type noticeData struct {
+	FirstName string
+	LastName  string
+	BookTitle string
+	DueDate   string
+	// Days is the number of days until the due date for reminders and since the due date for overdue notices
+	Days int
+}
+
+// localized holds the templates of one kind of notice in one language.
+// Email uses Subject and Body, SMS only the shorter SMS text.
+type localized struct {
+	Subject string
+	Body    string
+	SMS     string
+}
+
+type locale struct {
+	DateFormat string
+	Notices    map[string]localized
+}
+
+var locales = map[string]locale{
+	"en": {
+		DateFormat: "January 2, 2006",
+		Notices: map[string]localized{
+			models.NotificationDueSoon: {
+				Subject: `"{{.BookTitle}}" is due on {{.DueDate}}`,
+				Body: `Dear {{.FirstName}} {{.LastName}},
+
+this is a reminder that "{{.BookTitle}}" is due {{if eq .Days 0}}today{{else if eq .Days 1}}tomorrow{{else}}in {{.Days}} days{{end}}, on {{.DueDate}}.
+Please return it on time so other readers can enjoy it too.
+
+Your library`,
+				SMS: `Library: "{{.BookTitle}}" is due on {{.DueDate}}.`,
+			},
+			models.NotificationOverdue: {
+				Subject: `"{{.BookTitle}}" is overdue`,
+				Body: `Dear {{.FirstName}} {{.LastName}},
+
+"{{.BookTitle}}" was due on {{.DueDate}} and is {{.Days}} {{if eq .Days 1}}day{{else}}days{{end}} overdue.
+Please return it as soon as possible.
+
+Your library`,
+				SMS: `Library: "{{.BookTitle}}" was due on {{.DueDate}}, please return it.`,
+			},
+		},
+	},
+	"sl": {
+		DateFormat: "2. 1. 2006",
+		Notices: map[string]localized{
+			models.NotificationDueSoon: {
+				Subject: `Rok vračila za "{{.BookTitle}}" je {{.DueDate}}`,
+				Body: `Spoštovani {{.FirstName}} {{.LastName}},
+
+opominjamo vas, da je rok vračila za "{{.BookTitle}}" {{if eq .Days 0}}danes{{else if eq .Days 1}}jutri{{else}}čez {{.Days}} dni{{end}}, {{.DueDate}}.
+Prosimo, vrnite gradivo pravočasno, da ga bodo lahko uživali tudi drugi bralci.
+
+Vaša knjižnica`,
+				SMS: `Knjiznica: rok vracila za "{{.BookTitle}}" je {{.DueDate}}.`,
+			},
+			models.NotificationOverdue: {
+				Subject: `Zamuda pri vračilu "{{.BookTitle}}"`,
+				Body: `Spoštovani {{.FirstName}} {{.LastName}},
+
+rok vračila za "{{.BookTitle}}" je potekel {{.DueDate}}, zamujate {{.Days}} dni.
+Prosimo, vrnite gradivo čim prej.
+
+Vaša knjižnica`,
+				SMS: `Knjiznica: rok vracila za "{{.BookTitle}}" je potekel {{.DueDate}}, prosimo vrnite gradivo.`,
+			},
+		},
+	},
+}
+
+// render fills in the templates of a notice in the patron's locale, falling back first to the
+// language without region (sl-SI to sl) and then to defaultLocale
+func render(kind string, channel string, notice models.LoanNotice, defaultLocale string, now time.Time) (Message, error) {
+	lang := resolveLocale(notice.User.Locale, defaultLocale)
+	loc, ok := locales[lang]
+	if !ok {
+		return Message{}, fmt.Errorf("no notification templates for locale %q", lang)
+	}
+	texts, ok := loc.Notices[kind]
+	if !ok {
+		return Message{}, fmt.Errorf("no %s template for locale %q", kind, lang)
+	}
+
+	data := noticeData{
+		FirstName: notice.User.FirstName,
+		LastName:  notice.User.LastName,
+		BookTitle: notice.BookTitle,
+		DueDate:   notice.DueAt.Format(loc.DateFormat),
+		Days:      daysBetween(now, notice.DueAt),
+	}
+
+	var message Message
+	var err error
+	if channel == models.ChannelSMS {
+		message.Body, err = execute(texts.SMS, data)
+		return message, err
+	}
+	if message.Subject, err = execute(texts.Subject, data); err != nil {
+		return message, err
+	}
+	message.Body, err = execute(texts.Body, data)
+	return message, err
+}
+
+func resolveLocale(name string, defaultLocale string) string {
+	if _, ok := locales[name]; ok {
+		return name
+	}
+	if lang, _, ok := strings.Cut(name, "-"); ok {
+		if _, ok := locales[lang]; ok {
+			return lang
+		}
+	}
+	return defaultLocale
+}
+
+func execute(text string, data noticeData) (string, error) {
+	tmpl, err := template.New("notice").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// daysBetween returns the whole number of calendar days between two times, regardless of order
+func daysBetween(a time.Time, b time.Time) int {
+	dayA := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	dayB := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(dayB.Sub(dayA).Hours() / 24)
+	if days < 0 {
+		return -days
+	}
+	return days
+}
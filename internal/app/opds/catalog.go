@@ -0,0 +1,253 @@
+package opds
+
+import (
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const catalogName = "Library API"
+
+// PageSize is the number of entries on a page of a feed
+const PageSize = 25
+
+// Paths of the catalog documents
+const (
+	RootPath       = "/opds"
+	NewPath        = "/opds/new"
+	AuthorsPath    = "/opds/authors"
+	SubjectsPath   = "/opds/subjects"
+	BooksPath      = "/opds/books"
+	SearchPath     = "/opds/search"
+	OpenSearchPath = "/opds/opensearch.xml"
+)
+
+// headingFeeds describes the navigation feed of each heading kind
+var headingFeeds = map[string]struct {
+	path  string
+	title string
+}{
+	models.HeadingAuthor:  {AuthorsPath, "By author"},
+	models.HeadingSubject: {SubjectsPath, "By subject"},
+}
+
+// Root returns the navigation feed the catalog starts at
+func Root() (Feed, models.HttpError) {
+	page, httpErr := services.SearchBooks(models.BookQuery{})
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return Feed{}, httpErr
+	}
+	feed := newFeed("urn:library:opds", catalogName, page.Updated)
+	feed.Links = append(commonLinks(RootPath, NavigationType), Link{Rel: relNew, Href: NewPath, Type: AcquisitionType, Title: "New arrivals"})
+	updated := timestamp(page.Updated)
+	feed.Entries = []Entry{
+		navigationEntry("urn:library:opds:new", "New arrivals", updated, fmt.Sprintf("All %s, most recently added first", bookCount(page.Total)),
+			Link{Rel: relNew, Href: NewPath, Type: AcquisitionType}),
+		navigationEntry("urn:library:opds:author", "By author", updated, "Books grouped by author",
+			Link{Rel: relSubsection, Href: AuthorsPath, Type: NavigationType}),
+		navigationEntry("urn:library:opds:subject", "By subject", updated, "Books grouped by subject",
+			Link{Rel: relSubsection, Href: SubjectsPath, Type: NavigationType}),
+	}
+	return feed, models.NewEmptyHttpError()
+}
+
+// NewArrivals returns a page of the acquisition feed of all books, most recently added first
+func NewArrivals(page int) (Feed, models.HttpError) {
+	return acquisitionFeed("urn:library:opds:new", "New arrivals", NewPath, url.Values{}, models.BookQuery{}, page)
+}
+
+// Headings returns a page of the navigation feed listing every author or subject
+func Headings(kind string, page int) (Feed, models.HttpError) {
+	headingFeed, ok := headingFeeds[kind]
+	if !ok {
+		return Feed{}, models.NewHttpError(fmt.Sprintf("unknown heading kind %q", kind), http.StatusNotFound)
+	}
+	headings, httpErr := services.GetHeadings(kind, PageSize, (page-1)*PageSize)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return Feed{}, httpErr
+	}
+	if httpErr := checkPage(page, headings.Total); !models.IsHttpErrorEmpty(httpErr) {
+		return Feed{}, httpErr
+	}
+	feed := newFeed("urn:library:opds:"+kind, headingFeed.title, headings.Updated)
+	feed.Links = append(commonLinks(pageHref(headingFeed.path, url.Values{}, page), NavigationType), Link{Rel: relUp, Href: RootPath, Type: NavigationType})
+	feed.Links = append(feed.Links, pageLinks(headingFeed.path, url.Values{}, page, headings.Total, NavigationType)...)
+	paginate(&feed, page, headings.Total)
+	updated := timestamp(headings.Updated)
+	for _, heading := range headings.Headings {
+		query := url.Values{kind: {heading.Name}}
+		feed.Entries = append(feed.Entries, navigationEntry("urn:library:opds:"+kind+":"+url.QueryEscape(heading.Name), heading.Name, updated,
+			bookCount(heading.Books), Link{Rel: relSubsection, Href: BooksPath + "?" + query.Encode(), Type: AcquisitionType}))
+	}
+	return feed, models.NewEmptyHttpError()
+}
+
+// BooksBy returns a page of the acquisition feed of the books with an author or subject heading
+func BooksBy(kind string, name string, page int) (Feed, models.HttpError) {
+	query := models.BookQuery{}
+	switch kind {
+	case models.HeadingAuthor:
+		query.Author = name
+	case models.HeadingSubject:
+		query.Subject = name
+	default:
+		return Feed{}, models.NewHttpError(fmt.Sprintf("unknown heading kind %q", kind), http.StatusNotFound)
+	}
+	feed, httpErr := acquisitionFeed("urn:library:opds:"+kind+":"+url.QueryEscape(name), name, BooksPath, url.Values{kind: {name}}, query, page)
+	if models.IsHttpErrorEmpty(httpErr) {
+		feed.Links = append(feed.Links, Link{Rel: relUp, Href: headingFeeds[kind].path, Type: NavigationType})
+	}
+	return feed, httpErr
+}
+
+// Search returns a page of the acquisition feed of the books matching the search terms
+func Search(terms string, page int) (Feed, models.HttpError) {
+	return acquisitionFeed("urn:library:opds:search:"+url.QueryEscape(terms), fmt.Sprintf("Search results for %q", terms), SearchPath,
+		url.Values{"q": {terms}}, models.BookQuery{Search: terms}, page)
+}
+
+func acquisitionFeed(id string, title string, path string, params url.Values, query models.BookQuery, page int) (Feed, models.HttpError) {
+	query.Limit = PageSize
+	query.Offset = (page - 1) * PageSize
+	books, httpErr := services.SearchBooks(query)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return Feed{}, httpErr
+	}
+	if httpErr := checkPage(page, books.Total); !models.IsHttpErrorEmpty(httpErr) {
+		return Feed{}, httpErr
+	}
+	feed := newFeed(id, title, books.Updated)
+	feed.Links = append(commonLinks(pageHref(path, params, page), AcquisitionType), pageLinks(path, params, page, books.Total, AcquisitionType)...)
+	paginate(&feed, page, books.Total)
+	for _, book := range books.Books {
+		feed.Entries = append(feed.Entries, bookEntry(book))
+	}
+	return feed, models.NewEmptyHttpError()
+}
+
+// bookEntry describes a book with its availability on the borrow link
+func bookEntry(book models.ListedBook) Entry {
+	entry := Entry{
+		ID:        "urn:library:book:" + strconv.Itoa(book.ID),
+		Title:     book.Title,
+		Updated:   timestamp(book.AddedAt),
+		Publisher: book.Publisher,
+		Issued:    book.PublicationDate,
+		Content:   &Content{Type: "text", Value: copiesAvailable(book.AvailableCount)},
+	}
+	if book.ISBN != "" {
+		entry.Identifier = "urn:isbn:" + book.ISBN
+	}
+	for _, author := range book.Authors {
+		entry.Authors = append(entry.Authors, Person{Name: author})
+	}
+	for _, subject := range book.Subjects {
+		entry.Categories = append(entry.Categories, Category{Term: subject, Label: subject})
+	}
+	status := "available"
+	if book.AvailableCount <= 0 {
+		status = "unavailable"
+	}
+	href := "/books/" + strconv.Itoa(book.ID)
+	entry.Links = []Link{
+		{
+			Rel:          relBorrow,
+			Href:         href,
+			Type:         "application/json",
+			Availability: &Availability{Status: status},
+			Copies:       &Copies{Available: max(book.AvailableCount, 0)},
+		},
+		{Rel: relAlternate, Href: href + ".xml", Type: "application/marcxml+xml", Title: "MARCXML record"},
+	}
+	return entry
+}
+
+func navigationEntry(id string, title string, updated string, summary string, link Link) Entry {
+	return Entry{
+		ID:      id,
+		Title:   title,
+		Updated: updated,
+		Content: &Content{Type: "text", Value: summary},
+		Links:   []Link{link},
+	}
+}
+
+func commonLinks(self string, feedType string) []Link {
+	return []Link{
+		{Rel: relSelf, Href: self, Type: feedType},
+		{Rel: relStart, Href: RootPath, Type: NavigationType},
+		{Rel: relSearch, Href: OpenSearchPath, Type: OpenSearchType},
+	}
+}
+
+// checkPage rejects pages past the last one, the first page of an empty feed exists
+func checkPage(page int, total int) models.HttpError {
+	if page < 1 || page > max(lastPage(total), 1) {
+		return models.NewHttpError(fmt.Sprintf("page %d does not exist", page), http.StatusNotFound)
+	}
+	return models.NewEmptyHttpError()
+}
+
+func lastPage(total int) int {
+	return (total + PageSize - 1) / PageSize
+}
+
+// pageLinks links to the first, previous, next and last pages of a paginated feed
+func pageLinks(path string, params url.Values, page int, total int, feedType string) []Link {
+	last := lastPage(total)
+	if last <= 1 {
+		return nil
+	}
+	links := []Link{{Rel: relFirst, Href: pageHref(path, params, 1), Type: feedType}}
+	if page > 1 {
+		links = append(links, Link{Rel: relPrevious, Href: pageHref(path, params, page-1), Type: feedType})
+	}
+	if page < last {
+		links = append(links, Link{Rel: relNext, Href: pageHref(path, params, page+1), Type: feedType})
+	}
+	return append(links, Link{Rel: relLast, Href: pageHref(path, params, last), Type: feedType})
+}
+
+func pageHref(path string, params url.Values, page int) string {
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
+
+// paginate adds the OpenSearch response elements that tell clients the size of the result
+func paginate(feed *Feed, page int, total int) {
+	perPage := PageSize
+	start := (page-1)*PageSize + 1
+	feed.TotalResults = &total
+	feed.ItemsPerPage = &perPage
+	feed.StartIndex = &start
+}
+
+func bookCount(n int) string {
+	if n == 1 {
+		return "1 book"
+	}
+	return fmt.Sprintf("%d books", n)
+}
+
+func copiesAvailable(n int) string {
+	switch {
+	case n <= 0:
+		return "No copies available"
+	case n == 1:
+		return "1 copy available"
+	default:
+		return fmt.Sprintf("%d copies available", n)
+	}
+}
@@ -0,0 +1,138 @@
+// Package opds builds OPDS 1.2 catalog feeds (Atom) for e-reader apps: a navigation root, new arrivals,
+// books by author and by subject, and search through an OpenSearch description.
+package opds
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// Media types of OPDS catalog documents
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	OpenSearchType  = "application/opensearchdescription+xml"
+)
+
+// Link relations used in the feeds
+const (
+	relSelf       = "self"
+	relStart      = "start"
+	relUp         = "up"
+	relSearch     = "search"
+	relSubsection = "subsection"
+	relFirst      = "first"
+	relPrevious   = "previous"
+	relNext       = "next"
+	relLast       = "last"
+	relAlternate  = "alternate"
+	relNew        = "http://opds-spec.org/sort/new"
+	relBorrow     = "http://opds-spec.org/acquisition/borrow"
+)
+
+const (
+	atomNamespace       = "http://www.w3.org/2005/Atom"
+	opdsNamespace       = "http://opds-spec.org/2010/catalog"
+	dcNamespace         = "http://purl.org/dc/terms/"
+	openSearchNamespace = "http://a9.com/-/spec/opensearch/1.1/"
+)
+
+// Feed is an Atom feed with the OPDS, Dublin Core and OpenSearch extensions used by the catalog
+type Feed struct {
+	XMLName      xml.Name `xml:"feed"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	XmlnsOPDS    string   `xml:"xmlns:opds,attr"`
+	XmlnsDC      string   `xml:"xmlns:dc,attr"`
+	XmlnsSearch  string   `xml:"xmlns:opensearch,attr"`
+	ID           string   `xml:"id"`
+	Title        string   `xml:"title"`
+	Updated      string   `xml:"updated"`
+	Author       *Person  `xml:"author,omitempty"`
+	Links        []Link   `xml:"link"`
+	TotalResults *int     `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage *int     `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex   *int     `xml:"opensearch:startIndex,omitempty"`
+	Entries      []Entry  `xml:"entry"`
+}
+
+type Person struct {
+	Name string `xml:"name"`
+}
+
+type Link struct {
+	Rel          string        `xml:"rel,attr,omitempty"`
+	Href         string        `xml:"href,attr"`
+	Type         string        `xml:"type,attr,omitempty"`
+	Title        string        `xml:"title,attr,omitempty"`
+	Availability *Availability `xml:"opds:availability,omitempty"`
+	Copies       *Copies       `xml:"opds:copies,omitempty"`
+}
+
+// Availability tells whether a copy can be borrowed now, "available" or "unavailable"
+type Availability struct {
+	Status string `xml:"status,attr"`
+}
+
+// Copies is the number of copies that can be borrowed now
+type Copies struct {
+	Available int `xml:"available,attr"`
+}
+
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type Content struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type Entry struct {
+	ID         string     `xml:"id"`
+	Title      string     `xml:"title"`
+	Updated    string     `xml:"updated"`
+	Authors    []Person   `xml:"author"`
+	Identifier string     `xml:"dc:identifier,omitempty"`
+	Publisher  string     `xml:"dc:publisher,omitempty"`
+	Issued     string     `xml:"dc:issued,omitempty"`
+	Categories []Category `xml:"category"`
+	Content    *Content   `xml:"content,omitempty"`
+	Links      []Link     `xml:"link"`
+}
+
+func newFeed(id string, title string, updated time.Time) Feed {
+	return Feed{
+		Xmlns:       atomNamespace,
+		XmlnsOPDS:   opdsNamespace,
+		XmlnsDC:     dcNamespace,
+		XmlnsSearch: openSearchNamespace,
+		ID:          id,
+		Title:       title,
+		Updated:     timestamp(updated),
+		Author:      &Person{Name: catalogName},
+	}
+}
+
+// Write writes a feed or an OpenSearch description as an XML document
+func Write(w io.Writer, document any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// timestamp formats an Atom date, an empty catalog has no updates and uses the Unix epoch
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,35 @@
+package opds
+
+import "encoding/xml"
+
+// OpenSearchDescription tells clients how to search the catalog
+type OpenSearchDescription struct {
+	XMLName        xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName      string          `xml:"ShortName"`
+	Description    string          `xml:"Description"`
+	InputEncoding  string          `xml:"InputEncoding"`
+	OutputEncoding string          `xml:"OutputEncoding"`
+	URLs           []OpenSearchURL `xml:"Url"`
+}
+
+type OpenSearchURL struct {
+	Type       string `xml:"type,attr"`
+	Template   string `xml:"template,attr"`
+	PageOffset int    `xml:"pageOffset,attr"`
+}
+
+// Description returns the OpenSearch description of the catalog.
+// Clients expand the template themselves, so it is built from the absolute URL of the catalog, e.g. https://library.example.com.
+func Description(baseURL string) OpenSearchDescription {
+	return OpenSearchDescription{
+		ShortName:      catalogName,
+		Description:    "Search the library catalog by title, author, subject or ISBN",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URLs: []OpenSearchURL{{
+			Type:       AcquisitionType,
+			Template:   baseURL + SearchPath + "?q={searchTerms}&page={startPage?}",
+			PageOffset: 1,
+		}},
+	}
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"context"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	libraryv1 "github.com/spin311/library-api/pkg/api/library/v1"
+)
+
+type bookServer struct {
+	libraryv1.UnimplementedBookServiceServer
+}
+
+func (bookServer) GetBook(_ context.Context, request *libraryv1.GetBookRequest) (*libraryv1.GetBookResponse, error) {
+	id, err := toId("id", request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	book, httpErr := services.GetBook(id)
+	if err := toStatus(httpErr); err != nil {
+		return nil, err
+	}
+	return &libraryv1.GetBookResponse{Book: toBook(book)}, nil
+}
+
+func (bookServer) ListBooks(_ context.Context, _ *libraryv1.ListBooksRequest) (*libraryv1.ListBooksResponse, error) {
+	books, httpErr := services.GetBooks()
+	if err := toStatus(httpErr); err != nil {
+		return nil, err
+	}
+	response := &libraryv1.ListBooksResponse{Books: make([]*libraryv1.Book, len(books))}
+	for i, book := range books {
+		response.Books[i] = toBook(book)
+	}
+	return response, nil
+}
+
+func toBook(book models.BookResponse) *libraryv1.Book {
+	return &libraryv1.Book{
+		Id:              int64(book.ID),
+		Title:           book.Title,
+		AvailableCopies: int32(book.AvailableCount),
+		Isbn:            book.ISBN,
+		Authors:         book.Authors,
+		Publisher:       book.Publisher,
+		PublicationDate: book.PublicationDate,
+		Subjects:        book.Subjects,
+	}
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math"
+	"net/http"
+)
+
+// codesByStatus maps the status codes the services return to the gRPC code with the same meaning
+var codesByStatus = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.FailedPrecondition,
+	http.StatusPreconditionFailed:    codes.FailedPrecondition,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusUnprocessableEntity:   codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusNotImplemented:        codes.Unimplemented,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+	http.StatusGatewayTimeout:        codes.DeadlineExceeded,
+}
+
+// toStatus converts a service error to a gRPC status error, nil when there is no error
+func toStatus(httpErr models.HttpError) error {
+	if models.IsHttpErrorEmpty(httpErr) {
+		return nil
+	}
+	code, ok := codesByStatus[httpErr.StatusCode]
+	if !ok {
+		code = codes.Internal
+		if httpErr.StatusCode < http.StatusInternalServerError {
+			code = codes.Unknown
+		}
+	}
+	return status.Error(code, httpErr.Message)
+}
+
+// toId checks an ID from a request, the services use int IDs that are positive
+func toId(name string, id int64) (int, error) {
+	if id <= 0 || id > math.MaxInt32 {
+		return 0, status.Error(codes.InvalidArgument, fmt.Sprintf("%s must be a positive ID", name))
+	}
+	return int(id), nil
+}
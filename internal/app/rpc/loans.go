@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"context"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	libraryv1 "github.com/spin311/library-api/pkg/api/library/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type loanServer struct {
+	libraryv1.UnimplementedLoanServiceServer
+}
+
+func (loanServer) BorrowBook(ctx context.Context, request *libraryv1.BorrowBookRequest) (*libraryv1.BorrowBookResponse, error) {
+	userId, bookId, err := loanIds(request.GetUserId(), request.GetBookId())
+	if err != nil {
+		return nil, err
+	}
+	borrow, httpErr := services.BorrowBook(userId, bookId, helpers.ActorFromContext(ctx))
+	if err := toStatus(httpErr); err != nil {
+		return nil, err
+	}
+	return &libraryv1.BorrowBookResponse{Loan: toLoan(borrow)}, nil
+}
+
+func (loanServer) ReturnBook(ctx context.Context, request *libraryv1.ReturnBookRequest) (*libraryv1.ReturnBookResponse, error) {
+	userId, bookId, err := loanIds(request.GetUserId(), request.GetBookId())
+	if err != nil {
+		return nil, err
+	}
+	borrow, httpErr := services.ReturnBook(userId, bookId, request.GetDamaged(), helpers.ActorFromContext(ctx))
+	if err := toStatus(httpErr); err != nil {
+		return nil, err
+	}
+	return &libraryv1.ReturnBookResponse{Loan: toLoan(borrow)}, nil
+}
+
+func (loanServer) ListOpenLoans(_ context.Context, request *libraryv1.ListOpenLoansRequest) (*libraryv1.ListOpenLoansResponse, error) {
+	userId, err := toId("user_id", request.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	if _, httpErr := services.GetUser(userId); !models.IsHttpErrorEmpty(httpErr) {
+		return nil, toStatus(httpErr)
+	}
+	borrows, httpErr := services.GetOpenBorrows([]int{userId})
+	if err := toStatus(httpErr); err != nil {
+		return nil, err
+	}
+	response := &libraryv1.ListOpenLoansResponse{Loans: make([]*libraryv1.Loan, len(borrows))}
+	for i, borrow := range borrows {
+		response.Loans[i] = toLoan(borrow)
+	}
+	return response, nil
+}
+
+func loanIds(userId int64, bookId int64) (int, int, error) {
+	user, err := toId("user_id", userId)
+	if err != nil {
+		return 0, 0, err
+	}
+	book, err := toId("book_id", bookId)
+	return user, book, err
+}
+
+func toLoan(borrow models.Borrow) *libraryv1.Loan {
+	loan := &libraryv1.Loan{
+		Id:         int64(borrow.ID),
+		UserId:     int64(borrow.UserID),
+		BookId:     int64(borrow.BookID),
+		BorrowedAt: timestamppb.New(borrow.BorrowedAt),
+		Damaged:    borrow.Damaged,
+	}
+	if borrow.DueAt != nil {
+		loan.DueAt = timestamppb.New(*borrow.DueAt)
+	}
+	if borrow.ReturnedAt != nil {
+		loan.ReturnedAt = timestamppb.New(*borrow.ReturnedAt)
+	}
+	if borrow.LostAt != nil {
+		loan.LostAt = timestamppb.New(*borrow.LostAt)
+	}
+	if borrow.FoundAt != nil {
+		loan.FoundAt = timestamppb.New(*borrow.FoundAt)
+	}
+	return loan
+}
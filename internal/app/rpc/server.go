@@ -0,0 +1,82 @@
+// Package rpc serves the library.v1 gRPC services from proto/library/v1 for internal consumers.
+// The services share the services package with the REST handlers, so both apply the same rules
+// and record the same events and audit entries.
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/middleware"
+	"github.com/spin311/library-api/internal/repository/models"
+	libraryv1 "github.com/spin311/library-api/pkg/api/library/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"net"
+	"strings"
+)
+
+// metadata keys, the gRPC counterparts of the X-Actor and X-Request-ID headers
+const (
+	actorKey     = "x-actor"
+	requestIDKey = "x-request-id"
+)
+
+// NewServer returns a gRPC server with the library services, the health service and server reflection.
+// Without a TLS configuration the server accepts plaintext connections.
+func NewServer(tlsConfig *tls.Config) *grpc.Server {
+	options := []grpc.ServerOption{grpc.UnaryInterceptor(withActor)}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	libraryv1.RegisterUserServiceServer(server, userServer{})
+	libraryv1.RegisterBookServiceServer(server, bookServer{})
+	libraryv1.RegisterLoanServiceServer(server, loanServer{})
+
+	healthServer := health.NewServer()
+	for name := range server.GetServiceInfo() {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+	return server
+}
+
+// withActor records who makes each call like the Actor middleware does for HTTP requests,
+// from the client certificate, keeping the x-actor metadata as the claimed actor, and echoes the request ID in the response header
+func withActor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestId := middleware.RequestID(first(md, requestIDKey))
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestId))
+
+	actor := models.Actor{RequestID: requestId}
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &info.State
+		}
+		if p.Addr != nil {
+			actor.ClientIP = p.Addr.String()
+			if host, _, err := net.SplitHostPort(actor.ClientIP); err == nil {
+				actor.ClientIP = host
+			}
+		}
+	}
+	actor.Name = middleware.ActorName(state)
+	actor.Claimed = middleware.ClaimedActor(first(md, actorKey))
+	return handler(helpers.WithActor(ctx, actor), req)
+}
+
+func first(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[0])
+}
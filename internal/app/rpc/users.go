@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"context"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	libraryv1 "github.com/spin311/library-api/pkg/api/library/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type userServer struct {
+	libraryv1.UnimplementedUserServiceServer
+}
+
+func (userServer) GetUser(_ context.Context, request *libraryv1.GetUserRequest) (*libraryv1.GetUserResponse, error) {
+	id, err := toId("id", request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	user, httpErr := services.GetUser(id)
+	if err := toStatus(httpErr); err != nil {
+		return nil, err
+	}
+	return &libraryv1.GetUserResponse{User: toUser(user)}, nil
+}
+
+func (userServer) ListUsers(_ context.Context, _ *libraryv1.ListUsersRequest) (*libraryv1.ListUsersResponse, error) {
+	users, httpErr := services.GetUsers()
+	if err := toStatus(httpErr); err != nil {
+		return nil, err
+	}
+	response := &libraryv1.ListUsersResponse{Users: make([]*libraryv1.User, len(users))}
+	for i, user := range users {
+		response.Users[i] = toUser(user)
+	}
+	return response, nil
+}
+
+func (userServer) CreateUser(ctx context.Context, request *libraryv1.CreateUserRequest) (*libraryv1.CreateUserResponse, error) {
+	if request.GetFirstName() == "" || request.GetLastName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "first_name and last_name are required")
+	}
+	user, httpErr := services.CreateUser(models.User{
+		FirstName:         request.GetFirstName(),
+		LastName:          request.GetLastName(),
+		Email:             request.GetEmail(),
+		Phone:             request.GetPhone(),
+		Locale:            request.GetLocale(),
+		NotifyEmail:       request.GetNotifyEmail(),
+		NotifySMS:         request.GetNotifySms(),
+		Category:          request.GetCategory(),
+		DateOfBirth:       request.GetDateOfBirth(),
+		Address:           request.GetAddress(),
+		MembershipStarts:  request.GetMembershipStarts(),
+		MembershipExpires: request.GetMembershipExpires(),
+	}, helpers.ActorFromContext(ctx))
+	if err := toStatus(httpErr); err != nil {
+		return nil, err
+	}
+	return &libraryv1.CreateUserResponse{User: toUser(user)}, nil
+}
+
+func toUser(user models.User) *libraryv1.User {
+	return &libraryv1.User{
+		Id:                int64(user.ID),
+		FirstName:         user.FirstName,
+		LastName:          user.LastName,
+		Email:             user.Email,
+		Phone:             user.Phone,
+		Locale:            user.Locale,
+		NotifyEmail:       user.NotifyEmail,
+		NotifySms:         user.NotifySMS,
+		Category:          user.Category,
+		CardNumber:        user.CardNumber,
+		DateOfBirth:       user.DateOfBirth,
+		Address:           user.Address,
+		MembershipStarts:  user.MembershipStarts,
+		MembershipExpires: user.MembershipExpires,
+	}
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"net/http"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+func GetAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, models.HttpError) {
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit < 0 || filter.Limit > maxAuditLimit {
+		return nil, models.NewHttpError("limit must be between 1 and 1000", http.StatusBadRequest)
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, models.NewHttpError("from must be before to", http.StatusBadRequest)
+	}
+	return postgres.GetAuditEntries(filter)
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"log"
+)
+
+var publishAvailability = func(models.BookAvailability) {}
+
+// SetAvailabilityPublisher sets where the availability of books goes after borrows, returns and updates change it
+func SetAvailabilityPublisher(publish func(models.BookAvailability)) {
+	publishAvailability = publish
+}
+
+// NotifyAvailability publishes availability to every replica through PostgreSQL NOTIFY
+func NotifyAvailability(availability models.BookAvailability) {
+	if err := postgres.NotifyBookAvailability(availability); !models.IsHttpErrorEmpty(err) {
+		log.Printf("Failed to notify availability of book %d: %v", availability.BookID, err)
+	}
+}
+
+// announceAvailability publishes the availability of a book after a change was committed.
+// The book is read again, the change may not tell how many copies are left.
+func announceAvailability(bookId int) {
+	book, err := postgres.GetBook(bookId)
+	if !models.IsHttpErrorEmpty(err) {
+		log.Printf("Failed to read availability of book %d: %v", bookId, err)
+		return
+	}
+	publishAvailability(models.NewBookAvailability(models.NewBookResponseFromBook(book)))
+}
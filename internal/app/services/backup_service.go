@@ -0,0 +1,14 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+)
+
+func ExportBackup() (models.Backup, models.HttpError) {
+	return postgres.ExportBackup()
+}
+
+func RestoreBackup(backup models.Backup, replace bool, actor models.Actor) models.HttpError {
+	return postgres.RestoreBackup(backup, replace, actor)
+}
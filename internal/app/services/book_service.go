@@ -1,18 +1,20 @@
 package services
 
 import (
-	"fmt"
 	"github.com/spin311/library-api/internal/repository/models"
 	"github.com/spin311/library-api/internal/repository/postgres"
-	"net/http"
 )
 
 func GetBooks() ([]models.BookResponse, models.HttpError) {
 	return postgres.GetBooks()
 }
 
-func BorrowBook(userId int, bookId int) models.HttpError {
-	return postgres.BorrowBook(userId, bookId)
+func BorrowBook(userId int, bookId int, actor models.Actor) (models.Borrow, models.HttpError) {
+	borrow, err := postgres.BorrowBook(userId, bookId, actor)
+	if models.IsHttpErrorEmpty(err) {
+		announceAvailability(bookId)
+	}
+	return borrow, err
 }
 
 func GetBook(id int) (models.BookResponse, models.HttpError) {
@@ -25,14 +27,83 @@ func GetBook(id int) (models.BookResponse, models.HttpError) {
 	return bookResponse, err
 }
 
-func ReturnBook(userId int, bookId int) models.HttpError {
-	book, err := postgres.GetBook(bookId)
+// GetBooksByIds returns the books with the given IDs in no particular order, unknown IDs are skipped
+func GetBooksByIds(ids []int) ([]models.BookResponse, models.HttpError) {
+	books, err := postgres.GetBooksByIds(ids)
 	if !models.IsHttpErrorEmpty(err) {
-		return err
+		return nil, err
+	}
+	responses := make([]models.BookResponse, len(books))
+	for i, book := range books {
+		responses[i] = models.NewBookResponseFromBook(book)
+	}
+	return responses, err
+}
+
+// GetOpenBorrows returns the borrows of the given users that are not returned yet, oldest first
+func GetOpenBorrows(userIds []int) ([]models.Borrow, models.HttpError) {
+	return postgres.GetOpenBorrows(userIds)
+}
+
+// GetCatalogBook returns a book with its full catalog description
+func GetCatalogBook(id int) (models.Book, models.HttpError) {
+	return postgres.GetBook(id)
+}
+
+// ReturnBook closes the user's loan of a book, a copy returned damaged is withdrawn and charged for
+func ReturnBook(userId int, bookId int, damaged bool, actor models.Actor) (models.Borrow, models.HttpError) {
+	borrow, err := postgres.ReturnBook(userId, bookId, damaged, actor)
+	if models.IsHttpErrorEmpty(err) {
+		announceAvailability(bookId)
 	}
+	return borrow, err
+}
+
+// RenewBook extends a loan by the loan period of the user's category
+func RenewBook(userId int, bookId int, actor models.Actor) (models.Borrow, models.HttpError) {
+	return postgres.RenewBook(userId, bookId, actor)
+}
 
-	if book.BorrowedCount == 0 {
-		return models.NewHttpError(fmt.Sprintf("no borrowed copies exist for the book with ID %d", book.ID), http.StatusBadRequest)
+// MarkBorrowLost closes a loan whose copy was lost, withdraws the copy and charges the replacement fee
+func MarkBorrowLost(borrowId int, actor models.Actor) (models.LossResponse, models.HttpError) {
+	loss, err := postgres.MarkBorrowLost(borrowId, actor)
+	if models.IsHttpErrorEmpty(err) {
+		announceAvailability(loss.Borrow.BookID)
 	}
-	return postgres.ReturnBook(userId, bookId, book.BorrowedCount-1)
+	return loss, err
+}
+
+// MarkBorrowFound puts a lost copy back into stock and waives its replacement fee
+func MarkBorrowFound(borrowId int, actor models.Actor) (models.LossResponse, models.HttpError) {
+	loss, err := postgres.MarkBorrowFound(borrowId, actor)
+	if models.IsHttpErrorEmpty(err) {
+		announceAvailability(loss.Borrow.BookID)
+	}
+	return loss, err
+}
+
+func UpdateBook(id int, request models.BookRequest, version int, actor models.Actor) (models.BookResponse, models.HttpError) {
+	book, err := postgres.UpdateBook(models.Book{
+		ID:           id,
+		Title:        request.Title,
+		Quantity:     request.Quantity,
+		Version:      version,
+		Restrictions: request.Restrictions,
+	}, actor)
+	if !models.IsHttpErrorEmpty(err) {
+		return models.BookResponse{}, err
+	}
+	response := models.NewBookResponseFromBook(book)
+	publishAvailability(models.NewBookAvailability(response))
+	return response, err
+}
+
+// SearchBooks returns a page of the books matching the query, newest first
+func SearchBooks(query models.BookQuery) (models.BookPage, models.HttpError) {
+	return postgres.SearchBooks(query)
+}
+
+// GetHeadings returns a page of the authors or subjects of all books in alphabetical order
+func GetHeadings(kind string, limit int, offset int) (models.HeadingPage, models.HttpError) {
+	return postgres.GetHeadings(kind, limit, offset)
 }
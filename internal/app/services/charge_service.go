@@ -0,0 +1,14 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+)
+
+// GetCharges returns the replacement fees charged to a user, newest first
+func GetCharges(userId int) ([]models.Charge, models.HttpError) {
+	if _, err := postgres.GetUser(userId); !models.IsHttpErrorEmpty(err) {
+		return nil, err
+	}
+	return postgres.GetCharges(userId)
+}
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+)
+
+// CheckConsistency reports books whose borrowed count differs from their open borrows and repairs them if asked
+func CheckConsistency(repair bool, actor models.Actor) (models.ConsistencyReport, models.HttpError) {
+	report, err := postgres.CheckBorrowedCounts(repair, actor)
+	for _, mismatch := range report.Mismatches {
+		if mismatch.Repaired {
+			announceAvailability(mismatch.BookID)
+		}
+	}
+	return report, err
+}
@@ -0,0 +1,15 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"time"
+)
+
+func ClaimOutbox(limit int, lease time.Duration) ([]models.Event, models.HttpError) {
+	return postgres.ClaimOutbox(limit, lease)
+}
+
+func RecordOutboxAttempt(event models.Event, publishedTo []string, publishErr error, maxAttempts int, retryDelay func(attempts int) time.Duration) models.HttpError {
+	return postgres.RecordOutboxAttempt(event, publishedTo, publishErr, maxAttempts, retryDelay)
+}
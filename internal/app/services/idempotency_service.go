@@ -0,0 +1,47 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"time"
+)
+
+var (
+	idempotencyTTL   = 24 * time.Hour
+	idempotencyLease = 2 * time.Minute
+	// idempotencyOwner identifies this instance as the holder of the keys it reserves
+	idempotencyOwner = "unknown"
+)
+
+// SetIdempotency sets how long responses are kept, how long a reservation lasts without being renewed
+// and the name of this instance
+func SetIdempotency(ttl time.Duration, lease time.Duration, owner string) {
+	idempotencyTTL = ttl
+	idempotencyLease = lease
+	idempotencyOwner = owner
+}
+
+// IdempotencyLease is how long a reservation lasts without being renewed
+func IdempotencyLease() time.Duration {
+	return idempotencyLease
+}
+
+func ReserveIdempotencyKey(key string, fingerprint string) (models.IdempotencyRecord, bool, models.HttpError) {
+	return postgres.ReserveIdempotencyKey(key, fingerprint, idempotencyOwner, idempotencyTTL, idempotencyLease)
+}
+
+func RenewIdempotencyKey(key string) models.HttpError {
+	return postgres.RenewIdempotencyKey(key, idempotencyOwner, idempotencyLease)
+}
+
+func SaveIdempotentResponse(record models.IdempotencyRecord) models.HttpError {
+	return postgres.SaveIdempotentResponse(record, idempotencyOwner)
+}
+
+func ReleaseIdempotencyKey(key string) models.HttpError {
+	return postgres.ReleaseIdempotencyKey(key, idempotencyOwner)
+}
+
+func DeleteExpiredIdempotencyKeys() (int64, models.HttpError) {
+	return postgres.DeleteExpiredIdempotencyKeys()
+}
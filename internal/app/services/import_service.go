@@ -0,0 +1,31 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"time"
+)
+
+func InsertImport(imp models.Import, payload []byte) (models.Import, models.HttpError) {
+	return postgres.InsertImport(imp, payload)
+}
+
+func GetImport(id int64) (models.Import, models.HttpError) {
+	return postgres.GetImport(id)
+}
+
+func ClaimImport(staleAfter time.Duration) (models.Import, []byte, bool, models.HttpError) {
+	return postgres.ClaimImport(staleAfter)
+}
+
+func FinishImport(id int64, status string, message string) models.HttpError {
+	return postgres.FinishImport(id, status, message)
+}
+
+func ImportBooks(importId int64, from int, to int, books []models.Book, actor models.Actor) models.HttpError {
+	return postgres.ImportBooks(importId, from, to, books, actor)
+}
+
+func ImportUsers(importId int64, from int, to int, users []models.User, actor models.Actor) models.HttpError {
+	return postgres.ImportUsers(importId, from, to, users, actor)
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"time"
+)
+
+const jobRunLogLimit = 100
+
+func TryJobLeaderLock(ctx context.Context) (*postgres.JobLeaderLock, bool, models.HttpError) {
+	return postgres.TryJobLeaderLock(ctx)
+}
+
+func StartScheduledJobRun(jobName string, scheduledAt time.Time, instance string) (models.JobRun, bool, models.HttpError) {
+	return postgres.StartScheduledJobRun(jobName, scheduledAt, instance)
+}
+
+func QueueJobRun(jobName string, actor models.Actor) (models.JobRun, models.HttpError) {
+	return postgres.QueueJobRun(jobName, actor)
+}
+
+func ClaimQueuedJobRuns(instance string, running []string) ([]models.JobRun, models.HttpError) {
+	return postgres.ClaimQueuedJobRuns(instance, running)
+}
+
+func FinishJobRun(run models.JobRun) models.HttpError {
+	return postgres.FinishJobRun(run)
+}
+
+func FailInterruptedJobRuns() (int64, models.HttpError) {
+	return postgres.FailInterruptedJobRuns()
+}
+
+func GetLatestJobRuns(scheduledOnly bool) (map[string]models.JobRun, models.HttpError) {
+	return postgres.GetLatestJobRuns(scheduledOnly)
+}
+
+func GetJobRuns(jobName string) ([]models.JobRun, models.HttpError) {
+	return postgres.GetJobRuns(jobName, jobRunLogLimit)
+}
+
+func DeleteJobRunsOlderThan(age time.Duration) (int64, models.HttpError) {
+	return postgres.DeleteJobRunsOlderThan(age)
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"time"
+)
+
+const notificationLogLimit = 100
+
+func GetLoansForNotification(kind string, dueSoonDays int, maxAttempts int, retryBackoff time.Duration) ([]models.LoanNotice, models.HttpError) {
+	return postgres.GetLoansForNotification(kind, dueSoonDays, maxAttempts, retryBackoff)
+}
+
+func RecordNotification(notification models.Notification) models.HttpError {
+	return postgres.InsertNotification(notification)
+}
+
+func GetNotifications(userId int) ([]models.Notification, models.HttpError) {
+	if _, err := postgres.GetUser(userId); !models.IsHttpErrorEmpty(err) {
+		return nil, err
+	}
+	return postgres.GetNotifications(userId, notificationLogLimit)
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"net/http"
+)
+
+const (
+	defaultRecommendationLimit = 10
+	maxRecommendationLimit     = 100
+	// recommendationBatchSize is the number of borrow IDs counted in one transaction
+	recommendationBatchSize = 10000
+)
+
+func recommendationLimit(limit int) (int, models.HttpError) {
+	if limit == 0 {
+		return defaultRecommendationLimit, models.NewEmptyHttpError()
+	}
+	if limit < 0 || limit > maxRecommendationLimit {
+		return limit, models.NewHttpError("limit must be between 1 and 100", http.StatusBadRequest)
+	}
+	return limit, models.NewEmptyHttpError()
+}
+
+// GetSimilarBooks returns the books people who borrowed the book also borrowed
+func GetSimilarBooks(bookId int, limit int) ([]models.Recommendation, models.HttpError) {
+	limit, httpErr := recommendationLimit(limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	if _, httpErr := postgres.GetBook(bookId); !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	return postgres.GetSimilarBooks(bookId, limit)
+}
+
+// GetRecommendations recommends books co-borrowed with the user's books, filled up with popular books
+// when the user's history yields fewer than limit
+func GetRecommendations(userId int, limit int) ([]models.Recommendation, models.HttpError) {
+	limit, httpErr := recommendationLimit(limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	if _, httpErr := postgres.GetUser(userId); !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	recommendations, httpErr := postgres.GetRecommendations(userId, limit)
+	if !models.IsHttpErrorEmpty(httpErr) || len(recommendations) == limit {
+		return recommendations, httpErr
+	}
+	ids := make([]int, len(recommendations))
+	for i, recommendation := range recommendations {
+		ids[i] = recommendation.ID
+	}
+	popular, httpErr := postgres.GetPopularBooks(userId, ids, limit-len(recommendations))
+	return append(recommendations, popular...), httpErr
+}
+
+// RefreshRecommendations counts the next batch of borrows into the co-borrowing tables
+func RefreshRecommendations() (models.RecommendationRefresh, models.HttpError) {
+	return postgres.RefreshRecommendations(recommendationBatchSize)
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultReportLimit = 10
+	maxReportLimit     = 1000
+	// defaultReportDays is the length of the period when from is not given
+	defaultReportDays = 30
+	// maxReportBuckets bounds the number of rows of the borrows report
+	maxReportBuckets = 1000
+)
+
+// reportPeriod fills in a missing end with now and a missing start with 30 days before the end
+func reportPeriod(from *time.Time, to *time.Time) (models.ReportPeriod, models.HttpError) {
+	period := models.ReportPeriod{To: time.Now().UTC()}
+	if to != nil {
+		period.To = to.UTC()
+	}
+	period.From = period.To.AddDate(0, 0, -defaultReportDays)
+	if from != nil {
+		period.From = from.UTC()
+	}
+	if !period.From.Before(period.To) {
+		return period, models.NewHttpError("from must be before to", http.StatusBadRequest)
+	}
+	return period, models.NewEmptyHttpError()
+}
+
+func reportLimit(limit int) (int, models.HttpError) {
+	if limit == 0 {
+		return defaultReportLimit, models.NewEmptyHttpError()
+	}
+	if limit < 0 || limit > maxReportLimit {
+		return limit, models.NewHttpError("limit must be between 1 and 1000", http.StatusBadRequest)
+	}
+	return limit, models.NewEmptyHttpError()
+}
+
+func GetTopBooks(from *time.Time, to *time.Time, limit int) ([]models.TopBook, models.HttpError) {
+	period, httpErr := reportPeriod(from, to)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	limit, httpErr = reportLimit(limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	return postgres.GetTopBooks(period, limit)
+}
+
+// GetBorrowCounts counts borrows per day, week or month, by day when interval is empty
+func GetBorrowCounts(from *time.Time, to *time.Time, interval string) ([]models.BorrowCount, models.HttpError) {
+	period, httpErr := reportPeriod(from, to)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	var buckets float64
+	switch interval {
+	case "", models.ReportDay:
+		interval = models.ReportDay
+		buckets = period.Days()
+	case models.ReportWeek:
+		buckets = period.Days() / 7
+	case models.ReportMonth:
+		buckets = period.Days() / 28
+	default:
+		return nil, models.NewHttpError("interval must be day, week or month", http.StatusBadRequest)
+	}
+	if buckets > maxReportBuckets {
+		return nil, models.NewHttpError("the period has more than 1000 intervals, use a longer interval or a shorter period", http.StatusBadRequest)
+	}
+	return postgres.GetBorrowCounts(period, interval)
+}
+
+func GetLoanDurations(from *time.Time, to *time.Time) (models.LoanDurationReport, models.HttpError) {
+	period, httpErr := reportPeriod(from, to)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return models.LoanDurationReport{}, httpErr
+	}
+	return postgres.GetLoanDurations(period)
+}
+
+func GetUtilization(from *time.Time, to *time.Time, limit int) ([]models.BookUtilization, models.HttpError) {
+	period, httpErr := reportPeriod(from, to)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	limit, httpErr = reportLimit(limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	return postgres.GetUtilization(period, limit)
+}
+
+// GetActivePatrons ranks the users by their borrows, anonymized patrons only keep their rank
+func GetActivePatrons(from *time.Time, to *time.Time, limit int, anonymize bool) ([]models.ActivePatron, models.HttpError) {
+	period, httpErr := reportPeriod(from, to)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	limit, httpErr = reportLimit(limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	patrons, httpErr := postgres.GetActivePatrons(period, limit)
+	if anonymize {
+		for i := range patrons {
+			patrons[i].UserID = 0
+			patrons[i].Name = ""
+		}
+	}
+	return patrons, httpErr
+}
+
+func GetUnborrowedBooks(limit int) ([]models.UnborrowedBook, models.HttpError) {
+	limit, httpErr := reportLimit(limit)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return nil, httpErr
+	}
+	return postgres.GetUnborrowedBooks(limit)
+}
@@ -1,18 +1,152 @@
 package services
 
 import (
+	"fmt"
+	"github.com/spin311/library-api/internal/app/cards"
 	"github.com/spin311/library-api/internal/repository/models"
 	"github.com/spin311/library-api/internal/repository/postgres"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+	"time"
+	"unicode/utf8"
 )
 
-func CreateUser(user models.User) models.HttpError {
-	return postgres.InsertUser(user)
+const defaultLocale = "en"
+
+// the lengths of the VARCHAR columns of users
+const (
+	maxNameLength    = 100
+	maxAddressLength = 500
+)
+
+var (
+	phonePattern  = regexp.MustCompile(`^\+?[0-9]{6,15}$`)
+	localePattern = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+)
+
+func CreateUser(user models.User, actor models.Actor) (models.User, models.HttpError) {
+	if err := ValidateIdentity(&user); !models.IsHttpErrorEmpty(err) {
+		return user, err
+	}
+	if err := ValidateContact(&user); !models.IsHttpErrorEmpty(err) {
+		return user, err
+	}
+	if err := ValidateCategory(&user); !models.IsHttpErrorEmpty(err) {
+		return user, err
+	}
+	return postgres.InsertUser(user, actor)
 }
 
 func GetUsers() ([]models.User, models.HttpError) {
 	return postgres.GetUsers()
 }
 
+// GetUsersByIds returns the users with the given IDs in no particular order, unknown IDs are skipped
+func GetUsersByIds(ids []int) ([]models.User, models.HttpError) {
+	return postgres.GetUsersByIds(ids)
+}
+
 func GetUser(id int) (models.User, models.HttpError) {
 	return postgres.GetUser(id)
 }
+
+// GetUserByCard looks up a user by a typed or scanned card number, mistyped numbers fail the check digit
+func GetUserByCard(card string) (models.User, models.HttpError) {
+	card = cards.Normalize(card)
+	if !cards.Valid(card) {
+		return models.User{}, models.NewHttpError(fmt.Sprintf("%q is not a card number, it must be %d digits with a valid check digit", card, cards.Length), http.StatusBadRequest)
+	}
+	return postgres.GetUserByCard(card)
+}
+
+// ReplaceCard issues a new card to the user, the old card number no longer identifies them
+func ReplaceCard(userId int, actor models.Actor) (models.User, models.HttpError) {
+	return postgres.ReplaceCard(userId, actor)
+}
+
+func UpdateUser(user models.User, actor models.Actor) (models.User, models.HttpError) {
+	if err := ValidateIdentity(&user); !models.IsHttpErrorEmpty(err) {
+		return user, err
+	}
+	if err := ValidateContact(&user); !models.IsHttpErrorEmpty(err) {
+		return user, err
+	}
+	if err := ValidateCategory(&user); !models.IsHttpErrorEmpty(err) {
+		return user, err
+	}
+	return postgres.UpdateUser(user, actor)
+}
+
+// ValidateContact checks the contact details and notification preferences of a user and fills in the default locale
+func ValidateContact(user *models.User) models.HttpError {
+	if user.Email != "" {
+		address, err := mail.ParseAddress(user.Email)
+		if err != nil || address.Address != user.Email {
+			return models.NewHttpError("email must be a plain email address", http.StatusBadRequest)
+		}
+	}
+	if user.Phone != "" && !phonePattern.MatchString(user.Phone) {
+		return models.NewHttpError("phone must be a number in international format, e.g. +38640123456", http.StatusBadRequest)
+	}
+	if user.Locale == "" {
+		user.Locale = defaultLocale
+	}
+	if !localePattern.MatchString(user.Locale) {
+		return models.NewHttpError("locale must be a language code such as en or sl", http.StatusBadRequest)
+	}
+	if user.NotifyEmail && user.Email == "" {
+		return models.NewHttpError("email is required when notify_email is set", http.StatusBadRequest)
+	}
+	if user.NotifySMS && user.Phone == "" {
+		return models.NewHttpError("phone is required when notify_sms is set", http.StatusBadRequest)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// ValidateCategory checks the patron category of a user and fills in adult when it is empty
+func ValidateCategory(user *models.User) models.HttpError {
+	if user.Category == "" {
+		user.Category = models.CategoryAdult
+	}
+	if !slices.Contains(models.PatronCategories, user.Category) {
+		return models.NewHttpError("category must be child, adult, staff or institutional", http.StatusBadRequest)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// ValidateIdentity checks the name, date of birth, address and membership dates of a user.
+// The card number is issued by the library, so one sent by a client is ignored.
+func ValidateIdentity(user *models.User) models.HttpError {
+	user.CardNumber = ""
+	if utf8.RuneCountInString(user.FirstName) > maxNameLength || utf8.RuneCountInString(user.LastName) > maxNameLength {
+		return models.NewHttpError(fmt.Sprintf("first_name and last_name must be at most %d characters", maxNameLength), http.StatusBadRequest)
+	}
+	if utf8.RuneCountInString(user.Address) > maxAddressLength {
+		return models.NewHttpError(fmt.Sprintf("address must be at most %d characters", maxAddressLength), http.StatusBadRequest)
+	}
+	dates := []struct {
+		name  string
+		value string
+	}{
+		{"date_of_birth", user.DateOfBirth},
+		{"membership_starts", user.MembershipStarts},
+		{"membership_expires", user.MembershipExpires},
+	}
+	for _, date := range dates {
+		if date.value == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date.value); err != nil {
+			return models.NewHttpError(fmt.Sprintf("%s must be a date such as 2024-12-31", date.name), http.StatusBadRequest)
+		}
+	}
+	if user.DateOfBirth > time.Now().Format(time.DateOnly) {
+		return models.NewHttpError("date_of_birth must not be in the future", http.StatusBadRequest)
+	}
+	if user.MembershipStarts != "" && user.MembershipExpires != "" && user.MembershipExpires < user.MembershipStarts {
+		return models.NewHttpError("membership_expires must not be before membership_starts", http.StatusBadRequest)
+	}
+	return models.NewEmptyHttpError()
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const webhookDeliveryLogLimit = 100
+
+// webhookPolicy restricts the addresses subscriptions may point to
+var webhookPolicy helpers.OutboundPolicy
+
+// SetWebhookPolicy sets the addresses subscriptions may point to, public ones and the allowed networks of the policy
+func SetWebhookPolicy(policy helpers.OutboundPolicy) {
+	webhookPolicy = policy
+}
+
+func CreateWebhookSubscription(request models.WebhookSubscriptionRequest, actor models.Actor) (models.WebhookSubscription, models.HttpError) {
+	parsed, err := url.Parse(request.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return models.WebhookSubscription{}, models.NewHttpError("url must be an absolute http or https URL", http.StatusBadRequest)
+	}
+	// the dispatcher checks the address again when it connects, the host may resolve differently by then
+	if err := webhookPolicy.CheckHost(context.Background(), parsed.Hostname()); err != nil {
+		return models.WebhookSubscription{}, models.NewHttpError(fmt.Sprintf("url must point to a public address: %v", err), http.StatusBadRequest)
+	}
+	if len(request.EventTypes) == 0 {
+		return models.WebhookSubscription{}, models.NewHttpError("event_types must not be empty", http.StatusBadRequest)
+	}
+	for _, eventType := range request.EventTypes {
+		if eventType != models.AllEventTypes && !slices.Contains(models.EventTypes, eventType) {
+			return models.WebhookSubscription{}, models.NewHttpError(fmt.Sprintf("unknown event type %q, expected one of %v or %q", eventType, models.EventTypes, models.AllEventTypes), http.StatusBadRequest)
+		}
+	}
+
+	secret := request.Secret
+	if secret == "" {
+		generated := make([]byte, 32)
+		if _, err := rand.Read(generated); err != nil {
+			return models.WebhookSubscription{}, models.NewHttpErrorFromError("failed to generate secret", err, http.StatusInternalServerError)
+		}
+		secret = hex.EncodeToString(generated)
+	}
+
+	return postgres.InsertWebhookSubscription(models.WebhookSubscription{
+		URL:        request.URL,
+		EventTypes: request.EventTypes,
+		Secret:     secret,
+	}, actor)
+}
+
+func GetWebhookSubscriptions() ([]models.WebhookSubscription, models.HttpError) {
+	return postgres.GetWebhookSubscriptions()
+}
+
+func GetWebhookSubscription(id int) (models.WebhookSubscription, models.HttpError) {
+	return postgres.GetWebhookSubscription(id)
+}
+
+func DeleteWebhookSubscription(id int, actor models.Actor) models.HttpError {
+	return postgres.DeleteWebhookSubscription(id, actor)
+}
+
+func GetWebhookDeliveries(subscriptionId int, status string) ([]models.WebhookDelivery, models.HttpError) {
+	if status != "" && status != models.DeliveryPending && status != models.DeliverySucceeded && status != models.DeliveryDead {
+		return nil, models.NewHttpError(fmt.Sprintf("unknown status %q, expected pending, succeeded or dead", status), http.StatusBadRequest)
+	}
+	if _, err := postgres.GetWebhookSubscription(subscriptionId); !models.IsHttpErrorEmpty(err) {
+		return nil, err
+	}
+	return postgres.GetWebhookDeliveries(subscriptionId, status, webhookDeliveryLogLimit)
+}
+
+func RedeliverWebhook(subscriptionId int, deliveryId int64, actor models.Actor) models.HttpError {
+	return postgres.RedeliverWebhook(subscriptionId, deliveryId, actor)
+}
+
+func EnqueueWebhookDeliveries(event models.Event) models.HttpError {
+	return postgres.EnqueueWebhookDeliveries(event)
+}
+
+func ClaimWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, models.HttpError) {
+	return postgres.ClaimWebhookDeliveries(limit, lease)
+}
+
+func RecordWebhookDelivery(delivery models.WebhookDelivery, statusCode int, deliverErr error, maxAttempts int, retryDelay func(attempts int) time.Duration) models.HttpError {
+	return postgres.RecordWebhookDelivery(delivery, statusCode, deliverErr, maxAttempts, retryDelay)
+}
@@ -0,0 +1,291 @@
+package sru
+
+import (
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"strings"
+)
+
+// indexes maps the supported CQL indexes, in lower case, to book fields
+var indexes = map[string]string{
+	"cql.serverchoice": models.BookFieldAny,
+	"cql.allrecords":   models.BookFieldAll,
+	"title":            models.BookFieldTitle,
+	"dc.title":         models.BookFieldTitle,
+	"bath.title":       models.BookFieldTitle,
+	"author":           models.BookFieldAuthor,
+	"creator":          models.BookFieldAuthor,
+	"dc.creator":       models.BookFieldAuthor,
+	"bath.author":      models.BookFieldAuthor,
+	"bath.name":        models.BookFieldAuthor,
+	"subject":          models.BookFieldSubject,
+	"dc.subject":       models.BookFieldSubject,
+	"bath.subject":     models.BookFieldSubject,
+	"isbn":             models.BookFieldISBN,
+	"dc.identifier":    models.BookFieldISBN,
+	"bath.isbn":        models.BookFieldISBN,
+}
+
+// contextSets are the index prefixes the indexes above belong to
+var contextSets = []string{"cql", "dc", "bath"}
+
+// relations maps the supported CQL relations to how the term is matched, <> is handled separately
+var relations = map[string]string{
+	"=":     models.MatchPhrase,
+	"adj":   models.MatchPhrase,
+	"all":   models.MatchAllWords,
+	"any":   models.MatchAnyWord,
+	"==":    models.MatchExact,
+	"exact": models.MatchExact,
+}
+
+// namedRelations are the relations written as words, a word followed by one of them and a term starts an index clause
+var namedRelations = []string{"adj", "all", "any", "exact", "within", "encloses"}
+
+// ParseCQL parses a CQL query into a book condition. It supports search clauses on title, author, subject and ISBN
+// indexes with the =, ==, <>, adj, all, any and exact relations, combined with and, or, not and parentheses.
+// Errors are returned as a *Diagnostic.
+func ParseCQL(query string) (models.BookCondition, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return models.BookCondition{}, err
+	}
+	p := &parser{tokens: tokens}
+	condition, err := p.scopedClause()
+	if err != nil {
+		return condition, err
+	}
+	switch next := p.peek(); {
+	case next.kind == tokenWord && !next.quoted && strings.EqualFold(next.text, "sortby"):
+		return condition, newDiagnostic(DiagnosticSortUnsupported, "sortBy")
+	case next.kind != tokenEnd:
+		return condition, newDiagnostic(DiagnosticQuerySyntax, fmt.Sprintf("unexpected %q", next.text))
+	}
+	return condition, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenOpen
+	tokenClose
+	tokenSlash
+	tokenSymbol
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	quoted bool
+}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")"})
+			i++
+		case c == '/':
+			tokens = append(tokens, token{kind: tokenSlash, text: "/"})
+			i++
+		case c == '=' || c == '<' || c == '>':
+			end := i + 1
+			for _, symbol := range []string{"==", "<>", "<=", ">="} {
+				if strings.HasPrefix(query[i:], symbol) {
+					end = i + 2
+					break
+				}
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: query[i:end]})
+			i = end
+		case c == '"':
+			// the term keeps its backslash escapes, they are resolved when the term is matched
+			var term strings.Builder
+			closed := false
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' && i+1 < len(query) {
+					if query[i+1] != '"' {
+						term.WriteByte('\\')
+					}
+					term.WriteByte(query[i+1])
+					i++
+					continue
+				}
+				if query[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				term.WriteByte(query[i])
+			}
+			if !closed {
+				return nil, newDiagnostic(DiagnosticQuerySyntax, "unterminated quoted term")
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: term.String(), quoted: true})
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n\r()/=<>\"", rune(query[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: query[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.peekAt(0)
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return token{kind: tokenEnd, text: "end of query"}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+// scopedClause reads search clauses joined by boolean operators, which bind left to right
+func (p *parser) scopedClause() (models.BookCondition, error) {
+	left, err := p.searchClause()
+	if err != nil {
+		return left, err
+	}
+	for {
+		operator := p.peek()
+		if operator.kind != tokenWord || operator.quoted {
+			return left, nil
+		}
+		name := strings.ToLower(operator.text)
+		switch name {
+		case models.ConditionAnd, models.ConditionOr, models.ConditionNot:
+		case "prox":
+			return left, newDiagnostic(DiagnosticUnsupportedBoolean, operator.text)
+		default:
+			return left, nil
+		}
+		p.next()
+		if p.peek().kind == tokenSlash {
+			p.next()
+			return left, newDiagnostic(DiagnosticUnsupportedBooleanModify, p.next().text)
+		}
+		right, err := p.searchClause()
+		if err != nil {
+			return left, err
+		}
+		left = models.BookCondition{Operator: name, Operands: []models.BookCondition{left, right}}
+	}
+}
+
+func (p *parser) searchClause() (models.BookCondition, error) {
+	first := p.next()
+	switch first.kind {
+	case tokenOpen:
+		condition, err := p.scopedClause()
+		if err != nil {
+			return condition, err
+		}
+		if closing := p.next(); closing.kind != tokenClose {
+			return condition, newDiagnostic(DiagnosticQuerySyntax, fmt.Sprintf("expected ) instead of %q", closing.text))
+		}
+		return condition, nil
+	case tokenWord:
+	default:
+		return models.BookCondition{}, newDiagnostic(DiagnosticQuerySyntax, fmt.Sprintf("expected a search term instead of %q", first.text))
+	}
+
+	if !p.startsRelation() {
+		return term(models.BookFieldAny, "=", first)
+	}
+	field, err := index(first.text)
+	if err != nil {
+		return models.BookCondition{}, err
+	}
+	relation := strings.ToLower(p.next().text)
+	if p.peek().kind == tokenSlash {
+		p.next()
+		return models.BookCondition{}, newDiagnostic(DiagnosticUnsupportedModifier, p.next().text)
+	}
+	value := p.next()
+	if value.kind != tokenWord {
+		return models.BookCondition{}, newDiagnostic(DiagnosticQuerySyntax, fmt.Sprintf("expected a search term instead of %q", value.text))
+	}
+	return term(field, relation, value)
+}
+
+// startsRelation reports whether the word just read is an index, that is followed by a relation and a term
+func (p *parser) startsRelation() bool {
+	next := p.peek()
+	if next.kind == tokenSymbol {
+		return true
+	}
+	if next.kind != tokenWord || next.quoted {
+		return false
+	}
+	for _, relation := range namedRelations {
+		if strings.EqualFold(next.text, relation) {
+			after := p.peekAt(1)
+			return after.kind == tokenWord || after.kind == tokenSlash
+		}
+	}
+	return false
+}
+
+func index(name string) (string, error) {
+	field, ok := indexes[strings.ToLower(name)]
+	if ok {
+		return field, nil
+	}
+	if set, _, prefixed := strings.Cut(name, "."); prefixed {
+		known := false
+		for _, contextSet := range contextSets {
+			known = known || strings.EqualFold(set, contextSet)
+		}
+		if !known {
+			return "", newDiagnostic(DiagnosticUnsupportedContextSet, set)
+		}
+	}
+	return "", newDiagnostic(DiagnosticUnsupportedIndex, name)
+}
+
+func term(field string, relation string, value token) (models.BookCondition, error) {
+	if field == models.BookFieldAll {
+		return models.BookCondition{Field: models.BookFieldAll}, nil
+	}
+	if strings.TrimSpace(value.text) == "" {
+		return models.BookCondition{}, newDiagnostic(DiagnosticEmptyTerm, "")
+	}
+	if relation == "<>" {
+		// <> matches every book the exact relation does not
+		return models.BookCondition{Operator: models.ConditionNot, Operands: []models.BookCondition{
+			{Field: models.BookFieldAll},
+			{Field: field, Match: models.MatchExact, Value: value.text},
+		}}, nil
+	}
+	match, ok := relations[relation]
+	if !ok {
+		return models.BookCondition{}, newDiagnostic(DiagnosticUnsupportedRelation, relation)
+	}
+	return models.BookCondition{Field: field, Match: match, Value: value.text}, nil
+}
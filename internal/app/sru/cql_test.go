@@ -0,0 +1,76 @@
+package sru
+
+import (
+	"errors"
+	"github.com/spin311/library-api/internal/repository/models"
+	"reflect"
+	"testing"
+)
+
+func leaf(field string, match string, value string) models.BookCondition {
+	return models.BookCondition{Field: field, Match: match, Value: value}
+}
+
+func combine(operator string, left models.BookCondition, right models.BookCondition) models.BookCondition {
+	return models.BookCondition{Operator: operator, Operands: []models.BookCondition{left, right}}
+}
+
+func TestParseCQL(t *testing.T) {
+	tests := map[string]models.BookCondition{
+		`hobbit`:                leaf(models.BookFieldAny, models.MatchPhrase, "hobbit"),
+		`"lord of the rings"`:   leaf(models.BookFieldAny, models.MatchPhrase, "lord of the rings"),
+		`dc.title = hobbit`:     leaf(models.BookFieldTitle, models.MatchPhrase, "hobbit"),
+		`TITLE all "ring lord"`: leaf(models.BookFieldTitle, models.MatchAllWords, "ring lord"),
+		`bath.author any "a b"`: leaf(models.BookFieldAuthor, models.MatchAnyWord, "a b"),
+		`dc.creator==Tolkien*`:  leaf(models.BookFieldAuthor, models.MatchExact, "Tolkien*"),
+		`isbn exact 0261102214`: leaf(models.BookFieldISBN, models.MatchExact, "0261102214"),
+		`subject adj "a \"b\""`: leaf(models.BookFieldSubject, models.MatchPhrase, `a "b"`),
+		`title = "50\% \*off"`:  leaf(models.BookFieldTitle, models.MatchPhrase, `50\% \*off`),
+		`cql.allRecords = 1`:    {Field: models.BookFieldAll},
+		`title = a and author = b or c`: combine(models.ConditionOr,
+			combine(models.ConditionAnd, leaf(models.BookFieldTitle, models.MatchPhrase, "a"), leaf(models.BookFieldAuthor, models.MatchPhrase, "b")),
+			leaf(models.BookFieldAny, models.MatchPhrase, "c")),
+		`title = a NOT (subject = b or subject = c)`: combine(models.ConditionNot,
+			leaf(models.BookFieldTitle, models.MatchPhrase, "a"),
+			combine(models.ConditionOr, leaf(models.BookFieldSubject, models.MatchPhrase, "b"), leaf(models.BookFieldSubject, models.MatchPhrase, "c"))),
+		`author <> Tolkien`: combine(models.ConditionNot,
+			models.BookCondition{Field: models.BookFieldAll},
+			leaf(models.BookFieldAuthor, models.MatchExact, "Tolkien")),
+		`any and all`: combine(models.ConditionAnd, leaf(models.BookFieldAny, models.MatchPhrase, "any"), leaf(models.BookFieldAny, models.MatchPhrase, "all")),
+	}
+	for query, want := range tests {
+		got, err := ParseCQL(query)
+		if err != nil {
+			t.Errorf("ParseCQL(%q) error = %v", query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseCQL(%q)\n got: %+v\nwant: %+v", query, got, want)
+		}
+	}
+}
+
+func TestParseCQLDiagnostics(t *testing.T) {
+	tests := map[string]string{
+		`title = `:                    "info:srw/diagnostic/1/10",
+		`(title = a`:                  "info:srw/diagnostic/1/10",
+		`title = "a`:                  "info:srw/diagnostic/1/10",
+		`a b`:                         "info:srw/diagnostic/1/10",
+		`dc.date = 1999`:              "info:srw/diagnostic/1/16",
+		`marc.245 = a`:                "info:srw/diagnostic/1/15",
+		`title > a`:                   "info:srw/diagnostic/1/19",
+		`title within "a b"`:          "info:srw/diagnostic/1/19",
+		`title =/stem a`:              "info:srw/diagnostic/1/20",
+		`title = ""`:                  "info:srw/diagnostic/1/27",
+		`a prox b`:                    "info:srw/diagnostic/1/37",
+		`a and/rel.algorithm=cori b`:  "info:srw/diagnostic/1/46",
+		`title = a sortBy dc.creator`: "info:srw/diagnostic/1/80",
+	}
+	for query, want := range tests {
+		_, err := ParseCQL(query)
+		var diagnostic *Diagnostic
+		if !errors.As(err, &diagnostic) || diagnostic.URI != want {
+			t.Errorf("ParseCQL(%q) error = %v, want diagnostic %s", query, err, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package sru
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// Diagnostic codes from the SRU diagnostics list, info:srw/diagnostic/1/<code>
+const (
+	DiagnosticGeneral                  = 1
+	DiagnosticUnsupportedOperation     = 4
+	DiagnosticUnsupportedVersion       = 5
+	DiagnosticUnsupportedParameter     = 6
+	DiagnosticMissingParameter         = 7
+	DiagnosticQuerySyntax              = 10
+	DiagnosticUnsupportedContextSet    = 15
+	DiagnosticUnsupportedIndex         = 16
+	DiagnosticUnsupportedRelation      = 19
+	DiagnosticUnsupportedModifier      = 20
+	DiagnosticEmptyTerm                = 27
+	DiagnosticUnsupportedBoolean       = 37
+	DiagnosticUnsupportedBooleanModify = 46
+	DiagnosticFirstRecordOutOfRange    = 61
+	DiagnosticUnknownSchema            = 66
+	DiagnosticUnsupportedPacking       = 71
+	DiagnosticSortUnsupported          = 80
+)
+
+var diagnosticMessages = map[int]string{
+	DiagnosticGeneral:                  "General system error",
+	DiagnosticUnsupportedOperation:     "Unsupported operation",
+	DiagnosticUnsupportedVersion:       "Unsupported version",
+	DiagnosticUnsupportedParameter:     "Unsupported parameter value",
+	DiagnosticMissingParameter:         "Mandatory parameter not supplied",
+	DiagnosticQuerySyntax:              "Query syntax error",
+	DiagnosticUnsupportedContextSet:    "Unsupported context set",
+	DiagnosticUnsupportedIndex:         "Unsupported index",
+	DiagnosticUnsupportedRelation:      "Unsupported relation",
+	DiagnosticUnsupportedModifier:      "Unsupported relation modifier",
+	DiagnosticEmptyTerm:                "Empty term unsupported",
+	DiagnosticUnsupportedBoolean:       "Unsupported boolean operator",
+	DiagnosticUnsupportedBooleanModify: "Unsupported boolean modifier",
+	DiagnosticFirstRecordOutOfRange:    "First record position out of range",
+	DiagnosticUnknownSchema:            "Unknown schema for retrieval",
+	DiagnosticUnsupportedPacking:       "Unsupported record packing",
+	DiagnosticSortUnsupported:          "Sort not supported",
+}
+
+// Diagnostic is an SRU error. SRU reports errors in the response body, so it is answered with 200 OK.
+type Diagnostic struct {
+	XMLName xml.Name `xml:"diag:diagnostic"`
+	Xmlns   string   `xml:"xmlns:diag,attr"`
+	URI     string   `xml:"diag:uri"`
+	Details string   `xml:"diag:details,omitempty"`
+	Message string   `xml:"diag:message"`
+}
+
+func newDiagnostic(code int, details string) *Diagnostic {
+	return &Diagnostic{
+		Xmlns:   diagnosticNamespace,
+		URI:     fmt.Sprintf("info:srw/diagnostic/1/%d", code),
+		Details: details,
+		Message: diagnosticMessages[code],
+	}
+}
+
+func (d *Diagnostic) Error() string {
+	if d.Details == "" {
+		return d.Message
+	}
+	return d.Message + ": " + d.Details
+}
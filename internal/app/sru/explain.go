@@ -0,0 +1,105 @@
+package sru
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+// Explain is a ZeeRex record describing the server, its indexes and record schemas
+type Explain struct {
+	XMLName      xml.Name            `xml:"http://explain.z3950.org/dtd/2.0/ explain"`
+	ServerInfo   explainServer       `xml:"serverInfo"`
+	DatabaseInfo explainDatabase     `xml:"databaseInfo"`
+	IndexInfo    explainIndexInfo    `xml:"indexInfo"`
+	SchemaInfo   []explainSchema     `xml:"schemaInfo>schema"`
+	ConfigInfo   []explainConfigItem `xml:"configInfo>default"`
+	Settings     []explainConfigItem `xml:"configInfo>setting"`
+}
+
+type explainServer struct {
+	Protocol string `xml:"protocol,attr"`
+	Version  string `xml:"version,attr"`
+	Host     string `xml:"host"`
+	Port     int    `xml:"port"`
+	Database string `xml:"database"`
+}
+
+type explainDatabase struct {
+	Title       string `xml:"title"`
+	Description string `xml:"description"`
+}
+
+type explainIndexInfo struct {
+	Sets    []explainSet   `xml:"set"`
+	Indexes []explainIndex `xml:"index"`
+}
+
+type explainSet struct {
+	Name       string `xml:"name,attr"`
+	Identifier string `xml:"identifier,attr"`
+}
+
+type explainIndex struct {
+	Title string        `xml:"title"`
+	Names []explainName `xml:"map>name"`
+}
+
+type explainName struct {
+	Set  string `xml:"set,attr"`
+	Name string `xml:",chardata"`
+}
+
+type explainSchema struct {
+	Name       string `xml:"name,attr"`
+	Identifier string `xml:"identifier,attr"`
+	Title      string `xml:"title"`
+}
+
+type explainConfigItem struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func explain(host string, port int) ExplainResponse {
+	record := Explain{
+		ServerInfo: explainServer{Protocol: "SRU", Version: Version, Host: host, Port: port, Database: "sru"},
+		DatabaseInfo: explainDatabase{
+			Title:       "Library API",
+			Description: "Bibliographic records of the library catalog",
+		},
+		IndexInfo: explainIndexInfo{
+			Sets: []explainSet{
+				{Name: "cql", Identifier: "info:srw/cql-context-set/1/cql-v1.2"},
+				{Name: "dc", Identifier: "info:srw/cql-context-set/1/dc-v1.1"},
+				{Name: "bath", Identifier: "http://zing.z3950.org/cql/bath/2.0/"},
+			},
+			Indexes: []explainIndex{
+				{Title: "Any field", Names: []explainName{{Set: "cql", Name: "serverChoice"}}},
+				{Title: "All records", Names: []explainName{{Set: "cql", Name: "allRecords"}}},
+				{Title: "Title", Names: []explainName{{Set: "dc", Name: "title"}, {Set: "bath", Name: "title"}}},
+				{Title: "Author", Names: []explainName{{Set: "dc", Name: "creator"}, {Set: "bath", Name: "author"}, {Set: "bath", Name: "name"}}},
+				{Title: "Subject", Names: []explainName{{Set: "dc", Name: "subject"}, {Set: "bath", Name: "subject"}}},
+				{Title: "ISBN", Names: []explainName{{Set: "dc", Name: "identifier"}, {Set: "bath", Name: "isbn"}}},
+			},
+		},
+		ConfigInfo: []explainConfigItem{
+			{Type: "numberOfRecords", Value: strconv.Itoa(DefaultMaximumRecords)},
+			{Type: "contextSet", Value: "cql"},
+			{Type: "index", Value: "cql.serverChoice"},
+			{Type: "relation", Value: "="},
+		},
+		Settings: []explainConfigItem{{Type: "maximumRecords", Value: strconv.Itoa(MaxMaximumRecords)}},
+	}
+	for _, schema := range recordSchemas {
+		record.SchemaInfo = append(record.SchemaInfo, explainSchema{Name: schema.name, Identifier: schema.identifier, Title: schema.title})
+	}
+	return ExplainResponse{
+		Xmlns:   srwNamespace,
+		Version: Version,
+		Record: &Record{
+			Schema:  explainNamespace,
+			Packing: "xml",
+			Data:    recordData{Record: record},
+		},
+	}
+}
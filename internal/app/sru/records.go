@@ -0,0 +1,65 @@
+package sru
+
+import (
+	"encoding/xml"
+	"github.com/spin311/library-api/internal/app/marc"
+	"github.com/spin311/library-api/internal/repository/models"
+	"strings"
+)
+
+// recordSchema is a format records can be retrieved in, clients name it by its short name or identifier
+type recordSchema struct {
+	name       string
+	identifier string
+	title      string
+	record     func(models.ListedBook) any
+}
+
+var recordSchemas = []recordSchema{
+	{name: "marcxml", identifier: "info:srw/schema/1/marcxml-v1.1", title: "MARCXML", record: marcRecord},
+	{name: "dc", identifier: "info:srw/schema/1/dc-v1.1", title: "Dublin Core", record: dcRecord},
+}
+
+func findSchema(name string) (recordSchema, bool) {
+	for _, schema := range recordSchemas {
+		if strings.EqualFold(name, schema.name) || name == schema.identifier {
+			return schema, true
+		}
+	}
+	return recordSchema{}, false
+}
+
+func marcRecord(book models.ListedBook) any {
+	return marc.FromBook(models.Book{ID: book.ID, Title: book.Title, Catalog: book.Catalog})
+}
+
+// DublinCore is a record in the SRU Dublin Core schema
+type DublinCore struct {
+	XMLName     xml.Name `xml:"srw_dc:dc"`
+	XmlnsSRWDC  string   `xml:"xmlns:srw_dc,attr"`
+	XmlnsDC     string   `xml:"xmlns:dc,attr"`
+	Title       string   `xml:"dc:title"`
+	Creators    []string `xml:"dc:creator"`
+	Subjects    []string `xml:"dc:subject"`
+	Publisher   string   `xml:"dc:publisher,omitempty"`
+	Date        string   `xml:"dc:date,omitempty"`
+	Type        string   `xml:"dc:type"`
+	Identifiers []string `xml:"dc:identifier"`
+}
+
+func dcRecord(book models.ListedBook) any {
+	record := DublinCore{
+		XmlnsSRWDC: "info:srw/schema/1/dc-schema",
+		XmlnsDC:    "http://purl.org/dc/elements/1.1/",
+		Title:      book.Title,
+		Creators:   book.Authors,
+		Subjects:   book.Subjects,
+		Publisher:  book.Publisher,
+		Date:       book.PublicationDate,
+		Type:       "Text",
+	}
+	if book.ISBN != "" {
+		record.Identifiers = append(record.Identifiers, "urn:isbn:"+book.ISBN)
+	}
+	return record
+}
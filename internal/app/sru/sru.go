@@ -0,0 +1,180 @@
+// Package sru answers SRU 1.2 (Search/Retrieve via URL) requests for union catalogs and interlibrary loan systems.
+// Queries are written in CQL and records are returned as MARCXML or Dublin Core.
+package sru
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Version is the SRU version of the responses, requests may also ask for 1.1
+const Version = "1.2"
+
+const (
+	srwNamespace        = "http://www.loc.gov/zing/srw/"
+	diagnosticNamespace = "http://www.loc.gov/zing/srw/diagnostic/"
+	explainNamespace    = "http://explain.z3950.org/dtd/2.0/"
+)
+
+// Limits of the number of records in a searchRetrieve response
+const (
+	DefaultMaximumRecords = 10
+	MaxMaximumRecords     = 100
+)
+
+// SearchRetrieveResponse answers a searchRetrieve request
+type SearchRetrieveResponse struct {
+	XMLName            xml.Name     `xml:"srw:searchRetrieveResponse"`
+	Xmlns              string       `xml:"xmlns:srw,attr"`
+	Version            string       `xml:"srw:version"`
+	NumberOfRecords    int          `xml:"srw:numberOfRecords"`
+	Records            *Records     `xml:"srw:records,omitempty"`
+	NextRecordPosition int          `xml:"srw:nextRecordPosition,omitempty"`
+	Diagnostics        *Diagnostics `xml:"srw:diagnostics,omitempty"`
+}
+
+// ExplainResponse describes the server, it also carries the diagnostics of requests for unknown operations
+type ExplainResponse struct {
+	XMLName     xml.Name     `xml:"srw:explainResponse"`
+	Xmlns       string       `xml:"xmlns:srw,attr"`
+	Version     string       `xml:"srw:version"`
+	Record      *Record      `xml:"srw:record,omitempty"`
+	Diagnostics *Diagnostics `xml:"srw:diagnostics,omitempty"`
+}
+
+type Records struct {
+	Records []Record `xml:"srw:record"`
+}
+
+type Diagnostics struct {
+	Diagnostics []*Diagnostic `xml:"diag:diagnostic"`
+}
+
+type Record struct {
+	Schema   string     `xml:"srw:recordSchema"`
+	Packing  string     `xml:"srw:recordPacking"`
+	Data     recordData `xml:"srw:recordData"`
+	Position int        `xml:"srw:recordPosition,omitempty"`
+}
+
+type recordData struct {
+	Record any
+}
+
+// Respond answers an SRU request given its parameters. Without an operation a request with a query
+// is a searchRetrieve and any other request an explain. Host and port are described by explain.
+func Respond(params url.Values, host string, port int) any {
+	if version := params.Get("version"); version != "" && version != "1.1" && version != Version {
+		return explainError(newDiagnostic(DiagnosticUnsupportedVersion, Version))
+	}
+	operation := params.Get("operation")
+	if operation == "" && params.Get("query") != "" {
+		operation = "searchRetrieve"
+	}
+	switch operation {
+	case "", "explain":
+		return explain(host, port)
+	case "searchRetrieve":
+		return searchRetrieve(params)
+	default:
+		return explainError(newDiagnostic(DiagnosticUnsupportedOperation, operation))
+	}
+}
+
+func searchRetrieve(params url.Values) SearchRetrieveResponse {
+	response := SearchRetrieveResponse{Xmlns: srwNamespace, Version: Version}
+	fail := func(diagnostic *Diagnostic) SearchRetrieveResponse {
+		response.Records = nil
+		response.Diagnostics = &Diagnostics{Diagnostics: []*Diagnostic{diagnostic}}
+		return response
+	}
+
+	query := params.Get("query")
+	if query == "" {
+		return fail(newDiagnostic(DiagnosticMissingParameter, "query"))
+	}
+	start, err := intParam(params, "startRecord", 1)
+	if err != nil || start < 1 {
+		return fail(newDiagnostic(DiagnosticUnsupportedParameter, "startRecord"))
+	}
+	maximum, err := intParam(params, "maximumRecords", DefaultMaximumRecords)
+	if err != nil || maximum < 0 || maximum > MaxMaximumRecords {
+		return fail(newDiagnostic(DiagnosticUnsupportedParameter, "maximumRecords"))
+	}
+	schema, ok := findSchema(params.Get("recordSchema"))
+	if params.Get("recordSchema") == "" {
+		schema, ok = recordSchemas[0], true
+	}
+	if !ok {
+		return fail(newDiagnostic(DiagnosticUnknownSchema, params.Get("recordSchema")))
+	}
+	if packing := params.Get("recordPacking"); packing != "" && packing != "xml" {
+		return fail(newDiagnostic(DiagnosticUnsupportedPacking, packing))
+	}
+	condition, err := ParseCQL(query)
+	if err != nil {
+		if diagnostic, ok := err.(*Diagnostic); ok {
+			return fail(diagnostic)
+		}
+		return fail(newDiagnostic(DiagnosticQuerySyntax, err.Error()))
+	}
+
+	page, httpErr := services.SearchBooks(models.BookQuery{Condition: &condition, Limit: maximum, Offset: start - 1})
+	if !models.IsHttpErrorEmpty(httpErr) {
+		if httpErr.StatusCode == http.StatusBadRequest {
+			return fail(newDiagnostic(DiagnosticQuerySyntax, httpErr.Message))
+		}
+		return fail(newDiagnostic(DiagnosticGeneral, httpErr.Message))
+	}
+	response.NumberOfRecords = page.Total
+	if page.Total > 0 && start > page.Total {
+		return fail(newDiagnostic(DiagnosticFirstRecordOutOfRange, strconv.Itoa(start)))
+	}
+	if len(page.Books) > 0 {
+		response.Records = &Records{}
+	}
+	for i, book := range page.Books {
+		response.Records.Records = append(response.Records.Records, Record{
+			Schema:   schema.identifier,
+			Packing:  "xml",
+			Data:     recordData{Record: schema.record(book)},
+			Position: start + i,
+		})
+	}
+	if next := start + len(page.Books); len(page.Books) > 0 && next <= page.Total {
+		response.NextRecordPosition = next
+	}
+	return response
+}
+
+func intParam(params url.Values, name string, fallback int) (int, error) {
+	value := params.Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func explainError(diagnostic *Diagnostic) ExplainResponse {
+	return ExplainResponse{Xmlns: srwNamespace, Version: Version, Diagnostics: &Diagnostics{Diagnostics: []*Diagnostic{diagnostic}}}
+}
+
+// Write writes an SRU response as an XML document
+func Write(w io.Writer, response any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(response); err != nil {
+		return fmt.Errorf("failed to encode the SRU response: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
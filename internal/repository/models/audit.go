@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditUserCreate       = "user.create"
+	AuditUserUpdate       = "user.update"
+	AuditUserCard         = "user.card"
+	AuditBookCreate       = "book.create"
+	AuditBookUpdate       = "book.update"
+	AuditBookBorrow       = "book.borrow"
+	AuditBookReturn       = "book.return"
+	AuditBookRenew        = "book.renew"
+	AuditBookLost         = "book.lost"
+	AuditBookFound        = "book.found"
+	AuditBookRepair       = "book.repair"
+	AuditWebhookCreate    = "webhook.create"
+	AuditWebhookDelete    = "webhook.delete"
+	AuditWebhookRedeliver = "webhook.redeliver"
+	AuditJobRun           = "job.run"
+	AuditBackupRestore    = "backup.restore"
+)
+
+const (
+	// AuditTargetJob is the target type of manually queued job runs, the target ID is the run's ID
+	AuditTargetJob = "job"
+	// AuditTargetBackup is the target type of restores, they have no target ID and are recorded with 0
+	AuditTargetBackup = "backup"
+)
+
+// AnonymousActor is recorded when a request comes without a verified client certificate
+const AnonymousActor = "anonymous"
+
+// Actor describes who made a change and through which request
+type Actor struct {
+	Name string
+	// Claimed is who the client says it is, e.g. in the X-Actor header. It is not verified, so it is only recorded next to Name.
+	Claimed   string
+	RequestID string
+	ClientIP  string
+}
+
+// SystemActor is the actor of changes made by the service itself, e.g. by background jobs or commands
+func SystemActor(name string) Actor {
+	return Actor{Name: "system:" + name}
+}
+
+// AuditEntry records a single change, with the state of the target before and after it
+//
+//swagger:model
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	//example: cert:kiosk-3
+	Actor string `json:"actor"`
+	// ClaimedActor is the unverified X-Actor header of the request
+	//example: jane
+	ClaimedActor string `json:"claimed_actor,omitempty"`
+	//example: book.return
+	Action string `json:"action"`
+	//example: borrow
+	TargetType string `json:"target_type"`
+	TargetID   int    `json:"target_id"`
+	// Before is the target before the change, absent for creations
+	Before json.RawMessage `json:"before,omitempty" swaggertype:"object"`
+	// After is the target after the change, absent for deletions
+	After     json.RawMessage `json:"after,omitempty" swaggertype:"object"`
+	RequestID string          `json:"request_id,omitempty"`
+	ClientIP  string          `json:"client_ip,omitempty"`
+}
+
+// AuditFilter selects audit entries, zero values match everything
+type AuditFilter struct {
+	Actor        string
+	ClaimedActor string
+	Action       string
+	TargetType   string
+	TargetID     int
+	// UserID and BookID match entries whose target is, or whose snapshots refer to, the user or book
+	UserID    int
+	BookID    int
+	RequestID string
+	From      *time.Time
+	To        *time.Time
+	// BeforeID pages backwards, only entries with a lower ID are returned
+	BeforeID int64
+	Limit    int
+}
@@ -0,0 +1,17 @@
+package models
+
+// BookAvailability is the number of copies of a book that can be borrowed now, as pushed to availability streams
+type BookAvailability struct {
+	BookID    int `json:"book_id"`
+	Available int `json:"available"`
+	// Version is the version of the book, streams skip updates older than the last one they sent
+	Version int `json:"version"`
+}
+
+func NewBookAvailability(book BookResponse) BookAvailability {
+	return BookAvailability{
+		BookID:    book.ID,
+		Available: book.AvailableCount,
+		Version:   book.Version,
+	}
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// BackupVersion is the version of the backup bundle layout written by this build.
+// Version 2 added charges and version 3 revoked cards and the creation time of books, older bundles are read as having none.
+const BackupVersion = 3
+
+const (
+	BackupFormatNDJSON = "ndjson"
+	BackupFormatTarGz  = "tar.gz"
+)
+
+// BackupManifest describes a backup bundle
+type BackupManifest struct {
+	// Version is the bundle layout version, bundles of a newer version are rejected
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// SchemaVersion is the migration the database was at when the backup was taken
+	SchemaVersion uint `json:"schema_version"`
+	Users         int  `json:"users"`
+	Books         int  `json:"books"`
+	Borrows       int  `json:"borrows"`
+	Charges       int  `json:"charges"`
+	RevokedCards  int  `json:"revoked_cards"`
+}
+
+// Backup is a snapshot of the library: its users, books, borrows and charges with their original IDs,
+// and the numbers of replaced cards
+type Backup struct {
+	Manifest     BackupManifest
+	Users        []User
+	Books        []BackupBook
+	Borrows      []Borrow
+	Charges      []Charge
+	RevokedCards []RevokedCard
+}
+
+// BackupBook is a book with the time it was added to the catalog, which orders the new arrivals feed.
+// CreatedAt is missing in older bundles, those books are restored as added at the time of the restore.
+type BackupBook struct {
+	Book
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// BackupRestore is the audit log snapshot of a restore
+type BackupRestore struct {
+	Manifest BackupManifest `json:"manifest"`
+	Replace  bool           `json:"replace"`
+	// ReplacedRows counts the users, books and borrows that were deleted to make room for the backup
+	ReplacedRows int `json:"replaced_rows"`
+}
+
+// RevokedCard is the number of a replaced library card, it is never issued again
+type RevokedCard struct {
+	CardNumber string    `json:"card_number"`
+	UserID     int       `json:"user_id"`
+	RevokedAt  time.Time `json:"revoked_at"`
+}
@@ -5,6 +5,18 @@ type Book struct {
 	Title         string `json:"title"`
 	Quantity      int    `json:"quantity"`
 	BorrowedCount int    `json:"borrowed_count"`
+	Version       int    `json:"version"`
+	Restrictions
+	Catalog
+}
+
+// Restrictions limit who may borrow a book
+type Restrictions struct {
+	// ReferenceOnly books are only lent to patron categories allowed to borrow reference books
+	ReferenceOnly bool `json:"reference_only"`
+	// AgeRating is the minimum age of readers, 0 when the book is not rated
+	//example: 12
+	AgeRating int `json:"age_rating"`
 }
 
 // BookResponse represents a book in the system
@@ -17,6 +29,21 @@ type BookResponse struct {
 	Title string `json:"title"`
 	//example: 5
 	AvailableCount int `json:"quantity"`
+	// Version is sent as the ETag header
+	Version int `json:"-"`
+	Restrictions
+	Catalog
+}
+
+// BookRequest holds the editable fields of a book
+//
+//swagger:model
+type BookRequest struct {
+	//example: The Great Gatsby
+	Title string `json:"title"`
+	//example: 5
+	Quantity int `json:"quantity"`
+	Restrictions
 }
 
 func NewBookResponseFromBook(book Book) BookResponse {
@@ -24,5 +51,8 @@ func NewBookResponseFromBook(book Book) BookResponse {
 		ID:             book.ID,
 		Title:          book.Title,
 		AvailableCount: book.Quantity - book.BorrowedCount,
+		Version:        book.Version,
+		Restrictions:   book.Restrictions,
+		Catalog:        book.Catalog,
 	}
 }
@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// Heading kinds listed by GetHeadings
+const (
+	HeadingAuthor  = "author"
+	HeadingSubject = "subject"
+)
+
+// BookQuery selects a page of books, zero values match every book
+type BookQuery struct {
+	// Author and Subject match a heading exactly, as listed by GetHeadings
+	Author  string
+	Subject string
+	// Search matches books whose title, authors or subjects contain every word, or whose ISBN it is
+	Search string
+	// Condition further restricts the books, e.g. to those matching a CQL query
+	Condition *BookCondition
+	Limit     int
+	Offset    int
+}
+
+// Fields a BookCondition can match
+const (
+	BookFieldAny     = "any"
+	BookFieldTitle   = "title"
+	BookFieldAuthor  = "author"
+	BookFieldSubject = "subject"
+	BookFieldISBN    = "isbn"
+	// BookFieldAll matches every book regardless of the value
+	BookFieldAll = "all"
+)
+
+// How a BookCondition matches the value against a field
+const (
+	// MatchPhrase matches fields containing the words of the value next to each other
+	MatchPhrase = "phrase"
+	// MatchAllWords matches fields containing every word of the value
+	MatchAllWords = "all"
+	// MatchAnyWord matches fields containing at least one word of the value
+	MatchAnyWord = "any"
+	// MatchExact matches fields, or for authors and subjects single headings, equal to the value
+	MatchExact = "exact"
+)
+
+// Operators combining the operands of a BookCondition
+const (
+	ConditionAnd = "and"
+	ConditionOr  = "or"
+	// ConditionNot matches books matching the first operand but not the second
+	ConditionNot = "not"
+)
+
+// BookCondition is a boolean expression over the catalog fields of books.
+// A condition either combines two operands with Operator or matches Value against Field.
+type BookCondition struct {
+	Operator string
+	Operands []BookCondition
+	Field    string
+	Match    string
+	// Value may mask characters like CQL: * stands for any run of characters, ? for one character
+	// and a backslash makes the next character literal. Matching ignores case except for MatchExact.
+	Value string
+}
+
+// ListedBook is a book with the time it was added to the catalog
+type ListedBook struct {
+	BookResponse
+	AddedAt time.Time
+}
+
+// BookPage is a page of the books matching a BookQuery, newest first
+type BookPage struct {
+	Books []ListedBook
+	// Total is the number of matching books on all pages
+	Total int
+	// Updated is when the newest matching book was added, zero when nothing matches
+	Updated time.Time
+}
+
+// Heading is an author or subject with the number of books cataloged under it
+type Heading struct {
+	Name  string
+	Books int
+}
+
+// HeadingPage is a page of headings in alphabetical order
+type HeadingPage struct {
+	Headings []Heading
+	// Total is the number of headings on all pages
+	Total int
+	// Updated is when the newest book with any of the headings was added
+	Updated time.Time
+}
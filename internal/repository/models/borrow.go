@@ -1,9 +1,44 @@
 package models
 
+import "time"
+
 type Borrow struct {
-	ID         int    `json:"id"`
-	UserID     int    `json:"user_id"`
-	BookID     int    `json:"book_id"`
-	BorrowedAt string `json:"borrowed_at"`
-	ReturnedAt string `json:"returned_at"`
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	BookID     int        `json:"book_id"`
+	BorrowedAt time.Time  `json:"borrowed_at"`
+	DueAt      *time.Time `json:"due_at,omitempty"`
+	ReturnedAt *time.Time `json:"returned_at,omitempty"`
+	// Renewals is the number of times the loan was renewed
+	Renewals int `json:"renewals"`
+	// LostAt is when the copy was reported lost, the loan was closed at the same time
+	LostAt *time.Time `json:"lost_at,omitempty"`
+	// FoundAt is when a lost copy was found again and put back into stock
+	FoundAt *time.Time `json:"found_at,omitempty"`
+	// Damaged is set when the copy was returned damaged and withdrawn
+	Damaged bool `json:"damaged,omitempty"`
+}
+
+// LoanRules are the circulation limits enforced when a book is borrowed or renewed
+type LoanRules struct {
+	// PeriodDays is the loan period of categories without their own
+	PeriodDays int
+	// MaxActive caps the open loans of every user, 0 means no cap beyond the category's
+	MaxActive int
+	// Categories holds the rules of each patron category
+	Categories map[string]CategoryRules
+	// ReplacementFee is charged in cents for a lost or damaged copy, 0 means no charge
+	ReplacementFee int
+}
+
+// Category returns the rules of a patron category with the loan period filled in
+func (r LoanRules) Category(category string) CategoryRules {
+	rules := r.Categories[category]
+	if rules.PeriodDays == 0 {
+		rules.PeriodDays = r.PeriodDays
+	}
+	if r.MaxActive > 0 && (rules.MaxActive == 0 || rules.MaxActive > r.MaxActive) {
+		rules.MaxActive = r.MaxActive
+	}
+	return rules
 }
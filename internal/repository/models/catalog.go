@@ -0,0 +1,17 @@
+package models
+
+// Catalog holds the bibliographic description of a book, as exchanged in MARC records
+type Catalog struct {
+	// ISBN is stored without hyphens, as 10 or 13 characters
+	//example: 9780261102217
+	ISBN string `json:"isbn,omitempty"`
+	//example: ["Tolkien, J. R. R."]
+	Authors []string `json:"authors,omitempty"`
+	//example: HarperCollins
+	Publisher string `json:"publisher,omitempty"`
+	// PublicationDate is kept as cataloged, e.g. 1999 or c1937
+	//example: 1999
+	PublicationDate string `json:"publication_date,omitempty"`
+	//example: ["Middle Earth (Imaginary place) -- Fiction"]
+	Subjects []string `json:"subjects,omitempty"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Reasons a patron is charged for a copy
+const (
+	ChargeLost    = "lost"
+	ChargeDamaged = "damaged"
+)
+
+// Codes of the errors returned when a loan cannot be reported lost or found
+const (
+	ErrorLoanClosed = "LOAN_CLOSED"
+	ErrorNotLost    = "NOT_LOST"
+)
+
+// Charge is a replacement fee charged to a patron for a lost or damaged copy
+//
+//swagger:model
+type Charge struct {
+	ID       int    `json:"id"`
+	UserID   int    `json:"user_id"`
+	BorrowID int    `json:"borrow_id"`
+	BookID   int    `json:"book_id"`
+	Reason   string `json:"reason"`
+	// Amount is in cents
+	//example: 2500
+	Amount    int        `json:"amount"`
+	CreatedAt time.Time  `json:"created_at"`
+	WaivedAt  *time.Time `json:"waived_at,omitempty"`
+}
+
+// LossResponse is a loan reported lost or found, with the charge it created or waived.
+// Charge is missing when no replacement fee is configured.
+type LossResponse struct {
+	Borrow Borrow  `json:"borrow"`
+	Charge *Charge `json:"charge,omitempty"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// BorrowedCountMismatch is a book whose borrowed_count differs from its open borrows
+//
+//swagger:model
+type BorrowedCountMismatch struct {
+	//example: 1
+	BookID int `json:"book_id"`
+	//example: The Great Gatsby
+	Title    string `json:"title"`
+	Quantity int    `json:"quantity"`
+	//example: 3
+	BorrowedCount int `json:"borrowed_count"`
+	//example: 2
+	OpenBorrows int `json:"open_borrows"`
+	// Repaired is set when borrowed_count was corrected to open_borrows
+	Repaired bool `json:"repaired"`
+	// Problem explains why a mismatch could not be repaired
+	Problem string `json:"problem,omitempty"`
+}
+
+// ConsistencyReport is the result of comparing the borrowed count of every book with its open borrows
+//
+//swagger:model
+type ConsistencyReport struct {
+	CheckedAt time.Time `json:"checked_at"`
+	// Books is the number of books checked
+	Books      int                     `json:"books"`
+	Mismatches []BorrowedCountMismatch `json:"mismatches"`
+}
+
+// Unrepaired returns the number of mismatches that are still present
+func (r ConsistencyReport) Unrepaired() int {
+	count := 0
+	for _, mismatch := range r.Mismatches {
+		if !mismatch.Repaired {
+			count++
+		}
+	}
+	return count
+}
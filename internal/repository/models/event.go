@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventBookBorrowed = "BookBorrowed"
+	EventBookReturned = "BookReturned"
+	EventBookRenewed  = "BookRenewed"
+	EventBookLost     = "BookLost"
+	EventBookFound    = "BookFound"
+	EventBookCreated  = "BookCreated"
+	EventBookUpdated  = "BookUpdated"
+	EventUserCreated  = "UserCreated"
+	EventUserUpdated  = "UserUpdated"
+)
+
+const (
+	AggregateBook    = "book"
+	AggregateUser    = "user"
+	AggregateBorrow  = "borrow"
+	AggregateWebhook = "webhook"
+)
+
+// Event is a domain event stored in the outbox and delivered to publishers at least once.
+// Consumers should use ID to ignore duplicates.
+type Event struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int             `json:"aggregate_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+	Attempts      int             `json:"-"`
+	// PublishedTo names the relay targets that already received the event
+	PublishedTo []string `json:"-"`
+}
+
+type BorrowEventData struct {
+	BorrowID   int        `json:"borrow_id"`
+	UserID     int        `json:"user_id"`
+	BookID     int        `json:"book_id"`
+	BorrowedAt time.Time  `json:"borrowed_at"`
+	DueAt      *time.Time `json:"due_at,omitempty"`
+	ReturnedAt *time.Time `json:"returned_at,omitempty"`
+	Renewals   int        `json:"renewals,omitempty"`
+	LostAt     *time.Time `json:"lost_at,omitempty"`
+	FoundAt    *time.Time `json:"found_at,omitempty"`
+	Damaged    bool       `json:"damaged,omitempty"`
+	// Charge is the replacement fee charged or waived with the event, in cents
+	Charge int `json:"charge,omitempty"`
+}
+
+type UserEventData struct {
+	UserID    int    `json:"user_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type BookEventData struct {
+	BookID        int    `json:"book_id"`
+	Title         string `json:"title"`
+	Quantity      int    `json:"quantity"`
+	BorrowedCount int    `json:"borrowed_count"`
+}
+
+// Borrow returns the borrow the event describes
+func (e BorrowEventData) Borrow() Borrow {
+	return Borrow{
+		ID:         e.BorrowID,
+		UserID:     e.UserID,
+		BookID:     e.BookID,
+		BorrowedAt: e.BorrowedAt,
+		DueAt:      e.DueAt,
+		ReturnedAt: e.ReturnedAt,
+		Renewals:   e.Renewals,
+		LostAt:     e.LostAt,
+		FoundAt:    e.FoundAt,
+		Damaged:    e.Damaged,
+	}
+}
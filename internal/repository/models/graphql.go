@@ -0,0 +1,11 @@
+package models
+
+// GraphQLRequest is the body of a GraphQL request
+//
+//swagger:model
+type GraphQLRequest struct {
+	//example: { user(id: 1) { firstName loans { dueAt book { title available } } } }
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
@@ -10,6 +10,9 @@ type HttpError struct {
 	Message string
 	//example: 400
 	StatusCode int
+	// Code identifies the circulation rule a request broke, e.g. LOAN_LIMIT_REACHED
+	//example: LOAN_LIMIT_REACHED
+	Code string `json:",omitempty"`
 }
 
 func NewHttpError(message string, statusCode int) HttpError {
@@ -19,6 +22,15 @@ func NewHttpError(message string, statusCode int) HttpError {
 	}
 }
 
+// NewHttpErrorWithCode returns an error with a code clients can match on
+func NewHttpErrorWithCode(code string, message string, statusCode int) HttpError {
+	return HttpError{
+		Message:    message,
+		StatusCode: statusCode,
+		Code:       code,
+	}
+}
+
 func NewHttpErrorFromError(message string, err error, statusCode int) HttpError {
 	return HttpError{
 		Message:    fmt.Sprintf("%s: %v", message, err),
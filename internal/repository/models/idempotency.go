@@ -0,0 +1,12 @@
+package models
+
+// IdempotencyRecord is a stored request fingerprint and, once the request has finished, its response
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	// Completed is false while the first request with the key is still being processed
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
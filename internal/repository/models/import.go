@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+const (
+	ImportBooks = "books"
+	ImportUsers = "users"
+)
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+	// ImportFormatMARC and ImportFormatMARCXML hold MARC 21 bibliographic records and only import books
+	ImportFormatMARC    = "marc"
+	ImportFormatMARCXML = "marcxml"
+)
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	// ImportFailed means nothing was imported because rows were invalid, or the import stopped on an error.
+	// A queued import keeps the batches it committed before it stopped, ProcessedRows counts their rows.
+	ImportFailed = "failed"
+)
+
+// ErrorImportTakenOver is returned for a batch of an import another worker claimed in the meantime,
+// the batch is rolled back and the other worker continues the import
+const ErrorImportTakenOver = "IMPORT_TAKEN_OVER"
+
+// Import is a bulk upload of books or users and its progress
+//
+//swagger:model
+type Import struct {
+	ID int64 `json:"id"`
+	//example: books
+	Kind string `json:"kind"`
+	//example: csv
+	Format string `json:"format"`
+	// DryRun imports validate every row without writing anything
+	DryRun bool `json:"dry_run"`
+	// Status is pending, running, completed or failed
+	Status    string `json:"status"`
+	TotalRows int    `json:"total_rows"`
+	// ProcessedRows is the number of rows imported so far
+	ProcessedRows int `json:"processed_rows"`
+	ErrorCount    int `json:"error_count"`
+	// Errors lists invalid rows, capped at the first 1000
+	Errors []ImportRowError `json:"errors,omitempty"`
+	// Error explains why a valid import stopped
+	Error string `json:"error,omitempty"`
+	Actor string `json:"actor"`
+	// ClaimedActor is the unverified X-Actor header of the upload
+	ClaimedActor string     `json:"claimed_actor,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	// RequestID and ClientIP attribute the imported rows in the audit log
+	RequestID string `json:"-"`
+	ClientIP  string `json:"-"`
+}
+
+// ImportRowError describes why a row was rejected.
+// Rows are the records after the CSV header, the lines of an NDJSON file or the MARC records, numbered from 1.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportActor returns the actor who uploaded the import, its rows are attributed to them
+func (i Import) ImportActor() Actor {
+	return Actor{Name: i.Actor, Claimed: i.ClaimedActor, RequestID: i.RequestID, ClientIP: i.ClientIP}
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobRun is a single execution of a background job
+//
+//swagger:model
+type JobRun struct {
+	ID      int64  `json:"id"`
+	JobName string `json:"job_name"`
+	// TriggeredBy is schedule or manual
+	TriggeredBy string `json:"triggered_by"`
+	// Status is queued, running, succeeded or failed
+	Status      string     `json:"status"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	DurationMs  *int64     `json:"duration_ms,omitempty"`
+	// Message summarizes what a successful run did
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Instance is the replica that executed the run
+	Instance string `json:"instance,omitempty"`
+}
+
+// JobStatus describes a registered background job
+//
+//swagger:model
+type JobStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	//example: 0 9 * * *
+	Schedule  string     `json:"schedule"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	LastRun   *JobRun    `json:"last_run,omitempty"`
+}
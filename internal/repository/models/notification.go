@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+const (
+	NotificationDueSoon = "due_soon"
+	NotificationOverdue = "overdue"
+)
+
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+const (
+	NotificationSent   = "sent"
+	NotificationFailed = "failed"
+)
+
+// Notification is a message sent, or attempted, to a patron
+//
+//swagger:model
+type Notification struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"user_id"`
+	BorrowID  *int      `json:"borrow_id,omitempty"`
+	Kind      string    `json:"kind"`
+	Channel   string    `json:"channel"`
+	Recipient string    `json:"recipient"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoanNotice is an open loan that is due soon or overdue, together with what is needed to notify the patron
+type LoanNotice struct {
+	BorrowID   int
+	User       User
+	BookID     int
+	BookTitle  string
+	BorrowedAt time.Time
+	DueAt      time.Time
+	// SkipChannels lists the channels this kind of notice was already delivered on, gave up on or waits to be retried on
+	SkipChannels []string
+}
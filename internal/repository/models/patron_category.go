@@ -0,0 +1,36 @@
+package models
+
+// Patron categories
+const (
+	CategoryChild         = "child"
+	CategoryAdult         = "adult"
+	CategoryStaff         = "staff"
+	CategoryInstitutional = "institutional"
+)
+
+// PatronCategories lists every patron category
+var PatronCategories = []string{CategoryChild, CategoryAdult, CategoryStaff, CategoryInstitutional}
+
+// Codes of the errors returned when a circulation rule is broken
+const (
+	ErrorLoanLimitReached    = "LOAN_LIMIT_REACHED"
+	ErrorReferenceOnly       = "REFERENCE_ONLY"
+	ErrorAgeRestricted       = "AGE_RESTRICTED"
+	ErrorRenewalLimitReached = "RENEWAL_LIMIT_REACHED"
+	ErrorMembershipExpired   = "MEMBERSHIP_EXPIRED"
+	ErrorCardReplaced        = "CARD_REPLACED"
+)
+
+// CategoryRules are the circulation rules of a patron category
+type CategoryRules struct {
+	// MaxActive is the maximum number of open loans, 0 means unlimited
+	MaxActive int
+	// PeriodDays is the number of days a book may be kept, also added by every renewal
+	PeriodDays int
+	// Renewals is the number of times a loan may be renewed
+	Renewals int
+	// Reference allows borrowing reference-only books
+	Reference bool
+	// MaxAgeRating is the highest age rating the category may borrow, 0 means any
+	MaxAgeRating int
+}
@@ -0,0 +1,34 @@
+package models
+
+// Reasons a book is recommended
+const (
+	// RecommendationCoBorrowed books were borrowed by patrons who also borrowed the book or the patron's books
+	RecommendationCoBorrowed = "co-borrowed"
+	// RecommendationPopular books fill up recommendations for patrons with little history
+	RecommendationPopular = "popular"
+)
+
+// Recommendation is a recommended book. Books with copies available to borrow are ranked first.
+//
+//swagger:model
+type Recommendation struct {
+	BookResponse
+	// Score is the cosine similarity of the books' borrowers, summed over the patron's books for personal recommendations
+	//example: 0.42
+	Score float64 `json:"score"`
+	// CoBorrowers is the number of patrons who borrowed both books, only for similar books
+	//example: 7
+	CoBorrowers int `json:"co_borrowers,omitempty"`
+	//example: co-borrowed
+	Reason string `json:"reason"`
+}
+
+// RecommendationRefresh describes one batch of borrows counted into the co-borrowing tables
+type RecommendationRefresh struct {
+	// Borrows is the number of first borrows of a book by a patron in the batch
+	Borrows int
+	// LastBorrowID is the last borrow counted so far
+	LastBorrowID int
+	// Done is set when no settled borrows are left to count
+	Done bool
+}
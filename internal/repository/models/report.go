@@ -0,0 +1,109 @@
+package models
+
+import "time"
+
+// Intervals of the borrows-over-time report
+const (
+	ReportDay   = "day"
+	ReportWeek  = "week"
+	ReportMonth = "month"
+)
+
+// ReportPeriod is the time range [From, To) a report covers, in UTC
+type ReportPeriod struct {
+	From time.Time
+	To   time.Time
+}
+
+// Days returns the length of the period in days
+func (p ReportPeriod) Days() float64 {
+	return p.To.Sub(p.From).Hours() / 24
+}
+
+// TopBook is a book with the number of times it was borrowed in the period
+//
+//swagger:model
+type TopBook struct {
+	//example: 1
+	BookID int `json:"book_id"`
+	//example: The Great Gatsby
+	Title string `json:"title"`
+	//example: 12
+	Borrows int `json:"borrows"`
+}
+
+// BorrowCount is the number of borrows in one day, week or month, weeks start on Monday
+//
+//swagger:model
+type BorrowCount struct {
+	//example: 2024-01-01T00:00:00Z
+	Start time.Time `json:"start"`
+	//example: 42
+	Borrows int `json:"borrows"`
+}
+
+// LoanDurationReport summarizes how long the loans returned in the period lasted
+//
+//swagger:model
+type LoanDurationReport struct {
+	//example: 120
+	Returned int `json:"returned"`
+	// ReturnedLate is the number of returns after the due date
+	//example: 9
+	ReturnedLate int `json:"returned_late"`
+	//example: 12.5
+	AverageDays float64 `json:"average_days"`
+	//example: 11
+	MedianDays float64 `json:"median_days"`
+	//example: 64
+	MaxDays float64 `json:"max_days"`
+}
+
+// BookUtilization is the share of a book's copies that were on loan during the period
+//
+//swagger:model
+type BookUtilization struct {
+	//example: 1
+	BookID int `json:"book_id"`
+	//example: The Great Gatsby
+	Title string `json:"title"`
+	//example: 4
+	Quantity int `json:"quantity"`
+	// BorrowedCount is the number of copies on loan now
+	//example: 3
+	BorrowedCount int `json:"borrowed_count"`
+	// LoanDays is the total time copies were on loan during the period
+	//example: 84.5
+	LoanDays float64 `json:"loan_days"`
+	// Utilization is LoanDays divided by the copy days of the period, between 0 and 1
+	//example: 0.7
+	Utilization float64 `json:"utilization"`
+}
+
+// ActivePatron is a user with the number of books they borrowed in the period.
+// Anonymized reports only have the rank.
+//
+//swagger:model
+type ActivePatron struct {
+	//example: 1
+	Rank int `json:"rank"`
+	//example: 7
+	UserID int `json:"user_id,omitempty"`
+	//example: Jane Doe
+	Name string `json:"name,omitempty"`
+	//example: 23
+	Borrows int `json:"borrows"`
+}
+
+// UnborrowedBook is a book that was never borrowed
+//
+//swagger:model
+type UnborrowedBook struct {
+	//example: 1
+	BookID int `json:"book_id"`
+	//example: The Great Gatsby
+	Title string `json:"title"`
+	//example: 2
+	Quantity int       `json:"quantity"`
+	AddedAt  time.Time `json:"added_at"`
+}
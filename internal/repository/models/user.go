@@ -10,6 +10,35 @@ type User struct {
 	FirstName string `json:"first_name"`
 	//example: Doe
 	LastName string `json:"last_name"`
+	// CardNumber is printed as a barcode on the library card, it is issued by the library and changes when the card is replaced
+	//example: 20000000000014
+	CardNumber string `json:"card_number,omitempty" readonly:"true"`
+	//example: john.doe@example.com
+	Email string `json:"email,omitempty"`
+	//example: +38640123456
+	Phone string `json:"phone,omitempty"`
+	// Locale selects the language of notifications
+	//example: en
+	Locale string `json:"locale,omitempty"`
+	// NotifyEmail opts in to due date reminders and overdue notices by email
+	NotifyEmail bool `json:"notify_email"`
+	// NotifySMS opts in to due date reminders and overdue notices by SMS
+	NotifySMS bool `json:"notify_sms"`
+	//example: 2010-05-31
+	DateOfBirth string `json:"date_of_birth,omitempty"`
+	//example: Slovenska cesta 1, 1000 Ljubljana
+	Address string `json:"address,omitempty"`
+	// MembershipStarts is the first day of the membership, the day the user is created by default
+	//example: 2024-01-01
+	MembershipStarts string `json:"membership_starts,omitempty"`
+	// MembershipExpires is the last day the user may borrow and renew, memberships without it do not expire
+	//example: 2024-12-31
+	MembershipExpires string `json:"membership_expires,omitempty"`
+	// Category selects the loan rules of the user, adult by default
+	//example: adult
+	Category string `json:"category,omitempty" enums:"child,adult,staff,institutional"`
+	// Version is sent as the ETag header
+	Version int `json:"-"`
 }
 
 type UserResponse struct {
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	// DeliveryDead marks a delivery that exhausted its attempts, it stays in the dead-letter list until redelivered
+	DeliveryDead = "dead"
+)
+
+// AllEventTypes subscribes a webhook to every event type
+const AllEventTypes = "*"
+
+// EventTypes lists the domain events a webhook can subscribe to
+var EventTypes = []string{EventBookBorrowed, EventBookReturned, EventBookRenewed, EventBookLost, EventBookFound, EventBookCreated, EventBookUpdated, EventUserCreated, EventUserUpdated}
+
+// WebhookSubscription represents a partner endpoint that receives events
+//
+//swagger:model
+type WebhookSubscription struct {
+	//example: 1
+	ID int `json:"id"`
+	//example: https://partner.example.com/hooks/library
+	URL string `json:"url"`
+	//example: ["BookBorrowed","BookReturned"]
+	EventTypes []string `json:"event_types"`
+	// Secret signs the deliveries, it is only returned when the subscription is created
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookSubscriptionRequest is the body of POST /webhooks, a secret is generated when none is given
+//
+//swagger:model
+type WebhookSubscriptionRequest struct {
+	//example: https://partner.example.com/hooks/library
+	URL string `json:"url"`
+	//example: ["BookBorrowed","BookReturned"]
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+}
+
+// WebhookDelivery is one attempt series of sending an event to a subscription
+//
+//swagger:model
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int             `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	// URL and Secret are filled in for the dispatcher only
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"strings"
+)
+
+var dbAudit *sql.DB
+
+func SetAuditDB(database *sql.DB) {
+	dbAudit = database
+}
+
+// insertAuditWithTx appends an audit entry as part of the caller's transaction,
+// so a change is never committed without its entry. before or after is nil when the target did not exist.
+func insertAuditWithTx(tx *sql.Tx, actor models.Actor, action string, targetType string, targetId int, before any, after any) error {
+	beforeJson, err := marshalSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJson, err := marshalSnapshot(after)
+	if err != nil {
+		return err
+	}
+	name := actor.Name
+	if name == "" {
+		name = models.AnonymousActor
+	}
+	_, err = tx.ExecContext(context.Background(), `
+		INSERT INTO audit_log (actor, claimed_actor, action, target_type, target_id, before_state, after_state, request_id, client_ip)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''))
+	`, name, actor.Claimed, action, targetType, targetId, beforeJson, afterJson, actor.RequestID, actor.ClientIP)
+	return err
+}
+
+func marshalSnapshot(snapshot any) ([]byte, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	return json.Marshal(snapshot)
+}
+
+// GetAuditEntries returns the entries matching the filter, newest first
+func GetAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, models.HttpError) {
+	var conditions []string
+	var args []any
+	where := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
+	if filter.Actor != "" {
+		where("actor = ?", filter.Actor)
+	}
+	if filter.ClaimedActor != "" {
+		where("claimed_actor = ?", filter.ClaimedActor)
+	}
+	if filter.Action != "" {
+		where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != 0 {
+		where("target_id = ?", filter.TargetID)
+	}
+	if filter.UserID != 0 {
+		where(`((target_type = 'user' AND target_id = ?::INT) OR (after_state->>'user_id')::INT = ?::INT OR (before_state->>'user_id')::INT = ?::INT)`, filter.UserID)
+	}
+	if filter.BookID != 0 {
+		where(`((target_type = 'book' AND target_id = ?::INT) OR (after_state->>'book_id')::INT = ?::INT OR (before_state->>'book_id')::INT = ?::INT)`, filter.BookID)
+	}
+	if filter.RequestID != "" {
+		where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		where("occurred_at >= ?", filter.From.UTC())
+	}
+	if filter.To != nil {
+		where("occurred_at < ?", filter.To.UTC())
+	}
+	if filter.BeforeID != 0 {
+		where("id < ?", filter.BeforeID)
+	}
+
+	query := `
+		SELECT id, occurred_at, actor, COALESCE(claimed_actor, ''), action, target_type, target_id, before_state, after_state,
+		       COALESCE(request_id, ''), COALESCE(client_ip, '')
+		  FROM audit_log`
+	if len(conditions) > 0 {
+		query += "\n WHERE " + strings.Join(conditions, "\n   AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf("\nORDER BY id DESC\nLIMIT $%d", len(args))
+
+	rows, err := dbAudit.Query(query, args...)
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query audit log", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&entry.ID, &entry.OccurredAt, &entry.Actor, &entry.ClaimedActor, &entry.Action, &entry.TargetType, &entry.TargetID,
+			&before, &after, &entry.RequestID, &entry.ClientIP); err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan audit entry", err, http.StatusInternalServerError)
+		}
+		entry.Before = before
+		entry.After = after
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over audit log", err, http.StatusInternalServerError)
+	}
+	return entries, models.NewEmptyHttpError()
+}
@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"encoding/json"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+)
+
+// AvailabilityChannel is the PostgreSQL notification channel that carries book availability between replicas
+const AvailabilityChannel = "book_availability"
+
+// NotifyBookAvailability sends the availability of a book to every connection listening on AvailabilityChannel
+func NotifyBookAvailability(availability models.BookAvailability) models.HttpError {
+	payload, err := json.Marshal(availability)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to encode availability", err, http.StatusInternalServerError)
+	}
+	if _, err := dbBook.Exec(`SELECT pg_notify($1, $2)`, AvailabilityChannel, string(payload)); err != nil {
+		return models.NewHttpErrorFromError("failed to notify availability", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
@@ -0,0 +1,268 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"time"
+)
+
+var dbBackup *sql.DB
+
+func SetBackupDB(database *sql.DB) {
+	dbBackup = database
+}
+
+// ExportBackup reads all users, books, borrows, charges and revoked cards from a single snapshot, so they always refer to exported rows
+func ExportBackup() (models.Backup, models.HttpError) {
+	var backup models.Backup
+	ctx := context.Background()
+	tx, err := dbBackup.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return backup, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	err = queryEach(ctx, tx, `SELECT `+userColumns+` FROM users ORDER BY id`, func(row rowScanner) error {
+		user, err := scanUser(row)
+		backup.Users = append(backup.Users, user)
+		return err
+	})
+	if err != nil {
+		return backup, models.NewHttpErrorFromError("failed to export users", err, http.StatusInternalServerError)
+	}
+	err = queryEach(ctx, tx, `SELECT `+bookColumns+`, created_at FROM books ORDER BY id`, func(row rowScanner) error {
+		var createdAt time.Time
+		book, err := scanBook(scannerFunc(func(dest ...any) error {
+			return row.Scan(append(dest, &createdAt)...)
+		}))
+		backup.Books = append(backup.Books, models.BackupBook{Book: book, CreatedAt: &createdAt})
+		return err
+	})
+	if err != nil {
+		return backup, models.NewHttpErrorFromError("failed to export books", err, http.StatusInternalServerError)
+	}
+	err = queryEach(ctx, tx, `SELECT `+borrowColumns+` FROM borrow ORDER BY id`, func(row rowScanner) error {
+		borrow, err := scanBorrow(row)
+		backup.Borrows = append(backup.Borrows, borrow)
+		return err
+	})
+	if err != nil {
+		return backup, models.NewHttpErrorFromError("failed to export borrows", err, http.StatusInternalServerError)
+	}
+	err = queryEach(ctx, tx, `SELECT `+chargeColumns+` FROM charges c JOIN borrow b ON b.id = c.borrow_id ORDER BY c.id`, func(row rowScanner) error {
+		charge, err := scanCharge(row)
+		backup.Charges = append(backup.Charges, charge)
+		return err
+	})
+	if err != nil {
+		return backup, models.NewHttpErrorFromError("failed to export charges", err, http.StatusInternalServerError)
+	}
+	err = queryEach(ctx, tx, `SELECT card_number, user_id, revoked_at FROM revoked_cards ORDER BY revoked_at, card_number`, func(row rowScanner) error {
+		var card models.RevokedCard
+		err := row.Scan(&card.CardNumber, &card.UserID, &card.RevokedAt)
+		backup.RevokedCards = append(backup.RevokedCards, card)
+		return err
+	})
+	if err != nil {
+		return backup, models.NewHttpErrorFromError("failed to export revoked cards", err, http.StatusInternalServerError)
+	}
+	return backup, models.NewEmptyHttpError()
+}
+
+func queryEach(ctx context.Context, tx *sql.Tx, query string, scan func(row rowScanner) error) error {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// RestoreBackup writes the users, books, borrows, charges and revoked cards of a backup with their original IDs in a single transaction
+// and moves the ID sequences past them. The tables must be empty unless replace is set, in which case their rows
+// are deleted first together with the notifications and recommendations that refer to them.
+func RestoreBackup(backup models.Backup, replace bool, actor models.Actor) models.HttpError {
+	ctx := context.Background()
+	tx, err := dbBackup.BeginTx(ctx, nil)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	var existing int
+	err = tx.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM users) + (SELECT COUNT(*) FROM books) + (SELECT COUNT(*) FROM borrow)
+	`).Scan(&existing)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to count existing rows", err, http.StatusInternalServerError)
+	}
+	if replace {
+		if _, err := tx.ExecContext(ctx, `TRUNCATE borrow, books, users, recommendation_state RESTART IDENTITY CASCADE`); err != nil {
+			_ = tx.Rollback()
+			return models.NewHttpErrorFromError("failed to clear tables", err, http.StatusInternalServerError)
+		}
+	} else if existing > 0 {
+		_ = tx.Rollback()
+		return models.NewHttpError(fmt.Sprintf("the database already has %d users, books or borrows, restore into an empty database or replace them", existing), http.StatusConflict)
+	}
+
+	if err := restoreRows(ctx, tx, backup); err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to restore rows", err, http.StatusInternalServerError)
+	}
+	for _, table := range []string{"users", "books", "borrow", "charges"} {
+		_, err := tx.ExecContext(ctx, `SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM `+table, table)
+		if err != nil {
+			_ = tx.Rollback()
+			return models.NewHttpErrorFromError(fmt.Sprintf("failed to reset the %s ID sequence", table), err, http.StatusInternalServerError)
+		}
+	}
+	// restored cards keep their numbers, so new ones continue after the highest restored serial, revoked ones included
+	_, err = tx.ExecContext(ctx, `
+		SELECT setval('library_card_seq', GREATEST(MAX(SUBSTR(card_number, 2, 12)::BIGINT), (SELECT last_value FROM library_card_seq)))
+		  FROM (SELECT card_number FROM users UNION ALL SELECT card_number FROM revoked_cards) cards
+		 WHERE card_number ~ '^2[0-9]{13}$'
+		HAVING COUNT(*) > 0
+	`)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to reset the card number sequence", err, http.StatusInternalServerError)
+	}
+
+	// the restored rows themselves are not audited one by one, the entry names the bundle and what it replaced
+	restore := models.BackupRestore{Manifest: backup.Manifest, Replace: replace, ReplacedRows: existing}
+	if err := insertAuditWithTx(tx, actor, models.AuditBackupRestore, models.AuditTargetBackup, 0, nil, restore); err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+func restoreRows(ctx context.Context, tx *sql.Tx, backup models.Backup) error {
+	stmtUser, err := tx.PrepareContext(ctx, `
+		INSERT INTO users (id, first_name, last_name, email, phone, locale, notify_email, notify_sms, category,
+		                   card_number, date_of_birth, address, membership_starts, membership_expires)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, COALESCE(NULLIF($9, ''), 'adult'),
+		        COALESCE(NULLIF($10, ''), LIBRARY_CARD_NUMBER()), NULLIF($11, '')::DATE, NULLIF($12, ''),
+		        COALESCE(NULLIF($13, '')::DATE, CURRENT_DATE), NULLIF($14, '')::DATE)
+	`)
+	if err != nil {
+		return err
+	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			return
+		}
+	}(stmtUser)
+	for _, user := range backup.Users {
+		_, err := stmtUser.ExecContext(ctx, user.ID, user.FirstName, user.LastName, user.Email, user.Phone, user.Locale, user.NotifyEmail, user.NotifySMS, user.Category,
+			user.CardNumber, user.DateOfBirth, user.Address, user.MembershipStarts, user.MembershipExpires)
+		if err != nil {
+			return fmt.Errorf("user %d: %w", user.ID, err)
+		}
+	}
+
+	stmtBook, err := tx.PrepareContext(ctx, `
+		INSERT INTO books (id, title, quantity, borrowed_count, isbn, authors, publisher, publication_date, subjects, reference_only, age_rating, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11, COALESCE($12, NOW()))
+	`)
+	if err != nil {
+		return err
+	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			return
+		}
+	}(stmtBook)
+	for _, book := range backup.Books {
+		_, err := stmtBook.ExecContext(ctx, book.ID, book.Title, book.Quantity, book.BorrowedCount,
+			book.ISBN, pq.Array(nonNil(book.Authors)), book.Publisher, book.PublicationDate, pq.Array(nonNil(book.Subjects)),
+			book.ReferenceOnly, book.AgeRating, book.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("book %d: %w", book.ID, err)
+		}
+	}
+
+	stmtBorrow, err := tx.PrepareContext(ctx, `
+		INSERT INTO borrow (id, user_id, book_id, borrowed_at, due_at, returned_at, renewals, lost_at, found_at, damaged)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`)
+	if err != nil {
+		return err
+	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			return
+		}
+	}(stmtBorrow)
+	for _, borrow := range backup.Borrows {
+		_, err := stmtBorrow.ExecContext(ctx, borrow.ID, borrow.UserID, borrow.BookID, borrow.BorrowedAt, borrow.DueAt, borrow.ReturnedAt, borrow.Renewals,
+			borrow.LostAt, borrow.FoundAt, borrow.Damaged)
+		if err != nil {
+			return fmt.Errorf("borrow %d: %w", borrow.ID, err)
+		}
+	}
+
+	stmtCharge, err := tx.PrepareContext(ctx, `
+		INSERT INTO charges (id, user_id, borrow_id, reason, amount, created_at, waived_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`)
+	if err != nil {
+		return err
+	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			return
+		}
+	}(stmtCharge)
+	for _, charge := range backup.Charges {
+		_, err := stmtCharge.ExecContext(ctx, charge.ID, charge.UserID, charge.BorrowID, charge.Reason, charge.Amount, charge.CreatedAt, charge.WaivedAt)
+		if err != nil {
+			return fmt.Errorf("charge %d: %w", charge.ID, err)
+		}
+	}
+
+	stmtRevokedCard, err := tx.PrepareContext(ctx, `
+		INSERT INTO revoked_cards (card_number, user_id, revoked_at)
+		VALUES ($1, $2, $3)
+	`)
+	if err != nil {
+		return err
+	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			return
+		}
+	}(stmtRevokedCard)
+	for _, card := range backup.RevokedCards {
+		_, err := stmtRevokedCard.ExecContext(ctx, card.CardNumber, card.UserID, card.RevokedAt)
+		if err != nil {
+			return fmt.Errorf("revoked card %s: %w", card.CardNumber, err)
+		}
+	}
+	return nil
+}
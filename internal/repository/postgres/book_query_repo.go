@@ -0,0 +1,306 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"strings"
+)
+
+// headingColumns maps heading kinds to the array column they are read from
+var headingColumns = map[string]string{
+	models.HeadingAuthor:  "AUTHORS",
+	models.HeadingSubject: "SUBJECTS",
+}
+
+// likeEscaper escapes the LIKE wildcards in search words
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchBooks returns a page of the books matching the query, newest first
+func SearchBooks(query models.BookQuery) (models.BookPage, models.HttpError) {
+	var page models.BookPage
+	var conditions []string
+	var args []any
+	where := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
+	if query.Author != "" {
+		where("AUTHORS @> ARRAY[?::TEXT]", query.Author)
+	}
+	if query.Subject != "" {
+		where("SUBJECTS @> ARRAY[?::TEXT]", query.Subject)
+	}
+	if words := strings.Fields(query.Search); len(words) > 0 {
+		var matches []string
+		for _, word := range words {
+			args = append(args, "%"+likeEscaper.Replace(word)+"%")
+			matches = append(matches, fmt.Sprintf(`(TITLE ILIKE $%[1]d OR ARRAY_TO_STRING(AUTHORS, ' ') ILIKE $%[1]d OR ARRAY_TO_STRING(SUBJECTS, ' ') ILIKE $%[1]d)`, len(args)))
+		}
+		search := "(" + strings.Join(matches, " AND ")
+		args = append(args, strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(query.Search)))
+		search += fmt.Sprintf(" OR ISBN = $%d)", len(args))
+		conditions = append(conditions, search)
+	}
+	if query.Condition != nil {
+		bind := func(value any) string {
+			args = append(args, value)
+			return fmt.Sprintf("$%d", len(args))
+		}
+		condition, err := conditionSQL(*query.Condition, bind)
+		if err != nil {
+			return page, models.NewHttpError(err.Error(), http.StatusBadRequest)
+		}
+		conditions = append(conditions, condition)
+	}
+	filter := ""
+	if len(conditions) > 0 {
+		filter = "\n WHERE " + strings.Join(conditions, "\n   AND ")
+	}
+
+	var updated sql.NullTime
+	err := dbBook.QueryRow(`SELECT COUNT(*), MAX(CREATED_AT) FROM books`+filter, args...).Scan(&page.Total, &updated)
+	if err != nil {
+		return page, models.NewHttpErrorFromError("failed to count books", err, http.StatusInternalServerError)
+	}
+	page.Updated = updated.Time
+	if page.Total == 0 || query.Offset >= page.Total {
+		return page, models.NewEmptyHttpError()
+	}
+
+	args = append(args, query.Limit, query.Offset)
+	rows, err := dbBook.Query(`SELECT `+bookColumns+`, CREATED_AT FROM books`+filter+
+		fmt.Sprintf("\nORDER BY CREATED_AT DESC, ID DESC\nLIMIT $%d OFFSET $%d", len(args)-1, len(args)), args...)
+	if err != nil {
+		return page, models.NewHttpErrorFromError("failed to query books", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	for rows.Next() {
+		var listed models.ListedBook
+		book, err := scanBook(scannerFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &listed.AddedAt)...)
+		}))
+		if err != nil {
+			return page, models.NewHttpErrorFromError("failed to scan book", err, http.StatusInternalServerError)
+		}
+		listed.BookResponse = models.NewBookResponseFromBook(book)
+		page.Books = append(page.Books, listed)
+	}
+	if err = rows.Err(); err != nil {
+		return page, models.NewHttpErrorFromError("failed to iterate over books", err, http.StatusInternalServerError)
+	}
+	return page, models.NewEmptyHttpError()
+}
+
+// GetHeadings returns a page of the authors or subjects of all books in alphabetical order
+func GetHeadings(kind string, limit int, offset int) (models.HeadingPage, models.HttpError) {
+	var page models.HeadingPage
+	column, ok := headingColumns[kind]
+	if !ok {
+		return page, models.NewHttpError(fmt.Sprintf("unknown heading kind %q", kind), http.StatusBadRequest)
+	}
+	from := fmt.Sprintf(`FROM books, UNNEST(%s) AS heading(name)`, column)
+
+	var updated sql.NullTime
+	err := dbBook.QueryRow(`SELECT COUNT(DISTINCT heading.name), MAX(CREATED_AT) `+from).Scan(&page.Total, &updated)
+	if err != nil {
+		return page, models.NewHttpErrorFromError("failed to count headings", err, http.StatusInternalServerError)
+	}
+	page.Updated = updated.Time
+	if page.Total == 0 || offset >= page.Total {
+		return page, models.NewEmptyHttpError()
+	}
+
+	rows, err := dbBook.Query(`SELECT heading.name, COUNT(*) `+from+`
+		GROUP BY heading.name
+		ORDER BY heading.name
+		LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return page, models.NewHttpErrorFromError("failed to query headings", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	for rows.Next() {
+		var heading models.Heading
+		if err := rows.Scan(&heading.Name, &heading.Books); err != nil {
+			return page, models.NewHttpErrorFromError("failed to scan heading", err, http.StatusInternalServerError)
+		}
+		page.Headings = append(page.Headings, heading)
+	}
+	if err = rows.Err(); err != nil {
+		return page, models.NewHttpErrorFromError("failed to iterate over headings", err, http.StatusInternalServerError)
+	}
+	return page, models.NewEmptyHttpError()
+}
+
+// conditionSQL compiles a condition to a WHERE clause, bind adds a query argument and returns its placeholder
+func conditionSQL(condition models.BookCondition, bind func(any) string) (string, error) {
+	if condition.Operator != "" {
+		if len(condition.Operands) != 2 {
+			return "", fmt.Errorf("%s needs two operands", condition.Operator)
+		}
+		left, err := conditionSQL(condition.Operands[0], bind)
+		if err != nil {
+			return "", err
+		}
+		right, err := conditionSQL(condition.Operands[1], bind)
+		if err != nil {
+			return "", err
+		}
+		switch condition.Operator {
+		case models.ConditionAnd:
+			return "(" + left + " AND " + right + ")", nil
+		case models.ConditionOr:
+			return "(" + left + " OR " + right + ")", nil
+		case models.ConditionNot:
+			return "(" + left + " AND NOT " + right + ")", nil
+		default:
+			return "", fmt.Errorf("unknown operator %q", condition.Operator)
+		}
+	}
+
+	switch condition.Field {
+	case models.BookFieldAll:
+		return "TRUE", nil
+	case models.BookFieldAny:
+		if words := strings.Fields(condition.Value); len(words) > 1 && (condition.Match == models.MatchAllWords || condition.Match == models.MatchAnyWord) {
+			// every word may match a different field
+			var matches []string
+			for _, word := range words {
+				clause, err := conditionSQL(models.BookCondition{Field: models.BookFieldAny, Match: models.MatchPhrase, Value: word}, bind)
+				if err != nil {
+					return "", err
+				}
+				matches = append(matches, clause)
+			}
+			if condition.Match == models.MatchAnyWord {
+				return "(" + strings.Join(matches, " OR ") + ")", nil
+			}
+			return "(" + strings.Join(matches, " AND ") + ")", nil
+		}
+		var fields []string
+		for _, field := range []string{models.BookFieldTitle, models.BookFieldAuthor, models.BookFieldSubject, models.BookFieldISBN} {
+			leaf := condition
+			leaf.Field = field
+			clause, err := conditionSQL(leaf, bind)
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, clause)
+		}
+		return "(" + strings.Join(fields, " OR ") + ")", nil
+	case models.BookFieldISBN:
+		return isbnSQL(condition, bind)
+	}
+
+	column, heading := map[string]string{
+		models.BookFieldTitle:   "TITLE",
+		models.BookFieldAuthor:  "AUTHORS",
+		models.BookFieldSubject: "SUBJECTS",
+	}[condition.Field], condition.Field != models.BookFieldTitle
+	if column == "" {
+		return "", fmt.Errorf("unknown field %q", condition.Field)
+	}
+	text := column
+	if heading {
+		// the separator keeps phrases from matching across two headings
+		text = "ARRAY_TO_STRING(" + column + ", ' | ')"
+	}
+
+	switch condition.Match {
+	case models.MatchExact:
+		pattern, literal, masked := likePattern(condition.Value)
+		switch {
+		case !heading:
+			return column + " LIKE " + bind(pattern), nil
+		case !masked:
+			return column + " @> ARRAY[" + bind(literal) + "::TEXT]", nil
+		default:
+			return "EXISTS (SELECT 1 FROM UNNEST(" + column + ") AS heading(name) WHERE heading.name LIKE " + bind(pattern) + ")", nil
+		}
+	case models.MatchPhrase:
+		pattern, _, _ := likePattern(strings.Join(strings.Fields(condition.Value), " "))
+		return text + " ILIKE " + bind("%"+pattern+"%"), nil
+	case models.MatchAllWords, models.MatchAnyWord:
+		var words []string
+		for _, word := range strings.Fields(condition.Value) {
+			pattern, _, _ := likePattern(word)
+			words = append(words, text+" ILIKE "+bind("%"+pattern+"%"))
+		}
+		if len(words) == 0 {
+			return "", errors.New("the search term is empty")
+		}
+		if condition.Match == models.MatchAnyWord {
+			return "(" + strings.Join(words, " OR ") + ")", nil
+		}
+		return "(" + strings.Join(words, " AND ") + ")", nil
+	default:
+		return "", fmt.Errorf("unknown match %q", condition.Match)
+	}
+}
+
+// isbnSQL matches ISBNs as stored, without hyphens or spaces. Every word of the value is a separate ISBN
+// except for phrase and exact matches.
+func isbnSQL(condition models.BookCondition, bind func(any) string) (string, error) {
+	values := strings.Fields(condition.Value)
+	if condition.Match == models.MatchPhrase || condition.Match == models.MatchExact {
+		values = []string{condition.Value}
+	}
+	var isbns []string
+	for _, value := range values {
+		pattern, literal, masked := likePattern(strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(value)))
+		if masked {
+			isbns = append(isbns, "COALESCE(ISBN, '') LIKE "+bind(pattern))
+		} else {
+			isbns = append(isbns, "COALESCE(ISBN, '') = "+bind(literal))
+		}
+	}
+	if len(isbns) == 0 {
+		return "", errors.New("the search term is empty")
+	}
+	if condition.Match == models.MatchAllWords {
+		return "(" + strings.Join(isbns, " AND ") + ")", nil
+	}
+	return "(" + strings.Join(isbns, " OR ") + ")", nil
+}
+
+// likePattern converts a masked value to a LIKE pattern. It also returns the value without escapes
+// and whether it has masking characters.
+func likePattern(value string) (string, string, bool) {
+	var pattern, literal strings.Builder
+	masked := false
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			escaped = false
+			pattern.WriteString(likeEscaper.Replace(string(r)))
+			literal.WriteRune(r)
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			masked = true
+			pattern.WriteByte('%')
+		case r == '?':
+			masked = true
+			pattern.WriteByte('_')
+		default:
+			pattern.WriteString(likeEscaper.Replace(string(r)))
+			literal.WriteRune(r)
+		}
+	}
+	return pattern.String(), literal.String(), masked
+}
@@ -5,18 +5,36 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/spin311/library-api/internal/repository/models"
 	"net/http"
+	"time"
 )
 
 var dbBook *sql.DB
+var loanRules = models.LoanRules{PeriodDays: 21}
+
+// bookColumns is the column list read by scanBook
+const bookColumns = `ID, TITLE, QUANTITY, BORROWED_COUNT, VERSION, COALESCE(ISBN, ''), AUTHORS, COALESCE(PUBLISHER, ''), COALESCE(PUBLICATION_DATE, ''), SUBJECTS, REFERENCE_ONLY, AGE_RATING`
 
 func SetBookDB(database *sql.DB) {
 	dbBook = database
 }
 
+func SetLoanRules(rules models.LoanRules) {
+	loanRules = rules
+}
+
+func scanBook(row rowScanner) (models.Book, error) {
+	var book models.Book
+	err := row.Scan(&book.ID, &book.Title, &book.Quantity, &book.BorrowedCount, &book.Version,
+		&book.ISBN, pq.Array(&book.Authors), &book.Publisher, &book.PublicationDate, pq.Array(&book.Subjects),
+		&book.ReferenceOnly, &book.AgeRating)
+	return book, err
+}
+
 func GetBooks() ([]models.BookResponse, models.HttpError) {
-	stmt, err := dbBook.Prepare(`SELECT ID, TITLE, QUANTITY, BORROWED_COUNT FROM books`)
+	stmt, err := dbBook.Prepare(`SELECT ` + bookColumns + ` FROM books`)
 	if err != nil {
 		return nil, models.NewHttpErrorFromError("failed to prepare statement", err, http.StatusInternalServerError)
 	}
@@ -40,13 +58,11 @@ func GetBooks() ([]models.BookResponse, models.HttpError) {
 
 	var books []models.BookResponse
 	for rows.Next() {
-		var book models.BookResponse
-		var quantity, borrowedCount int
-		if err := rows.Scan(&book.ID, &book.Title, &quantity, &borrowedCount); err != nil {
+		book, err := scanBook(rows)
+		if err != nil {
 			return nil, models.NewHttpErrorFromError("failed to scan row", err, http.StatusInternalServerError)
 		}
-		book.AvailableCount = quantity - borrowedCount
-		books = append(books, book)
+		books = append(books, models.NewBookResponseFromBook(book))
 	}
 
 	if err = rows.Err(); err != nil {
@@ -56,9 +72,36 @@ func GetBooks() ([]models.BookResponse, models.HttpError) {
 	return books, models.NewEmptyHttpError()
 }
 
+// GetBooksByIds returns the books with the given IDs in no particular order, unknown IDs are skipped
+func GetBooksByIds(ids []int) ([]models.Book, models.HttpError) {
+	rows, err := dbBook.Query(`SELECT `+bookColumns+` FROM books WHERE id = ANY($1)`, pq.Array(int64s(ids)))
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query books", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var books []models.Book
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan book", err, http.StatusInternalServerError)
+		}
+		books = append(books, book)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over books", err, http.StatusInternalServerError)
+	}
+	return books, models.NewEmptyHttpError()
+}
+
 func GetBook(bookId int) (models.Book, models.HttpError) {
 	var book models.Book
-	stmt, err := dbBook.Prepare(`SELECT ID, TITLE, QUANTITY, BORROWED_COUNT FROM books WHERE id = $1`)
+	stmt, err := dbBook.Prepare(`SELECT ` + bookColumns + ` FROM books WHERE id = $1`)
 	if err != nil {
 		return book, models.NewHttpErrorFromError("failed to prepare statement", err, http.StatusInternalServerError)
 	}
@@ -69,7 +112,8 @@ func GetBook(bookId int) (models.Book, models.HttpError) {
 		}
 	}(stmt)
 
-	if err := stmt.QueryRow(bookId).Scan(&book.ID, &book.Title, &book.Quantity, &book.BorrowedCount); err != nil {
+	book, err = scanBook(stmt.QueryRow(bookId))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return book, models.NewHttpError(fmt.Sprintf("book with ID %d not found", bookId), http.StatusNotFound)
 		}
@@ -80,19 +124,19 @@ func GetBook(bookId int) (models.Book, models.HttpError) {
 }
 
 // BorrowBook updates the borrowed count for the book and creates a new borrow record
-func BorrowBook(userId int, bookId int) models.HttpError {
+func BorrowBook(userId int, bookId int, actor models.Actor) (models.Borrow, models.HttpError) {
 	// Begin transaction to ensure atomicity
 	ctx := context.Background()
 	tx, err := dbBook.BeginTx(ctx, nil)
 	if err != nil {
-		return models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
 	}
 
 	// Lock the row for the book to prevent race conditions
-	stmtLock, err := tx.PrepareContext(ctx, `SELECT quantity, borrowed_count FROM books WHERE id = $1 FOR UPDATE`)
+	stmtLock, err := tx.PrepareContext(ctx, `SELECT quantity, borrowed_count, reference_only, age_rating FROM books WHERE id = $1 FOR UPDATE`)
 	if err != nil {
 		_ = tx.Rollback()
-		return models.NewHttpErrorFromError("failed to prepare lock statement", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to prepare lock statement", err, http.StatusInternalServerError)
 	}
 	defer func(stmtLock *sql.Stmt) {
 		err := stmtLock.Close()
@@ -102,25 +146,36 @@ func BorrowBook(userId int, bookId int) models.HttpError {
 	}(stmtLock)
 
 	var quantity, borrowedCount int
-	err = stmtLock.QueryRow(bookId).Scan(&quantity, &borrowedCount)
+	var restrictions models.Restrictions
+	err = stmtLock.QueryRow(bookId).Scan(&quantity, &borrowedCount, &restrictions.ReferenceOnly, &restrictions.AgeRating)
 	if err != nil {
 		_ = tx.Rollback()
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.NewHttpError(fmt.Sprintf("book with ID %d not found", bookId), http.StatusNotFound)
+			return models.Borrow{}, models.NewHttpError(fmt.Sprintf("book with ID %d not found", bookId), http.StatusNotFound)
 		}
-		return models.NewHttpErrorFromError("failed to scan book row", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to scan book row", err, http.StatusInternalServerError)
+	}
+
+	rules, ruleErr := checkCategoryRulesWithTx(tx, userId, bookId, restrictions)
+	if !models.IsHttpErrorEmpty(ruleErr) {
+		_ = tx.Rollback()
+		return models.Borrow{}, ruleErr
 	}
 
 	availableBooks := quantity - borrowedCount
 	if availableBooks <= 0 {
 		_ = tx.Rollback()
-		return models.NewHttpError(fmt.Sprintf("no available copies of the book with ID %d", bookId), http.StatusConflict)
+		return models.Borrow{}, models.NewHttpError(fmt.Sprintf("no available copies of the book with ID %d", bookId), http.StatusConflict)
 	}
 
-	stmtBorrow, err := tx.PrepareContext(ctx, `INSERT INTO borrow (user_id, book_id) VALUES ($1, $2)`)
+	stmtBorrow, err := tx.PrepareContext(ctx, `
+		INSERT INTO borrow (user_id, book_id, due_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(days => $3))
+		RETURNING id, borrowed_at, due_at
+	`)
 	if err != nil {
 		_ = tx.Rollback()
-		return models.NewHttpErrorFromError("failed to prepare borrow statement", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to prepare borrow statement", err, http.StatusInternalServerError)
 	}
 	defer func(stmtBorrow *sql.Stmt) {
 		err := stmtBorrow.Close()
@@ -129,27 +184,93 @@ func BorrowBook(userId int, bookId int) models.HttpError {
 		}
 	}(stmtBorrow)
 
-	_, err = stmtBorrow.Exec(userId, bookId)
+	event := models.BorrowEventData{UserID: userId, BookID: bookId}
+	var dueAt time.Time
+	err = stmtBorrow.QueryRow(userId, bookId, rules.PeriodDays).Scan(&event.BorrowID, &event.BorrowedAt, &dueAt)
 	if err != nil {
 		_ = tx.Rollback()
-		return models.NewHttpErrorFromError("failed to execute borrow statement", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to execute borrow statement", err, http.StatusInternalServerError)
 	}
+	event.DueAt = &dueAt
 
-	updateErr := updateBookCountWithTx(tx, bookId, borrowedCount+1)
+	updateErr := updateBookCountWithTx(tx, bookId, 1, 0)
 	if updateErr != nil {
 		_ = tx.Rollback()
-		return models.NewHttpErrorFromError("failed to update book count", updateErr, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to update book count", updateErr, http.StatusInternalServerError)
+	}
+
+	if err := insertEventWithTx(tx, models.EventBookBorrowed, models.AggregateBorrow, event.BorrowID, event); err != nil {
+		_ = tx.Rollback()
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to record event", err, http.StatusInternalServerError)
+	}
+	if err := insertAuditWithTx(tx, actor, models.AuditBookBorrow, models.AggregateBorrow, event.BorrowID, nil, event); err != nil {
+		_ = tx.Rollback()
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+
+	return event.Borrow(), models.NewEmptyHttpError()
+}
+
+// lockPatronWithTx locks the user row so concurrent loans of the same user are checked one after another,
+// checks that the membership has not expired and returns the rules of the user's category
+func lockPatronWithTx(tx *sql.Tx, userId int) (models.CategoryRules, string, models.HttpError) {
+	var category string
+	var expires sql.NullTime
+	var expired bool
+	err := tx.QueryRowContext(context.Background(), `
+		SELECT category, membership_expires, COALESCE(membership_expires < CURRENT_DATE, FALSE) FROM users WHERE id = $1 FOR UPDATE
+	`, userId).Scan(&category, &expires, &expired)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.CategoryRules{}, category, models.NewHttpError(fmt.Sprintf("user with ID %d not found", userId), http.StatusNotFound)
+		}
+		return models.CategoryRules{}, category, models.NewHttpErrorFromError("failed to lock user row", err, http.StatusInternalServerError)
+	}
+	if expired {
+		return models.CategoryRules{}, category, models.NewHttpErrorWithCode(models.ErrorMembershipExpired,
+			fmt.Sprintf("the membership of user with ID %d expired on %s", userId, expires.Time.Format(time.DateOnly)), http.StatusForbidden)
+	}
+	return loanRules.Category(category), category, models.NewEmptyHttpError()
+}
+
+// checkCategoryRulesWithTx checks that the user's category may borrow the book and has not reached its loan limit
+func checkCategoryRulesWithTx(tx *sql.Tx, userId int, bookId int, restrictions models.Restrictions) (models.CategoryRules, models.HttpError) {
+	rules, category, httpErr := lockPatronWithTx(tx, userId)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		return rules, httpErr
+	}
+	if restrictions.ReferenceOnly && !rules.Reference {
+		return rules, models.NewHttpErrorWithCode(models.ErrorReferenceOnly,
+			fmt.Sprintf("book with ID %d is reference-only and cannot be borrowed by %s patrons", bookId, category), http.StatusForbidden)
+	}
+	if rules.MaxAgeRating > 0 && restrictions.AgeRating > rules.MaxAgeRating {
+		return rules, models.NewHttpErrorWithCode(models.ErrorAgeRestricted,
+			fmt.Sprintf("book with ID %d is rated %d+ and %s patrons may borrow books rated up to %d+", bookId, restrictions.AgeRating, category, rules.MaxAgeRating), http.StatusForbidden)
+	}
+	if rules.MaxActive == 0 {
+		return rules, models.NewEmptyHttpError()
 	}
 
-	return models.NewEmptyHttpError()
+	var activeLoans int
+	err := tx.QueryRowContext(context.Background(), `SELECT COUNT(*) FROM borrow WHERE user_id = $1 AND returned_at IS NULL`, userId).Scan(&activeLoans)
+	if err != nil {
+		return rules, models.NewHttpErrorFromError("failed to count active loans", err, http.StatusInternalServerError)
+	}
+	if activeLoans >= rules.MaxActive {
+		return rules, models.NewHttpErrorWithCode(models.ErrorLoanLimitReached,
+			fmt.Sprintf("user with ID %d has reached the limit of %d borrowed books", userId, rules.MaxActive), http.StatusConflict)
+	}
+	return rules, models.NewEmptyHttpError()
 }
 
-func updateBookCountWithTx(tx *sql.Tx, bookId int, newCount int) error {
-	stmtUpdate, err := tx.PrepareContext(context.Background(), `UPDATE books SET borrowed_count = $1 WHERE id = $2`)
+// updateBookCountWithTx adds change to the borrowed count and takes the withdrawn copies off the quantity.
+// The caller must hold the lock on the book row.
+func updateBookCountWithTx(tx *sql.Tx, bookId int, change int, withdrawn int) error {
+	stmtUpdate, err := tx.PrepareContext(context.Background(), `UPDATE books SET borrowed_count = borrowed_count + $1, quantity = quantity - $3 WHERE id = $2`)
 	if err != nil {
 		return err
 	}
@@ -160,20 +281,36 @@ func updateBookCountWithTx(tx *sql.Tx, bookId int, newCount int) error {
 		}
 	}(stmtUpdate)
 
-	_, execErr := stmtUpdate.Exec(newCount, bookId)
+	_, execErr := stmtUpdate.Exec(change, bookId, withdrawn)
 	if execErr != nil {
 		return execErr
 	}
 	return nil
 }
 
-// ReturnBook updates the borrowed count for the book and sets the return date for the borrow record
-func ReturnBook(userId int, bookId int, newCount int) models.HttpError {
+// ReturnBook updates the borrowed count for the book and sets the return date for the borrow record.
+// The book is locked first, like in BorrowBook, so concurrent loans of the same title wait for each other.
+// A copy returned damaged is withdrawn from the book's quantity and the replacement fee is charged.
+func ReturnBook(userId int, bookId int, damaged bool, actor models.Actor) (models.Borrow, models.HttpError) {
 	// Begin transaction to ensure atomicity
 	ctx := context.Background()
 	tx, err := dbBook.BeginTx(ctx, nil)
 	if err != nil {
-		return models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	var borrowedCount int
+	err = tx.QueryRowContext(ctx, `SELECT borrowed_count FROM books WHERE id = $1 FOR UPDATE`, bookId).Scan(&borrowedCount)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Borrow{}, models.NewHttpError(fmt.Sprintf("book with ID %d not found", bookId), http.StatusNotFound)
+		}
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to lock book row", err, http.StatusInternalServerError)
+	}
+	if borrowedCount == 0 {
+		_ = tx.Rollback()
+		return models.Borrow{}, models.NewHttpError(fmt.Sprintf("no borrowed copies exist for the book with ID %d", bookId), http.StatusBadRequest)
 	}
 
 	// update return date for the borrowed book
@@ -188,12 +325,14 @@ func ReturnBook(userId int, bookId int, newCount int) models.HttpError {
 			LIMIT 1
 		)
 		UPDATE borrow
-			   SET returned_at = CURRENT_TIMESTAMP
+			   SET returned_at = CURRENT_TIMESTAMP,
+			       damaged = $3
 		 WHERE id IN (SELECT id FROM borrowed)
+		RETURNING id, borrowed_at, due_at, returned_at, renewals
 	`)
 	if err != nil {
 		_ = tx.Rollback()
-		return models.NewHttpErrorFromError("failed to prepare statement", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to prepare statement", err, http.StatusInternalServerError)
 	}
 	defer func(stmtReturn *sql.Stmt) {
 		err := stmtReturn.Close()
@@ -202,31 +341,183 @@ func ReturnBook(userId int, bookId int, newCount int) models.HttpError {
 		}
 	}(stmtReturn)
 
-	result, err := stmtReturn.Exec(bookId, userId)
+	event := models.BorrowEventData{UserID: userId, BookID: bookId, Damaged: damaged}
+	var dueAt sql.NullTime
+	var returnedAt time.Time
+	err = stmtReturn.QueryRow(bookId, userId, damaged).Scan(&event.BorrowID, &event.BorrowedAt, &dueAt, &returnedAt, &event.Renewals)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Borrow{}, models.NewHttpError(fmt.Sprintf("no borrowed books found for user ID %d and book ID %d", userId, bookId), http.StatusBadRequest)
+		}
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to execute statement", err, http.StatusInternalServerError)
+	}
+	if dueAt.Valid {
+		event.DueAt = &dueAt.Time
+	}
+	event.ReturnedAt = &returnedAt
+
+	withdrawn := 0
+	if damaged {
+		withdrawn = 1
+	}
+	err = updateBookCountWithTx(tx, bookId, -1, withdrawn)
 	if err != nil {
 		_ = tx.Rollback()
-		return models.NewHttpErrorFromError("failed to execute statement", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to update book count", err, http.StatusInternalServerError)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if damaged {
+		charge, err := insertChargeWithTx(tx, event, models.ChargeDamaged)
+		if err != nil {
+			_ = tx.Rollback()
+			return models.Borrow{}, models.NewHttpErrorFromError("failed to charge the replacement fee", err, http.StatusInternalServerError)
+		}
+		if charge != nil {
+			event.Charge = charge.Amount
+		}
+	}
+
+	if err := insertEventWithTx(tx, models.EventBookReturned, models.AggregateBorrow, event.BorrowID, event); err != nil {
+		_ = tx.Rollback()
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to record event", err, http.StatusInternalServerError)
+	}
+	before := event
+	before.ReturnedAt = nil
+	before.Damaged = false
+	before.Charge = 0
+	if err := insertAuditWithTx(tx, actor, models.AuditBookReturn, models.AggregateBorrow, event.BorrowID, before, event); err != nil {
+		_ = tx.Rollback()
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+
+	return event.Borrow(), models.NewEmptyHttpError()
+}
+
+// RenewBook extends the user's oldest open loan of the book by the loan period of the user's category,
+// counted from the due date or from now when the loan is overdue
+func RenewBook(userId int, bookId int, actor models.Actor) (models.Borrow, models.HttpError) {
+	ctx := context.Background()
+	tx, err := dbBook.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	rules, category, httpErr := lockPatronWithTx(tx, userId)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		_ = tx.Rollback()
+		return models.Borrow{}, httpErr
+	}
+
+	before := models.BorrowEventData{UserID: userId, BookID: bookId}
+	var dueAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, borrowed_at, due_at, renewals
+		  FROM borrow
+		 WHERE book_id = $1 AND user_id = $2 AND returned_at IS NULL
+		 ORDER BY borrowed_at
+		 LIMIT 1
+		   FOR UPDATE
+	`, bookId, userId).Scan(&before.BorrowID, &before.BorrowedAt, &dueAt, &before.Renewals)
 	if err != nil {
 		_ = tx.Rollback()
-		return models.NewHttpErrorFromError("failed to get rows affected", err, http.StatusInternalServerError)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Borrow{}, models.NewHttpError(fmt.Sprintf("no borrowed books found for user ID %d and book ID %d", userId, bookId), http.StatusBadRequest)
+		}
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to lock borrow row", err, http.StatusInternalServerError)
+	}
+	if dueAt.Valid {
+		before.DueAt = &dueAt.Time
 	}
-	if rowsAffected == 0 {
+	if before.Renewals >= rules.Renewals {
 		_ = tx.Rollback()
-		return models.NewHttpError(fmt.Sprintf("no borrowed books found for user ID %d and book ID %d", userId, bookId), http.StatusBadRequest)
+		return models.Borrow{}, models.NewHttpErrorWithCode(models.ErrorRenewalLimitReached,
+			fmt.Sprintf("the loan of book with ID %d was renewed %d times, the limit for %s patrons", bookId, before.Renewals, category), http.StatusConflict)
 	}
 
-	err = updateBookCountWithTx(tx, bookId, newCount)
+	event := before
+	var renewedDueAt time.Time
+	err = tx.QueryRowContext(ctx, `
+		UPDATE borrow
+		   SET due_at = GREATEST(COALESCE(due_at, CURRENT_TIMESTAMP), CURRENT_TIMESTAMP) + make_interval(days => $2),
+		       renewals = renewals + 1
+		 WHERE id = $1
+		RETURNING due_at, renewals
+	`, before.BorrowID, rules.PeriodDays).Scan(&renewedDueAt, &event.Renewals)
 	if err != nil {
 		_ = tx.Rollback()
-		return models.NewHttpErrorFromError("failed to update book count", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to renew borrow", err, http.StatusInternalServerError)
+	}
+	event.DueAt = &renewedDueAt
+
+	if err := insertEventWithTx(tx, models.EventBookRenewed, models.AggregateBorrow, event.BorrowID, event); err != nil {
+		_ = tx.Rollback()
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to record event", err, http.StatusInternalServerError)
+	}
+	if err := insertAuditWithTx(tx, actor, models.AuditBookRenew, models.AggregateBorrow, event.BorrowID, before, event); err != nil {
+		_ = tx.Rollback()
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+		return models.Borrow{}, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return event.Borrow(), models.NewEmptyHttpError()
+}
+
+// UpdateBook changes the title, quantity and restrictions of a book if it is still at book.Version
+func UpdateBook(book models.Book, actor models.Actor) (models.Book, models.HttpError) {
+	ctx := context.Background()
+	tx, err := dbBook.BeginTx(ctx, nil)
+	if err != nil {
+		return book, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	before, err := scanBook(tx.QueryRowContext(ctx, `SELECT `+bookColumns+` FROM books WHERE id = $1 FOR UPDATE`, book.ID))
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return book, models.NewHttpError(fmt.Sprintf("book with ID %d not found", book.ID), http.StatusNotFound)
+		}
+		return book, models.NewHttpErrorFromError("failed to scan book row", err, http.StatusInternalServerError)
 	}
+	if before.Version != book.Version {
+		_ = tx.Rollback()
+		return book, models.NewHttpError(fmt.Sprintf("book with ID %d was modified, current version is %d", book.ID, before.Version), http.StatusPreconditionFailed)
+	}
+	if book.Quantity < before.BorrowedCount {
+		_ = tx.Rollback()
+		return book, models.NewHttpError(fmt.Sprintf("quantity cannot be lower than the %d borrowed copies", before.BorrowedCount), http.StatusConflict)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE books
+		   SET title = $1, quantity = $2, reference_only = $4, age_rating = $5
+		 WHERE id = $3
+		RETURNING borrowed_count, version
+	`, book.Title, book.Quantity, book.ID, book.ReferenceOnly, book.AgeRating).Scan(&book.BorrowedCount, &book.Version)
+	if err != nil {
+		_ = tx.Rollback()
+		return book, models.NewHttpErrorFromError("failed to update book", err, http.StatusInternalServerError)
+	}
+	book.Catalog = before.Catalog
 
-	return models.NewEmptyHttpError()
+	event := models.BookEventData{BookID: book.ID, Title: book.Title, Quantity: book.Quantity, BorrowedCount: book.BorrowedCount}
+	if err := insertEventWithTx(tx, models.EventBookUpdated, models.AggregateBook, book.ID, event); err != nil {
+		_ = tx.Rollback()
+		return book, models.NewHttpErrorFromError("failed to record event", err, http.StatusInternalServerError)
+	}
+	if err := insertAuditWithTx(tx, actor, models.AuditBookUpdate, models.AggregateBook, book.ID, before, book); err != nil {
+		_ = tx.Rollback()
+		return book, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return book, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return book, models.NewEmptyHttpError()
 }
@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"time"
+)
+
+// borrowColumns is the column list read by scanBorrow
+const borrowColumns = `id, user_id, book_id, borrowed_at, due_at, returned_at, renewals, lost_at, found_at, damaged`
+
+var dbBorrow *sql.DB
+
+func SetBorrowDB(database *sql.DB) {
+	dbBorrow = database
+}
+
+func scanBorrow(row rowScanner) (models.Borrow, error) {
+	var borrow models.Borrow
+	var dueAt, returnedAt, lostAt, foundAt sql.NullTime
+	if err := row.Scan(&borrow.ID, &borrow.UserID, &borrow.BookID, &borrow.BorrowedAt, &dueAt, &returnedAt, &borrow.Renewals,
+		&lostAt, &foundAt, &borrow.Damaged); err != nil {
+		return borrow, err
+	}
+	if dueAt.Valid {
+		borrow.DueAt = &dueAt.Time
+	}
+	if returnedAt.Valid {
+		borrow.ReturnedAt = &returnedAt.Time
+	}
+	if lostAt.Valid {
+		borrow.LostAt = &lostAt.Time
+	}
+	if foundAt.Valid {
+		borrow.FoundAt = &foundAt.Time
+	}
+	return borrow, nil
+}
+
+// GetOpenBorrows returns the borrows of the given users that are not returned yet, oldest first
+func GetOpenBorrows(userIds []int) ([]models.Borrow, models.HttpError) {
+	rows, err := dbBorrow.Query(`
+		SELECT `+borrowColumns+`
+		  FROM borrow
+		 WHERE user_id = ANY($1) AND returned_at IS NULL
+		 ORDER BY borrowed_at, id
+	`, pq.Array(int64s(userIds)))
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query borrows", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var borrows []models.Borrow
+	for rows.Next() {
+		borrow, err := scanBorrow(rows)
+		if err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan borrow", err, http.StatusInternalServerError)
+		}
+		borrows = append(borrows, borrow)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over borrows", err, http.StatusInternalServerError)
+	}
+	return borrows, models.NewEmptyHttpError()
+}
+
+// MarkBorrowLost closes an open loan whose copy the patron lost, withdraws the copy from the book's quantity
+// and charges the replacement fee
+func MarkBorrowLost(borrowId int, actor models.Actor) (models.LossResponse, models.HttpError) {
+	ctx := context.Background()
+	tx, err := dbBorrow.BeginTx(ctx, nil)
+	if err != nil {
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	before, httpErr := lockBorrowWithTx(tx, borrowId)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		_ = tx.Rollback()
+		return models.LossResponse{}, httpErr
+	}
+	if before.ReturnedAt != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorWithCode(models.ErrorLoanClosed,
+			fmt.Sprintf("the loan with ID %d is already closed", borrowId), http.StatusConflict)
+	}
+
+	event := before
+	var lostAt time.Time
+	err = tx.QueryRowContext(ctx, `
+		UPDATE borrow
+		   SET returned_at = CURRENT_TIMESTAMP,
+		       lost_at = CURRENT_TIMESTAMP
+		 WHERE id = $1
+		RETURNING lost_at
+	`, borrowId).Scan(&lostAt)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to close borrow", err, http.StatusInternalServerError)
+	}
+	event.ReturnedAt = &lostAt
+	event.LostAt = &lostAt
+
+	_, err = tx.ExecContext(ctx, `UPDATE books SET quantity = quantity - 1, borrowed_count = borrowed_count - 1 WHERE id = $1`, event.BookID)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to withdraw the lost copy", err, http.StatusInternalServerError)
+	}
+
+	charge, err := insertChargeWithTx(tx, event, models.ChargeLost)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to charge the replacement fee", err, http.StatusInternalServerError)
+	}
+	if charge != nil {
+		event.Charge = charge.Amount
+	}
+
+	if err := insertEventWithTx(tx, models.EventBookLost, models.AggregateBorrow, event.BorrowID, event); err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to record event", err, http.StatusInternalServerError)
+	}
+	if err := insertAuditWithTx(tx, actor, models.AuditBookLost, models.AggregateBorrow, event.BorrowID, before, event); err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return models.LossResponse{Borrow: event.Borrow(), Charge: charge}, models.NewEmptyHttpError()
+}
+
+// MarkBorrowFound puts the copy of a loan reported lost back into the book's quantity and waives the lost charge
+func MarkBorrowFound(borrowId int, actor models.Actor) (models.LossResponse, models.HttpError) {
+	ctx := context.Background()
+	tx, err := dbBorrow.BeginTx(ctx, nil)
+	if err != nil {
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	before, httpErr := lockBorrowWithTx(tx, borrowId)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		_ = tx.Rollback()
+		return models.LossResponse{}, httpErr
+	}
+	if before.LostAt == nil || before.FoundAt != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorWithCode(models.ErrorNotLost,
+			fmt.Sprintf("the copy of the loan with ID %d is not lost", borrowId), http.StatusConflict)
+	}
+
+	event := before
+	var foundAt time.Time
+	err = tx.QueryRowContext(ctx, `UPDATE borrow SET found_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING found_at`, borrowId).Scan(&foundAt)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to update borrow", err, http.StatusInternalServerError)
+	}
+	event.FoundAt = &foundAt
+
+	_, err = tx.ExecContext(ctx, `UPDATE books SET quantity = quantity + 1 WHERE id = $1`, event.BookID)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to restock the found copy", err, http.StatusInternalServerError)
+	}
+
+	charge, err := waiveChargeWithTx(tx, borrowId, models.ChargeLost)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to waive the replacement fee", err, http.StatusInternalServerError)
+	}
+	if charge != nil {
+		event.Charge = charge.Amount
+	}
+
+	if err := insertEventWithTx(tx, models.EventBookFound, models.AggregateBorrow, event.BorrowID, event); err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to record event", err, http.StatusInternalServerError)
+	}
+	if err := insertAuditWithTx(tx, actor, models.AuditBookFound, models.AggregateBorrow, event.BorrowID, before, event); err != nil {
+		_ = tx.Rollback()
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.LossResponse{}, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return models.LossResponse{Borrow: event.Borrow(), Charge: charge}, models.NewEmptyHttpError()
+}
+
+// lockBorrowWithTx locks the book of a borrow and then the borrow row, in the order BorrowBook and ReturnBook
+// lock them, and returns the borrow as event data
+func lockBorrowWithTx(tx *sql.Tx, borrowId int) (models.BorrowEventData, models.HttpError) {
+	ctx := context.Background()
+	_, err := tx.ExecContext(ctx, `SELECT 1 FROM books WHERE id = (SELECT book_id FROM borrow WHERE id = $1) FOR UPDATE`, borrowId)
+	if err != nil {
+		return models.BorrowEventData{}, models.NewHttpErrorFromError("failed to lock book row", err, http.StatusInternalServerError)
+	}
+	borrow, err := scanBorrow(tx.QueryRowContext(ctx, `SELECT `+borrowColumns+` FROM borrow WHERE id = $1 FOR UPDATE`, borrowId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.BorrowEventData{}, models.NewHttpError(fmt.Sprintf("borrow with ID %d not found", borrowId), http.StatusNotFound)
+		}
+		return models.BorrowEventData{}, models.NewHttpErrorFromError("failed to lock borrow row", err, http.StatusInternalServerError)
+	}
+	return models.BorrowEventData{
+		BorrowID:   borrow.ID,
+		UserID:     borrow.UserID,
+		BookID:     borrow.BookID,
+		BorrowedAt: borrow.BorrowedAt,
+		DueAt:      borrow.DueAt,
+		ReturnedAt: borrow.ReturnedAt,
+		Renewals:   borrow.Renewals,
+		LostAt:     borrow.LostAt,
+		FoundAt:    borrow.FoundAt,
+		Damaged:    borrow.Damaged,
+	}, models.NewEmptyHttpError()
+}
+
+// int64s converts IDs for pq.Array, which has no encoder for []int
+func int64s(ids []int) []int64 {
+	values := make([]int64, len(ids))
+	for i, id := range ids {
+		values[i] = int64(id)
+	}
+	return values
+}
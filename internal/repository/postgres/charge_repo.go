@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+)
+
+// chargeColumns is the column list read by scanCharge, c is the charges table and b the borrow table
+const chargeColumns = `c.id, c.user_id, c.borrow_id, b.book_id, c.reason, c.amount, c.created_at, c.waived_at`
+
+var dbCharge *sql.DB
+
+func SetChargeDB(database *sql.DB) {
+	dbCharge = database
+}
+
+func scanCharge(row rowScanner) (models.Charge, error) {
+	var charge models.Charge
+	var waivedAt sql.NullTime
+	if err := row.Scan(&charge.ID, &charge.UserID, &charge.BorrowID, &charge.BookID, &charge.Reason, &charge.Amount, &charge.CreatedAt, &waivedAt); err != nil {
+		return charge, err
+	}
+	if waivedAt.Valid {
+		charge.WaivedAt = &waivedAt.Time
+	}
+	return charge, nil
+}
+
+// GetCharges returns the charges of a user, newest first
+func GetCharges(userId int) ([]models.Charge, models.HttpError) {
+	rows, err := dbCharge.Query(`
+		SELECT `+chargeColumns+`
+		  FROM charges c
+		  JOIN borrow b ON b.id = c.borrow_id
+		 WHERE c.user_id = $1
+		 ORDER BY c.created_at DESC, c.id DESC
+	`, userId)
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query charges", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var charges []models.Charge
+	for rows.Next() {
+		charge, err := scanCharge(rows)
+		if err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan charge", err, http.StatusInternalServerError)
+		}
+		charges = append(charges, charge)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over charges", err, http.StatusInternalServerError)
+	}
+	return charges, models.NewEmptyHttpError()
+}
+
+// insertChargeWithTx charges the replacement fee for the copy of a borrow,
+// nil is returned without a charge when no fee is configured
+func insertChargeWithTx(tx *sql.Tx, borrow models.BorrowEventData, reason string) (*models.Charge, error) {
+	if loanRules.ReplacementFee <= 0 {
+		return nil, nil
+	}
+	charge := models.Charge{UserID: borrow.UserID, BorrowID: borrow.BorrowID, BookID: borrow.BookID, Reason: reason, Amount: loanRules.ReplacementFee}
+	err := tx.QueryRowContext(context.Background(), `
+		INSERT INTO charges (user_id, borrow_id, reason, amount)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, charge.UserID, charge.BorrowID, charge.Reason, charge.Amount).Scan(&charge.ID, &charge.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &charge, nil
+}
+
+// waiveChargeWithTx waives the open charge of a borrow for the given reason, nil is returned when there is none
+func waiveChargeWithTx(tx *sql.Tx, borrowId int, reason string) (*models.Charge, error) {
+	charge, err := scanCharge(tx.QueryRowContext(context.Background(), `
+		UPDATE charges c
+		   SET waived_at = NOW()
+		  FROM borrow b
+		 WHERE b.id = c.borrow_id AND c.borrow_id = $1 AND c.reason = $2 AND c.waived_at IS NULL
+		RETURNING `+chargeColumns, borrowId, reason))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &charge, nil
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"time"
+)
+
+var dbConsistency *sql.DB
+
+func SetConsistencyDB(database *sql.DB) {
+	dbConsistency = database
+}
+
+// CheckBorrowedCounts compares the borrowed count of every book with its open borrows.
+// With repair set the mismatched books are locked, counted again and corrected in a single transaction,
+// a book with more open borrows than copies is reported but left unchanged.
+func CheckBorrowedCounts(repair bool, actor models.Actor) (models.ConsistencyReport, models.HttpError) {
+	report := models.ConsistencyReport{CheckedAt: time.Now()}
+	ctx := context.Background()
+	options := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	if repair {
+		options = nil
+	}
+	tx, err := dbConsistency.BeginTx(ctx, options)
+	if err != nil {
+		return report, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM books`).Scan(&report.Books); err != nil {
+		_ = tx.Rollback()
+		return report, models.NewHttpErrorFromError("failed to count books", err, http.StatusInternalServerError)
+	}
+	report.Mismatches, err = borrowedCountMismatches(ctx, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return report, models.NewHttpErrorFromError("failed to compare borrowed counts", err, http.StatusInternalServerError)
+	}
+	if !repair {
+		_ = tx.Rollback()
+		return report, models.NewEmptyHttpError()
+	}
+
+	repaired := report.Mismatches[:0]
+	for _, mismatch := range report.Mismatches {
+		mismatch, err := repairBorrowedCount(ctx, tx, mismatch, actor)
+		if err != nil {
+			_ = tx.Rollback()
+			return report, models.NewHttpErrorFromError("failed to repair borrowed count", err, http.StatusInternalServerError)
+		}
+		// a concurrent borrow or return may have settled the mismatch since it was found
+		if mismatch.BorrowedCount != mismatch.OpenBorrows {
+			repaired = append(repaired, mismatch)
+		}
+	}
+	report.Mismatches = repaired
+
+	if err := tx.Commit(); err != nil {
+		return report, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return report, models.NewEmptyHttpError()
+}
+
+func borrowedCountMismatches(ctx context.Context, tx *sql.Tx) ([]models.BorrowedCountMismatch, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT b.id, b.title, b.quantity, b.borrowed_count, COALESCE(o.open_borrows, 0)
+		  FROM books b
+		  LEFT JOIN (SELECT book_id, COUNT(*) AS open_borrows
+		               FROM borrow
+		              WHERE returned_at IS NULL
+		              GROUP BY book_id) o ON o.book_id = b.id
+		 WHERE b.borrowed_count <> COALESCE(o.open_borrows, 0)
+		 ORDER BY b.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	mismatches := []models.BorrowedCountMismatch{}
+	for rows.Next() {
+		var mismatch models.BorrowedCountMismatch
+		if err := rows.Scan(&mismatch.BookID, &mismatch.Title, &mismatch.Quantity, &mismatch.BorrowedCount, &mismatch.OpenBorrows); err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	return mismatches, rows.Err()
+}
+
+// repairBorrowedCount sets the borrowed count of the book to its open borrows, counted again after locking the book
+// so that borrows and returns running at the same time are either included or fail on the changed version
+func repairBorrowedCount(ctx context.Context, tx *sql.Tx, mismatch models.BorrowedCountMismatch, actor models.Actor) (models.BorrowedCountMismatch, error) {
+	before, err := scanBook(tx.QueryRowContext(ctx, `SELECT `+bookColumns+` FROM books WHERE id = $1 FOR UPDATE`, mismatch.BookID))
+	if err != nil {
+		return mismatch, err
+	}
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM borrow WHERE book_id = $1 AND returned_at IS NULL`, mismatch.BookID).Scan(&mismatch.OpenBorrows)
+	if err != nil {
+		return mismatch, err
+	}
+	mismatch.Title = before.Title
+	mismatch.Quantity = before.Quantity
+	mismatch.BorrowedCount = before.BorrowedCount
+	if mismatch.BorrowedCount == mismatch.OpenBorrows {
+		return mismatch, nil
+	}
+	if mismatch.OpenBorrows > mismatch.Quantity {
+		mismatch.Problem = "the book has more open borrows than copies, raise its quantity and repair again"
+		return mismatch, nil
+	}
+
+	after := before
+	err = tx.QueryRowContext(ctx, `
+		UPDATE books
+		   SET borrowed_count = $2
+		 WHERE id = $1
+		RETURNING borrowed_count, version
+	`, mismatch.BookID, mismatch.OpenBorrows).Scan(&after.BorrowedCount, &after.Version)
+	if err != nil {
+		return mismatch, err
+	}
+	event := models.BookEventData{BookID: after.ID, Title: after.Title, Quantity: after.Quantity, BorrowedCount: after.BorrowedCount}
+	if err := insertEventWithTx(tx, models.EventBookUpdated, models.AggregateBook, after.ID, event); err != nil {
+		return mismatch, err
+	}
+	if err := insertAuditWithTx(tx, actor, models.AuditBookRepair, models.AggregateBook, after.ID, before, after); err != nil {
+		return mismatch, err
+	}
+	mismatch.Repaired = true
+	return mismatch, nil
+}
@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"time"
+)
+
+var dbIdempotency *sql.DB
+
+func SetIdempotencyDB(database *sql.DB) {
+	dbIdempotency = database
+}
+
+// ReserveIdempotencyKey claims the key for a new request on behalf of owner, which holds it for the lease
+// and must renew it while the request runs. If the key is already taken and not expired,
+// the existing record is returned with reserved set to false.
+// A request that never finished is only taken over once its lease ran out, i.e. its instance stopped renewing it.
+func ReserveIdempotencyKey(key string, fingerprint string, owner string, ttl time.Duration, lease time.Duration) (models.IdempotencyRecord, bool, models.HttpError) {
+	record := models.IdempotencyRecord{Key: key}
+	var reservedKey string
+	err := dbIdempotency.QueryRow(`
+		INSERT INTO idempotency_keys (idempotency_key, fingerprint, expires_at, owner, lease_expires_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3), $4, CURRENT_TIMESTAMP + make_interval(secs => $5))
+		ON CONFLICT (idempotency_key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint,
+			    status_code = NULL,
+			    content_type = NULL,
+			    response_body = NULL,
+			    created_at = CURRENT_TIMESTAMP,
+			    expires_at = EXCLUDED.expires_at,
+			    owner = EXCLUDED.owner,
+			    lease_expires_at = EXCLUDED.lease_expires_at
+		  WHERE idempotency_keys.expires_at < CURRENT_TIMESTAMP
+		     OR (idempotency_keys.status_code IS NULL AND idempotency_keys.lease_expires_at < CURRENT_TIMESTAMP)
+		RETURNING idempotency_key
+	`, key, fingerprint, ttl.Seconds(), owner, lease.Seconds()).Scan(&reservedKey)
+	if err == nil {
+		record.Fingerprint = fingerprint
+		return record, true, models.NewEmptyHttpError()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return record, false, models.NewHttpErrorFromError("failed to reserve idempotency key", err, http.StatusInternalServerError)
+	}
+
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+	err = dbIdempotency.QueryRow(`
+		SELECT fingerprint, status_code, content_type, response_body
+		  FROM idempotency_keys
+		 WHERE idempotency_key = $1
+	`, key).Scan(&record.Fingerprint, &statusCode, &contentType, &record.Body)
+	if err != nil {
+		return record, false, models.NewHttpErrorFromError("failed to read idempotency key", err, http.StatusInternalServerError)
+	}
+	record.Completed = statusCode.Valid
+	record.StatusCode = int(statusCode.Int64)
+	record.ContentType = contentType.String
+	return record, false, models.NewEmptyHttpError()
+}
+
+// RenewIdempotencyKey extends the lease of an unfinished reservation held by owner
+func RenewIdempotencyKey(key string, owner string, lease time.Duration) models.HttpError {
+	_, err := dbIdempotency.Exec(`
+		UPDATE idempotency_keys
+		   SET lease_expires_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+		 WHERE idempotency_key = $1 AND owner = $2 AND status_code IS NULL
+	`, key, owner, lease.Seconds())
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to renew idempotency key", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// SaveIdempotentResponse stores the response of a key reserved by owner so retries can replay it
+func SaveIdempotentResponse(record models.IdempotencyRecord, owner string) models.HttpError {
+	_, err := dbIdempotency.Exec(`
+		UPDATE idempotency_keys
+		   SET status_code = $2, content_type = $3, response_body = $4, lease_expires_at = NULL
+		 WHERE idempotency_key = $1 AND owner = $5 AND status_code IS NULL
+	`, record.Key, record.StatusCode, record.ContentType, record.Body, owner)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to save idempotent response", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// ReleaseIdempotencyKey removes a reservation held by owner so the request can be retried,
+// used when it failed with a server error
+func ReleaseIdempotencyKey(key string, owner string) models.HttpError {
+	_, err := dbIdempotency.Exec(`DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND owner = $2 AND status_code IS NULL`, key, owner)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to release idempotency key", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+func DeleteExpiredIdempotencyKeys() (int64, models.HttpError) {
+	result, err := dbIdempotency.Exec(`DELETE FROM idempotency_keys WHERE expires_at < CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, models.NewHttpErrorFromError("failed to delete expired idempotency keys", err, http.StatusInternalServerError)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, models.NewHttpErrorFromError("failed to get rows affected", err, http.StatusInternalServerError)
+	}
+	return deleted, models.NewEmptyHttpError()
+}
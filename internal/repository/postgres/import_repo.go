@@ -0,0 +1,221 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"time"
+)
+
+const importColumns = `id, kind, format, dry_run, status, total_rows, processed_rows, error_count, errors, COALESCE(error, ''),
+       actor, COALESCE(claimed_actor, ''), COALESCE(request_id, ''), COALESCE(client_ip, ''), created_at, updated_at, finished_at`
+
+var dbImport *sql.DB
+
+func SetImportDB(database *sql.DB) {
+	dbImport = database
+}
+
+func scanImport(row rowScanner) (models.Import, error) {
+	var imp models.Import
+	var rowErrors []byte
+	var finishedAt sql.NullTime
+	err := row.Scan(&imp.ID, &imp.Kind, &imp.Format, &imp.DryRun, &imp.Status, &imp.TotalRows, &imp.ProcessedRows, &imp.ErrorCount,
+		&rowErrors, &imp.Error, &imp.Actor, &imp.ClaimedActor, &imp.RequestID, &imp.ClientIP, &imp.CreatedAt, &imp.UpdatedAt, &finishedAt)
+	if err != nil {
+		return imp, err
+	}
+	if finishedAt.Valid {
+		imp.FinishedAt = &finishedAt.Time
+	}
+	if rowErrors != nil {
+		err = json.Unmarshal(rowErrors, &imp.Errors)
+	}
+	return imp, err
+}
+
+// InsertImport records a new import. payload is only stored for imports that still have to run.
+func InsertImport(imp models.Import, payload []byte) (models.Import, models.HttpError) {
+	rowErrors, err := marshalRowErrors(imp.Errors)
+	if err != nil {
+		return imp, models.NewHttpErrorFromError("failed to encode import errors", err, http.StatusInternalServerError)
+	}
+	finished := imp.Status == models.ImportCompleted || imp.Status == models.ImportFailed
+	imp, err = scanImport(dbImport.QueryRow(`
+		INSERT INTO imports (kind, format, dry_run, status, total_rows, error_count, errors, payload, actor, claimed_actor, request_id, client_ip, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''), CASE WHEN $13 THEN CURRENT_TIMESTAMP END)
+		RETURNING `+importColumns,
+		imp.Kind, imp.Format, imp.DryRun, imp.Status, imp.TotalRows, imp.ErrorCount, rowErrors, payload,
+		imp.Actor, imp.ClaimedActor, imp.RequestID, imp.ClientIP, finished))
+	if err != nil {
+		return imp, models.NewHttpErrorFromError("failed to insert import", err, http.StatusInternalServerError)
+	}
+	return imp, models.NewEmptyHttpError()
+}
+
+func marshalRowErrors(rowErrors []models.ImportRowError) ([]byte, error) {
+	if len(rowErrors) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(rowErrors)
+}
+
+func GetImport(id int64) (models.Import, models.HttpError) {
+	imp, err := scanImport(dbImport.QueryRow(`SELECT `+importColumns+` FROM imports WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return imp, models.NewHttpError(fmt.Sprintf("import with ID %d not found", id), http.StatusNotFound)
+		}
+		return imp, models.NewHttpErrorFromError("failed to scan import", err, http.StatusInternalServerError)
+	}
+	return imp, models.NewEmptyHttpError()
+}
+
+// ClaimImport marks the oldest pending import as running and returns it with its payload.
+// A running import whose instance stopped updating it for staleAfter is claimed again and resumes where it stopped.
+func ClaimImport(staleAfter time.Duration) (models.Import, []byte, bool, models.HttpError) {
+	var payload []byte
+	row := dbImport.QueryRow(`
+		UPDATE imports
+		   SET status = 'running', updated_at = CURRENT_TIMESTAMP
+		 WHERE id = (
+		       SELECT id
+		         FROM imports
+		        WHERE status = 'pending'
+		           OR (status = 'running' AND updated_at < CURRENT_TIMESTAMP - make_interval(secs => $1))
+		       ORDER BY id
+		       LIMIT 1
+		       FOR UPDATE SKIP LOCKED
+		 )
+		RETURNING payload, `+importColumns, staleAfter.Seconds())
+
+	var imp models.Import
+	var rowErrors []byte
+	var finishedAt sql.NullTime
+	err := row.Scan(&payload, &imp.ID, &imp.Kind, &imp.Format, &imp.DryRun, &imp.Status, &imp.TotalRows, &imp.ProcessedRows, &imp.ErrorCount,
+		&rowErrors, &imp.Error, &imp.Actor, &imp.ClaimedActor, &imp.RequestID, &imp.ClientIP, &imp.CreatedAt, &imp.UpdatedAt, &finishedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return imp, nil, false, models.NewEmptyHttpError()
+		}
+		return imp, nil, false, models.NewHttpErrorFromError("failed to claim import", err, http.StatusInternalServerError)
+	}
+	return imp, payload, true, models.NewEmptyHttpError()
+}
+
+// FinishImport records the final status of an import and drops its payload
+func FinishImport(id int64, status string, message string) models.HttpError {
+	_, err := dbImport.Exec(`
+		UPDATE imports
+		   SET status = $2, error = NULLIF($3, ''), payload = NULL, updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+		 WHERE id = $1
+	`, id, status, message)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to update import", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// ImportBooks inserts a batch of books and advances the import from rows from to rows to in one transaction,
+// so a resumed import continues exactly after the last committed batch
+func ImportBooks(importId int64, from int, to int, books []models.Book, actor models.Actor) models.HttpError {
+	return importBatch(importId, from, to, func(tx *sql.Tx) error {
+		for _, book := range books {
+			err := tx.QueryRowContext(context.Background(), `
+				INSERT INTO books (title, quantity, isbn, authors, publisher, publication_date, subjects)
+				VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+				RETURNING id, borrowed_count, version
+			`, book.Title, book.Quantity, book.ISBN, pq.Array(nonNil(book.Authors)), book.Publisher, book.PublicationDate,
+				pq.Array(nonNil(book.Subjects))).Scan(&book.ID, &book.BorrowedCount, &book.Version)
+			if err != nil {
+				return err
+			}
+			event := models.BookEventData{BookID: book.ID, Title: book.Title, Quantity: book.Quantity, BorrowedCount: book.BorrowedCount}
+			if err := insertEventWithTx(tx, models.EventBookCreated, models.AggregateBook, book.ID, event); err != nil {
+				return err
+			}
+			if err := insertAuditWithTx(tx, actor, models.AuditBookCreate, models.AggregateBook, book.ID, nil, book); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ImportUsers inserts a batch of users and advances the import from rows from to rows to in one transaction
+func ImportUsers(importId int64, from int, to int, users []models.User, actor models.Actor) models.HttpError {
+	return importBatch(importId, from, to, func(tx *sql.Tx) error {
+		for _, user := range users {
+			err := tx.QueryRowContext(context.Background(), `
+				INSERT INTO users (first_name, last_name, email, phone, locale, notify_email, notify_sms, category,
+				                   date_of_birth, address, membership_starts, membership_expires)
+				VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8,
+				        NULLIF($9, '')::DATE, NULLIF($10, ''), COALESCE(NULLIF($11, '')::DATE, CURRENT_DATE), NULLIF($12, '')::DATE)
+				RETURNING id, card_number
+			`, user.FirstName, user.LastName, user.Email, user.Phone, user.Locale, user.NotifyEmail, user.NotifySMS, user.Category,
+				user.DateOfBirth, user.Address, user.MembershipStarts, user.MembershipExpires).Scan(&user.ID, &user.CardNumber)
+			if err != nil {
+				return err
+			}
+			event := models.UserEventData{UserID: user.ID, FirstName: user.FirstName, LastName: user.LastName}
+			if err := insertEventWithTx(tx, models.EventUserCreated, models.AggregateUser, user.ID, event); err != nil {
+				return err
+			}
+			if err := insertAuditWithTx(tx, actor, models.AuditUserCreate, models.AggregateUser, user.ID, nil, user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// nonNil turns a nil slice into an empty one, a nil pq.Array is stored as NULL
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// importBatch inserts a batch and moves the import's progress from from to to in one transaction.
+// The progress only moves if it is still at from: when a stalled worker's import was claimed again and the other
+// worker committed this batch first, the batch is rolled back instead of inserting its rows a second time.
+func importBatch(importId int64, from int, to int, insert func(tx *sql.Tx) error) models.HttpError {
+	ctx := context.Background()
+	tx, err := dbImport.BeginTx(ctx, nil)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+	if err := insert(tx); err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to import rows", err, http.StatusInternalServerError)
+	}
+	result, err := tx.ExecContext(ctx, `
+		UPDATE imports
+		   SET processed_rows = $3, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND processed_rows = $2 AND status = 'running'
+	`, importId, from, to)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to update import progress", err, http.StatusInternalServerError)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to get rows affected", err, http.StatusInternalServerError)
+	}
+	if rowsAffected == 0 {
+		_ = tx.Rollback()
+		return models.NewHttpErrorWithCode(models.ErrorImportTakenOver,
+			fmt.Sprintf("import %d is no longer at row %d, another worker took it over", importId, from), http.StatusConflict)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
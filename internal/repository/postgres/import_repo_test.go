@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/migration"
+	"os"
+	"testing"
+	"time"
+)
+
+// testDB connects to the database in TEST_DATABASE_URL and migrates it, tests that need PostgreSQL are skipped without one.
+// The tests write rows and the audit log is append-only, so point it at a throwaway database.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	if err := migration.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestImportBatchAfterReclaim(t *testing.T) {
+	db := testDB(t)
+	SetImportDB(db)
+
+	title := "reclaimed import " + time.Now().Format(time.RFC3339Nano)
+	imp, httpErr := InsertImport(models.Import{
+		Kind:      models.ImportBooks,
+		Format:    models.ImportFormatNDJSON,
+		Status:    models.ImportPending,
+		TotalRows: 1,
+		Actor:     models.AnonymousActor,
+	}, []byte(`{"title":"`+title+`","quantity":1}`))
+	if !models.IsHttpErrorEmpty(httpErr) {
+		t.Fatal(httpErr)
+	}
+
+	// worker A claims the import and stalls, worker B takes it over once it looks abandoned
+	claimed := func() models.Import {
+		t.Helper()
+		for {
+			claimed, _, ok, httpErr := ClaimImport(time.Minute)
+			if !models.IsHttpErrorEmpty(httpErr) {
+				t.Fatal(httpErr)
+			}
+			if !ok {
+				t.Fatalf("import %d was not claimed", imp.ID)
+			}
+			if claimed.ID == imp.ID {
+				return claimed
+			}
+		}
+	}
+	claimed()
+	if _, err := db.Exec(`UPDATE imports SET updated_at = CURRENT_TIMESTAMP - INTERVAL '1 hour' WHERE id = $1`, imp.ID); err != nil {
+		t.Fatal(err)
+	}
+	claimed()
+
+	books := []models.Book{{Title: title, Quantity: 1}}
+	if httpErr := ImportBooks(imp.ID, 0, 1, books, models.Actor{Name: models.AnonymousActor}); !models.IsHttpErrorEmpty(httpErr) {
+		t.Fatalf("worker B: %v", httpErr)
+	}
+	httpErr = ImportBooks(imp.ID, 0, 1, books, models.Actor{Name: models.AnonymousActor})
+	if httpErr.Code != models.ErrorImportTakenOver {
+		t.Fatalf("worker A: got %+v, want %s", httpErr, models.ErrorImportTakenOver)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM books WHERE title = $1`, title).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("the batch was inserted %d times", count)
+	}
+	got, httpErr := GetImport(imp.ID)
+	if !models.IsHttpErrorEmpty(httpErr) {
+		t.Fatal(httpErr)
+	}
+	if got.ProcessedRows != 1 {
+		t.Errorf("processed rows = %d, want 1", got.ProcessedRows)
+	}
+}
@@ -0,0 +1,252 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"time"
+)
+
+// jobLeaderLockKey identifies the advisory lock held by the replica that runs background jobs
+const jobLeaderLockKey = `library-api.jobs.leader`
+
+const jobRunColumns = `id, job_name, triggered_by, status, scheduled_at, started_at, finished_at, duration_ms,
+       COALESCE(message, ''), COALESCE(error, ''), COALESCE(instance, '')`
+
+var dbJob *sql.DB
+
+func SetJobDB(database *sql.DB) {
+	dbJob = database
+}
+
+// JobLeaderLock is a session-level advisory lock held on a dedicated connection.
+// PostgreSQL releases it when the connection closes, so a crashed leader hands over leadership by itself.
+type JobLeaderLock struct {
+	conn *sql.Conn
+}
+
+// TryJobLeaderLock takes the leader lock if no other replica holds it
+func TryJobLeaderLock(ctx context.Context) (*JobLeaderLock, bool, models.HttpError) {
+	conn, err := dbJob.Conn(ctx)
+	if err != nil {
+		return nil, false, models.NewHttpErrorFromError("failed to get database connection", err, http.StatusInternalServerError)
+	}
+	var acquired bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, jobLeaderLockKey).Scan(&acquired)
+	if err != nil || !acquired {
+		_ = conn.Close()
+		if err != nil {
+			return nil, false, models.NewHttpErrorFromError("failed to take job leader lock", err, http.StatusInternalServerError)
+		}
+		return nil, false, models.NewEmptyHttpError()
+	}
+	return &JobLeaderLock{conn: conn}, true, models.NewEmptyHttpError()
+}
+
+// Held reports whether the connection holding the lock is still alive
+func (l *JobLeaderLock) Held(ctx context.Context) bool {
+	return l.conn.PingContext(ctx) == nil
+}
+
+// Release unlocks and returns the connection to the pool
+func (l *JobLeaderLock) Release() {
+	_, _ = l.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, jobLeaderLockKey)
+	_ = l.conn.Close()
+}
+
+func scanJobRun(row rowScanner) (models.JobRun, error) {
+	var run models.JobRun
+	var startedAt, finishedAt sql.NullTime
+	var durationMs sql.NullInt64
+	err := row.Scan(&run.ID, &run.JobName, &run.TriggeredBy, &run.Status, &run.ScheduledAt, &startedAt, &finishedAt, &durationMs,
+		&run.Message, &run.Error, &run.Instance)
+	if startedAt.Valid {
+		run.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	if durationMs.Valid {
+		run.DurationMs = &durationMs.Int64
+	}
+	return run, err
+}
+
+func queryJobRuns(query string, args ...any) ([]models.JobRun, models.HttpError) {
+	rows, err := dbJob.Query(query, args...)
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query job runs", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var runs []models.JobRun
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan job run", err, http.StatusInternalServerError)
+		}
+		runs = append(runs, run)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over job runs", err, http.StatusInternalServerError)
+	}
+	return runs, models.NewEmptyHttpError()
+}
+
+// StartScheduledJobRun records the start of a scheduled run.
+// It returns false if the slot was already run, e.g. by the previous leader.
+func StartScheduledJobRun(jobName string, scheduledAt time.Time, instance string) (models.JobRun, bool, models.HttpError) {
+	run, err := scanJobRun(dbJob.QueryRow(`
+		INSERT INTO job_runs (job_name, triggered_by, status, scheduled_at, started_at, instance)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, $5)
+		ON CONFLICT (job_name, scheduled_at) WHERE triggered_by = 'schedule' DO NOTHING
+		RETURNING `+jobRunColumns,
+		jobName, models.JobTriggerSchedule, models.JobRunning, scheduledAt.UTC(), instance))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return run, false, models.NewEmptyHttpError()
+		}
+		return run, false, models.NewHttpErrorFromError("failed to insert job run", err, http.StatusInternalServerError)
+	}
+	return run, true, models.NewEmptyHttpError()
+}
+
+// QueueJobRun asks the leader to run a job as soon as possible and records the request in the audit log.
+// If the job is already waiting to run, the waiting run is returned instead of queuing another one, nothing is recorded then.
+func QueueJobRun(jobName string, actor models.Actor) (models.JobRun, models.HttpError) {
+	ctx := context.Background()
+	tx, err := dbJob.BeginTx(ctx, nil)
+	if err != nil {
+		return models.JobRun{}, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	run, err := scanJobRun(tx.QueryRowContext(ctx, `
+		INSERT INTO job_runs (job_name, triggered_by, status)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (job_name) WHERE status = 'queued' DO NOTHING
+		RETURNING `+jobRunColumns,
+		jobName, models.JobTriggerManual, models.JobQueued))
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		run, err = scanJobRun(dbJob.QueryRow(`SELECT `+jobRunColumns+` FROM job_runs WHERE job_name = $1 AND status = 'queued'`, jobName))
+		if err != nil {
+			return run, models.NewHttpErrorFromError("failed to queue job run", err, http.StatusInternalServerError)
+		}
+		return run, models.NewEmptyHttpError()
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return run, models.NewHttpErrorFromError("failed to queue job run", err, http.StatusInternalServerError)
+	}
+
+	if err := insertAuditWithTx(tx, actor, models.AuditJobRun, models.AuditTargetJob, int(run.ID), nil, run); err != nil {
+		_ = tx.Rollback()
+		return run, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return run, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return run, models.NewEmptyHttpError()
+}
+
+// ClaimQueuedJobRuns marks the oldest queued run of every job that is not already running as running
+func ClaimQueuedJobRuns(instance string, running []string) ([]models.JobRun, models.HttpError) {
+	if running == nil {
+		// a NULL array would exclude every job
+		running = []string{}
+	}
+	return queryJobRuns(`
+		UPDATE job_runs
+		   SET status = 'running', started_at = CURRENT_TIMESTAMP, instance = $1
+		 WHERE id IN (
+		       SELECT DISTINCT ON (job_name) id
+		         FROM job_runs
+		        WHERE status = 'queued'
+		          AND NOT (job_name = ANY($2))
+		       ORDER BY job_name, id
+		 )
+		RETURNING `+jobRunColumns,
+		instance, pq.Array(running))
+}
+
+// FinishJobRun records the outcome of a run
+func FinishJobRun(run models.JobRun) models.HttpError {
+	_, err := dbJob.Exec(`
+		UPDATE job_runs
+		   SET status = $2, finished_at = CURRENT_TIMESTAMP, duration_ms = $3, message = NULLIF($4, ''), error = NULLIF($5, '')
+		 WHERE id = $1
+	`, run.ID, run.Status, run.DurationMs, run.Message, run.Error)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to update job run", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// FailInterruptedJobRuns marks runs left running by a previous leader as failed.
+// It must only be called while holding the leader lock, when no run can be in progress.
+func FailInterruptedJobRuns() (int64, models.HttpError) {
+	result, err := dbJob.Exec(`
+		UPDATE job_runs
+		   SET status = 'failed', finished_at = CURRENT_TIMESTAMP, error = 'interrupted, the instance running it stopped'
+		 WHERE status = 'running'
+	`)
+	if err != nil {
+		return 0, models.NewHttpErrorFromError("failed to update interrupted job runs", err, http.StatusInternalServerError)
+	}
+	failed, err := result.RowsAffected()
+	if err != nil {
+		return 0, models.NewHttpErrorFromError("failed to get rows affected", err, http.StatusInternalServerError)
+	}
+	return failed, models.NewEmptyHttpError()
+}
+
+// GetLatestJobRuns returns the most recent run of every job, or only of scheduled runs when scheduledOnly is set
+func GetLatestJobRuns(scheduledOnly bool) (map[string]models.JobRun, models.HttpError) {
+	runs, err := queryJobRuns(`
+		SELECT DISTINCT ON (job_name) `+jobRunColumns+`
+		  FROM job_runs
+		 WHERE NOT $1 OR triggered_by = 'schedule'
+		ORDER BY job_name, id DESC
+	`, scheduledOnly)
+	if !models.IsHttpErrorEmpty(err) {
+		return nil, err
+	}
+	latest := make(map[string]models.JobRun, len(runs))
+	for _, run := range runs {
+		latest[run.JobName] = run
+	}
+	return latest, models.NewEmptyHttpError()
+}
+
+// GetJobRuns returns the run history of a job, newest first
+func GetJobRuns(jobName string, limit int) ([]models.JobRun, models.HttpError) {
+	return queryJobRuns(`
+		SELECT `+jobRunColumns+`
+		  FROM job_runs
+		 WHERE job_name = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, jobName, limit)
+}
+
+// DeleteJobRunsOlderThan removes runs that finished longer than age ago
+func DeleteJobRunsOlderThan(age time.Duration) (int64, models.HttpError) {
+	result, err := dbJob.Exec(`DELETE FROM job_runs WHERE finished_at < CURRENT_TIMESTAMP - make_interval(secs => $1)`, age.Seconds())
+	if err != nil {
+		return 0, models.NewHttpErrorFromError("failed to delete job runs", err, http.StatusInternalServerError)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, models.NewHttpErrorFromError("failed to get rows affected", err, http.StatusInternalServerError)
+	}
+	return deleted, models.NewEmptyHttpError()
+}
@@ -0,0 +1,134 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"time"
+)
+
+var dbNotification *sql.DB
+
+func SetNotificationDB(database *sql.DB) {
+	dbNotification = database
+}
+
+// GetLoansForNotification returns open loans of opted-in patrons that need a notice of the given kind.
+// due_soon loans are due within dueSoonDays, overdue loans are past their due date.
+// A channel is skipped once the notice was sent on it or failed maxAttempts times, and while it waits for its next attempt,
+// which is retryBackoff after the first failure and doubles with every further one.
+func GetLoansForNotification(kind string, dueSoonDays int, maxAttempts int, retryBackoff time.Duration) ([]models.LoanNotice, models.HttpError) {
+	args := []any{kind, maxAttempts, retryBackoff.Seconds()}
+	var dueCondition string
+	switch kind {
+	case models.NotificationDueSoon:
+		dueCondition = `b.due_at >= CURRENT_TIMESTAMP AND b.due_at < CURRENT_TIMESTAMP + make_interval(days => $4)`
+		args = append(args, dueSoonDays)
+	case models.NotificationOverdue:
+		dueCondition = `b.due_at < CURRENT_TIMESTAMP`
+	default:
+		return nil, models.NewHttpError(fmt.Sprintf("unknown notification kind %q", kind), http.StatusBadRequest)
+	}
+
+	rows, err := dbNotification.Query(`
+		SELECT b.id, b.book_id, bk.title, b.borrowed_at, b.due_at,
+		       u.id, u.first_name, u.last_name, COALESCE(u.email, ''), COALESCE(u.phone, ''), u.locale, u.notify_email, u.notify_sms,
+		       COALESCE(ARRAY(
+		           SELECT n.channel FROM notifications n
+		            WHERE n.borrow_id = b.id AND n.kind = $1
+		           GROUP BY n.channel
+		           HAVING bool_or(n.status = 'sent')
+		               OR count(*) >= $2
+		               OR max(n.created_at) > CURRENT_TIMESTAMP - make_interval(secs => $3 * power(2, count(*) - 1))
+		       ), '{}')
+		  FROM borrow b
+		  JOIN users u ON u.id = b.user_id
+		  JOIN books bk ON bk.id = b.book_id
+		 WHERE b.returned_at IS NULL
+		   AND (u.notify_email OR u.notify_sms)
+		   AND `+dueCondition+`
+		ORDER BY b.due_at, b.id
+	`, args...)
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query loans for notification", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var notices []models.LoanNotice
+	for rows.Next() {
+		var notice models.LoanNotice
+		user := &notice.User
+		if err := rows.Scan(&notice.BorrowID, &notice.BookID, &notice.BookTitle, &notice.BorrowedAt, &notice.DueAt,
+			&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Phone, &user.Locale, &user.NotifyEmail, &user.NotifySMS,
+			pq.Array(&notice.SkipChannels)); err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan loan", err, http.StatusInternalServerError)
+		}
+		notices = append(notices, notice)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over loans", err, http.StatusInternalServerError)
+	}
+	return notices, models.NewEmptyHttpError()
+}
+
+// InsertNotification records a sent or failed notification.
+// Recording a second successful notice for the same loan, kind and channel is a no-op.
+func InsertNotification(notification models.Notification) models.HttpError {
+	_, err := dbNotification.Exec(`
+		INSERT INTO notifications (user_id, borrow_id, kind, channel, recipient, subject, body, status, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+		ON CONFLICT (borrow_id, kind, channel) WHERE status = 'sent' DO NOTHING
+	`, notification.UserID, notification.BorrowID, notification.Kind, notification.Channel, notification.Recipient,
+		notification.Subject, notification.Body, notification.Status, notification.Error)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to insert notification", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// GetNotifications returns the notifications of a user, newest first
+func GetNotifications(userId int, limit int) ([]models.Notification, models.HttpError) {
+	rows, err := dbNotification.Query(`
+		SELECT id, user_id, borrow_id, kind, channel, recipient, subject, body, status, COALESCE(error, ''), created_at
+		  FROM notifications
+		 WHERE user_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, userId, limit)
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query notifications", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var notifications []models.Notification
+	for rows.Next() {
+		var notification models.Notification
+		var borrowId sql.NullInt64
+		if err := rows.Scan(&notification.ID, &notification.UserID, &borrowId, &notification.Kind, &notification.Channel,
+			&notification.Recipient, &notification.Subject, &notification.Body, &notification.Status, &notification.Error,
+			&notification.CreatedAt); err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan notification", err, http.StatusInternalServerError)
+		}
+		if borrowId.Valid {
+			id := int(borrowId.Int64)
+			notification.BorrowID = &id
+		}
+		notifications = append(notifications, notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over notifications", err, http.StatusInternalServerError)
+	}
+	return notifications, models.NewEmptyHttpError()
+}
@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"slices"
+	"time"
+)
+
+var dbOutbox *sql.DB
+
+func SetOutboxDB(database *sql.DB) {
+	dbOutbox = database
+}
+
+// insertEventWithTx writes a domain event to the outbox as part of the caller's transaction,
+// so the event exists if and only if the change it describes was committed
+func insertEventWithTx(tx *sql.Tx, eventType string, aggregateType string, aggregateId int, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(context.Background(), `
+		INSERT INTO outbox (event_type, aggregate_type, aggregate_id, payload)
+		VALUES ($1, $2, $3, $4)
+	`, eventType, aggregateType, aggregateId, payload)
+	return err
+}
+
+// ClaimOutbox hands out up to limit due events in insertion order and moves their next attempt lease into the future,
+// so other relays skip them while this one publishes without holding a transaction or a row lock.
+// An event is marked published only by RecordOutboxAttempt, if the relay dies before that the event is claimed again
+// once the lease ran out, so a crash causes a redelivery, never a loss.
+func ClaimOutbox(limit int, lease time.Duration) ([]models.Event, models.HttpError) {
+	rows, err := dbOutbox.Query(`
+		UPDATE outbox
+		   SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		 WHERE id IN (
+		       SELECT id
+		         FROM outbox
+		        WHERE published_at IS NULL
+		          AND dead_at IS NULL
+		          AND next_attempt_at <= CURRENT_TIMESTAMP
+		       ORDER BY id
+		       LIMIT $1
+		       FOR UPDATE SKIP LOCKED)
+		RETURNING id, event_type, aggregate_type, aggregate_id, payload, created_at, attempts, published_to
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to claim outbox events", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var events []models.Event
+	for rows.Next() {
+		var event models.Event
+		if err := rows.Scan(&event.ID, &event.Type, &event.AggregateType, &event.AggregateID, &event.Data, &event.OccurredAt, &event.Attempts, pq.Array(&event.PublishedTo)); err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan outbox row", err, http.StatusInternalServerError)
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("rows error", err, http.StatusInternalServerError)
+	}
+	// RETURNING does not keep the order of the subquery
+	slices.SortFunc(events, func(a, b models.Event) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return events, models.NewEmptyHttpError()
+}
+
+// RecordOutboxAttempt stores the outcome of publishing a claimed event. publishedTo lists every publisher the event reached so far,
+// a retry skips them. An event that failed maxAttempts times is marked dead and no longer claimed.
+func RecordOutboxAttempt(event models.Event, publishedTo []string, publishErr error, maxAttempts int, retryDelay func(attempts int) time.Duration) models.HttpError {
+	attempts := event.Attempts + 1
+	var err error
+	switch {
+	case publishErr == nil:
+		_, err = dbOutbox.Exec(`
+			UPDATE outbox
+			   SET attempts = $2, published_to = $3, published_at = CURRENT_TIMESTAMP, last_error = NULL
+			 WHERE id = $1
+		`, event.ID, attempts, pq.Array(publishedTo))
+	case attempts >= maxAttempts:
+		_, err = dbOutbox.Exec(`
+			UPDATE outbox
+			   SET attempts = $2, published_to = $3, dead_at = CURRENT_TIMESTAMP, last_error = $4
+			 WHERE id = $1
+		`, event.ID, attempts, pq.Array(publishedTo), publishErr.Error())
+	default:
+		_, err = dbOutbox.Exec(`
+			UPDATE outbox
+			   SET attempts = $2, published_to = $3, last_error = $4,
+			       next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $5)
+			 WHERE id = $1
+		`, event.ID, attempts, pq.Array(publishedTo), publishErr.Error(), retryDelay(attempts).Seconds())
+	}
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to update outbox row", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
@@ -0,0 +1,211 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+)
+
+var dbRecommendation *sql.DB
+
+func SetRecommendationDB(database *sql.DB) {
+	dbRecommendation = database
+}
+
+// recommendationScore is the cosine similarity of the borrowers of co.BOOK_ID and co.OTHER_BOOK_ID
+const recommendationScore = `co.READERS / SQRT(ra.READERS::FLOAT8 * rb.READERS)`
+
+// RefreshRecommendations counts the borrows after the last counted one, at most batchSize IDs of them, into
+// BOOK_READERS and BOOK_CO_BORROWS. Only a patron's first borrow of a book counts. The batch ends before the first
+// borrow younger than a minute, so one whose ID was taken by a transaction that has not committed yet is not skipped.
+func RefreshRecommendations(batchSize int) (models.RecommendationRefresh, models.HttpError) {
+	var refresh models.RecommendationRefresh
+	ctx := context.Background()
+	tx, err := dbRecommendation.BeginTx(ctx, nil)
+	if err != nil {
+		return refresh, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO recommendation_state (id, last_borrow_id) VALUES (1, 0) ON CONFLICT (id) DO NOTHING`)
+	if err != nil {
+		_ = tx.Rollback()
+		return refresh, models.NewHttpErrorFromError("failed to create recommendation state", err, http.StatusInternalServerError)
+	}
+	var last int
+	var settled sql.NullInt64
+	err = tx.QueryRowContext(ctx, `SELECT last_borrow_id FROM recommendation_state WHERE id = 1 FOR UPDATE`).Scan(&last)
+	if err != nil {
+		_ = tx.Rollback()
+		return refresh, models.NewHttpErrorFromError("failed to read recommendation state", err, http.StatusInternalServerError)
+	}
+	err = tx.QueryRowContext(ctx, `
+		SELECT MAX(id) FROM borrow
+		 WHERE id > $1 AND id <= $1 + $2
+		   AND id < (SELECT COALESCE(MIN(id), $1 + $2 + 1) FROM borrow WHERE id > $1 AND borrowed_at >= NOW() - INTERVAL '1 minute')
+	`, last, batchSize).Scan(&settled)
+	if err != nil {
+		_ = tx.Rollback()
+		return refresh, models.NewHttpErrorFromError("failed to find new borrows", err, http.StatusInternalServerError)
+	}
+	if !settled.Valid {
+		_ = tx.Rollback()
+		return skipBorrowGap(last, batchSize)
+	}
+	upper := int(settled.Int64)
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TEMP TABLE first_reads ON COMMIT DROP AS
+		SELECT DISTINCT b.user_id, b.book_id
+		  FROM borrow b
+		 WHERE b.id > $1 AND b.id <= $2
+		   AND NOT EXISTS (SELECT 1 FROM borrow o WHERE o.user_id = b.user_id AND o.book_id = b.book_id AND o.id <= $1)
+	`, last, upper)
+	if err != nil {
+		_ = tx.Rollback()
+		return refresh, models.NewHttpErrorFromError("failed to collect new borrows", err, http.StatusInternalServerError)
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO book_readers (book_id, readers)
+		SELECT book_id, COUNT(*) FROM first_reads GROUP BY book_id
+		    ON CONFLICT (book_id) DO UPDATE SET readers = book_readers.readers + EXCLUDED.readers
+	`)
+	if err != nil {
+		_ = tx.Rollback()
+		return refresh, models.NewHttpErrorFromError("failed to count readers", err, http.StatusInternalServerError)
+	}
+	if rows, err := result.RowsAffected(); err == nil {
+		refresh.Borrows = int(rows)
+	}
+	// pairs with a book the patron read before are counted in both directions here,
+	// pairs of two new books in one direction from each of them
+	_, err = tx.ExecContext(ctx, `
+		WITH earlier AS (
+			SELECT DISTINCT user_id, book_id FROM borrow
+			 WHERE id <= $1 AND user_id IN (SELECT user_id FROM first_reads)
+		), pairs AS (
+			SELECT f.book_id, e.book_id AS other_book_id FROM first_reads f JOIN earlier e ON e.user_id = f.user_id
+			 UNION ALL
+			SELECT e.book_id, f.book_id FROM first_reads f JOIN earlier e ON e.user_id = f.user_id
+			 UNION ALL
+			SELECT f.book_id, g.book_id FROM first_reads f JOIN first_reads g ON g.user_id = f.user_id AND g.book_id <> f.book_id
+		)
+		INSERT INTO book_co_borrows (book_id, other_book_id, readers)
+		SELECT book_id, other_book_id, COUNT(*) FROM pairs GROUP BY book_id, other_book_id
+		    ON CONFLICT (book_id, other_book_id) DO UPDATE SET readers = book_co_borrows.readers + EXCLUDED.readers
+	`, last)
+	if err != nil {
+		_ = tx.Rollback()
+		return refresh, models.NewHttpErrorFromError("failed to count co-borrows", err, http.StatusInternalServerError)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE recommendation_state SET last_borrow_id = $1, updated_at = NOW() WHERE id = 1`, upper)
+	if err != nil {
+		_ = tx.Rollback()
+		return refresh, models.NewHttpErrorFromError("failed to update recommendation state", err, http.StatusInternalServerError)
+	}
+	if err := tx.Commit(); err != nil {
+		return refresh, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	refresh.LastBorrowID = upper
+	return refresh, models.NewEmptyHttpError()
+}
+
+// skipBorrowGap moves the last counted borrow past a range of IDs without borrows, or reports that no settled borrows are left
+func skipBorrowGap(last int, batchSize int) (models.RecommendationRefresh, models.HttpError) {
+	refresh := models.RecommendationRefresh{LastBorrowID: last, Done: true}
+	var next sql.NullInt64
+	err := dbRecommendation.QueryRow(`SELECT MIN(id) FROM borrow WHERE id > $1`, last).Scan(&next)
+	if err != nil {
+		return refresh, models.NewHttpErrorFromError("failed to find new borrows", err, http.StatusInternalServerError)
+	}
+	if !next.Valid || int(next.Int64) <= last+batchSize {
+		return refresh, models.NewEmptyHttpError()
+	}
+	_, err = dbRecommendation.Exec(`UPDATE recommendation_state SET last_borrow_id = $2, updated_at = NOW() WHERE id = 1 AND last_borrow_id = $1`, last, next.Int64-1)
+	if err != nil {
+		return refresh, models.NewHttpErrorFromError("failed to update recommendation state", err, http.StatusInternalServerError)
+	}
+	refresh.LastBorrowID = int(next.Int64) - 1
+	refresh.Done = false
+	return refresh, models.NewEmptyHttpError()
+}
+
+// GetSimilarBooks returns the books most often borrowed by the borrowers of the book, available ones first
+func GetSimilarBooks(bookId int, limit int) ([]models.Recommendation, models.HttpError) {
+	return queryRecommendations(`
+		SELECT `+bookColumns+`, `+recommendationScore+` AS score, co.READERS
+		  FROM book_co_borrows co
+		  JOIN book_readers ra ON ra.BOOK_ID = co.BOOK_ID
+		  JOIN book_readers rb ON rb.BOOK_ID = co.OTHER_BOOK_ID
+		  JOIN books ON books.ID = co.OTHER_BOOK_ID
+		 WHERE co.BOOK_ID = $1
+		 ORDER BY QUANTITY > BORROWED_COUNT DESC, score DESC, ID
+		 LIMIT $2`, models.RecommendationCoBorrowed, bookId, limit)
+}
+
+// GetRecommendations ranks the books co-borrowed with the books the user borrowed by their summed similarity,
+// available ones first. Books the user borrowed are left out, also those not counted yet.
+func GetRecommendations(userId int, limit int) ([]models.Recommendation, models.HttpError) {
+	return queryRecommendations(`
+		WITH borrowed AS (
+			SELECT DISTINCT book_id FROM borrow WHERE user_id = $1
+		), candidates AS (
+			SELECT co.OTHER_BOOK_ID AS book_id, SUM(`+recommendationScore+`) AS score
+			  FROM borrowed
+			  JOIN book_co_borrows co ON co.BOOK_ID = borrowed.book_id
+			  JOIN book_readers ra ON ra.BOOK_ID = co.BOOK_ID
+			  JOIN book_readers rb ON rb.BOOK_ID = co.OTHER_BOOK_ID
+			 WHERE co.OTHER_BOOK_ID NOT IN (SELECT book_id FROM borrowed)
+			 GROUP BY co.OTHER_BOOK_ID
+		)
+		SELECT `+bookColumns+`, candidates.score, 0
+		  FROM candidates
+		  JOIN books ON books.ID = candidates.book_id
+		 ORDER BY QUANTITY > BORROWED_COUNT DESC, candidates.score DESC, ID
+		 LIMIT $2`, models.RecommendationCoBorrowed, userId, limit)
+}
+
+// GetPopularBooks returns the books with the most borrowers that the user has not borrowed, available ones first.
+// They fill up the recommendations of users with little history.
+func GetPopularBooks(userId int, exclude []int, limit int) ([]models.Recommendation, models.HttpError) {
+	return queryRecommendations(`
+		SELECT `+bookColumns+`, 0, 0
+		  FROM book_readers r
+		  JOIN books ON books.ID = r.BOOK_ID
+		 WHERE NOT EXISTS (SELECT 1 FROM borrow WHERE borrow.user_id = $1 AND borrow.book_id = books.ID)
+		   AND books.ID <> ALL($2)
+		 ORDER BY QUANTITY > BORROWED_COUNT DESC, r.READERS DESC, ID
+		 LIMIT $3`, models.RecommendationPopular, userId, pq.Array(int64s(exclude)), limit)
+}
+
+func queryRecommendations(query string, reason string, args ...any) ([]models.Recommendation, models.HttpError) {
+	rows, err := dbRecommendation.Query(query, args...)
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query recommendations", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var recommendations []models.Recommendation
+	for rows.Next() {
+		recommendation := models.Recommendation{Reason: reason}
+		book, err := scanBook(scannerFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &recommendation.Score, &recommendation.CoBorrowers)...)
+		}))
+		if err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan recommendation", err, http.StatusInternalServerError)
+		}
+		recommendation.BookResponse = models.NewBookResponseFromBook(book)
+		recommendations = append(recommendations, recommendation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over recommendations", err, http.StatusInternalServerError)
+	}
+	return recommendations, models.NewEmptyHttpError()
+}
@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"time"
+)
+
+var dbReport *sql.DB
+
+func SetReportDB(database *sql.DB) {
+	dbReport = database
+}
+
+// reportQuery runs a report query and scans every row with scan
+func reportQuery(name string, scan func(rowScanner) error, query string, args ...any) models.HttpError {
+	rows, err := dbReport.Query(query, args...)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to query "+name, err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return models.NewHttpErrorFromError("failed to scan "+name, err, http.StatusInternalServerError)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return models.NewHttpErrorFromError("failed to iterate over "+name, err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// GetTopBooks returns the most borrowed books of the period, most borrows first
+func GetTopBooks(period models.ReportPeriod, limit int) ([]models.TopBook, models.HttpError) {
+	var books []models.TopBook
+	httpErr := reportQuery("top books", func(row rowScanner) error {
+		var book models.TopBook
+		err := row.Scan(&book.BookID, &book.Title, &book.Borrows)
+		books = append(books, book)
+		return err
+	}, `
+		SELECT b.id, b.title, COUNT(*) AS borrows
+		  FROM borrow br
+		  JOIN books b ON b.id = br.book_id
+		 WHERE br.borrowed_at >= $1 AND br.borrowed_at < $2
+		 GROUP BY b.id, b.title
+		 ORDER BY borrows DESC, b.id
+		 LIMIT $3`, period.From.UTC(), period.To.UTC(), limit)
+	return books, httpErr
+}
+
+// GetBorrowCounts returns the number of borrows in every day, week or month of the period, including empty ones.
+// The first and last intervals only count borrows within the period.
+func GetBorrowCounts(period models.ReportPeriod, interval string) ([]models.BorrowCount, models.HttpError) {
+	var counts []models.BorrowCount
+	httpErr := reportQuery("borrow counts", func(row rowScanner) error {
+		var count models.BorrowCount
+		err := row.Scan(&count.Start, &count.Borrows)
+		count.Start = time.Date(count.Start.Year(), count.Start.Month(), count.Start.Day(), 0, 0, 0, 0, time.UTC)
+		counts = append(counts, count)
+		return err
+	}, `
+		SELECT buckets.start, COUNT(br.id)
+		  FROM GENERATE_SERIES(DATE_TRUNC($3, $1::TIMESTAMP), $2::TIMESTAMP - INTERVAL '1 microsecond', ('1 ' || $3)::INTERVAL) AS buckets(start)
+		  LEFT JOIN borrow br
+		    ON DATE_TRUNC($3, br.borrowed_at) = buckets.start
+		   AND br.borrowed_at >= $1 AND br.borrowed_at < $2
+		 GROUP BY buckets.start
+		 ORDER BY buckets.start`, period.From.UTC(), period.To.UTC(), interval)
+	return counts, httpErr
+}
+
+// GetLoanDurations summarizes the loans returned during the period, loans closed because the copy was lost are left out
+func GetLoanDurations(period models.ReportPeriod) (models.LoanDurationReport, models.HttpError) {
+	var report models.LoanDurationReport
+	err := dbReport.QueryRow(`
+		WITH loans AS (
+			SELECT EXTRACT(EPOCH FROM returned_at - borrowed_at) / 86400 AS days, returned_at > due_at AS late
+			  FROM borrow
+			 WHERE returned_at >= $1 AND returned_at < $2 AND lost_at IS NULL
+		)
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE late),
+		       COALESCE(AVG(days), 0),
+		       COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY days), 0),
+		       COALESCE(MAX(days), 0)
+		  FROM loans`, period.From.UTC(), period.To.UTC()).
+		Scan(&report.Returned, &report.ReturnedLate, &report.AverageDays, &report.MedianDays, &report.MaxDays)
+	if err != nil {
+		return report, models.NewHttpErrorFromError("failed to query loan durations", err, http.StatusInternalServerError)
+	}
+	return report, models.NewEmptyHttpError()
+}
+
+// GetUtilization returns the time copies of each book were on loan during the period, most utilized first.
+// Loans still open count until now. Utilization is relative to the current quantity.
+func GetUtilization(period models.ReportPeriod, limit int) ([]models.BookUtilization, models.HttpError) {
+	var books []models.BookUtilization
+	httpErr := reportQuery("utilization", func(row rowScanner) error {
+		var book models.BookUtilization
+		err := row.Scan(&book.BookID, &book.Title, &book.Quantity, &book.BorrowedCount, &book.LoanDays)
+		if book.Quantity > 0 && period.Days() > 0 {
+			book.Utilization = book.LoanDays / (float64(book.Quantity) * period.Days())
+		}
+		books = append(books, book)
+		return err
+	}, `
+		WITH loans AS (
+			SELECT book_id,
+			       SUM(GREATEST(EXTRACT(EPOCH FROM LEAST(COALESCE(returned_at, NOW() AT TIME ZONE 'UTC'), $2) - GREATEST(borrowed_at, $1)), 0)) / 86400 AS days
+			  FROM borrow
+			 WHERE borrowed_at < $2 AND (returned_at IS NULL OR returned_at > $1)
+			 GROUP BY book_id
+		)
+		SELECT b.id, b.title, b.quantity, b.borrowed_count, COALESCE(l.days, 0)
+		  FROM books b
+		  LEFT JOIN loans l ON l.book_id = b.id
+		 ORDER BY COALESCE(l.days, 0) / NULLIF(b.quantity, 0) DESC NULLS LAST, b.id
+		 LIMIT $3`, period.From.UTC(), period.To.UTC(), limit)
+	return books, httpErr
+}
+
+// GetActivePatrons returns the users who borrowed the most books in the period, ranked from 1
+func GetActivePatrons(period models.ReportPeriod, limit int) ([]models.ActivePatron, models.HttpError) {
+	var patrons []models.ActivePatron
+	httpErr := reportQuery("active patrons", func(row rowScanner) error {
+		var patron models.ActivePatron
+		var firstName, lastName string
+		err := row.Scan(&patron.UserID, &firstName, &lastName, &patron.Borrows)
+		patron.Rank = len(patrons) + 1
+		patron.Name = firstName + " " + lastName
+		patrons = append(patrons, patron)
+		return err
+	}, `
+		SELECT u.id, u.first_name, u.last_name, COUNT(*) AS borrows
+		  FROM borrow br
+		  JOIN users u ON u.id = br.user_id
+		 WHERE br.borrowed_at >= $1 AND br.borrowed_at < $2
+		 GROUP BY u.id, u.first_name, u.last_name
+		 ORDER BY borrows DESC, u.id
+		 LIMIT $3`, period.From.UTC(), period.To.UTC(), limit)
+	return patrons, httpErr
+}
+
+// GetUnborrowedBooks returns the books that were never borrowed, longest in the catalog first
+func GetUnborrowedBooks(limit int) ([]models.UnborrowedBook, models.HttpError) {
+	var books []models.UnborrowedBook
+	httpErr := reportQuery("never borrowed books", func(row rowScanner) error {
+		var book models.UnborrowedBook
+		err := row.Scan(&book.BookID, &book.Title, &book.Quantity, &book.AddedAt)
+		books = append(books, book)
+		return err
+	}, `
+		SELECT b.id, b.title, b.quantity, b.created_at
+		  FROM books b
+		 WHERE NOT EXISTS (SELECT 1 FROM borrow br WHERE br.book_id = b.id)
+		 ORDER BY b.created_at, b.id
+		 LIMIT $1`, limit)
+	return books, httpErr
+}
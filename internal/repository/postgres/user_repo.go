@@ -1,33 +1,96 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/spin311/library-api/internal/repository/models"
 	"net/http"
+	"time"
 )
 
 var dbUser *sql.DB
 
+// userColumns is the column list read by scanUser
+const userColumns = `ID, FIRST_NAME, LAST_NAME, COALESCE(EMAIL, ''), COALESCE(PHONE, ''), LOCALE, NOTIFY_EMAIL, NOTIFY_SMS, CATEGORY, VERSION,
+	CARD_NUMBER, COALESCE(TO_CHAR(DATE_OF_BIRTH, 'YYYY-MM-DD'), ''), COALESCE(ADDRESS, ''),
+	TO_CHAR(MEMBERSHIP_STARTS, 'YYYY-MM-DD'), COALESCE(TO_CHAR(MEMBERSHIP_EXPIRES, 'YYYY-MM-DD'), '')`
+
 func SetUserDB(database *sql.DB) {
 	dbUser = database
 }
 
-func InsertUser(user models.User) models.HttpError {
-	stmt, err := dbUser.Prepare(`INSERT INTO users (FIRST_NAME, LAST_NAME) VALUES ($1, $2)`)
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scannerFunc adapts a function to rowScanner, e.g. to read extra columns after the ones a scanX helper reads
+type scannerFunc func(dest ...any) error
+
+func (f scannerFunc) Scan(dest ...any) error {
+	return f(dest...)
+}
+
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Phone, &user.Locale, &user.NotifyEmail, &user.NotifySMS, &user.Category, &user.Version,
+		&user.CardNumber, &user.DateOfBirth, &user.Address, &user.MembershipStarts, &user.MembershipExpires)
+	return user, err
+}
+
+// InsertUser creates the user and returns it with its ID and version
+func InsertUser(user models.User, actor models.Actor) (models.User, models.HttpError) {
+	ctx := context.Background()
+	tx, err := dbUser.BeginTx(ctx, nil)
 	if err != nil {
-		return models.NewHttpErrorFromError("failed to prepare statement", err, http.StatusInternalServerError)
+		return user, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
 	}
-	_, err = stmt.Exec(user.FirstName, user.LastName)
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO users (FIRST_NAME, LAST_NAME, EMAIL, PHONE, LOCALE, NOTIFY_EMAIL, NOTIFY_SMS, CATEGORY,
+		                   DATE_OF_BIRTH, ADDRESS, MEMBERSHIP_STARTS, MEMBERSHIP_EXPIRES)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8,
+		        NULLIF($9, '')::DATE, NULLIF($10, ''), COALESCE(NULLIF($11, '')::DATE, CURRENT_DATE), NULLIF($12, '')::DATE)
+		RETURNING ID, VERSION, CARD_NUMBER, TO_CHAR(MEMBERSHIP_STARTS, 'YYYY-MM-DD')
+	`)
 	if err != nil {
-		return models.NewHttpErrorFromError("failed to execute statement", err, http.StatusInternalServerError)
+		_ = tx.Rollback()
+		return user, models.NewHttpErrorFromError("failed to prepare statement", err, http.StatusInternalServerError)
+	}
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			return
+		}
+	}(stmt)
+
+	err = stmt.QueryRow(user.FirstName, user.LastName, user.Email, user.Phone, user.Locale, user.NotifyEmail, user.NotifySMS, user.Category,
+		user.DateOfBirth, user.Address, user.MembershipStarts, user.MembershipExpires).Scan(&user.ID, &user.Version, &user.CardNumber, &user.MembershipStarts)
+	if err != nil {
+		_ = tx.Rollback()
+		return user, models.NewHttpErrorFromError("failed to execute statement", err, http.StatusInternalServerError)
+	}
+
+	event := models.UserEventData{UserID: user.ID, FirstName: user.FirstName, LastName: user.LastName}
+	if err := insertEventWithTx(tx, models.EventUserCreated, models.AggregateUser, user.ID, event); err != nil {
+		_ = tx.Rollback()
+		return user, models.NewHttpErrorFromError("failed to record event", err, http.StatusInternalServerError)
+	}
+	if err := insertAuditWithTx(tx, actor, models.AuditUserCreate, models.AggregateUser, user.ID, nil, user); err != nil {
+		_ = tx.Rollback()
+		return user, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return user, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
 	}
-	return models.NewEmptyHttpError()
+	return user, models.NewEmptyHttpError()
 }
 
 func GetUsers() ([]models.User, models.HttpError) {
-	rows, err := dbUser.Query(`SELECT ID, FIRST_NAME, LAST_NAME FROM users`)
+	rows, err := dbUser.Query(`SELECT ` + userColumns + ` FROM users`)
 	if err != nil {
 		return nil, models.NewHttpErrorFromError("failed to query users", err, http.StatusInternalServerError)
 	}
@@ -40,8 +103,35 @@ func GetUsers() ([]models.User, models.HttpError) {
 
 	var users []models.User
 	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.FirstName, &user.LastName); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan user", err, http.StatusInternalServerError)
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over users", err, http.StatusInternalServerError)
+	}
+	return users, models.NewEmptyHttpError()
+}
+
+// GetUsersByIds returns the users with the given IDs in no particular order, unknown IDs are skipped
+func GetUsersByIds(ids []int) ([]models.User, models.HttpError) {
+	rows, err := dbUser.Query(`SELECT `+userColumns+` FROM users WHERE id = ANY($1)`, pq.Array(int64s(ids)))
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query users", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, models.NewHttpErrorFromError("failed to scan user", err, http.StatusInternalServerError)
 		}
 		users = append(users, user)
@@ -54,7 +144,7 @@ func GetUsers() ([]models.User, models.HttpError) {
 
 func GetUser(id int) (models.User, models.HttpError) {
 	var user models.User
-	stmt, err := dbUser.Prepare(`SELECT ID, FIRST_NAME, LAST_NAME FROM users WHERE ID = $1`)
+	stmt, err := dbUser.Prepare(`SELECT ` + userColumns + ` FROM users WHERE ID = $1`)
 	if err != nil {
 		return user, models.NewHttpErrorFromError("failed to prepare statement", err, http.StatusInternalServerError)
 	}
@@ -65,8 +155,8 @@ func GetUser(id int) (models.User, models.HttpError) {
 		}
 	}(stmt)
 
-	row := stmt.QueryRow(id)
-	if err := row.Scan(&user.ID, &user.FirstName, &user.LastName); err != nil {
+	user, err = scanUser(stmt.QueryRow(id))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return user, models.NewHttpError(fmt.Sprintf("user with ID %d not found", id), http.StatusNotFound)
 		}
@@ -74,3 +164,130 @@ func GetUser(id int) (models.User, models.HttpError) {
 	}
 	return user, models.NewEmptyHttpError()
 }
+
+// UpdateUser changes the name, contact details, notification preferences, category and membership of a user
+// if it is still at user.Version. The card number is kept, it only changes when the card is replaced.
+func UpdateUser(user models.User, actor models.Actor) (models.User, models.HttpError) {
+	ctx := context.Background()
+	tx, err := dbUser.BeginTx(ctx, nil)
+	if err != nil {
+		return user, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	before, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1 FOR UPDATE`, user.ID))
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, models.NewHttpError(fmt.Sprintf("user with ID %d not found", user.ID), http.StatusNotFound)
+		}
+		return user, models.NewHttpErrorFromError("failed to scan user", err, http.StatusInternalServerError)
+	}
+	if before.Version != user.Version {
+		_ = tx.Rollback()
+		return user, models.NewHttpError(fmt.Sprintf("user with ID %d was modified, current version is %d", user.ID, before.Version), http.StatusPreconditionFailed)
+	}
+	if user.MembershipStarts == "" {
+		user.MembershipStarts = before.MembershipStarts
+	}
+	if user.MembershipExpires != "" && user.MembershipExpires < user.MembershipStarts {
+		_ = tx.Rollback()
+		return user, models.NewHttpError(fmt.Sprintf("membership_expires must not be before membership_starts %s", user.MembershipStarts), http.StatusBadRequest)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		   SET first_name = $1, last_name = $2, email = NULLIF($4, ''), phone = NULLIF($5, ''),
+		       locale = $6, notify_email = $7, notify_sms = $8, category = $9,
+		       date_of_birth = NULLIF($10, '')::DATE, address = NULLIF($11, ''),
+		       membership_starts = $12::DATE, membership_expires = NULLIF($13, '')::DATE
+		 WHERE id = $3
+		RETURNING version, card_number
+	`, user.FirstName, user.LastName, user.ID, user.Email, user.Phone, user.Locale, user.NotifyEmail, user.NotifySMS, user.Category,
+		user.DateOfBirth, user.Address, user.MembershipStarts, user.MembershipExpires).Scan(&user.Version, &user.CardNumber)
+	if err != nil {
+		_ = tx.Rollback()
+		return user, models.NewHttpErrorFromError("failed to update user", err, http.StatusInternalServerError)
+	}
+
+	event := models.UserEventData{UserID: user.ID, FirstName: user.FirstName, LastName: user.LastName}
+	if err := insertEventWithTx(tx, models.EventUserUpdated, models.AggregateUser, user.ID, event); err != nil {
+		_ = tx.Rollback()
+		return user, models.NewHttpErrorFromError("failed to record event", err, http.StatusInternalServerError)
+	}
+	if err := insertAuditWithTx(tx, actor, models.AuditUserUpdate, models.AggregateUser, user.ID, before, user); err != nil {
+		_ = tx.Rollback()
+		return user, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return user, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return user, models.NewEmptyHttpError()
+}
+
+// GetUserByCard returns the user holding the card. The number of a replaced card is answered with 410 Gone.
+func GetUserByCard(cardNumber string) (models.User, models.HttpError) {
+	user, err := scanUser(dbUser.QueryRow(`SELECT `+userColumns+` FROM users WHERE card_number = $1`, cardNumber))
+	if err == nil {
+		return user, models.NewEmptyHttpError()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return user, models.NewHttpErrorFromError("failed to scan user", err, http.StatusInternalServerError)
+	}
+
+	var revokedAt time.Time
+	err = dbUser.QueryRow(`SELECT revoked_at FROM revoked_cards WHERE card_number = $1`, cardNumber).Scan(&revokedAt)
+	if err == nil {
+		return user, models.NewHttpErrorWithCode(models.ErrorCardReplaced,
+			fmt.Sprintf("card %s was replaced on %s", cardNumber, revokedAt.Format(time.DateOnly)), http.StatusGone)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return user, models.NewHttpErrorFromError("failed to look up revoked card", err, http.StatusInternalServerError)
+	}
+	return user, models.NewHttpError(fmt.Sprintf("no user with card %s", cardNumber), http.StatusNotFound)
+}
+
+// ReplaceCard issues a new card number to the user and revokes the old one, e.g. when the card was lost
+func ReplaceCard(userId int, actor models.Actor) (models.User, models.HttpError) {
+	ctx := context.Background()
+	tx, err := dbUser.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	before, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1 FOR UPDATE`, userId))
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return before, models.NewHttpError(fmt.Sprintf("user with ID %d not found", userId), http.StatusNotFound)
+		}
+		return before, models.NewHttpErrorFromError("failed to scan user", err, http.StatusInternalServerError)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO revoked_cards (card_number, user_id) VALUES ($1, $2)`, before.CardNumber, userId); err != nil {
+		_ = tx.Rollback()
+		return before, models.NewHttpErrorFromError("failed to revoke card", err, http.StatusInternalServerError)
+	}
+	user := before
+	err = tx.QueryRowContext(ctx, `UPDATE users SET card_number = LIBRARY_CARD_NUMBER() WHERE id = $1 RETURNING card_number, version`, userId).
+		Scan(&user.CardNumber, &user.Version)
+	if err != nil {
+		_ = tx.Rollback()
+		return before, models.NewHttpErrorFromError("failed to issue card", err, http.StatusInternalServerError)
+	}
+
+	event := models.UserEventData{UserID: user.ID, FirstName: user.FirstName, LastName: user.LastName}
+	if err := insertEventWithTx(tx, models.EventUserUpdated, models.AggregateUser, user.ID, event); err != nil {
+		_ = tx.Rollback()
+		return before, models.NewHttpErrorFromError("failed to record event", err, http.StatusInternalServerError)
+	}
+	if err := insertAuditWithTx(tx, actor, models.AuditUserCard, models.AggregateUser, user.ID, before, user); err != nil {
+		_ = tx.Rollback()
+		return before, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return before, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return user, models.NewEmptyHttpError()
+}
@@ -0,0 +1,323 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/spin311/library-api/internal/repository/models"
+	"net/http"
+	"time"
+)
+
+var dbWebhook *sql.DB
+
+func SetWebhookDB(database *sql.DB) {
+	dbWebhook = database
+}
+
+func InsertWebhookSubscription(subscription models.WebhookSubscription, actor models.Actor) (models.WebhookSubscription, models.HttpError) {
+	ctx := context.Background()
+	tx, err := dbWebhook.BeginTx(ctx, nil)
+	if err != nil {
+		return subscription, models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO webhook_subscriptions (url, event_types, secret)
+		VALUES ($1, $2, $3)
+		RETURNING id, active, created_at
+	`, subscription.URL, pq.Array(subscription.EventTypes), subscription.Secret).Scan(&subscription.ID, &subscription.Active, &subscription.CreatedAt)
+	if err != nil {
+		_ = tx.Rollback()
+		return subscription, models.NewHttpErrorFromError("failed to insert webhook subscription", err, http.StatusInternalServerError)
+	}
+
+	// the secret must not end up in the audit log
+	after := subscription
+	after.Secret = ""
+	if err := insertAuditWithTx(tx, actor, models.AuditWebhookCreate, models.AggregateWebhook, subscription.ID, nil, after); err != nil {
+		_ = tx.Rollback()
+		return subscription, models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return subscription, models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return subscription, models.NewEmptyHttpError()
+}
+
+func GetWebhookSubscriptions() ([]models.WebhookSubscription, models.HttpError) {
+	rows, err := dbWebhook.Query(`SELECT id, url, event_types, active, created_at FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query webhook subscriptions", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var subscriptions []models.WebhookSubscription
+	for rows.Next() {
+		var subscription models.WebhookSubscription
+		if err := rows.Scan(&subscription.ID, &subscription.URL, pq.Array(&subscription.EventTypes), &subscription.Active, &subscription.CreatedAt); err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan webhook subscription", err, http.StatusInternalServerError)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over webhook subscriptions", err, http.StatusInternalServerError)
+	}
+	return subscriptions, models.NewEmptyHttpError()
+}
+
+func GetWebhookSubscription(id int) (models.WebhookSubscription, models.HttpError) {
+	var subscription models.WebhookSubscription
+	err := dbWebhook.QueryRow(`
+		SELECT id, url, event_types, active, created_at
+		  FROM webhook_subscriptions
+		 WHERE id = $1
+	`, id).Scan(&subscription.ID, &subscription.URL, pq.Array(&subscription.EventTypes), &subscription.Active, &subscription.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return subscription, models.NewHttpError(fmt.Sprintf("webhook with ID %d not found", id), http.StatusNotFound)
+		}
+		return subscription, models.NewHttpErrorFromError("failed to scan webhook subscription", err, http.StatusInternalServerError)
+	}
+	return subscription, models.NewEmptyHttpError()
+}
+
+// DeleteWebhookSubscription removes the subscription together with its delivery log
+func DeleteWebhookSubscription(id int, actor models.Actor) models.HttpError {
+	ctx := context.Background()
+	tx, err := dbWebhook.BeginTx(ctx, nil)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	var before models.WebhookSubscription
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM webhook_subscriptions
+		 WHERE id = $1
+		RETURNING id, url, event_types, active, created_at
+	`, id).Scan(&before.ID, &before.URL, pq.Array(&before.EventTypes), &before.Active, &before.CreatedAt)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.NewHttpError(fmt.Sprintf("webhook with ID %d not found", id), http.StatusNotFound)
+		}
+		return models.NewHttpErrorFromError("failed to delete webhook subscription", err, http.StatusInternalServerError)
+	}
+
+	if err := insertAuditWithTx(tx, actor, models.AuditWebhookDelete, models.AggregateWebhook, id, before, nil); err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// EnqueueWebhookDeliveries creates a pending delivery of the event for every active matching subscription.
+// Enqueuing the same event twice is a no-op, so outbox redeliveries do not notify partners twice.
+func EnqueueWebhookDeliveries(event models.Event) models.HttpError {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to encode event", err, http.StatusInternalServerError)
+	}
+	_, err = dbWebhook.Exec(`
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT id, $1::BIGINT, $2::VARCHAR, $3::JSONB
+		  FROM webhook_subscriptions
+		 WHERE active
+		   AND ($2::TEXT = ANY(event_types) OR $4::TEXT = ANY(event_types))
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+	`, event.ID, event.Type, payload, models.AllEventTypes)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to enqueue webhook deliveries", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// ClaimWebhookDeliveries hands out up to limit due deliveries and moves their next attempt lease into the future,
+// so other dispatchers skip them while this one calls the subscribers without holding a transaction or a row lock.
+// A delivery whose dispatcher died before RecordWebhookDelivery is claimed again once the lease ran out.
+func ClaimWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, models.HttpError) {
+	rows, err := dbWebhook.Query(`
+		UPDATE webhook_deliveries d
+		   SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		  FROM webhook_subscriptions s
+		 WHERE s.id = d.subscription_id
+		   AND d.id IN (
+		       SELECT id
+		         FROM webhook_deliveries
+		        WHERE status = 'pending'
+		          AND next_attempt_at <= CURRENT_TIMESTAMP
+		       ORDER BY next_attempt_at, id
+		       LIMIT $1
+		       FOR UPDATE SKIP LOCKED)
+		RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts, d.created_at, s.url, s.secret
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to claim webhook deliveries", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Payload, &delivery.Attempts, &delivery.CreatedAt, &delivery.URL, &delivery.Secret); err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan webhook delivery", err, http.StatusInternalServerError)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("rows error", err, http.StatusInternalServerError)
+	}
+	return deliveries, models.NewEmptyHttpError()
+}
+
+// RecordWebhookDelivery stores the outcome of an attempt to send a claimed delivery.
+// A delivery that failed maxAttempts times is moved to the dead-letter list.
+func RecordWebhookDelivery(delivery models.WebhookDelivery, statusCode int, deliverErr error, maxAttempts int, retryDelay func(attempts int) time.Duration) models.HttpError {
+	lastStatusCode := sql.NullInt64{Int64: int64(statusCode), Valid: statusCode != 0}
+	attempts := delivery.Attempts + 1
+	var err error
+	switch {
+	case deliverErr == nil:
+		_, err = dbWebhook.Exec(`
+			UPDATE webhook_deliveries
+			   SET status = 'succeeded', attempts = $2, last_status_code = $3, last_error = NULL,
+			       delivered_at = CURRENT_TIMESTAMP, next_attempt_at = NULL
+			 WHERE id = $1
+		`, delivery.ID, attempts, lastStatusCode)
+	case attempts >= maxAttempts:
+		_, err = dbWebhook.Exec(`
+			UPDATE webhook_deliveries
+			   SET status = 'dead', attempts = $2, last_status_code = $3, last_error = $4, next_attempt_at = NULL
+			 WHERE id = $1
+		`, delivery.ID, attempts, lastStatusCode, deliverErr.Error())
+	default:
+		_, err = dbWebhook.Exec(`
+			UPDATE webhook_deliveries
+			   SET attempts = $2, last_status_code = $3, last_error = $4,
+			       next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $5)
+			 WHERE id = $1
+		`, delivery.ID, attempts, lastStatusCode, deliverErr.Error(), retryDelay(attempts).Seconds())
+	}
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to update webhook delivery", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
+
+// GetWebhookDeliveries returns the delivery log of a subscription, newest first, optionally filtered by status
+func GetWebhookDeliveries(subscriptionId int, status string, limit int) ([]models.WebhookDelivery, models.HttpError) {
+	rows, err := dbWebhook.Query(`
+		SELECT id, subscription_id, event_id, event_type, payload, status, attempts, last_status_code, last_error,
+		       created_at, next_attempt_at, delivered_at
+		  FROM webhook_deliveries
+		 WHERE subscription_id = $1
+		   AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`, subscriptionId, status, limit)
+	if err != nil {
+		return nil, models.NewHttpErrorFromError("failed to query webhook deliveries", err, http.StatusInternalServerError)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var lastStatusCode sql.NullInt64
+		var lastError sql.NullString
+		var nextAttemptAt, deliveredAt sql.NullTime
+		if err := rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Payload,
+			&delivery.Status, &delivery.Attempts, &lastStatusCode, &lastError, &delivery.CreatedAt, &nextAttemptAt, &deliveredAt); err != nil {
+			return nil, models.NewHttpErrorFromError("failed to scan webhook delivery", err, http.StatusInternalServerError)
+		}
+		if lastStatusCode.Valid {
+			code := int(lastStatusCode.Int64)
+			delivery.LastStatusCode = &code
+		}
+		if lastError.Valid {
+			delivery.LastError = &lastError.String
+		}
+		if nextAttemptAt.Valid {
+			delivery.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, models.NewHttpErrorFromError("failed to iterate over webhook deliveries", err, http.StatusInternalServerError)
+	}
+	return deliveries, models.NewEmptyHttpError()
+}
+
+// RedeliverWebhook queues a delivery again, whatever its current status, with a fresh set of attempts.
+// The audit entry targets the subscription and holds the delivery's status and attempts before and after.
+func RedeliverWebhook(subscriptionId int, deliveryId int64, actor models.Actor) models.HttpError {
+	ctx := context.Background()
+	tx, err := dbWebhook.BeginTx(ctx, nil)
+	if err != nil {
+		return models.NewHttpErrorFromError("failed to begin transaction", err, http.StatusInternalServerError)
+	}
+
+	before := models.WebhookDelivery{ID: deliveryId, SubscriptionID: subscriptionId}
+	err = tx.QueryRowContext(ctx, `
+		SELECT event_id, event_type, status, attempts
+		  FROM webhook_deliveries
+		 WHERE id = $1 AND subscription_id = $2
+		FOR UPDATE
+	`, deliveryId, subscriptionId).Scan(&before.EventID, &before.EventType, &before.Status, &before.Attempts)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.NewHttpError(fmt.Sprintf("delivery with ID %d not found for webhook with ID %d", deliveryId, subscriptionId), http.StatusNotFound)
+		}
+		return models.NewHttpErrorFromError("failed to get webhook delivery", err, http.StatusInternalServerError)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		   SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		 WHERE id = $1
+	`, deliveryId)
+	if err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to queue redelivery", err, http.StatusInternalServerError)
+	}
+
+	after := before
+	after.Status = models.DeliveryPending
+	after.Attempts = 0
+	if err := insertAuditWithTx(tx, actor, models.AuditWebhookRedeliver, models.AggregateWebhook, subscriptionId, before, after); err != nil {
+		_ = tx.Rollback()
+		return models.NewHttpErrorFromError("failed to record audit entry", err, http.StatusInternalServerError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.NewHttpErrorFromError("failed to commit transaction", err, http.StatusInternalServerError)
+	}
+	return models.NewEmptyHttpError()
+}
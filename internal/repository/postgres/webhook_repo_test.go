@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"errors"
+	"github.com/spin311/library-api/internal/repository/models"
+	"testing"
+	"time"
+)
+
+func TestRecordWebhookDelivery(t *testing.T) {
+	db := testDB(t)
+	SetWebhookDB(db)
+	SetAuditDB(db)
+
+	eventType := "TestEvent" + time.Now().Format("150405.000000000")
+	subscription, httpErr := InsertWebhookSubscription(models.WebhookSubscription{
+		URL:        "https://partner.example.com/hooks",
+		EventTypes: []string{eventType},
+		Secret:     "secret",
+	}, models.Actor{Name: models.AnonymousActor})
+	if !models.IsHttpErrorEmpty(httpErr) {
+		t.Fatal(httpErr)
+	}
+	if httpErr := EnqueueWebhookDeliveries(models.Event{ID: 1, Type: eventType}); !models.IsHttpErrorEmpty(httpErr) {
+		t.Fatal(httpErr)
+	}
+
+	delivery := func() models.WebhookDelivery {
+		t.Helper()
+		deliveries, httpErr := GetWebhookDeliveries(subscription.ID, "", 10)
+		if !models.IsHttpErrorEmpty(httpErr) {
+			t.Fatal(httpErr)
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("got %d deliveries, want 1", len(deliveries))
+		}
+		return deliveries[0]
+	}
+	retryDelay := func(int) time.Duration { return time.Hour }
+	const maxAttempts = 2
+
+	tests := []struct {
+		name       string
+		statusCode int
+		err        error
+		status     string
+		attempts   int
+	}{
+		{"failure is retried", 500, errors.New("receiver answered with status 500"), models.DeliveryPending, 1},
+		{"last attempt goes to the dead-letter list", 0, errors.New("connection refused"), models.DeliveryDead, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if httpErr := RecordWebhookDelivery(delivery(), tt.statusCode, tt.err, maxAttempts, retryDelay); !models.IsHttpErrorEmpty(httpErr) {
+				t.Fatal(httpErr)
+			}
+			got := delivery()
+			if got.Status != tt.status || got.Attempts != tt.attempts {
+				t.Errorf("got status %s after %d attempts, want %s after %d", got.Status, got.Attempts, tt.status, tt.attempts)
+			}
+			if got.LastError == nil || *got.LastError != tt.err.Error() {
+				t.Errorf("last error = %v, want %q", got.LastError, tt.err)
+			}
+			if tt.status == models.DeliveryPending && (got.NextAttemptAt == nil || time.Until(*got.NextAttemptAt) < 30*time.Minute) {
+				t.Errorf("next attempt at %v, want about an hour from now", got.NextAttemptAt)
+			}
+		})
+	}
+
+	t.Run("redelivery succeeds", func(t *testing.T) {
+		if httpErr := RedeliverWebhook(subscription.ID, delivery().ID, models.Actor{Name: models.AnonymousActor}); !models.IsHttpErrorEmpty(httpErr) {
+			t.Fatal(httpErr)
+		}
+		var audited int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = $1 AND target_id = $2`, models.AuditWebhookRedeliver, subscription.ID).Scan(&audited); err != nil {
+			t.Fatal(err)
+		}
+		if audited != 1 {
+			t.Errorf("got %d redelivery audit entries, want 1", audited)
+		}
+		redelivered := delivery()
+		if redelivered.Status != models.DeliveryPending || redelivered.Attempts != 0 {
+			t.Fatalf("got status %s after %d attempts, want a fresh pending delivery", redelivered.Status, redelivered.Attempts)
+		}
+		if httpErr := RecordWebhookDelivery(redelivered, 204, nil, maxAttempts, retryDelay); !models.IsHttpErrorEmpty(httpErr) {
+			t.Fatal(httpErr)
+		}
+		got := delivery()
+		if got.Status != models.DeliverySucceeded || got.DeliveredAt == nil || got.LastStatusCode == nil || *got.LastStatusCode != 204 {
+			t.Errorf("got %+v, want a succeeded delivery with status code 204", got)
+		}
+	})
+}
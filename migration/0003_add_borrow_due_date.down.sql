@@ -0,0 +1,2 @@
+ALTER TABLE BORROW
+    DROP COLUMN IF EXISTS DUE_AT;
@@ -0,0 +1,4 @@
+ALTER TABLE BORROW
+    ADD COLUMN DUE_AT TIMESTAMP;
+
+UPDATE BORROW SET DUE_AT = BORROWED_AT + INTERVAL '21 days' WHERE DUE_AT IS NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE IDEMPOTENCY_KEYS (
+                        IDEMPOTENCY_KEY VARCHAR(255) PRIMARY KEY,
+                        FINGERPRINT CHAR(64) NOT NULL,
+                        STATUS_CODE INT,
+                        CONTENT_TYPE VARCHAR(255),
+                        RESPONSE_BODY BYTEA,
+                        CREATED_AT TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        EXPIRES_AT TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IDX_IDEMPOTENCY_KEYS_EXPIRES_AT ON IDEMPOTENCY_KEYS (EXPIRES_AT);
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS USERS_INCREMENT_VERSION ON USERS;
+DROP TRIGGER IF EXISTS BOOKS_INCREMENT_VERSION ON BOOKS;
+DROP FUNCTION IF EXISTS INCREMENT_VERSION();
+
+ALTER TABLE USERS
+    DROP COLUMN IF EXISTS VERSION;
+
+ALTER TABLE BOOKS
+    DROP COLUMN IF EXISTS VERSION;
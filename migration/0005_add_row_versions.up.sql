@@ -0,0 +1,21 @@
+ALTER TABLE BOOKS
+    ADD COLUMN VERSION INT NOT NULL DEFAULT 1;
+
+ALTER TABLE USERS
+    ADD COLUMN VERSION INT NOT NULL DEFAULT 1;
+
+-- bump the version on every update, including manual edits made directly in SQL
+CREATE OR REPLACE FUNCTION INCREMENT_VERSION() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.VERSION := OLD.VERSION + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER BOOKS_INCREMENT_VERSION
+    BEFORE UPDATE ON BOOKS
+    FOR EACH ROW EXECUTE FUNCTION INCREMENT_VERSION();
+
+CREATE TRIGGER USERS_INCREMENT_VERSION
+    BEFORE UPDATE ON USERS
+    FOR EACH ROW EXECUTE FUNCTION INCREMENT_VERSION();
@@ -0,0 +1,14 @@
+CREATE TABLE OUTBOX (
+                        id BIGSERIAL PRIMARY KEY,
+                        EVENT_TYPE VARCHAR(100) NOT NULL,
+                        AGGREGATE_TYPE VARCHAR(50) NOT NULL,
+                        AGGREGATE_ID INT NOT NULL,
+                        PAYLOAD JSONB NOT NULL,
+                        CREATED_AT TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        ATTEMPTS INT NOT NULL DEFAULT 0,
+                        NEXT_ATTEMPT_AT TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        LAST_ERROR TEXT,
+                        PUBLISHED_AT TIMESTAMP
+);
+
+CREATE INDEX IDX_OUTBOX_PENDING ON OUTBOX (NEXT_ATTEMPT_AT, id) WHERE PUBLISHED_AT IS NULL;
@@ -0,0 +1,26 @@
+CREATE TABLE WEBHOOK_SUBSCRIPTIONS (
+                        id SERIAL PRIMARY KEY,
+                        URL VARCHAR(2048) NOT NULL,
+                        EVENT_TYPES TEXT[] NOT NULL,
+                        SECRET VARCHAR(255) NOT NULL,
+                        ACTIVE BOOLEAN NOT NULL DEFAULT TRUE,
+                        CREATED_AT TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE WEBHOOK_DELIVERIES (
+                        id BIGSERIAL PRIMARY KEY,
+                        SUBSCRIPTION_ID INT NOT NULL REFERENCES WEBHOOK_SUBSCRIPTIONS(id) ON DELETE CASCADE,
+                        EVENT_ID BIGINT NOT NULL,
+                        EVENT_TYPE VARCHAR(100) NOT NULL,
+                        PAYLOAD JSONB NOT NULL,
+                        STATUS VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (STATUS IN ('pending', 'succeeded', 'dead')),
+                        ATTEMPTS INT NOT NULL DEFAULT 0,
+                        NEXT_ATTEMPT_AT TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        LAST_STATUS_CODE INT,
+                        LAST_ERROR TEXT,
+                        CREATED_AT TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        DELIVERED_AT TIMESTAMP,
+                        UNIQUE (SUBSCRIPTION_ID, EVENT_ID)
+);
+
+CREATE INDEX IDX_WEBHOOK_DELIVERIES_PENDING ON WEBHOOK_DELIVERIES (NEXT_ATTEMPT_AT, id) WHERE STATUS = 'pending';
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS NOTIFICATIONS;
+
+ALTER TABLE USERS
+    DROP COLUMN IF EXISTS NOTIFY_SMS,
+    DROP COLUMN IF EXISTS NOTIFY_EMAIL,
+    DROP COLUMN IF EXISTS LOCALE,
+    DROP COLUMN IF EXISTS PHONE,
+    DROP COLUMN IF EXISTS EMAIL;
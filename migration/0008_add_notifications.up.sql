@@ -0,0 +1,24 @@
+ALTER TABLE USERS
+    ADD COLUMN EMAIL VARCHAR(255),
+    ADD COLUMN PHONE VARCHAR(32),
+    ADD COLUMN LOCALE VARCHAR(10) NOT NULL DEFAULT 'en',
+    ADD COLUMN NOTIFY_EMAIL BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN NOTIFY_SMS BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE NOTIFICATIONS (
+                        id BIGSERIAL PRIMARY KEY,
+                        USER_ID INT NOT NULL REFERENCES USERS(id),
+                        BORROW_ID INT REFERENCES BORROW(id),
+                        KIND VARCHAR(30) NOT NULL,
+                        CHANNEL VARCHAR(20) NOT NULL,
+                        RECIPIENT VARCHAR(255) NOT NULL,
+                        SUBJECT VARCHAR(255) NOT NULL,
+                        BODY TEXT NOT NULL,
+                        STATUS VARCHAR(20) NOT NULL CHECK (STATUS IN ('sent', 'failed')),
+                        ERROR TEXT,
+                        CREATED_AT TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a loan gets each kind of notice at most once per channel, failed attempts are retried
+CREATE UNIQUE INDEX UQ_NOTIFICATIONS_SENT ON NOTIFICATIONS (BORROW_ID, KIND, CHANNEL) WHERE STATUS = 'sent';
+CREATE INDEX IDX_NOTIFICATIONS_USER_ID ON NOTIFICATIONS (USER_ID);
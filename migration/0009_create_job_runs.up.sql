@@ -0,0 +1,19 @@
+CREATE TABLE JOB_RUNS (
+                        id BIGSERIAL PRIMARY KEY,
+                        JOB_NAME VARCHAR(100) NOT NULL,
+                        TRIGGERED_BY VARCHAR(20) NOT NULL CHECK (TRIGGERED_BY IN ('schedule', 'manual')),
+                        STATUS VARCHAR(20) NOT NULL CHECK (STATUS IN ('queued', 'running', 'succeeded', 'failed')),
+                        SCHEDULED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                        STARTED_AT TIMESTAMP,
+                        FINISHED_AT TIMESTAMP,
+                        DURATION_MS BIGINT,
+                        MESSAGE TEXT,
+                        ERROR TEXT,
+                        INSTANCE VARCHAR(255)
+);
+
+-- a scheduled slot runs once even if leadership changes hands around it
+CREATE UNIQUE INDEX UQ_JOB_RUNS_SCHEDULED ON JOB_RUNS (JOB_NAME, SCHEDULED_AT) WHERE TRIGGERED_BY = 'schedule';
+-- triggering a job that is already waiting to run returns the waiting run
+CREATE UNIQUE INDEX UQ_JOB_RUNS_QUEUED ON JOB_RUNS (JOB_NAME) WHERE STATUS = 'queued';
+CREATE INDEX IDX_JOB_RUNS_JOB_NAME ON JOB_RUNS (JOB_NAME, id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS AUDIT_LOG;
+DROP FUNCTION IF EXISTS REJECT_AUDIT_LOG_CHANGE();
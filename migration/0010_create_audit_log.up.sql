@@ -0,0 +1,31 @@
+CREATE TABLE AUDIT_LOG (
+                        id BIGSERIAL PRIMARY KEY,
+                        OCCURRED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                        ACTOR VARCHAR(255) NOT NULL,
+                        ACTION VARCHAR(50) NOT NULL,
+                        TARGET_TYPE VARCHAR(30) NOT NULL,
+                        TARGET_ID INT NOT NULL,
+                        BEFORE_STATE JSONB,
+                        AFTER_STATE JSONB,
+                        REQUEST_ID VARCHAR(128),
+                        CLIENT_IP VARCHAR(64)
+);
+
+CREATE INDEX IDX_AUDIT_LOG_TARGET ON AUDIT_LOG (TARGET_TYPE, TARGET_ID);
+CREATE INDEX IDX_AUDIT_LOG_ACTOR ON AUDIT_LOG (ACTOR);
+CREATE INDEX IDX_AUDIT_LOG_OCCURRED_AT ON AUDIT_LOG (OCCURRED_AT);
+
+-- the audit log is append-only, entries can neither be changed nor removed
+CREATE FUNCTION REJECT_AUDIT_LOG_CHANGE() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER AUDIT_LOG_APPEND_ONLY
+    BEFORE UPDATE OR DELETE ON AUDIT_LOG
+    FOR EACH ROW EXECUTE FUNCTION REJECT_AUDIT_LOG_CHANGE();
+
+CREATE TRIGGER AUDIT_LOG_NO_TRUNCATE
+    BEFORE TRUNCATE ON AUDIT_LOG
+    FOR EACH STATEMENT EXECUTE FUNCTION REJECT_AUDIT_LOG_CHANGE();
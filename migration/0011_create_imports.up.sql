@@ -0,0 +1,22 @@
+CREATE TABLE IMPORTS (
+                        id BIGSERIAL PRIMARY KEY,
+                        KIND VARCHAR(20) NOT NULL CHECK (KIND IN ('books', 'users')),
+                        FORMAT VARCHAR(20) NOT NULL,
+                        DRY_RUN BOOLEAN NOT NULL DEFAULT FALSE,
+                        STATUS VARCHAR(20) NOT NULL CHECK (STATUS IN ('pending', 'running', 'completed', 'failed')),
+                        TOTAL_ROWS INT NOT NULL DEFAULT 0,
+                        PROCESSED_ROWS INT NOT NULL DEFAULT 0,
+                        ERROR_COUNT INT NOT NULL DEFAULT 0,
+                        ERRORS JSONB,
+                        ERROR TEXT,
+                        -- the uploaded file, kept until an asynchronous import finishes so another instance can resume it
+                        PAYLOAD BYTEA,
+                        ACTOR VARCHAR(255) NOT NULL,
+                        REQUEST_ID VARCHAR(128),
+                        CLIENT_IP VARCHAR(64),
+                        CREATED_AT TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        UPDATED_AT TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        FINISHED_AT TIMESTAMP
+);
+
+CREATE INDEX IDX_IMPORTS_ACTIVE ON IMPORTS (id) WHERE STATUS IN ('pending', 'running');
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS IDX_BOOKS_ISBN;
+
+ALTER TABLE BOOKS
+    DROP COLUMN IF EXISTS SUBJECTS,
+    DROP COLUMN IF EXISTS PUBLICATION_DATE,
+    DROP COLUMN IF EXISTS PUBLISHER,
+    DROP COLUMN IF EXISTS AUTHORS,
+    DROP COLUMN IF EXISTS ISBN,
+    ALTER COLUMN TITLE TYPE VARCHAR(50) USING LEFT(TITLE, 50);
@@ -0,0 +1,10 @@
+-- bibliographic fields exchanged as MARC records, catalog titles are often longer than 50 characters
+ALTER TABLE BOOKS
+    ALTER COLUMN TITLE TYPE VARCHAR(255),
+    ADD COLUMN ISBN VARCHAR(13),
+    ADD COLUMN AUTHORS TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN PUBLISHER VARCHAR(255),
+    ADD COLUMN PUBLICATION_DATE VARCHAR(32),
+    ADD COLUMN SUBJECTS TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IDX_BOOKS_ISBN ON BOOKS (ISBN);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS IDX_BOOKS_SUBJECTS;
+DROP INDEX IF EXISTS IDX_BOOKS_AUTHORS;
+DROP INDEX IF EXISTS IDX_BOOKS_CREATED_AT;
+
+ALTER TABLE BOOKS
+    DROP COLUMN IF EXISTS CREATED_AT;
@@ -0,0 +1,7 @@
+-- when a book was added to the catalog, orders the new arrivals feed; existing books get the migration time
+ALTER TABLE BOOKS
+    ADD COLUMN CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IDX_BOOKS_CREATED_AT ON BOOKS (CREATED_AT DESC, ID DESC);
+CREATE INDEX IDX_BOOKS_AUTHORS ON BOOKS USING GIN (AUTHORS);
+CREATE INDEX IDX_BOOKS_SUBJECTS ON BOOKS USING GIN (SUBJECTS);
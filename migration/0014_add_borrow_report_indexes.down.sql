@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS IDX_BORROW_RETURNED_AT;
+DROP INDEX IF EXISTS IDX_BORROW_BORROWED_AT;
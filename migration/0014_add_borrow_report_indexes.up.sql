@@ -0,0 +1,3 @@
+-- circulation reports select borrows by when they were borrowed or returned
+CREATE INDEX IDX_BORROW_BORROWED_AT ON BORROW (BORROWED_AT);
+CREATE INDEX IDX_BORROW_RETURNED_AT ON BORROW (RETURNED_AT);
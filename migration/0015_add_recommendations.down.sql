@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS IDX_BORROW_USER_ID_BOOK_ID;
+DROP TABLE IF EXISTS RECOMMENDATION_STATE;
+DROP TABLE IF EXISTS BOOK_CO_BORROWS;
+DROP TABLE IF EXISTS BOOK_READERS;
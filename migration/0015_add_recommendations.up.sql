@@ -0,0 +1,22 @@
+-- number of patrons who borrowed each book, counting every patron once
+CREATE TABLE BOOK_READERS (
+                        BOOK_ID INT PRIMARY KEY REFERENCES BOOKS(id) ON DELETE CASCADE,
+                        READERS INT NOT NULL CHECK (READERS > 0)
+);
+
+-- number of patrons who borrowed both books, every pair is stored in both directions
+CREATE TABLE BOOK_CO_BORROWS (
+                        BOOK_ID INT NOT NULL REFERENCES BOOKS(id) ON DELETE CASCADE,
+                        OTHER_BOOK_ID INT NOT NULL REFERENCES BOOKS(id) ON DELETE CASCADE,
+                        READERS INT NOT NULL CHECK (READERS > 0),
+                        PRIMARY KEY (BOOK_ID, OTHER_BOOK_ID)
+);
+
+-- the last borrow counted into the tables above
+CREATE TABLE RECOMMENDATION_STATE (
+                        ID INT PRIMARY KEY CHECK (ID = 1),
+                        LAST_BORROW_ID INT NOT NULL,
+                        UPDATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IDX_BORROW_USER_ID_BOOK_ID ON BORROW (USER_ID, BOOK_ID);
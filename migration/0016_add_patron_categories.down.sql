@@ -0,0 +1,9 @@
+ALTER TABLE BORROW
+    DROP COLUMN IF EXISTS RENEWALS;
+
+ALTER TABLE BOOKS
+    DROP COLUMN IF EXISTS AGE_RATING,
+    DROP COLUMN IF EXISTS REFERENCE_ONLY;
+
+ALTER TABLE USERS
+    DROP COLUMN IF EXISTS CATEGORY;
@@ -0,0 +1,12 @@
+-- the patron category selects the loan limits, loan period and renewals of a user
+ALTER TABLE USERS
+    ADD COLUMN CATEGORY VARCHAR(20) NOT NULL DEFAULT 'adult'
+        CHECK (CATEGORY IN ('child', 'adult', 'staff', 'institutional'));
+
+-- reference-only books are only lent to categories allowed to borrow them, AGE_RATING is the minimum age, 0 for none
+ALTER TABLE BOOKS
+    ADD COLUMN REFERENCE_ONLY BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN AGE_RATING INT NOT NULL DEFAULT 0 CHECK (AGE_RATING BETWEEN 0 AND 21);
+
+ALTER TABLE BORROW
+    ADD COLUMN RENEWALS INT NOT NULL DEFAULT 0 CHECK (RENEWALS >= 0);
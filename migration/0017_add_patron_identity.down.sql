@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS REVOKED_CARDS;
+
+ALTER TABLE USERS
+    DROP CONSTRAINT IF EXISTS CHK_USERS_MEMBERSHIP,
+    DROP COLUMN IF EXISTS MEMBERSHIP_EXPIRES,
+    DROP COLUMN IF EXISTS MEMBERSHIP_STARTS,
+    DROP COLUMN IF EXISTS ADDRESS,
+    DROP COLUMN IF EXISTS DATE_OF_BIRTH,
+    DROP COLUMN IF EXISTS CARD_NUMBER,
+    ALTER COLUMN LAST_NAME TYPE VARCHAR(50) USING LEFT(LAST_NAME, 50),
+    ALTER COLUMN FIRST_NAME TYPE VARCHAR(50) USING LEFT(FIRST_NAME, 50);
+
+DROP FUNCTION IF EXISTS LIBRARY_CARD_NUMBER();
+DROP SEQUENCE IF EXISTS LIBRARY_CARD_SEQ;
@@ -0,0 +1,42 @@
+-- library card numbers are 14 digits: a leading 2, a 12 digit serial and a Luhn check digit
+CREATE SEQUENCE LIBRARY_CARD_SEQ;
+
+CREATE FUNCTION LIBRARY_CARD_NUMBER() RETURNS VARCHAR(14) AS $$
+DECLARE
+    payload TEXT := '2' || LPAD(NEXTVAL('library_card_seq')::TEXT, 12, '0');
+    total INT := 0;
+    digit INT;
+BEGIN
+    -- double every second digit counting from the right of the payload, starting with the last one
+    FOR i IN 1..LENGTH(payload) LOOP
+        digit := SUBSTR(payload, LENGTH(payload) - i + 1, 1)::INT;
+        IF i % 2 = 1 THEN
+            digit := digit * 2;
+            IF digit > 9 THEN
+                digit := digit - 9;
+            END IF;
+        END IF;
+        total := total + digit;
+    END LOOP;
+    RETURN payload || ((10 - total % 10) % 10)::TEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- names from other systems are often longer than 50 characters, existing users get a card number each
+ALTER TABLE USERS
+    ALTER COLUMN FIRST_NAME TYPE VARCHAR(100),
+    ALTER COLUMN LAST_NAME TYPE VARCHAR(100),
+    ADD COLUMN CARD_NUMBER VARCHAR(14) NOT NULL DEFAULT LIBRARY_CARD_NUMBER(),
+    ADD COLUMN DATE_OF_BIRTH DATE,
+    ADD COLUMN ADDRESS VARCHAR(500),
+    ADD COLUMN MEMBERSHIP_STARTS DATE NOT NULL DEFAULT CURRENT_DATE,
+    ADD COLUMN MEMBERSHIP_EXPIRES DATE,
+    ADD CONSTRAINT UQ_USERS_CARD_NUMBER UNIQUE (CARD_NUMBER),
+    ADD CONSTRAINT CHK_USERS_MEMBERSHIP CHECK (MEMBERSHIP_EXPIRES IS NULL OR MEMBERSHIP_EXPIRES >= MEMBERSHIP_STARTS);
+
+-- numbers of replaced cards, they are never issued again
+CREATE TABLE REVOKED_CARDS (
+                        CARD_NUMBER VARCHAR(14) PRIMARY KEY,
+                        USER_ID INT NOT NULL REFERENCES USERS(id) ON DELETE CASCADE,
+                        REVOKED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS CHARGES;
+
+ALTER TABLE BORROW
+    DROP CONSTRAINT IF EXISTS CHK_BORROW_FOUND,
+    DROP COLUMN IF EXISTS DAMAGED,
+    DROP COLUMN IF EXISTS FOUND_AT,
+    DROP COLUMN IF EXISTS LOST_AT;
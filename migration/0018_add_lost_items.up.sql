@@ -0,0 +1,21 @@
+-- a lost loan is closed when it is reported lost, FOUND_AT is set when the copy turns up again.
+-- DAMAGED marks a copy returned damaged, like a lost copy it is withdrawn from the stock
+ALTER TABLE BORROW
+    ADD COLUMN LOST_AT TIMESTAMP,
+    ADD COLUMN FOUND_AT TIMESTAMP,
+    ADD COLUMN DAMAGED BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD CONSTRAINT CHK_BORROW_FOUND CHECK (FOUND_AT IS NULL OR LOST_AT IS NOT NULL);
+
+-- replacement fees charged to patrons, AMOUNT is in cents. A charge is waived when a lost copy is found.
+CREATE TABLE CHARGES (
+                        id SERIAL PRIMARY KEY,
+                        USER_ID INT NOT NULL REFERENCES USERS(id) ON DELETE CASCADE,
+                        BORROW_ID INT NOT NULL REFERENCES BORROW(id) ON DELETE CASCADE,
+                        REASON VARCHAR(20) NOT NULL CHECK (REASON IN ('lost', 'damaged')),
+                        AMOUNT INT NOT NULL CHECK (AMOUNT > 0),
+                        CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                        WAIVED_AT TIMESTAMPTZ,
+                        CONSTRAINT UQ_CHARGES_BORROW_REASON UNIQUE (BORROW_ID, REASON)
+);
+
+CREATE INDEX IDX_CHARGES_USER_ID ON CHARGES (USER_ID, CREATED_AT);
@@ -0,0 +1,3 @@
+ALTER TABLE IDEMPOTENCY_KEYS
+    DROP COLUMN IF EXISTS LEASE_EXPIRES_AT,
+    DROP COLUMN IF EXISTS OWNER;
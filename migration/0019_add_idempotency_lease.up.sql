@@ -0,0 +1,9 @@
+-- an unfinished reservation belongs to the instance running the request, which renews the lease while it runs.
+-- Only a reservation whose lease ran out, because its instance stopped, can be taken over by a retry.
+ALTER TABLE IDEMPOTENCY_KEYS
+    ADD COLUMN OWNER VARCHAR(255),
+    ADD COLUMN LEASE_EXPIRES_AT TIMESTAMP;
+
+UPDATE IDEMPOTENCY_KEYS
+   SET LEASE_EXPIRES_AT = CREATED_AT + INTERVAL '1 minute'
+ WHERE STATUS_CODE IS NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS IDX_OUTBOX_PENDING;
+CREATE INDEX IDX_OUTBOX_PENDING ON OUTBOX (NEXT_ATTEMPT_AT, id) WHERE PUBLISHED_AT IS NULL;
+
+ALTER TABLE OUTBOX
+    DROP COLUMN IF EXISTS DEAD_AT,
+    DROP COLUMN IF EXISTS PUBLISHED_TO;
@@ -0,0 +1,8 @@
+-- PUBLISHED_TO lists the publishers an event already reached, a retry only goes to the others.
+-- An event that failed events.max_attempts times is given up on and marked DEAD_AT.
+ALTER TABLE OUTBOX
+    ADD COLUMN PUBLISHED_TO TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN DEAD_AT TIMESTAMP;
+
+DROP INDEX IF EXISTS IDX_OUTBOX_PENDING;
+CREATE INDEX IDX_OUTBOX_PENDING ON OUTBOX (NEXT_ATTEMPT_AT, id) WHERE PUBLISHED_AT IS NULL AND DEAD_AT IS NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS IDX_NOTIFICATIONS_ATTEMPTS;
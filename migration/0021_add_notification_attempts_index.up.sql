@@ -0,0 +1,2 @@
+-- the notifications job counts earlier attempts per loan, kind and channel to decide whether to retry
+CREATE INDEX IDX_NOTIFICATIONS_ATTEMPTS ON NOTIFICATIONS (BORROW_ID, KIND, CHANNEL);
@@ -0,0 +1,5 @@
+ALTER TABLE IMPORTS
+    DROP COLUMN IF EXISTS CLAIMED_ACTOR;
+
+ALTER TABLE AUDIT_LOG
+    DROP COLUMN IF EXISTS CLAIMED_ACTOR;
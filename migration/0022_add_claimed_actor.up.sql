@@ -0,0 +1,6 @@
+-- X-Actor is chosen freely by the client, it is kept next to the actor as a claim and never used as the actor itself
+ALTER TABLE AUDIT_LOG
+    ADD COLUMN CLAIMED_ACTOR VARCHAR(255);
+
+ALTER TABLE IMPORTS
+    ADD COLUMN CLAIMED_ACTOR VARCHAR(255);
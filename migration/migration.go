@@ -0,0 +1,152 @@
+// Package migration embeds the SQL migrations so the binary can apply them without the external migrate CLI.
+// Versions are tracked in the same schema_migrations table the migrate CLI uses, so both can be mixed.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Info describes a single embedded migration and whether it has been applied
+type Info struct {
+	Version uint
+	Name    string
+	Applied bool
+}
+
+// run opens a migrate instance on a dedicated connection and closes it afterwards without closing db.
+// The postgres driver takes a pg_advisory_lock around every operation, so replicas starting
+// together wait for each other instead of applying the same migration twice.
+func run(db *sql.DB, fn func(m *migrate.Migrate) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to initialize migration driver: %w", err)
+	}
+	source, err := iofs.New(files, ".")
+	if err != nil {
+		_ = driver.Close()
+		return fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		_ = driver.Close()
+		return fmt.Errorf("failed to initialize migrations: %w", err)
+	}
+	m.Log = logger{}
+	defer func(m *migrate.Migrate) {
+		sourceErr, dbErr := m.Close()
+		if sourceErr != nil || dbErr != nil {
+			log.Printf("failed to close migrations: source: %v, database: %v", sourceErr, dbErr)
+		}
+	}(m)
+
+	return fn(m)
+}
+
+// Up applies all pending migrations
+func Up(db *sql.DB) error {
+	return run(db, func(m *migrate.Migrate) error {
+		err := m.Up()
+		if errors.Is(err, migrate.ErrNoChange) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Down rolls back the given number of applied migrations
+func Down(db *sql.DB, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	return run(db, func(m *migrate.Migrate) error {
+		return m.Steps(-steps)
+	})
+}
+
+// Version returns the currently applied version, 0 if none has been applied
+func Version(db *sql.DB) (uint, bool, error) {
+	var version uint
+	var dirty bool
+	err := run(db, func(m *migrate.Migrate) error {
+		var err error
+		version, dirty, err = m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return nil
+		}
+		return err
+	})
+	return version, dirty, err
+}
+
+// Status lists every embedded migration and whether it is applied
+func Status(db *sql.DB) ([]Info, bool, error) {
+	current, dirty, err := Version(db)
+	if err != nil {
+		return nil, false, err
+	}
+	migrations, err := list()
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range migrations {
+		migrations[i].Applied = migrations[i].Version <= current
+	}
+	return migrations, dirty, nil
+}
+
+func list() ([]Info, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Info
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".up.sql")
+		if !ok {
+			continue
+		}
+		versionPart, description, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(versionPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %s: %w", entry.Name(), err)
+		}
+		migrations = append(migrations, Info{Version: uint(version), Name: description})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+type logger struct{}
+
+func (logger) Printf(format string, v ...interface{}) {
+	log.Printf("migrate: "+format, v...)
+}
+
+func (logger) Verbose() bool {
+	return false
+}
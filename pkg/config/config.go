@@ -1,65 +1,825 @@
 package config
 
 import (
-	"database/sql"
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
-	"github.com/spin311/library-api/internal/repository/postgres"
-	"log"
+	"io"
+	"net/mail"
+	"net/netip"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/spin311/library-api/internal/app/helpers"
+	"github.com/spin311/library-api/internal/app/jobs"
+	"github.com/spin311/library-api/internal/repository/models"
+	"gopkg.in/yaml.v3"
 )
 
+// Config holds every setting the API needs at startup.
+// Values are merged in the following order, later sources overriding earlier ones:
+// built-in defaults, optional YAML config file, environment variables (and .env), command-line flags.
 type Config struct {
-	DbHost     string
-	DbPort     string
-	DbUser     string
-	DbPassword string
-	DbName     string
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	Loans         LoanConfig          `yaml:"loans"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
+	Idempotency   IdempotencyConfig   `yaml:"idempotency"`
+	Events        EventsConfig        `yaml:"events"`
+	Webhooks      WebhooksConfig      `yaml:"webhooks"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Jobs          JobsConfig          `yaml:"jobs"`
+	Imports       ImportsConfig       `yaml:"imports"`
+	GRPC          GRPCConfig          `yaml:"grpc"`
+	Availability  AvailabilityConfig  `yaml:"availability"`
 }
 
-func init() {
-	err := godotenv.Load()
+type ServerConfig struct {
+	Address         string        `yaml:"address"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	TLS             TLSConfig     `yaml:"tls"`
+	// TrustProxy takes the client IP from X-Forwarded-For, only enable it behind a reverse proxy
+	TrustProxy bool `yaml:"trust_proxy"`
+}
+
+type DatabaseConfig struct {
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	Name            string        `yaml:"name"`
+	SSLMode         string        `yaml:"sslmode"`
+	SSLRootCert     string        `yaml:"sslrootcert"`
+	SSLCert         string        `yaml:"sslcert"`
+	SSLKey          string        `yaml:"sslkey"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	// AutoMigrate applies pending embedded migrations before the server starts
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// LoanConfig holds the circulation rules applied when a book is borrowed.
+type LoanConfig struct {
+	// PeriodDays is the number of days a book may be kept before it is overdue, for categories without their own
+	PeriodDays int `yaml:"period_days"`
+	// MaxActive caps the open loans of every user on top of the category limits, 0 means no cap
+	MaxActive int `yaml:"max_active"`
+	// Categories holds the rules of each patron category, a category listed in the file replaces its defaults
+	Categories map[string]CategoryConfig `yaml:"categories"`
+	// ReplacementFee is charged in cents for a copy reported lost or returned damaged, 0 means no charge
+	ReplacementFee int `yaml:"replacement_fee"`
+}
+
+// CategoryConfig holds the circulation rules of a patron category
+type CategoryConfig struct {
+	// MaxActive is the maximum number of open loans, 0 means unlimited
+	MaxActive int `yaml:"max_active"`
+	// PeriodDays is the loan period and the extension of every renewal, 0 means loans.period_days
+	PeriodDays int `yaml:"period_days"`
+	// Renewals is the number of times a loan may be renewed
+	Renewals int `yaml:"renewals"`
+	// Reference allows borrowing reference-only books
+	Reference bool `yaml:"reference"`
+	// MaxAgeRating is the highest age rating the category may borrow, 0 means any
+	MaxAgeRating int `yaml:"max_age_rating"`
+}
+
+// RateLimitConfig configures the token bucket rate limiter.
+// Routes are keyed by method and path template, e.g. "POST /users/{userId}/books/{bookId}/borrow".
+type RateLimitConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	KeyBy   string `yaml:"key_by"`
+	// APIKeys are the X-API-Key values keyed by api_key, requests with any other key are counted by client
+	APIKeys []string        `yaml:"api_keys"`
+	Default RateLimit       `yaml:"default"`
+	Routes  RateLimitRoutes `yaml:"routes"`
+}
+
+// RateLimitRoutes are the per-route budgets. Routes in the config file replace the default routes
+// rather than being merged into them, so a default route can be dropped by leaving it out.
+type RateLimitRoutes map[string]RateLimit
+
+func (r *RateLimitRoutes) UnmarshalYAML(node *yaml.Node) error {
+	// node.Decode does not reject unknown fields, the routes go through a strict decoder like the rest of the file
+	raw, err := yaml.Marshal(node)
 	if err != nil {
-		log.Fatalf("Error loading .env file")
+		return err
+	}
+	routes := make(map[string]RateLimit)
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&routes); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("rate_limit.routes: %w", err)
 	}
+	*r = routes
+	return nil
 }
 
-func getConfig() *Config {
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Burst    int           `yaml:"burst"`
+	KeyBy    string        `yaml:"key_by"`
+}
 
-	return &Config{
-		DbHost:     os.Getenv("DBHOST"),
-		DbPort:     os.Getenv("DBPORT"),
-		DbUser:     os.Getenv("DBUSER"),
-		DbPassword: os.Getenv("DBPASSWORD"),
-		DbName:     os.Getenv("DBNAME"),
-	}
+// IdempotencyConfig configures how long responses to requests with an Idempotency-Key are kept for replay
+type IdempotencyConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+	// Lease is how long a request that is still running holds its key without renewing it.
+	// Only after it runs out, e.g. because the instance crashed, can a retry take the key over.
+	Lease time.Duration `yaml:"lease"`
 }
 
-func SetDbs(database *sql.DB) {
-	postgres.SetUserDB(database)
-	postgres.SetBookDB(database)
+// EventsConfig configures the relay that publishes domain events from the outbox table
+type EventsConfig struct {
+	RelayEnabled bool `yaml:"relay_enabled"`
+	// Publisher is log or webhook
+	Publisher      string        `yaml:"publisher"`
+	WebhookURL     string        `yaml:"webhook_url"`
+	WebhookTimeout time.Duration `yaml:"webhook_timeout"`
+	PollInterval   time.Duration `yaml:"poll_interval"`
+	BatchSize      int           `yaml:"batch_size"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	ClaimLease     time.Duration `yaml:"claim_lease"`
 }
 
-func InitDatabase() (*sql.DB, error) {
-	cfg := getConfig()
+// WebhooksConfig configures the dispatcher that sends signed deliveries to webhook subscriptions
+type WebhooksConfig struct {
+	DispatcherEnabled bool          `yaml:"dispatcher_enabled"`
+	Timeout           time.Duration `yaml:"timeout"`
+	PollInterval      time.Duration `yaml:"poll_interval"`
+	BatchSize         int           `yaml:"batch_size"`
+	// MaxAttempts is the number of attempts before a delivery is moved to the dead-letter list
+	MaxAttempts int           `yaml:"max_attempts"`
+	MaxBackoff  time.Duration `yaml:"max_backoff"`
+	ClaimLease  time.Duration `yaml:"claim_lease"`
+	// AllowedNetworks are private networks or addresses subscriptions may point to besides public addresses,
+	// e.g. 127.0.0.1 for a local receiver during development
+	AllowedNetworks []string `yaml:"allowed_networks"`
+}
+
+// OutboundPolicy returns the addresses webhooks may be sent to, public ones and AllowedNetworks.
+// Entries that do not parse are skipped, Validate reports them.
+func (w WebhooksConfig) OutboundPolicy() helpers.OutboundPolicy {
+	var policy helpers.OutboundPolicy
+	for _, network := range w.AllowedNetworks {
+		if prefix, err := parseNetwork(network); err == nil {
+			policy.Allowed = append(policy.Allowed, prefix)
+		}
+	}
+	return policy
+}
 
-	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbPassword, cfg.DbName)
-	db, err := sql.Open("postgres", psqlInfo)
+// parseNetwork parses a CIDR network or a single address
+func parseNetwork(network string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(network); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(network)
 	if err != nil {
-		return nil, err
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// NotificationsConfig configures the job that reminds patrons of due and overdue loans,
+// it runs on the notifications schedule in JobsConfig
+type NotificationsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// DueSoonDays is how many days before the due date the reminder is sent
+	DueSoonDays int `yaml:"due_soon_days"`
+	// DefaultLocale is used for patrons whose locale has no templates
+	DefaultLocale string `yaml:"default_locale"`
+	// MaxAttempts is how often a notice is tried per loan and channel, failed attempts are retried
+	// RetryBackoff after the first failure, doubling with every further one
+	MaxAttempts  int           `yaml:"max_attempts"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	SMTP         SMTPConfig    `yaml:"smtp"`
+	SMS          SMSConfig     `yaml:"sms"`
+}
+
+// SMTPConfig configures the email channel, it is disabled when Host is empty
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// SMSConfig configures the SMS gateway channel, it is disabled when URL is empty
+type SMSConfig struct {
+	URL     string        `yaml:"url"`
+	Token   string        `yaml:"token"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// JobsConfig configures the background job runner.
+// Every replica competes for a PostgreSQL advisory lock and only the holder runs jobs.
+type JobsConfig struct {
+	RunnerEnabled bool `yaml:"runner_enabled"`
+	// PollInterval is how often due jobs, manual triggers and leadership are checked
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// HistoryRetention is how long finished job runs are kept
+	HistoryRetention time.Duration `yaml:"history_retention"`
+	// Schedules maps job names to cron expressions, @hourly style descriptors or "@every <duration>"
+	Schedules map[string]string `yaml:"schedules"`
+}
+
+// ImportsConfig configures bulk imports of books and users
+type ImportsConfig struct {
+	// MaxBytes is the largest accepted upload
+	MaxBytes int `yaml:"max_bytes"`
+	// SyncRows is the largest import run within the request, larger ones are queued and run by a worker
+	SyncRows int `yaml:"sync_rows"`
+	// BatchSize is the number of rows a worker commits at a time
+	BatchSize     int           `yaml:"batch_size"`
+	WorkerEnabled bool          `yaml:"worker_enabled"`
+	PollInterval  time.Duration `yaml:"poll_interval"`
+	// StaleAfter is how long a running import may go without progress before another worker resumes it
+	StaleAfter time.Duration `yaml:"stale_after"`
+}
+
+// GRPCConfig configures the gRPC server for internal consumers.
+// It uses the TLS settings of the HTTP server, so client certificates identify callers the same way.
+type GRPCConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address"`
+}
+
+// AvailabilityConfig configures the Server-Sent Events streams of book availability
+type AvailabilityConfig struct {
+	// Notify sends updates through PostgreSQL LISTEN/NOTIFY so streams on every replica see borrows made on any of them
+	Notify bool `yaml:"notify"`
+	// Heartbeat is how often an idle stream sends a comment to keep proxies from closing it
+	Heartbeat time.Duration `yaml:"heartbeat"`
+	// MaxBooks is the largest number of books one stream may follow
+	MaxBooks int `yaml:"max_books"`
+}
+
+var validPublishers = []string{"log", "webhook"}
+
+var validKeyBy = []string{"ip", "api_key", "user"}
+
+var validSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Default returns the configuration used when no other source sets a value.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Address:         ":8080",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+			TLS: TLSConfig{
+				ClientAuth: "none",
+			},
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "disable",
+			ConnectTimeout:  5 * time.Second,
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Loans: LoanConfig{
+			PeriodDays:     21,
+			MaxActive:      0,
+			ReplacementFee: 2500,
+			Categories: map[string]CategoryConfig{
+				models.CategoryChild:         {MaxActive: 5, PeriodDays: 14, Renewals: 1, MaxAgeRating: 12},
+				models.CategoryAdult:         {MaxActive: 10, Renewals: 2},
+				models.CategoryStaff:         {MaxActive: 30, PeriodDays: 42, Renewals: 5, Reference: true},
+				models.CategoryInstitutional: {MaxActive: 50, PeriodDays: 60, Renewals: 3, Reference: true},
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			KeyBy:   "ip",
+			Default: RateLimit{Requests: 120, Period: time.Minute},
+			Routes: RateLimitRoutes{
+				"POST /users": {Requests: 10, Period: time.Minute},
+				"POST /users/{userId}/books/{bookId}/borrow": {Requests: 30, Period: time.Minute},
+			},
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:   24 * time.Hour,
+			Lease: 2 * time.Minute,
+		},
+		Events: EventsConfig{
+			RelayEnabled:   true,
+			Publisher:      "log",
+			WebhookTimeout: 10 * time.Second,
+			PollInterval:   2 * time.Second,
+			BatchSize:      100,
+			MaxAttempts:    20,
+			MaxBackoff:     10 * time.Minute,
+			ClaimLease:     5 * time.Minute,
+		},
+		Webhooks: WebhooksConfig{
+			DispatcherEnabled: true,
+			Timeout:           10 * time.Second,
+			PollInterval:      2 * time.Second,
+			BatchSize:         20,
+			MaxAttempts:       8,
+			MaxBackoff:        time.Hour,
+			ClaimLease:        5 * time.Minute,
+		},
+		Notifications: NotificationsConfig{
+			Enabled:       false,
+			DueSoonDays:   3,
+			DefaultLocale: "en",
+			MaxAttempts:   5,
+			RetryBackoff:  time.Hour,
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+			SMS: SMSConfig{
+				Timeout: 10 * time.Second,
+			},
+		},
+		Jobs: JobsConfig{
+			RunnerEnabled:    true,
+			PollInterval:     5 * time.Second,
+			HistoryRetention: 30 * 24 * time.Hour,
+			Schedules: map[string]string{
+				"notifications":       "0 9 * * *",
+				"idempotency-cleanup": "@hourly",
+				"job-history-cleanup": "30 3 * * *",
+				"recommendations":     "*/15 * * * *",
+			},
+		},
+		Imports: ImportsConfig{
+			MaxBytes:      32 << 20,
+			SyncRows:      1000,
+			BatchSize:     500,
+			WorkerEnabled: true,
+			PollInterval:  2 * time.Second,
+			StaleAfter:    5 * time.Minute,
+		},
+		GRPC: GRPCConfig{
+			Enabled: false,
+			Address: ":9090",
+		},
+		Availability: AvailabilityConfig{
+			Notify:    false,
+			Heartbeat: 15 * time.Second,
+			MaxBooks:  100,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the config file, the environment and the given command-line arguments.
+// The config file is taken from the -config flag or the CONFIG_FILE environment variable.
+// Remaining non-flag arguments are returned so callers can dispatch subcommands.
+func Load(name string, args []string) (*Config, []string, error) {
+	// a missing .env is fine, variables may already be set by the environment
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("failed to load .env file: %w", err)
+	}
+
+	cfg := Default()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	overrides := registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := loadEnv(cfg); err != nil {
+		return nil, nil, err
 	}
-	err = db.Ping()
+	var flagErrs []error
+	fs.Visit(func(f *flag.Flag) {
+		if apply, ok := overrides[f.Name]; ok {
+			if err := apply(cfg, f.Value.String()); err != nil {
+				flagErrs = append(flagErrs, fmt.Errorf("flag -%s: %w", f.Name, err))
+			}
+		}
+	})
+	if err := errors.Join(flagErrs...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, fs.Args(), nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	file, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			return
+		}
+	}(file)
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	// an empty file decodes to io.EOF and leaves the defaults untouched
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// setting binds a single option to its environment variable and command-line flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	apply setter
+}
+
+// setter parses a value into the option of a setting, boolean options may be given as a flag without a value
+type setter struct {
+	set     func(cfg *Config, value string) error
+	boolean bool
+}
+
+// flagValue holds the raw value of a command-line flag until the config file and environment are loaded
+type flagValue struct {
+	value   string
+	boolean bool
+}
+
+func (v *flagValue) String() string {
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	return nil
+}
+
+// IsBoolFlag lets boolean flags be given as -name, which the flag package treats as -name=true
+func (v *flagValue) IsBoolFlag() bool {
+	return v.boolean
+}
+
+func settings() []setting {
+	return []setting{
+		// SERVER_PORT is kept for existing .env files, SERVER_ADDRESS takes precedence
+		{"SERVER_PORT", "", "", setString(func(c *Config) *string { return &c.Server.Address })},
+		{"SERVER_ADDRESS", "addr", "listen address, e.g. :8080", setString(func(c *Config) *string { return &c.Server.Address })},
+		{"SERVER_READ_TIMEOUT", "read-timeout", "maximum duration for reading a request", setDuration(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+		{"SERVER_WRITE_TIMEOUT", "write-timeout", "maximum duration for writing a response", setDuration(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+		{"SERVER_IDLE_TIMEOUT", "idle-timeout", "maximum keep-alive idle time", setDuration(func(c *Config) *time.Duration { return &c.Server.IdleTimeout })},
+		{"SERVER_SHUTDOWN_TIMEOUT", "shutdown-timeout", "grace period for in-flight requests on shutdown", setDuration(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+		{"SERVER_TRUST_PROXY", "trust-proxy", "take the client IP from X-Forwarded-For (true/false)", setBool(func(c *Config) *bool { return &c.Server.TrustProxy })},
+		{"SERVER_TLS_CERT_FILE", "tls-cert-file", "TLS certificate file, enables HTTPS together with -tls-key-file", setString(func(c *Config) *string { return &c.Server.TLS.CertFile })},
+		{"SERVER_TLS_KEY_FILE", "tls-key-file", "TLS private key file", setString(func(c *Config) *string { return &c.Server.TLS.KeyFile })},
+		{"SERVER_TLS_CLIENT_CA_FILE", "tls-client-ca-file", "CA bundle used to verify client certificates", setString(func(c *Config) *string { return &c.Server.TLS.ClientCAFile })},
+		{"SERVER_TLS_CLIENT_AUTH", "tls-client-auth", "client certificate policy: none, optional or require", setString(func(c *Config) *string { return &c.Server.TLS.ClientAuth })},
+		{"DBHOST", "db-host", "database host", setString(func(c *Config) *string { return &c.Database.Host })},
+		{"DBPORT", "db-port", "database port", setInt(func(c *Config) *int { return &c.Database.Port })},
+		{"DBUSER", "db-user", "database user", setString(func(c *Config) *string { return &c.Database.User })},
+		{"DBPASSWORD", "db-password", "database password", setString(func(c *Config) *string { return &c.Database.Password })},
+		{"DBNAME", "db-name", "database name", setString(func(c *Config) *string { return &c.Database.Name })},
+		{"DB_SSLMODE", "db-sslmode", "PostgreSQL sslmode", setString(func(c *Config) *string { return &c.Database.SSLMode })},
+		{"DB_SSLROOTCERT", "db-sslrootcert", "CA certificate used to verify the database server", setString(func(c *Config) *string { return &c.Database.SSLRootCert })},
+		{"DB_SSLCERT", "db-sslcert", "client certificate presented to the database", setString(func(c *Config) *string { return &c.Database.SSLCert })},
+		{"DB_SSLKEY", "db-sslkey", "private key of the database client certificate", setString(func(c *Config) *string { return &c.Database.SSLKey })},
+		{"DB_CONNECT_TIMEOUT", "db-connect-timeout", "database connect timeout", setDuration(func(c *Config) *time.Duration { return &c.Database.ConnectTimeout })},
+		{"DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum open database connections", setInt(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+		{"DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum idle database connections", setInt(func(c *Config) *int { return &c.Database.MaxIdleConns })},
+		{"DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum lifetime of a database connection", setDuration(func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime })},
+		{"DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time", "maximum idle time of a database connection", setDuration(func(c *Config) *time.Duration { return &c.Database.ConnMaxIdleTime })},
+		{"DB_AUTO_MIGRATE", "db-auto-migrate", "apply pending migrations on startup (true/false)", setBool(func(c *Config) *bool { return &c.Database.AutoMigrate })},
+		{"LOAN_PERIOD_DAYS", "loan-period-days", "number of days a book may be borrowed", setInt(func(c *Config) *int { return &c.Loans.PeriodDays })},
+		{"LOAN_MAX_ACTIVE", "loan-max-active", "maximum open loans of any user on top of the category limits, 0 for no cap", setInt(func(c *Config) *int { return &c.Loans.MaxActive })},
+		{"LOAN_REPLACEMENT_FEE", "loan-replacement-fee", "fee in cents charged for a lost or damaged copy, 0 for none", setInt(func(c *Config) *int { return &c.Loans.ReplacementFee })},
+		{"RATE_LIMIT_ENABLED", "rate-limit-enabled", "enable rate limiting (true/false)", setBool(func(c *Config) *bool { return &c.RateLimit.Enabled })},
+		{"RATE_LIMIT_KEY_BY", "rate-limit-key-by", "default rate limit key: ip, api_key or user", setString(func(c *Config) *string { return &c.RateLimit.KeyBy })},
+		{"RATE_LIMIT_API_KEYS", "rate-limit-api-keys", "comma-separated X-API-Key values keyed by api_key", setStrings(func(c *Config) *[]string { return &c.RateLimit.APIKeys })},
+		{"RATE_LIMIT_REQUESTS", "rate-limit-requests", "default number of requests per period", setInt(func(c *Config) *int { return &c.RateLimit.Default.Requests })},
+		{"RATE_LIMIT_PERIOD", "rate-limit-period", "default rate limit period", setDuration(func(c *Config) *time.Duration { return &c.RateLimit.Default.Period })},
+		{"RATE_LIMIT_BURST", "rate-limit-burst", "default rate limit burst, 0 uses the number of requests", setInt(func(c *Config) *int { return &c.RateLimit.Default.Burst })},
+		{"IDEMPOTENCY_TTL", "idempotency-ttl", "how long Idempotency-Key responses are kept", setDuration(func(c *Config) *time.Duration { return &c.Idempotency.TTL })},
+		{"IDEMPOTENCY_LEASE", "idempotency-lease", "how long a running request holds its Idempotency-Key without renewing it", setDuration(func(c *Config) *time.Duration { return &c.Idempotency.Lease })},
+		{"EVENTS_RELAY_ENABLED", "events-relay-enabled", "publish outbox events from this instance (true/false)", setBool(func(c *Config) *bool { return &c.Events.RelayEnabled })},
+		{"EVENTS_PUBLISHER", "events-publisher", "event publisher: log or webhook", setString(func(c *Config) *string { return &c.Events.Publisher })},
+		{"EVENTS_WEBHOOK_URL", "events-webhook-url", "URL the webhook publisher posts events to", setString(func(c *Config) *string { return &c.Events.WebhookURL })},
+		{"EVENTS_WEBHOOK_TIMEOUT", "events-webhook-timeout", "timeout of a single webhook delivery", setDuration(func(c *Config) *time.Duration { return &c.Events.WebhookTimeout })},
+		{"EVENTS_POLL_INTERVAL", "events-poll-interval", "how often the outbox is polled", setDuration(func(c *Config) *time.Duration { return &c.Events.PollInterval })},
+		{"EVENTS_BATCH_SIZE", "events-batch-size", "number of events published per batch", setInt(func(c *Config) *int { return &c.Events.BatchSize })},
+		{"EVENTS_MAX_ATTEMPTS", "events-max-attempts", "attempts before an event is marked dead", setInt(func(c *Config) *int { return &c.Events.MaxAttempts })},
+		{"EVENTS_MAX_BACKOFF", "events-max-backoff", "maximum delay between delivery retries", setDuration(func(c *Config) *time.Duration { return &c.Events.MaxBackoff })},
+		{"EVENTS_CLAIM_LEASE", "events-claim-lease", "how long a relay keeps a claimed batch of events from other relays", setDuration(func(c *Config) *time.Duration { return &c.Events.ClaimLease })},
+		{"WEBHOOKS_DISPATCHER_ENABLED", "webhooks-dispatcher-enabled", "send webhook deliveries from this instance (true/false)", setBool(func(c *Config) *bool { return &c.Webhooks.DispatcherEnabled })},
+		{"WEBHOOKS_TIMEOUT", "webhooks-timeout", "timeout of a single webhook delivery", setDuration(func(c *Config) *time.Duration { return &c.Webhooks.Timeout })},
+		{"WEBHOOKS_POLL_INTERVAL", "webhooks-poll-interval", "how often pending webhook deliveries are polled", setDuration(func(c *Config) *time.Duration { return &c.Webhooks.PollInterval })},
+		{"WEBHOOKS_BATCH_SIZE", "webhooks-batch-size", "number of webhook deliveries sent per batch", setInt(func(c *Config) *int { return &c.Webhooks.BatchSize })},
+		{"WEBHOOKS_MAX_ATTEMPTS", "webhooks-max-attempts", "attempts before a delivery is dead-lettered", setInt(func(c *Config) *int { return &c.Webhooks.MaxAttempts })},
+		{"WEBHOOKS_MAX_BACKOFF", "webhooks-max-backoff", "maximum delay between webhook delivery retries", setDuration(func(c *Config) *time.Duration { return &c.Webhooks.MaxBackoff })},
+		{"WEBHOOKS_ALLOWED_NETWORKS", "webhooks-allowed-networks", "comma-separated private networks (CIDR) or addresses webhooks may be sent to", setStrings(func(c *Config) *[]string { return &c.Webhooks.AllowedNetworks })},
+		{"WEBHOOKS_CLAIM_LEASE", "webhooks-claim-lease", "how long a dispatcher keeps a claimed batch of deliveries from other dispatchers", setDuration(func(c *Config) *time.Duration { return &c.Webhooks.ClaimLease })},
+		{"NOTIFICATIONS_ENABLED", "notifications-enabled", "send due date reminders and overdue notices from this instance (true/false)", setBool(func(c *Config) *bool { return &c.Notifications.Enabled })},
+		{"NOTIFICATIONS_DUE_SOON_DAYS", "notifications-due-soon-days", "days before the due date the reminder is sent", setInt(func(c *Config) *int { return &c.Notifications.DueSoonDays })},
+		{"NOTIFICATIONS_DEFAULT_LOCALE", "notifications-default-locale", "locale used when a patron's locale has no templates", setString(func(c *Config) *string { return &c.Notifications.DefaultLocale })},
+		{"NOTIFICATIONS_MAX_ATTEMPTS", "notifications-max-attempts", "attempts per loan and channel before a notice is given up", setInt(func(c *Config) *int { return &c.Notifications.MaxAttempts })},
+		{"NOTIFICATIONS_RETRY_BACKOFF", "notifications-retry-backoff", "delay before a failed notice is retried, doubled with every further failure", setDuration(func(c *Config) *time.Duration { return &c.Notifications.RetryBackoff })},
+		{"SMTP_HOST", "smtp-host", "SMTP server for email notifications, empty disables email", setString(func(c *Config) *string { return &c.Notifications.SMTP.Host })},
+		{"SMTP_PORT", "smtp-port", "SMTP server port", setInt(func(c *Config) *int { return &c.Notifications.SMTP.Port })},
+		{"SMTP_USERNAME", "smtp-username", "SMTP username", setString(func(c *Config) *string { return &c.Notifications.SMTP.Username })},
+		{"SMTP_PASSWORD", "smtp-password", "SMTP password", setString(func(c *Config) *string { return &c.Notifications.SMTP.Password })},
+		{"SMTP_FROM", "smtp-from", "sender address of email notifications", setString(func(c *Config) *string { return &c.Notifications.SMTP.From })},
+		{"SMS_GATEWAY_URL", "sms-gateway-url", "URL of the SMS gateway, empty disables SMS", setString(func(c *Config) *string { return &c.Notifications.SMS.URL })},
+		{"SMS_GATEWAY_TOKEN", "sms-gateway-token", "bearer token sent to the SMS gateway", setString(func(c *Config) *string { return &c.Notifications.SMS.Token })},
+		{"SMS_GATEWAY_TIMEOUT", "sms-gateway-timeout", "timeout of a single SMS gateway request", setDuration(func(c *Config) *time.Duration { return &c.Notifications.SMS.Timeout })},
+		{"JOBS_RUNNER_ENABLED", "jobs-runner-enabled", "compete for leadership and run background jobs from this instance (true/false)", setBool(func(c *Config) *bool { return &c.Jobs.RunnerEnabled })},
+		{"JOBS_POLL_INTERVAL", "jobs-poll-interval", "how often due jobs and manual triggers are checked", setDuration(func(c *Config) *time.Duration { return &c.Jobs.PollInterval })},
+		{"JOBS_HISTORY_RETENTION", "jobs-history-retention", "how long finished job runs are kept", setDuration(func(c *Config) *time.Duration { return &c.Jobs.HistoryRetention })},
+		{"IMPORTS_MAX_BYTES", "imports-max-bytes", "largest accepted import upload in bytes", setInt(func(c *Config) *int { return &c.Imports.MaxBytes })},
+		{"IMPORTS_SYNC_ROWS", "imports-sync-rows", "largest import run within the request, larger ones run in the background", setInt(func(c *Config) *int { return &c.Imports.SyncRows })},
+		{"IMPORTS_BATCH_SIZE", "imports-batch-size", "number of rows a background import commits at a time", setInt(func(c *Config) *int { return &c.Imports.BatchSize })},
+		{"IMPORTS_WORKER_ENABLED", "imports-worker-enabled", "run queued imports from this instance (true/false)", setBool(func(c *Config) *bool { return &c.Imports.WorkerEnabled })},
+		{"IMPORTS_POLL_INTERVAL", "imports-poll-interval", "how often queued imports are polled", setDuration(func(c *Config) *time.Duration { return &c.Imports.PollInterval })},
+		{"IMPORTS_STALE_AFTER", "imports-stale-after", "how long a running import may make no progress before another instance resumes it", setDuration(func(c *Config) *time.Duration { return &c.Imports.StaleAfter })},
+		{"GRPC_ENABLED", "grpc-enabled", "serve the gRPC API (true/false)", setBool(func(c *Config) *bool { return &c.GRPC.Enabled })},
+		{"GRPC_ADDRESS", "grpc-addr", "gRPC listen address, e.g. :9090", setString(func(c *Config) *string { return &c.GRPC.Address })},
+		{"AVAILABILITY_NOTIFY", "availability-notify", "share availability updates between replicas through PostgreSQL LISTEN/NOTIFY (true/false)", setBool(func(c *Config) *bool { return &c.Availability.Notify })},
+		{"AVAILABILITY_HEARTBEAT", "availability-heartbeat", "how often idle availability streams send a keepalive", setDuration(func(c *Config) *time.Duration { return &c.Availability.Heartbeat })},
+		{"AVAILABILITY_MAX_BOOKS", "availability-max-books", "largest number of books one availability stream may follow", setInt(func(c *Config) *int { return &c.Availability.MaxBooks })},
+	}
+}
+
+func registerFlags(fs *flag.FlagSet) map[string]func(*Config, string) error {
+	overrides := make(map[string]func(*Config, string) error)
+	for _, s := range settings() {
+		if s.flag == "" {
+			continue
+		}
+		fs.Var(&flagValue{boolean: s.apply.boolean}, s.flag, s.usage+" (env "+s.env+")")
+		overrides[s.flag] = s.apply.set
+	}
+	return overrides
+}
+
+func loadEnv(cfg *Config) error {
+	var errs []error
+	for _, s := range settings() {
+		value, ok := os.LookupEnv(s.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := s.apply.set(cfg, value); err != nil {
+			errs = append(errs, fmt.Errorf("environment variable %s: %w", s.env, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setString(field func(*Config) *string) setter {
+	return setter{set: func(cfg *Config, value string) error {
+		*field(cfg) = value
+		return nil
+	}}
+}
+
+// setStrings splits a comma-separated list, empty entries are dropped
+func setStrings(field func(*Config) *[]string) setter {
+	return setter{set: func(cfg *Config, value string) error {
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*field(cfg) = values
+		return nil
+	}}
+}
+
+func setInt(field func(*Config) *int) setter {
+	return setter{set: func(cfg *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid integer", value)
+		}
+		*field(cfg) = parsed
+		return nil
+	}}
+}
+
+func setBool(field func(*Config) *bool) setter {
+	return setter{set: func(cfg *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid boolean", value)
+		}
+		*field(cfg) = parsed
+		return nil
+	}, boolean: true}
+}
+
+func setDuration(field func(*Config) *time.Duration) setter {
+	return setter{set: func(cfg *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid duration (e.g. 10s, 1m)", value)
+		}
+		*field(cfg) = parsed
+		return nil
+	}}
+}
+
+// Validate reports every invalid or missing setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
 	}
-	fmt.Println("Successfully connected to database!")
 
-	return db, nil
+	check(c.Server.Address != "", "server.address is required (SERVER_ADDRESS or -addr)")
+	if c.Server.Address != "" {
+		check(strings.Contains(c.Server.Address, ":"), "server.address %q must be in host:port or :port form", c.Server.Address)
+	}
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout must not be negative")
+	check(c.Server.ShutdownTimeout >= 0, "server.shutdown_timeout must not be negative")
+	tlsCfg := c.Server.TLS
+	check((tlsCfg.CertFile == "") == (tlsCfg.KeyFile == ""), "server.tls.cert_file and server.tls.key_file must be set together")
+	check(slices.Contains(validClientAuthModes, tlsCfg.ClientAuth), "server.tls.client_auth %q must be one of %s", tlsCfg.ClientAuth, strings.Join(validClientAuthModes, ", "))
+	if tlsCfg.ClientAuth != "none" && slices.Contains(validClientAuthModes, tlsCfg.ClientAuth) {
+		check(tlsCfg.Enabled(), "server.tls.client_auth %q requires server.tls.cert_file and server.tls.key_file", tlsCfg.ClientAuth)
+		check(tlsCfg.ClientCAFile != "", "server.tls.client_auth %q requires server.tls.client_ca_file", tlsCfg.ClientAuth)
+	}
+	checkFile := func(path, setting string) {
+		if path == "" {
+			return
+		}
+		_, err := os.Stat(path)
+		check(err == nil, "%s: %v", setting, err)
+	}
+	checkFile(tlsCfg.CertFile, "server.tls.cert_file")
+	checkFile(tlsCfg.KeyFile, "server.tls.key_file")
+	checkFile(tlsCfg.ClientCAFile, "server.tls.client_ca_file")
+
+	check(c.Database.Host != "", "database.host is required (DBHOST or -db-host)")
+	check(c.Database.Port > 0 && c.Database.Port <= 65535, "database.port %d must be between 1 and 65535 (DBPORT or -db-port)", c.Database.Port)
+	check(c.Database.User != "", "database.user is required (DBUSER or -db-user)")
+	check(c.Database.Name != "", "database.name is required (DBNAME or -db-name)")
+	check(slices.Contains(validSSLModes, c.Database.SSLMode), "database.sslmode %q must be one of %s", c.Database.SSLMode, strings.Join(validSSLModes, ", "))
+	check((c.Database.SSLCert == "") == (c.Database.SSLKey == ""), "database.sslcert and database.sslkey must be set together")
+	if c.Database.SSLMode == "disable" {
+		check(c.Database.SSLRootCert == "" && c.Database.SSLCert == "", "database.sslrootcert, database.sslcert and database.sslkey have no effect with database.sslmode \"disable\"")
+	}
+	checkFile(c.Database.SSLRootCert, "database.sslrootcert")
+	checkFile(c.Database.SSLCert, "database.sslcert")
+	checkFile(c.Database.SSLKey, "database.sslkey")
+	check(c.Database.ConnectTimeout >= 0, "database.connect_timeout must not be negative")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	if c.Database.MaxOpenConns > 0 {
+		check(c.Database.MaxIdleConns <= c.Database.MaxOpenConns, "database.max_idle_conns (%d) must not exceed database.max_open_conns (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	}
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+
+	check(c.Loans.PeriodDays > 0, "loans.period_days must be positive")
+	check(c.Loans.MaxActive >= 0, "loans.max_active must not be negative")
+	check(c.Loans.ReplacementFee >= 0, "loans.replacement_fee must not be negative")
+	for _, category := range models.PatronCategories {
+		_, ok := c.Loans.Categories[category]
+		check(ok, "loans.categories has no rules for %s patrons", category)
+	}
+	for category, rules := range c.Loans.Categories {
+		check(slices.Contains(models.PatronCategories, category), "loans.categories[%q]: unknown category, use child, adult, staff or institutional", category)
+		check(rules.MaxActive >= 0, "loans.categories[%q].max_active must not be negative", category)
+		check(rules.PeriodDays >= 0, "loans.categories[%q].period_days must not be negative", category)
+		check(rules.Renewals >= 0, "loans.categories[%q].renewals must not be negative", category)
+		check(rules.MaxAgeRating >= 0 && rules.MaxAgeRating <= 21, "loans.categories[%q].max_age_rating must be between 0 and 21", category)
+	}
+
+	check(c.Idempotency.TTL > 0, "idempotency.ttl must be positive")
+	check(c.Idempotency.Lease >= 2*c.Server.WriteTimeout, "idempotency.lease must be at least twice server.write_timeout (%s)", c.Server.WriteTimeout)
+
+	check(slices.Contains(validPublishers, c.Events.Publisher), "events.publisher %q must be one of %s", c.Events.Publisher, strings.Join(validPublishers, ", "))
+	if c.Events.Publisher == "webhook" {
+		webhookURL, err := url.Parse(c.Events.WebhookURL)
+		check(err == nil && (webhookURL.Scheme == "http" || webhookURL.Scheme == "https") && webhookURL.Host != "", "events.webhook_url %q must be an http(s) URL when events.publisher is webhook (EVENTS_WEBHOOK_URL)", c.Events.WebhookURL)
+	}
+	check(c.Events.WebhookTimeout > 0, "events.webhook_timeout must be positive")
+	check(c.Events.PollInterval > 0, "events.poll_interval must be positive")
+	check(c.Events.BatchSize > 0, "events.batch_size must be positive")
+	check(c.Events.MaxAttempts > 0, "events.max_attempts must be positive")
+	check(c.Events.MaxBackoff >= time.Second, "events.max_backoff must be at least 1s")
+	check(c.Events.ClaimLease > 0, "events.claim_lease must be positive")
+	if c.Events.Publisher == "webhook" {
+		// a batch that outlives its lease is claimed by another relay and published twice
+		batchTime := time.Duration(c.Events.BatchSize) * c.Events.WebhookTimeout
+		check(c.Events.ClaimLease >= batchTime, "events.claim_lease %s must cover a batch of events.batch_size webhook deliveries (%s)", c.Events.ClaimLease, batchTime)
+	}
+
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	check(c.Webhooks.PollInterval > 0, "webhooks.poll_interval must be positive")
+	check(c.Webhooks.BatchSize > 0, "webhooks.batch_size must be positive")
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+	check(c.Webhooks.MaxBackoff >= 10*time.Second, "webhooks.max_backoff must be at least 10s")
+	// a batch that outlives its lease is claimed by another dispatcher and sent twice
+	deliveryBatchTime := time.Duration(c.Webhooks.BatchSize) * c.Webhooks.Timeout
+	for _, network := range c.Webhooks.AllowedNetworks {
+		_, err := parseNetwork(network)
+		check(err == nil, "webhooks.allowed_networks entry %q must be an address or a CIDR network", network)
+	}
+	check(c.Webhooks.ClaimLease >= deliveryBatchTime, "webhooks.claim_lease %s must cover a batch of webhooks.batch_size deliveries (%s)", c.Webhooks.ClaimLease, deliveryBatchTime)
+
+	if c.Notifications.Enabled {
+		check(c.Notifications.DueSoonDays > 0, "notifications.due_soon_days must be positive")
+		check(c.Notifications.DefaultLocale != "", "notifications.default_locale is required")
+		check(c.Notifications.MaxAttempts > 0, "notifications.max_attempts must be positive")
+		check(c.Notifications.RetryBackoff > 0, "notifications.retry_backoff must be positive")
+		check(c.Notifications.SMTP.Host != "" || c.Notifications.SMS.URL != "", "notifications need at least one channel, set notifications.smtp.host (SMTP_HOST) or notifications.sms.url (SMS_GATEWAY_URL)")
+		if c.Notifications.SMTP.Host != "" {
+			check(c.Notifications.SMTP.Port > 0 && c.Notifications.SMTP.Port <= 65535, "notifications.smtp.port %d is out of range", c.Notifications.SMTP.Port)
+			_, err := mail.ParseAddress(c.Notifications.SMTP.From)
+			check(err == nil, "notifications.smtp.from %q must be an email address (SMTP_FROM)", c.Notifications.SMTP.From)
+		}
+		if c.Notifications.SMS.URL != "" {
+			smsURL, err := url.Parse(c.Notifications.SMS.URL)
+			check(err == nil && (smsURL.Scheme == "http" || smsURL.Scheme == "https") && smsURL.Host != "", "notifications.sms.url %q must be an http(s) URL (SMS_GATEWAY_URL)", c.Notifications.SMS.URL)
+			check(c.Notifications.SMS.Timeout > 0, "notifications.sms.timeout must be positive")
+		}
+	}
+
+	check(c.Jobs.PollInterval > 0, "jobs.poll_interval must be positive")
+	check(c.Jobs.HistoryRetention >= time.Hour, "jobs.history_retention must be at least 1h")
+	for name, spec := range c.Jobs.Schedules {
+		_, err := jobs.ParseSchedule(spec)
+		check(err == nil, "jobs.schedules[%q]: %v", name, err)
+	}
+
+	check(c.Imports.MaxBytes > 0, "imports.max_bytes must be positive")
+	check(c.Imports.SyncRows >= 0, "imports.sync_rows must not be negative")
+	check(c.Imports.BatchSize > 0, "imports.batch_size must be positive")
+	check(c.Imports.PollInterval > 0, "imports.poll_interval must be positive")
+	check(c.Imports.StaleAfter >= time.Minute, "imports.stale_after must be at least 1m")
+
+	check(c.Availability.Heartbeat >= time.Second, "availability.heartbeat must be at least 1s")
+	check(c.Availability.MaxBooks > 0, "availability.max_books must be positive")
+
+	if c.GRPC.Enabled {
+		check(c.GRPC.Address != "", "grpc.address is required when grpc.enabled is true")
+		check(c.GRPC.Address != c.Server.Address, "grpc.address %q must differ from server.address", c.GRPC.Address)
+	}
+
+	if c.RateLimit.Enabled {
+		check(slices.Contains(validKeyBy, c.RateLimit.KeyBy), "rate_limit.key_by %q must be one of %s", c.RateLimit.KeyBy, strings.Join(validKeyBy, ", "))
+		errs = append(errs, c.RateLimit.Default.validate("rate_limit.default"))
+		for route, limit := range c.RateLimit.Routes {
+			method, path, ok := strings.Cut(route, " ")
+			check(ok && method != "" && strings.HasPrefix(path, "/"), "rate_limit.routes key %q must be in \"METHOD /path\" form", route)
+			errs = append(errs, limit.validate(fmt.Sprintf("rate_limit.routes[%q]", route)))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
-func GetEnvString(key string) string {
-	return os.Getenv(key)
+func (l RateLimit) validate(name string) error {
+	var errs []error
+	if l.Requests < 0 {
+		errs = append(errs, fmt.Errorf("%s.requests must not be negative", name))
+	}
+	if l.Requests > 0 && l.Period <= 0 {
+		errs = append(errs, fmt.Errorf("%s.period must be positive", name))
+	}
+	if l.Burst < 0 {
+		errs = append(errs, fmt.Errorf("%s.burst must not be negative", name))
+	}
+	if l.KeyBy != "" && !slices.Contains(validKeyBy, l.KeyBy) {
+		errs = append(errs, fmt.Errorf("%s.key_by %q must be one of %s", name, l.KeyBy, strings.Join(validKeyBy, ", ")))
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/spin311/library-api/internal/app/availability"
+	"github.com/spin311/library-api/internal/app/imports"
+	"github.com/spin311/library-api/internal/app/services"
+	"github.com/spin311/library-api/internal/repository/models"
+	"github.com/spin311/library-api/internal/repository/postgres"
+	"log"
+	"math"
+	"strings"
+)
+
+func SetDbs(database *sql.DB) {
+	postgres.SetUserDB(database)
+	postgres.SetBorrowDB(database)
+	postgres.SetBookDB(database)
+	postgres.SetIdempotencyDB(database)
+	postgres.SetOutboxDB(database)
+	postgres.SetWebhookDB(database)
+	postgres.SetNotificationDB(database)
+	postgres.SetJobDB(database)
+	postgres.SetAuditDB(database)
+	postgres.SetImportDB(database)
+	postgres.SetBackupDB(database)
+	postgres.SetConsistencyDB(database)
+	postgres.SetReportDB(database)
+	postgres.SetRecommendationDB(database)
+	postgres.SetChargeDB(database)
+}
+
+func SetLoanRules(loans LoanConfig) {
+	categories := make(map[string]models.CategoryRules, len(loans.Categories))
+	for category, rules := range loans.Categories {
+		categories[category] = models.CategoryRules(rules)
+	}
+	postgres.SetLoanRules(models.LoanRules{
+		PeriodDays:     loans.PeriodDays,
+		MaxActive:      loans.MaxActive,
+		Categories:     categories,
+		ReplacementFee: loans.ReplacementFee,
+	})
+}
+
+// SetIdempotency configures the Idempotency-Key store, instance names this replica as the holder of its reservations
+func SetIdempotency(idempotency IdempotencyConfig, instance string) {
+	services.SetIdempotency(idempotency.TTL, idempotency.Lease, instance)
+}
+
+// SetAvailability configures the availability streams. With notify, updates go through PostgreSQL
+// and reach the streams when a listener started with availability.Listen receives them.
+func SetAvailability(cfg AvailabilityConfig) {
+	availability.SetOptions(availability.Options{
+		Heartbeat: cfg.Heartbeat,
+		MaxBooks:  cfg.MaxBooks,
+	})
+	if cfg.Notify {
+		services.SetAvailabilityPublisher(services.NotifyAvailability)
+	} else {
+		services.SetAvailabilityPublisher(availability.Publish)
+	}
+}
+
+// SetWebhooks configures the addresses webhook subscriptions may point to
+func SetWebhooks(cfg WebhooksConfig) {
+	services.SetWebhookPolicy(cfg.OutboundPolicy())
+}
+
+func SetImports(cfg ImportsConfig) {
+	imports.SetLimits(imports.Limits{
+		MaxBytes:  int64(cfg.MaxBytes),
+		SyncRows:  cfg.SyncRows,
+		BatchSize: cfg.BatchSize,
+	})
+}
+
+// DSN builds the lib/pq connection string, quoting values so passwords with spaces work
+func (d DatabaseConfig) DSN() string {
+	params := []struct{ key, value string }{
+		{"host", d.Host},
+		{"port", fmt.Sprint(d.Port)},
+		{"user", d.User},
+		{"password", d.Password},
+		{"dbname", d.Name},
+		{"sslmode", d.SSLMode},
+		{"sslrootcert", d.SSLRootCert},
+		{"sslcert", d.SSLCert},
+		{"sslkey", d.SSLKey},
+		// lib/pq takes whole seconds and 0 means no timeout, so sub-second timeouts are rounded up instead of down
+		{"connect_timeout", fmt.Sprint(int(math.Ceil(d.ConnectTimeout.Seconds())))},
+	}
+	var parts []string
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		value := strings.ReplaceAll(strings.ReplaceAll(p.value, `\`, `\\`), `'`, `\'`)
+		parts = append(parts, fmt.Sprintf("%s='%s'", p.key, value))
+	}
+	return strings.Join(parts, " ")
+}
+
+func InitDatabase(cfg DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	err = db.Ping()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	log.Println("Successfully connected to database!")
+
+	return db, nil
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval limits how often the certificate files are checked for changes
+const certCheckInterval = 30 * time.Second
+
+var validClientAuthModes = []string{"none", "optional", "require"}
+
+// TLSConfig configures HTTPS for the API server.
+// TLS is enabled when both CertFile and KeyFile are set.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile is the CA bundle used to verify client certificates, e.g. the ones issued to kiosks
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuth is none, optional (verify a certificate if one is presented) or require
+	ClientAuth string `yaml:"client_auth"`
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// ServerTLSConfig returns a tls.Config that reloads the certificate, key and client CA
+// whenever the files change on disk, so rotated certificates are picked up without a restart.
+func (t TLSConfig) ServerTLSConfig() (*tls.Config, error) {
+	r := &certReloader{cfg: t}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetCertificate:     r.getCertificate,
+		GetConfigForClient: r.getConfigForClient,
+	}, nil
+}
+
+type certReloader struct {
+	cfg TLSConfig
+
+	mu        sync.Mutex
+	current   *tls.Config
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+}
+
+func (r *certReloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	current := r.config()
+	return &current.Certificates[0], nil
+}
+
+func (r *certReloader) getConfigForClient(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+	return r.config(), nil
+}
+
+// config returns the active tls.Config, reloading it first if any of the files changed
+func (r *certReloader) config() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) < certCheckInterval {
+		return r.current
+	}
+	r.checkedAt = time.Now()
+	if !r.filesChanged() {
+		return r.current
+	}
+	// keep serving the previous certificate if the new files are incomplete or invalid
+	if err := r.reloadLocked(); err != nil {
+		log.Printf("failed to reload TLS certificates, keeping previous ones: %v", err)
+	}
+	return r.current
+}
+
+func (r *certReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkedAt = time.Now()
+	return r.reloadLocked()
+}
+
+func (r *certReloader) reloadLocked() error {
+	modTimes, err := r.statFiles()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+		ClientAuth:   tls.NoClientCert,
+	}
+
+	if r.cfg.ClientAuth != "" && r.cfg.ClientAuth != "none" {
+		pool, err := loadCertPool(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.cfg.ClientAuth == "require" {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	if r.current != nil {
+		log.Println("Reloaded TLS certificates")
+	}
+	r.current = tlsConfig
+	r.modTimes = modTimes
+	return nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) statFiles() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS file: %w", err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (r *certReloader) filesChanged() bool {
+	modTimes, err := r.statFiles()
+	if err != nil {
+		// a file is missing mid-rotation, try again on the next check
+		return false
+	}
+	for file, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", file)
+	}
+	return pool, nil
+}